@@ -3,11 +3,16 @@ package main
 import (
 	"log"
 	"net/http"
+	"os"
+	"strconv"
 
 	"onrabble.com/chatserver/internal/cache"
 	"onrabble.com/chatserver/internal/db"
 	"onrabble.com/chatserver/internal/hub"
+	"onrabble.com/chatserver/internal/retention"
 	"onrabble.com/chatserver/internal/server"
+	"onrabble.com/chatserver/internal/storage"
+	"onrabble.com/chatserver/internal/unfurl"
 
 	"github.com/gorilla/websocket"
 	"github.com/valkey-io/valkey-go"
@@ -37,13 +42,23 @@ func main() {
 
 	// Initialize the message cache
 	messageCache := &cache.MessageCache{
-		ValkeyClient: client,
-		DB:           conn,
+		ValkeyClient:     client,
+		DB:               conn,
+		HistoryDepth:     envInt("CHANNEL_HISTORY_DEPTH"),
+		InitialSyncDepth: envInt("INITIAL_SYNC_DEPTH"),
 	}
 	messageCache.StartPeriodicFlush()
 
+	// Purge messages and sessions that have outlived their retention policies
+	retention.NewJanitor(conn, messageCache).Start()
+
 	// Create a new Hub instance
-	h := hub.NewHub(conn, messageCache)
+	// Link previews are fetched unless UNFURL_DISABLED is set
+	var unfurler *unfurl.Unfurler
+	if disabled, _ := strconv.ParseBool(os.Getenv("UNFURL_DISABLED")); !disabled {
+		unfurler = unfurl.New(unfurl.ConfigFromEnv())
+	}
+	h := hub.NewHub(conn, messageCache, unfurler)
 
 	// Start the Hub in a separate goroutine
 	go h.Run()
@@ -52,8 +67,19 @@ func main() {
 		log.Fatalf("Failed to connected to database")
 	}
 
+	// Initialize blob storage for attachments
+	store, err := storage.NewFromEnv()
+	if err != nil {
+		log.Fatalf("Failed to initialize attachment storage: %v", err)
+	}
+	attachments := server.AttachmentConfig{
+		Store:   store,
+		Signer:  storage.NewURLSigner(os.Getenv("ATTACHMENT_URL_SECRET")),
+		MaxSize: int64(envInt("MAX_ATTACHMENT_SIZE")),
+	}
+
 	// Create the Server instance and pass the Hub
-	srv, err := server.New("0.0.0.0:8080", h, conn, messageCache)
+	srv, err := server.New("0.0.0.0:8080", h, conn, messageCache, attachments)
 	if err != nil {
 		log.Fatalf("Failed to start server: %v", err)
 	}
@@ -64,3 +90,13 @@ func main() {
 		log.Fatalf("Server error: %v", err)
 	}
 }
+
+// envInt reads an integer setting from the environment, returning 0 when unset or invalid
+// so the consuming package falls back to its default.
+func envInt(name string) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return 0
+	}
+	return value
+}
@@ -0,0 +1,160 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// fetchRateLimit returns the server's message rate limit.
+func (a *app) fetchRateLimit() (models.RateLimiter, error) {
+	client, err := a.api()
+	if err != nil {
+		return models.RateLimiter{}, err
+	}
+	var resp struct {
+		RateLimiter models.RateLimiter `json:"rate_limiter"`
+	}
+	err = client.Do(http.MethodGet, "/ratelimits", nil, nil, &resp)
+	return resp.RateLimiter, err
+}
+
+func (a *app) rateLimitShow(args []string) error {
+	args, err := parse(a.flags("ratelimit show"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	limiter, err := a.fetchRateLimit()
+	if err != nil {
+		return err
+	}
+	return a.printer.Print(limiter, []string{"ID", "MESSAGE LIMIT", "WINDOW SECONDS"},
+		[][]string{{strconv.Itoa(limiter.ID), strconv.Itoa(limiter.MessageLimit), strconv.Itoa(limiter.WindowSeconds)}})
+}
+
+func (a *app) rateLimitSet(args []string) error {
+	fs := a.flags("ratelimit set")
+	limit := fs.Int("limit", 0, "Messages allowed per window (default unchanged)")
+	window := fs.Int("window", 0, "Window length in seconds (default unchanged)")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+	if *limit < 0 || *window < 0 || (*limit == 0 && *window == 0) {
+		return fmt.Errorf("%w: set a positive -limit, -window or both", errUsage)
+	}
+
+	limiter, err := a.fetchRateLimit()
+	if err != nil {
+		return err
+	}
+	if *limit > 0 {
+		limiter.MessageLimit = *limit
+	}
+	if *window > 0 {
+		limiter.WindowSeconds = *window
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	body := map[string]int{"id": limiter.ID, "message_limit": limiter.MessageLimit, "window_seconds": limiter.WindowSeconds}
+	if err := client.Do(http.MethodPatch, "/ratelimits", nil, body, nil); err != nil {
+		return err
+	}
+	return a.printer.Done(limiter, fmt.Sprintf("Rate limit set to %d messages per %d seconds", limiter.MessageLimit, limiter.WindowSeconds))
+}
+
+func (a *app) sessions(args []string) error {
+	args, err := parse(a.flags("sessions"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a user"); err != nil {
+		return err
+	}
+
+	userID, err := a.findUserID(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp envelope[api.SessionActivityPayload]
+	if err := client.Do(http.MethodGet, "/activity/sessions", url.Values{"user_id": {userID}}, nil, &resp); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(resp.Payload.Activity))
+	for i, day := range resp.Payload.Activity {
+		rows[i] = []string{day.SessionDate, strconv.Itoa(day.SessionCount), day.TotalDuration}
+	}
+	return a.printer.Print(resp.Payload.Activity, []string{"DATE", "SESSIONS", "DURATION"}, rows)
+}
+
+func (a *app) audit(args []string) error {
+	fs := a.flags("audit")
+	actor := fs.String("actor", "", "Only changes made by this user")
+	action := fs.String("action", "", "Only this action, e.g. channel.delete or user.ban")
+	target := fs.String("target", "", "Only changes to this target ID or name")
+	limit, before := pageFlags(fs)
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	query := pageQuery(*limit, *before)
+	if *actor != "" {
+		actorID, err := a.findUserID(*actor)
+		if err != nil {
+			return err
+		}
+		query.Set("actor_id", actorID)
+	}
+	if *action != "" {
+		query.Set("action", *action)
+	}
+	if *target != "" {
+		query.Set("target", *target)
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp envelope[api.AuditLogPayload]
+	if err := client.Do(http.MethodGet, "/audit", query, nil, &resp); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(resp.Payload.Entries))
+	for i, entry := range resp.Payload.Entries {
+		actor := entry.ActorUsername
+		if actor == "" {
+			actor = orDash(entry.ActorID)
+		}
+		rows[i] = []string{formatTime(&entry.CreatedAt), actor, entry.Action, orDash(entry.Target), orDash(truncate(string(entry.Details), 60))}
+	}
+	if err := a.printer.Print(resp.Payload, []string{"TIME", "ACTOR", "ACTION", "TARGET", "DETAILS"}, rows); err != nil {
+		return err
+	}
+	a.printer.More(resp.Payload.HasMore, resp.Payload.NextCursor)
+	return nil
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/google/uuid"
+)
+
+// findUserID resolves a user given by ID or username.
+func (a *app) findUserID(ref string) (string, error) {
+	if _, err := uuid.Parse(ref); err == nil {
+		return ref, nil
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return "", err
+	}
+	var resp envelope[api.UserSearchResultPayload]
+	query := url.Values{"username": {ref}, "limit": {"100"}}
+	if err := client.Do(http.MethodGet, "/users", query, nil, &resp); err != nil {
+		return "", err
+	}
+	for _, user := range resp.Payload.Users {
+		if strings.EqualFold(user.Username, ref) {
+			return user.ID, nil
+		}
+	}
+	return "", fmt.Errorf("no user %q", ref)
+}
+
+func (a *app) bansList(args []string) error {
+	fs := a.flags("bans list")
+	limit, before := pageFlags(fs)
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp envelope[api.BanRecordsPayload]
+	if err := client.Do(http.MethodGet, "/users/bans", pageQuery(*limit, *before), nil, &resp); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(resp.Payload.Records))
+	for i, ban := range resp.Payload.Records {
+		reason := ""
+		if ban.Reason != nil {
+			reason = *ban.Reason
+		}
+		scope := []string{}
+		if ban.IPRange != "" {
+			scope = append(scope, "ip "+ban.IPRange)
+		}
+		if ban.DeviceID != "" {
+			scope = append(scope, "device "+truncate(ban.DeviceID, 12))
+		}
+		rows[i] = []string{ban.ID, orDash(ban.BanishedUsername), ban.BanishedID, banStatus(ban), formatTime(&ban.Start),
+			formatTime(ban.End), orDash(strings.Join(scope, ", ")), orDash(truncate(reason, 40))}
+	}
+	if err := a.printer.Print(resp.Payload, []string{"ID", "USER", "USER ID", "STATUS", "START", "END", "ALSO BANS", "REASON"}, rows); err != nil {
+		return err
+	}
+	a.printer.More(resp.Payload.HasMore, resp.Payload.NextCursor)
+	return nil
+}
+
+// banStatus describes whether a ban is still in force.
+func banStatus(ban models.BanRecord) string {
+	switch {
+	case ban.Pardoned:
+		return "pardoned"
+	case ban.End != nil && ban.End.Before(time.Now()):
+		return "expired"
+	default:
+		return "active"
+	}
+}
+
+func (a *app) bansBan(args []string) error {
+	fs := a.flags("bans ban")
+	reason := fs.String("reason", "", "Reason shown to the user")
+	duration := fs.Int("duration", 0, "Length of the ban in hours; 0 bans permanently")
+	ip := fs.String("ip", "", "Address or CIDR range to ban too, or last for the user's last address")
+	device := fs.String("device", "", "Device ID to ban too, or last for the user's last device")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a user"); err != nil {
+		return err
+	}
+	if *duration < 0 {
+		return fmt.Errorf("%w: -duration can't be negative", errUsage)
+	}
+
+	userID, err := a.findUserID(args[0])
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"banished_id": userID, "ip": *ip, "device_id": *device}
+	if *reason != "" {
+		body["reason"] = *reason
+	}
+	if *duration > 0 {
+		body["duration"] = *duration
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	if err := client.Do(http.MethodPost, "/users/ban", nil, body, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Banned %s (%s)", args[0], resp["duration"]))
+}
+
+func (a *app) bansPardon(args []string) error {
+	args, err := parse(a.flags("bans pardon"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a ban ID"); err != nil {
+		return err
+	}
+	if _, err := strconv.Atoi(args[0]); err != nil {
+		return fmt.Errorf("%w: invalid ban ID %q", errUsage, args[0])
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	if err := client.Do(http.MethodDelete, "/users/ban", url.Values{"ban_id": {args[0]}}, nil, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Pardoned ban %s", args[0]))
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+)
+
+// fetchCategories returns the channel categories in display order.
+func (a *app) fetchCategories() ([]models.ChannelCategory, error) {
+	client, err := a.api()
+	if err != nil {
+		return nil, err
+	}
+	var resp struct {
+		Categories []models.ChannelCategory `json:"categories"`
+	}
+	err = client.Do(http.MethodGet, "/categories", nil, nil, &resp)
+	return resp.Categories, err
+}
+
+// findCategory resolves a channel category given by ID or name.
+func (a *app) findCategory(ref string) (models.ChannelCategory, error) {
+	categories, err := a.fetchCategories()
+	if err != nil {
+		return models.ChannelCategory{}, err
+	}
+	id, idErr := strconv.Atoi(ref)
+	for _, category := range categories {
+		if (idErr == nil && category.ID == id) || category.Name == ref {
+			return category, nil
+		}
+	}
+	for _, category := range categories {
+		if strings.EqualFold(category.Name, ref) {
+			return category, nil
+		}
+	}
+	return models.ChannelCategory{}, fmt.Errorf("no category %q", ref)
+}
+
+// updateCategory sends a PATCH for a category.
+func (a *app) updateCategory(id int, body map[string]any) (map[string]string, error) {
+	client, err := a.api()
+	if err != nil {
+		return nil, err
+	}
+	var resp map[string]string
+	err = client.Do(http.MethodPatch, fmt.Sprintf("/categories/%d", id), nil, body, &resp)
+	return resp, err
+}
+
+func (a *app) categoriesList(args []string) error {
+	args, err := parse(a.flags("categories list"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	categories, err := a.fetchCategories()
+	if err != nil {
+		return err
+	}
+	rows := make([][]string, len(categories))
+	for i, category := range categories {
+		rows[i] = []string{strconv.Itoa(category.ID), category.Name, strconv.FormatBool(category.Collapsed), strconv.Itoa(len(category.ChannelIDs))}
+	}
+	return a.printer.Print(categories, []string{"ID", "NAME", "COLLAPSED", "CHANNELS"}, rows)
+}
+
+func (a *app) categoriesCreate(args []string) error {
+	fs := a.flags("categories create")
+	collapsed := fs.Bool("collapsed", false, "Show the category collapsed by default")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a category name"); err != nil {
+		return err
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var category models.ChannelCategory
+	body := map[string]any{"name": args[0], "collapsed": *collapsed}
+	if err := client.Do(http.MethodPost, "/categories", nil, body, &category); err != nil {
+		return err
+	}
+	return a.printer.Done(category, fmt.Sprintf("Created category %s (ID %d)", category.Name, category.ID))
+}
+
+func (a *app) categoriesRename(args []string) error {
+	args, err := parse(a.flags("categories rename"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 2, "a category and its new name"); err != nil {
+		return err
+	}
+
+	category, err := a.findCategory(args[0])
+	if err != nil {
+		return err
+	}
+	resp, err := a.updateCategory(category.ID, map[string]any{"name": args[1]})
+	if err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Renamed category %s to %s", category.Name, args[1]))
+}
+
+func (a *app) categoriesReorder(args []string) error {
+	fs := a.flags("categories reorder")
+	before := fs.String("before", "", "Category to move the category in front of (default the end)")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a category"); err != nil {
+		return err
+	}
+
+	category, err := a.findCategory(args[0])
+	if err != nil {
+		return err
+	}
+	beforeID, message := 0, fmt.Sprintf("Moved category %s to the end", category.Name)
+	if *before != "" {
+		target, err := a.findCategory(*before)
+		if err != nil {
+			return err
+		}
+		beforeID, message = target.ID, fmt.Sprintf("Moved category %s before %s", category.Name, target.Name)
+	}
+	resp, err := a.updateCategory(category.ID, map[string]any{"before_id": beforeID})
+	if err != nil {
+		return err
+	}
+	return a.printer.Done(resp, message)
+}
+
+// categoriesCollapse returns the command that sets whether a category starts collapsed.
+func (a *app) categoriesCollapse(collapsed bool) func([]string) error {
+	name, verb := "categories expand", "expanded"
+	if collapsed {
+		name, verb = "categories collapse", "collapsed"
+	}
+	return func(args []string) error {
+		args, err := parse(a.flags(name), args)
+		if err != nil {
+			return err
+		}
+		if err := wantArgs(args, 1, "a category"); err != nil {
+			return err
+		}
+
+		category, err := a.findCategory(args[0])
+		if err != nil {
+			return err
+		}
+		resp, err := a.updateCategory(category.ID, map[string]any{"collapsed": collapsed})
+		if err != nil {
+			return err
+		}
+		return a.printer.Done(resp, fmt.Sprintf("Category %s now starts %s", category.Name, verb))
+	}
+}
+
+func (a *app) categoriesDelete(args []string) error {
+	args, err := parse(a.flags("categories delete"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a category"); err != nil {
+		return err
+	}
+
+	category, err := a.findCategory(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	if err := client.Do(http.MethodDelete, fmt.Sprintf("/categories/%d", category.ID), nil, nil, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Deleted category %s; its %d channels are now uncategorized", category.Name, len(category.ChannelIDs)))
+}
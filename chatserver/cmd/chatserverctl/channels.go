@@ -0,0 +1,363 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/channelarchive"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// channelTree is the channel list: the channels in display order and their categories.
+type channelTree struct {
+	Channels   []models.Channel         `json:"channels"`
+	Categories []models.ChannelCategory `json:"categories"`
+}
+
+// fetchChannels returns the active channels and their categories in display order.
+func (a *app) fetchChannels() (channelTree, error) {
+	client, err := a.api()
+	if err != nil {
+		return channelTree{}, err
+	}
+	var tree channelTree
+	err = client.Do(http.MethodGet, "/channels", nil, nil, &tree)
+	return tree, err
+}
+
+// findChannel resolves a channel given by ID or name.
+func (a *app) findChannel(ref string) (models.Channel, error) {
+	tree, err := a.fetchChannels()
+	if err != nil {
+		return models.Channel{}, err
+	}
+	channels := tree.Channels
+	id, idErr := strconv.Atoi(ref)
+	for _, channel := range channels {
+		if (idErr == nil && channel.ID == id) || channel.Name == ref {
+			return channel, nil
+		}
+	}
+	for _, channel := range channels {
+		if strings.EqualFold(channel.Name, ref) {
+			return channel, nil
+		}
+	}
+	return models.Channel{}, fmt.Errorf("no channel %q", ref)
+}
+
+func (a *app) channelsList(args []string) error {
+	args, err := parse(a.flags("channels list"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	tree, err := a.fetchChannels()
+	if err != nil {
+		return err
+	}
+	categories := map[int]string{}
+	for _, category := range tree.Categories {
+		categories[category.ID] = category.Name
+	}
+	rows := make([][]string, len(tree.Channels))
+	for i, channel := range tree.Channels {
+		description, category := "", ""
+		if channel.Description != nil {
+			description = *channel.Description
+		}
+		if channel.CategoryID != nil {
+			category = categories[*channel.CategoryID]
+		}
+		rows[i] = []string{strconv.Itoa(channel.ID), channel.Name, orDash(category), orDash(channel.Language), orDash(truncate(description, 50))}
+	}
+	return a.printer.Print(tree, []string{"ID", "NAME", "CATEGORY", "LANGUAGE", "DESCRIPTION"}, rows)
+}
+
+func (a *app) channelsCreate(args []string) error {
+	fs := a.flags("channels create")
+	description := fs.String("description", "", "Channel description")
+	category := fs.String("category", "", "Category to add the channel to")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a channel name"); err != nil {
+		return err
+	}
+
+	body := map[string]any{"name": args[0], "description": *description}
+	if *category != "" {
+		target, err := a.findCategory(*category)
+		if err != nil {
+			return err
+		}
+		body["category_id"] = target.ID
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	if err := client.Do(http.MethodPost, "/channels", nil, body, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Created channel %s", args[0]))
+}
+
+func (a *app) channelsRename(args []string) error {
+	args, err := parse(a.flags("channels rename"), args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 2, "a channel and its new name"); err != nil {
+		return err
+	}
+
+	channel, err := a.findChannel(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	body := map[string]any{"id": channel.ID, "name": args[1]}
+	if err := client.Do(http.MethodPatch, "/channels", nil, body, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, fmt.Sprintf("Renamed channel %s to %s", channel.Name, args[1]))
+}
+
+func (a *app) channelsReorder(args []string) error {
+	fs := a.flags("channels reorder")
+	before := fs.String("before", "", "Channel to move the channel in front of")
+	category := fs.String("category", "", "Category to move the channel to the end of, or none")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a channel"); err != nil {
+		return err
+	}
+	if *before == "" && *category == "" {
+		return fmt.Errorf("%w: -before or -category is required", errUsage)
+	}
+
+	channel, err := a.findChannel(args[0])
+	if err != nil {
+		return err
+	}
+	body := map[string]any{"id": channel.ID}
+	message := fmt.Sprintf("Moved channel %s", channel.Name)
+	if *category != "" {
+		categoryID, name := 0, "no category"
+		if *category != "none" {
+			target, err := a.findCategory(*category)
+			if err != nil {
+				return err
+			}
+			categoryID, name = target.ID, target.Name
+		}
+		body["category_id"] = categoryID
+		message += " to " + name
+	}
+	if *before != "" {
+		target, err := a.findChannel(*before)
+		if err != nil {
+			return err
+		}
+		body["before_id"] = target.ID
+		message += " before " + target.Name
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp map[string]string
+	if err := client.Do(http.MethodPatch, "/channels", nil, body, &resp); err != nil {
+		return err
+	}
+	return a.printer.Done(resp, message)
+}
+
+func (a *app) channelsDelete(args []string) error {
+	fs := a.flags("channels delete")
+	purge := fs.Bool("purge", false, "Delete the channel's messages too")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a channel"); err != nil {
+		return err
+	}
+
+	channel, err := a.findChannel(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	query := url.Values{"id": {strconv.Itoa(channel.ID)}, "purge": {strconv.FormatBool(*purge)}}
+	var resp map[string]string
+	if err := client.Do(http.MethodDelete, "/channels", query, nil, &resp); err != nil {
+		return err
+	}
+	message := fmt.Sprintf("Deleted channel %s", channel.Name)
+	if *purge {
+		message += " and its messages"
+	}
+	return a.printer.Done(resp, message)
+}
+
+func (a *app) channelsExport(args []string) error {
+	fs := a.flags("channels export")
+	file := fs.String("file", "", "Where to write the archive, or - for stdout (default <name>.jsonl)")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "a channel"); err != nil {
+		return err
+	}
+
+	channel, err := a.findChannel(args[0])
+	if err != nil {
+		return err
+	}
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	resp, err := client.Stream(http.MethodGet, fmt.Sprintf("/channels/%d/archive", channel.ID), nil, "", nil)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	path := *file
+	if path == "" {
+		path = channel.Name + ".jsonl"
+	}
+	var out io.Writer = os.Stdout
+	if path != "-" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+
+	written, err := io.Copy(out, resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to download archive: %w", err)
+	}
+	if path == "-" {
+		return nil
+	}
+	if f, ok := out.(*os.File); ok {
+		if err := f.Close(); err != nil {
+			return err
+		}
+	}
+	return a.printer.Done(map[string]any{"channel": channel, "file": path, "bytes": written},
+		fmt.Sprintf("Exported channel %s to %s (%d bytes)", channel.Name, path, written))
+}
+
+func (a *app) channelsImport(args []string) error {
+	fs := a.flags("channels import")
+	name := fs.String("name", "", "Name for the imported channel instead of the archived one")
+	users := fs.String("users", "", "JSON file mapping the archive's user IDs to this server's")
+	strict := fs.Bool("strict", false, "Fail when an author is not in the user map")
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 1, "an archive file"); err != nil {
+		return err
+	}
+
+	archive, err := os.Open(args[0])
+	if err != nil {
+		return err
+	}
+	defer archive.Close()
+
+	var userMap []byte
+	if *users != "" {
+		if userMap, err = os.ReadFile(*users); err != nil {
+			return err
+		}
+	}
+
+	// Stream the form so large archives are not held in memory
+	body, writer := io.Pipe()
+	form := multipart.NewWriter(writer)
+	go func() {
+		writer.CloseWithError(writeImportForm(form, archive, *name, userMap, *strict))
+	}()
+
+	client, err := a.api()
+	if err != nil {
+		body.Close()
+		return err
+	}
+	resp, err := client.Stream(http.MethodPost, "/channels/import", nil, form.FormDataContentType(), body)
+	if err != nil {
+		body.Close()
+		return err
+	}
+	defer resp.Body.Close()
+
+	var result channelarchive.ImportResult
+	if err := decodeJSON(resp.Body, &result); err != nil {
+		return err
+	}
+	if a.printer.format == formatJSON {
+		return a.printer.Print(result, nil, nil)
+	}
+	fmt.Fprintf(a.printer.out, "Imported channel %s (ID %d) with %d messages\n", result.Channel.Name, result.Channel.ID, result.Messages)
+	if len(result.UnmappedUsers) > 0 {
+		fmt.Fprintf(a.printer.out, "Authors kept under their source IDs: %s\n", strings.Join(result.UnmappedUsers, ", "))
+	}
+	return nil
+}
+
+// writeImportForm writes the parts of a channel import request.
+func writeImportForm(form *multipart.Writer, archive *os.File, name string, users []byte, strict bool) error {
+	part, err := form.CreateFormFile("archive", filepath.Base(archive.Name()))
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(part, archive); err != nil {
+		return err
+	}
+	fields := map[string]string{"name": name, "users": string(users)}
+	if strict {
+		fields["strict"] = "true"
+	}
+	for field, value := range fields {
+		if value == "" {
+			continue
+		}
+		if err := form.WriteField(field, value); err != nil {
+			return err
+		}
+	}
+	return form.Close()
+}
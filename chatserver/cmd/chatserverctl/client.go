@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+// Client calls the chat server's REST API with a bearer token.
+type Client struct {
+	baseURL string
+	http    *http.Client
+	token   string
+}
+
+// Config describes where the server and Keycloak are and how to authenticate.
+type Config struct {
+	ServerURL    string // Chat server base URL, e.g. https://chat.localhost
+	KeycloakURL  string // Keycloak base URL, e.g. https://keycloak.localhost
+	Realm        string
+	ClientID     string // Service-account client used for the client credentials grant
+	ClientSecret string
+	Token        string // Used as is instead of requesting one from Keycloak when set
+	Insecure     bool   // Skip TLS verification, e.g. for Caddy's internal CA
+}
+
+// NewClient returns a client for the server in cfg, requesting a service-account token
+// from Keycloak unless cfg carries one.
+func NewClient(cfg Config) (*Client, error) {
+	// No timeout, since archives can take long to export or import
+	httpClient := &http.Client{}
+	if cfg.Insecure {
+		httpClient.Transport = &http.Transport{TLSClientConfig: &tls.Config{InsecureSkipVerify: true}}
+	}
+
+	client := &Client{
+		baseURL: strings.TrimRight(cfg.ServerURL, "/"),
+		http:    httpClient,
+		token:   cfg.Token,
+	}
+	if client.token != "" {
+		return client, nil
+	}
+
+	if cfg.ClientID == "" || cfg.ClientSecret == "" {
+		return nil, errors.New("set CHATSERVERCTL_CLIENT_ID and CHATSERVERCTL_CLIENT_SECRET, or CHATSERVERCTL_TOKEN")
+	}
+	token, err := requestToken(httpClient, cfg)
+	if err != nil {
+		return nil, err
+	}
+	client.token = token
+	return client, nil
+}
+
+// requestToken runs Keycloak's client credentials grant for the service account.
+func requestToken(httpClient *http.Client, cfg Config) (string, error) {
+	tokenURL := fmt.Sprintf("%s/realms/%s/protocol/openid-connect/token",
+		strings.TrimRight(cfg.KeycloakURL, "/"), url.PathEscape(cfg.Realm))
+	form := url.Values{
+		"grant_type":    {"client_credentials"},
+		"client_id":     {cfg.ClientID},
+		"client_secret": {cfg.ClientSecret},
+	}
+
+	resp, err := httpClient.PostForm(tokenURL, form)
+	if err != nil {
+		return "", fmt.Errorf("failed to request token: %w", err)
+	}
+	defer resp.Body.Close()
+
+	var body struct {
+		AccessToken      string `json:"access_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return "", fmt.Errorf("failed to read token response (%s): %w", resp.Status, err)
+	}
+	if resp.StatusCode != http.StatusOK || body.AccessToken == "" {
+		return "", fmt.Errorf("keycloak refused the token request (%s): %s %s", resp.Status, body.Error, body.ErrorDescription)
+	}
+	return body.AccessToken, nil
+}
+
+// APIError is a non-2xx response from the server.
+type APIError struct {
+	Status  int
+	Message string
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("server returned %d: %s", e.Status, e.Message)
+}
+
+// Do sends a request to path with an optional JSON body and decodes a JSON response into
+// out when it is not nil and the response has a body.
+func (c *Client) Do(method, path string, query url.Values, body, out any) error {
+	var reader io.Reader
+	if body != nil {
+		encoded, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reader = bytes.NewReader(encoded)
+	}
+
+	resp, err := c.send(method, path, query, "application/json", reader)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if out == nil || resp.StatusCode == http.StatusNoContent {
+		return nil
+	}
+	return decodeJSON(resp.Body, out)
+}
+
+// decodeJSON decodes a JSON response body into out.
+func decodeJSON(body io.Reader, out any) error {
+	if err := json.NewDecoder(body).Decode(out); err != nil {
+		return fmt.Errorf("failed to decode response: %w", err)
+	}
+	return nil
+}
+
+// envelope is the type and payload wrapper of API result messages.
+type envelope[T any] struct {
+	Type    string `json:"type"`
+	Payload T      `json:"payload"`
+}
+
+// Stream sends a request with a raw body of the given content type and returns the
+// response for the caller to read and close.
+func (c *Client) Stream(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	return c.send(method, path, query, contentType, body)
+}
+
+func (c *Client) send(method, path string, query url.Values, contentType string, body io.Reader) (*http.Response, error) {
+	target := c.baseURL + path
+	if len(query) > 0 {
+		target += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequest(method, target, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+c.token)
+	if body != nil {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("%s %s failed: %w", method, path, err)
+	}
+	if resp.StatusCode >= 300 {
+		defer resp.Body.Close()
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 4096))
+		return nil, &APIError{Status: resp.StatusCode, Message: strings.TrimSpace(string(message))}
+	}
+	return resp, nil
+}
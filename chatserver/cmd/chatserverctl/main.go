@@ -0,0 +1,233 @@
+// Command chatserverctl administers a chat server through its REST API, authenticating as
+// a Keycloak service account.
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+)
+
+const usage = `Usage: chatserverctl [global flags] <command> [flags] [args]
+
+Commands:
+  channels list
+  channels create <name> [-description text] [-category category]
+  channels rename <channel> <new-name>
+  channels reorder <channel> [-before channel] [-category category|none]
+  channels delete <channel> [-purge]
+  channels export <channel> [-file path]
+  channels import <archive> [-name name] [-users path] [-strict]
+  categories list
+  categories create <name> [-collapsed]
+  categories rename <category> <new-name>
+  categories reorder <category> [-before category]
+  categories collapse|expand <category>
+  categories delete <category>
+  bans list [-limit n] [-before cursor]
+  bans ban <user> [-reason text] [-duration hours] [-ip address|last] [-device id|last]
+  bans pardon <ban-id>
+  messages search [-keyword text] [-user user] [-channel name]... [-from date] [-to date] [-relevance]
+  messages delete <message-id>...
+  ratelimit show
+  ratelimit set -limit n -window seconds
+  sessions <user>
+  audit [-actor user] [-action action] [-target target] [-limit n] [-before cursor]
+
+Channels and categories are given by ID or name, users by ID or username.
+
+Global flags:
+`
+
+// errUsage marks errors caused by how the command was invoked.
+var errUsage = errors.New("usage")
+
+// app holds what commands share: the configuration, output format and API client.
+type app struct {
+	cfg     Config
+	printer Printer
+	client  *Client
+}
+
+// api returns the API client, authenticating on first use.
+func (a *app) api() (*Client, error) {
+	if a.client == nil {
+		client, err := NewClient(a.cfg)
+		if err != nil {
+			return nil, err
+		}
+		a.client = client
+	}
+	return a.client, nil
+}
+
+// flags returns a flag set for a command that also accepts the output flag.
+func (a *app) flags(name string) *flag.FlagSet {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	fs.Usage = func() {} // The full usage is printed instead
+	fs.StringVar(&a.printer.format, "o", a.printer.format, "Output format: table or json")
+	return fs
+}
+
+// parse parses flags wherever they appear among args and returns the positional arguments.
+func parse(fs *flag.FlagSet, args []string) ([]string, error) {
+	var positional []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, errUsage
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			return positional, checkFormat(fs.Lookup("o").Value.String())
+		}
+		positional = append(positional, args[0])
+		args = args[1:]
+	}
+}
+
+// pageFlags adds the paging flags of list commands.
+func pageFlags(fs *flag.FlagSet) (limit *int, before *string) {
+	return fs.Int("limit", 50, "Number of results per page"),
+		fs.String("before", "", "Cursor of the page to continue from")
+}
+
+// pageQuery returns the query parameters for a page.
+func pageQuery(limit int, before string) url.Values {
+	query := url.Values{"limit": {strconv.Itoa(limit)}}
+	if before != "" {
+		query.Set("before", before)
+	}
+	return query
+}
+
+// checkFormat rejects unknown output formats.
+func checkFormat(format string) error {
+	if format != formatTable && format != formatJSON {
+		return fmt.Errorf("%w: -o must be table or json", errUsage)
+	}
+	return nil
+}
+
+// wantArgs checks the number of positional arguments.
+func wantArgs(args []string, n int, names string) error {
+	if len(args) != n {
+		return fmt.Errorf("%w: expected %s", errUsage, names)
+	}
+	return nil
+}
+
+func main() {
+	a := &app{printer: Printer{format: formatTable, out: os.Stdout}}
+	insecure, _ := strconv.ParseBool(os.Getenv("CHATSERVERCTL_INSECURE"))
+
+	flag.Usage = func() {
+		fmt.Fprint(os.Stderr, usage)
+		flag.PrintDefaults()
+		fmt.Fprint(os.Stderr, `
+Environment:
+  CHATSERVER_URL, KEYCLOAK_URL, KEYCLOAK_REALM   Defaults for the flags above
+  CHATSERVERCTL_CLIENT_ID, CHATSERVERCTL_CLIENT_SECRET
+                                                 Service-account client credentials
+  CHATSERVERCTL_TOKEN                            Bearer token to use instead
+  CHATSERVERCTL_INSECURE                         Default for -insecure
+`)
+	}
+	flag.StringVar(&a.cfg.ServerURL, "server", envOr("CHATSERVER_URL", "https://chat.localhost"), "Chat server URL")
+	flag.StringVar(&a.cfg.KeycloakURL, "keycloak", envOr("KEYCLOAK_URL", "https://keycloak.localhost"), "Keycloak URL")
+	flag.StringVar(&a.cfg.Realm, "realm", envOr("KEYCLOAK_REALM", "Chatserver"), "Keycloak realm")
+	flag.StringVar(&a.printer.format, "o", formatTable, "Output format: table or json")
+	flag.BoolVar(&a.cfg.Insecure, "insecure", insecure, "Skip TLS certificate verification")
+	flag.Parse()
+
+	a.cfg.ClientID = os.Getenv("CHATSERVERCTL_CLIENT_ID")
+	a.cfg.ClientSecret = os.Getenv("CHATSERVERCTL_CLIENT_SECRET")
+	a.cfg.Token = os.Getenv("CHATSERVERCTL_TOKEN")
+
+	err := checkFormat(a.printer.format)
+	if err == nil {
+		err = a.run(flag.Args())
+	}
+	switch {
+	case err == nil:
+	case errors.Is(err, errUsage):
+		if err != errUsage {
+			fmt.Fprintln(os.Stderr, err)
+		}
+		flag.Usage()
+		os.Exit(2)
+	default:
+		fmt.Fprintf(os.Stderr, "chatserverctl: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+// run dispatches to the command named by the first arguments.
+func (a *app) run(args []string) error {
+	if len(args) == 0 {
+		return errUsage
+	}
+
+	commands := map[string]map[string]func([]string) error{
+		"channels": {
+			"list":    a.channelsList,
+			"create":  a.channelsCreate,
+			"rename":  a.channelsRename,
+			"reorder": a.channelsReorder,
+			"delete":  a.channelsDelete,
+			"export":  a.channelsExport,
+			"import":  a.channelsImport,
+		},
+		"categories": {
+			"list":     a.categoriesList,
+			"create":   a.categoriesCreate,
+			"rename":   a.categoriesRename,
+			"reorder":  a.categoriesReorder,
+			"collapse": a.categoriesCollapse(true),
+			"expand":   a.categoriesCollapse(false),
+			"delete":   a.categoriesDelete,
+		},
+		"bans": {
+			"list":   a.bansList,
+			"ban":    a.bansBan,
+			"pardon": a.bansPardon,
+		},
+		"messages": {
+			"search": a.messagesSearch,
+			"delete": a.messagesDelete,
+		},
+		"ratelimit": {
+			"show": a.rateLimitShow,
+			"set":  a.rateLimitSet,
+		},
+	}
+	switch args[0] {
+	case "sessions":
+		return a.sessions(args[1:])
+	case "audit":
+		return a.audit(args[1:])
+	}
+
+	group, ok := commands[args[0]]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q", errUsage, args[0])
+	}
+	if len(args) < 2 {
+		return fmt.Errorf("%w: %s needs a subcommand", errUsage, args[0])
+	}
+	command, ok := group[args[1]]
+	if !ok {
+		return fmt.Errorf("%w: unknown command %q", errUsage, args[0]+" "+args[1])
+	}
+	return command(args[2:])
+}
+
+// envOr returns the environment variable key, or fallback when it is unset.
+func envOr(key, fallback string) string {
+	if value := os.Getenv(key); value != "" {
+		return value
+	}
+	return fallback
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/messages/api"
+)
+
+// stringList is a flag that can be given several times.
+type stringList []string
+
+func (l *stringList) String() string     { return strings.Join(*l, ",") }
+func (l *stringList) Set(s string) error { *l = append(*l, s); return nil }
+
+func (a *app) messagesSearch(args []string) error {
+	fs := a.flags("messages search")
+	keyword := fs.String("keyword", "", "Words to search for")
+	user := fs.String("user", "", "Only messages by this user")
+	var channels stringList
+	fs.Var(&channels, "channel", "Only messages in this channel; can be repeated")
+	from := fs.String("from", "", "Earliest date, YYYY-MM-DD or RFC 3339")
+	to := fs.String("to", "", "Latest date, YYYY-MM-DD or RFC 3339")
+	relevance := fs.Bool("relevance", false, "Order keyword matches by relevance instead of date")
+	limit, before := pageFlags(fs)
+	args, err := parse(fs, args)
+	if err != nil {
+		return err
+	}
+	if err := wantArgs(args, 0, "no arguments"); err != nil {
+		return err
+	}
+
+	query := pageQuery(*limit, *before)
+	if *user != "" {
+		userID, err := a.findUserID(*user)
+		if err != nil {
+			return err
+		}
+		query.Set("user_id", userID)
+	}
+	for _, ref := range channels {
+		channel, err := a.findChannel(ref)
+		if err != nil {
+			return err
+		}
+		query.Add("channel", channel.Name)
+	}
+	for key, value := range map[string]string{"keyword": *keyword, "from": *from, "to": *to} {
+		if value != "" {
+			query.Set(key, value)
+		}
+	}
+	if *relevance {
+		query.Set("sort", "relevance")
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	var resp envelope[api.MessageSearchResultPayload]
+	if err := client.Do(http.MethodGet, "/messages", query, nil, &resp); err != nil {
+		return err
+	}
+
+	rows := make([][]string, len(resp.Payload.Messages))
+	for i, msg := range resp.Payload.Messages {
+		rows[i] = []string{strconv.Itoa(msg.ID), msg.Channel, orDash(msg.Username), formatTime(&msg.Sent), truncate(msg.Message, 60)}
+	}
+	if err := a.printer.Print(resp.Payload, []string{"ID", "CHANNEL", "USER", "SENT", "MESSAGE"}, rows); err != nil {
+		return err
+	}
+	a.printer.More(resp.Payload.HasMore, resp.Payload.NextCursor)
+	return nil
+}
+
+func (a *app) messagesDelete(args []string) error {
+	args, err := parse(a.flags("messages delete"), args)
+	if err != nil {
+		return err
+	}
+	if len(args) == 0 {
+		return fmt.Errorf("%w: expected message IDs", errUsage)
+	}
+
+	ids := make([]int, len(args))
+	for i, arg := range args {
+		if ids[i], err = strconv.Atoi(arg); err != nil {
+			return fmt.Errorf("%w: invalid message ID %q", errUsage, arg)
+		}
+	}
+
+	client, err := a.api()
+	if err != nil {
+		return err
+	}
+	if err := client.Do(http.MethodDelete, "/messages", nil, map[string][]int{"ids": ids}, nil); err != nil {
+		return err
+	}
+	return a.printer.Done(map[string][]int{"deleted": ids}, fmt.Sprintf("Deleted %d messages", len(ids)))
+}
@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+// Output formats.
+const (
+	formatTable = "table"
+	formatJSON  = "json"
+)
+
+// Printer writes command results as a table or as JSON.
+type Printer struct {
+	format string
+	out    io.Writer
+}
+
+// Print writes data as indented JSON, or as a table of headers and rows.
+func (p Printer) Print(data any, headers []string, rows [][]string) error {
+	if p.format == formatJSON {
+		encoder := json.NewEncoder(p.out)
+		encoder.SetIndent("", "  ")
+		return encoder.Encode(data)
+	}
+
+	w := tabwriter.NewWriter(p.out, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(w, strings.Join(headers, "\t"))
+	for _, row := range rows {
+		fmt.Fprintln(w, strings.Join(row, "\t"))
+	}
+	return w.Flush()
+}
+
+// Done reports the outcome of a command without a result worth tabulating.
+func (p Printer) Done(data any, message string) error {
+	if p.format == formatJSON {
+		return p.Print(data, nil, nil)
+	}
+	_, err := fmt.Fprintln(p.out, message)
+	return err
+}
+
+// More tells table readers how to fetch the next page; JSON output carries the cursor.
+func (p Printer) More(hasMore bool, nextCursor string) {
+	if hasMore && p.format == formatTable {
+		fmt.Fprintf(os.Stderr, "More results: -before %s\n", nextCursor)
+	}
+}
+
+// formatTime renders a timestamp for tables, or "-" when it is unset.
+func formatTime(t *time.Time) string {
+	if t == nil || t.IsZero() {
+		return "-"
+	}
+	return t.Local().Format("2006-01-02 15:04")
+}
+
+// orDash returns s, or "-" when it is empty.
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+	return s
+}
+
+// truncate shortens s to n runes on one line for table cells.
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	runes := []rune(s)
+	if len(runes) <= n {
+		return s
+	}
+	return string(runes[:n-1]) + "…"
+}
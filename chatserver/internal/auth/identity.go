@@ -0,0 +1,37 @@
+package auth
+
+import "context"
+
+// RoleModerator is the realm role allowed to moderate channels, e.g. by pinning messages.
+const RoleModerator = "moderator"
+
+// Identity describes the authenticated caller behind a request, as read from a Keycloak JWT.
+type Identity struct {
+	Username string   // preferred_username claim
+	UserID   string   // sub claim, the stable Keycloak user ID
+	ClientID string   // azp claim, e.g. "ChatClient" or "WebClient"
+	Roles    []string // Realm roles from the realm_access claim
+}
+
+// HasRole reports whether the identity holds the given realm role.
+func (i Identity) HasRole(role string) bool {
+	for _, r := range i.Roles {
+		if r == role {
+			return true
+		}
+	}
+	return false
+}
+
+type contextKey struct{}
+
+// NewContext returns a copy of ctx carrying the identity.
+func NewContext(ctx context.Context, identity Identity) context.Context {
+	return context.WithValue(ctx, contextKey{}, identity)
+}
+
+// FromContext returns the identity stored in ctx, if any.
+func FromContext(ctx context.Context) (Identity, bool) {
+	identity, ok := ctx.Value(contextKey{}).(Identity)
+	return identity, ok
+}
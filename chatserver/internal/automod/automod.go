@@ -0,0 +1,453 @@
+package automod
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	maxWords         = 500
+	maxWordLength    = 64
+	maxPatternLength = 512
+	maxMuteSeconds   = 7 * 24 * 60 * 60
+	maxWindowSeconds = 60 * 60
+
+	defaultCapsLetters = 10 // Caps rules ignore messages with fewer letters than this by default
+
+	// maxHistoryPerUser caps how many recent messages are remembered per user for repeat rules.
+	maxHistoryPerUser = 50
+)
+
+// severity orders actions so the strictest one matched decides a message's fate.
+var severity = map[string]int{
+	models.AutomodActionFlag:  1,
+	models.AutomodActionMask:  2,
+	models.AutomodActionBlock: 3,
+	models.AutomodActionMute:  4,
+}
+
+// Validate checks a rule's settings for its type and action, and clears settings its type
+// does not use.
+func Validate(rule *models.AutomodRule) error {
+	rule.Name = strings.TrimSpace(rule.Name)
+	if rule.Name == "" || utf8.RuneCountInString(rule.Name) > 64 {
+		return fmt.Errorf("name must be 1 to 64 characters")
+	}
+	if _, ok := severity[rule.Action]; !ok {
+		return fmt.Errorf("unknown action %q", rule.Action)
+	}
+
+	words, pattern, limit, ratio, window := rule.Words, rule.Pattern, rule.Limit, rule.Ratio, rule.WindowSeconds
+	rule.Words, rule.Pattern, rule.Limit, rule.Ratio, rule.WindowSeconds = nil, "", 0, 0, 0
+
+	switch rule.Type {
+	case models.AutomodWords:
+		for _, word := range words {
+			if word = strings.TrimSpace(word); word != "" && !slices.Contains(rule.Words, word) {
+				rule.Words = append(rule.Words, word)
+			}
+			if utf8.RuneCountInString(word) > maxWordLength {
+				return fmt.Errorf("words must be at most %d characters", maxWordLength)
+			}
+		}
+		if len(rule.Words) == 0 || len(rule.Words) > maxWords {
+			return fmt.Errorf("words rules need 1 to %d words", maxWords)
+		}
+	case models.AutomodRegex:
+		if pattern == "" || len(pattern) > maxPatternLength {
+			return fmt.Errorf("pattern must be 1 to %d bytes", maxPatternLength)
+		}
+		if _, err := regexp.Compile(pattern); err != nil {
+			return fmt.Errorf("invalid pattern: %w", err)
+		}
+		rule.Pattern = pattern
+	case models.AutomodLinks, models.AutomodMentions:
+		if limit < 0 {
+			return fmt.Errorf("limit must not be negative")
+		}
+		rule.Limit = limit
+	case models.AutomodCaps:
+		if ratio <= 0 || ratio >= 1 {
+			return fmt.Errorf("ratio must be between 0 and 1")
+		}
+		if limit <= 0 {
+			limit = defaultCapsLetters
+		}
+		rule.Limit, rule.Ratio = limit, ratio
+	case models.AutomodRepeat:
+		if limit <= 0 || limit > maxHistoryPerUser {
+			return fmt.Errorf("limit must be 1 to %d", maxHistoryPerUser)
+		}
+		if window <= 0 || window > maxWindowSeconds {
+			return fmt.Errorf("window_seconds must be 1 to %d", maxWindowSeconds)
+		}
+		rule.Limit, rule.WindowSeconds = limit, window
+	default:
+		return fmt.Errorf("unknown rule type %q", rule.Type)
+	}
+
+	if rule.Action == models.AutomodActionMask && rule.Type != models.AutomodWords && rule.Type != models.AutomodRegex {
+		return fmt.Errorf("only words and regex rules can mask")
+	}
+	if rule.Action == models.AutomodActionMute {
+		if rule.MuteSeconds <= 0 || rule.MuteSeconds > maxMuteSeconds {
+			return fmt.Errorf("mute_seconds must be 1 to %d", maxMuteSeconds)
+		}
+	} else {
+		rule.MuteSeconds = 0
+	}
+
+	var channels []string
+	for _, channel := range rule.Channels {
+		if channel = strings.TrimSpace(channel); channel != "" && !slices.Contains(channels, channel) {
+			channels = append(channels, channel)
+		}
+	}
+	rule.Channels = channels
+	return nil
+}
+
+// Message is a message about to be stored, as seen by the rules.
+type Message struct {
+	UserID  string
+	Channel string // Empty for private messages
+	Text    string
+	Content []models.MessageNode
+}
+
+// Match is a rule that a message broke.
+type Match struct {
+	Rule   models.AutomodRule
+	Reason string
+}
+
+// Verdict is the outcome of checking a message against every rule.
+type Verdict struct {
+	Action  string // Strictest action of the matched rules; empty if none matched
+	Rule    models.AutomodRule
+	Reason  string
+	Text    string  // Text to deliver, with masked matches replaced by maskRune
+	Matches []Match // Every rule the message broke
+}
+
+// compiledRule is a rule ready to be checked.
+type compiledRule struct {
+	models.AutomodRule
+	pattern *regexp.Regexp // For words and regex rules
+}
+
+// sentMessage is a recent message remembered for repeat rules.
+type sentMessage struct {
+	text string
+	at   time.Time
+}
+
+// Engine checks messages against the automod rules and tracks muted users. It is safe for
+// concurrent use.
+type Engine struct {
+	mu      sync.RWMutex
+	rules   []compiledRule
+	history map[string][]sentMessage // Recent messages of each user, oldest first
+	mutes   map[string]time.Time     // End of each muted user's mute
+}
+
+// NewEngine creates an engine without rules.
+func NewEngine() *Engine {
+	return &Engine{
+		history: make(map[string][]sentMessage),
+		mutes:   make(map[string]time.Time),
+	}
+}
+
+// SetRules replaces the engine's rules with the enabled ones among rules. Rules that no
+// longer validate are skipped.
+func (e *Engine) SetRules(rules []models.AutomodRule) {
+	var compiled []compiledRule
+	for _, rule := range rules {
+		if !rule.Enabled {
+			continue
+		}
+		if err := Validate(&rule); err != nil {
+			log.Printf("Skipping invalid automod rule %d: %v", rule.ID, err)
+			continue
+		}
+
+		c := compiledRule{AutomodRule: rule}
+		switch rule.Type {
+		case models.AutomodWords:
+			c.pattern = wordsPattern(rule.Words)
+		case models.AutomodRegex:
+			c.pattern = regexp.MustCompile(rule.Pattern)
+		}
+		compiled = append(compiled, c)
+	}
+
+	e.mu.Lock()
+	e.rules = compiled
+	e.mu.Unlock()
+}
+
+// SetMutes replaces the engine's muted users.
+func (e *Engine) SetMutes(mutes []models.AutomodMute) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.mutes = make(map[string]time.Time, len(mutes))
+	for _, mute := range mutes {
+		e.mutes[mute.UserID] = mute.Until
+	}
+}
+
+// Mute stops userID from posting until the given time, unless already muted for longer.
+func (e *Engine) Mute(userID string, until time.Time) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if until.After(e.mutes[userID]) {
+		e.mutes[userID] = until
+	}
+}
+
+// MutedUntil returns when userID's mute ends, if the user is muted.
+func (e *Engine) MutedUntil(userID string) (time.Time, bool) {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	until, ok := e.mutes[userID]
+	if !ok || !until.After(time.Now()) {
+		return time.Time{}, false
+	}
+	return until, true
+}
+
+// Check runs msg through every rule that applies to it and remembers it for repeat rules.
+func (e *Engine) Check(msg Message) Verdict {
+	now := time.Now()
+	verdict := Verdict{Text: msg.Text}
+
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	text := normalizeRepeat(msg.Text)
+	var masks [][]int
+	for _, rule := range e.rules {
+		if len(rule.Channels) > 0 && !slices.Contains(rule.Channels, msg.Channel) {
+			continue
+		}
+
+		var reason string
+		var spans [][]int
+		switch rule.Type {
+		case models.AutomodWords:
+			if spans = wholeWords(msg.Text, rule.pattern.FindAllStringIndex(msg.Text, -1)); len(spans) > 0 {
+				reason = fmt.Sprintf("contains %q", msg.Text[spans[0][0]:spans[0][1]])
+			}
+		case models.AutomodRegex:
+			if spans = nonEmpty(rule.pattern.FindAllStringIndex(msg.Text, -1)); len(spans) > 0 {
+				reason = "matches the pattern"
+			}
+		case models.AutomodLinks:
+			if links := format.Links(msg.Content, rule.Limit+1); len(links) > rule.Limit {
+				reason = fmt.Sprintf("has more than %d links", rule.Limit)
+			}
+		case models.AutomodMentions:
+			if mentions := distinct(format.Mentions(msg.Content)); len(mentions) > rule.Limit {
+				reason = fmt.Sprintf("mentions %d users", len(mentions))
+			}
+		case models.AutomodCaps:
+			if letters, upper := countCaps(msg.Content); letters >= rule.Limit && float64(upper) > rule.Ratio*float64(letters) {
+				reason = fmt.Sprintf("is %d%% capitals", upper*100/letters)
+			}
+		case models.AutomodRepeat:
+			since := now.Add(-time.Duration(rule.WindowSeconds) * time.Second)
+			if n := e.countSent(msg.UserID, text, since); n >= rule.Limit {
+				reason = fmt.Sprintf("repeats a message sent %d times in %ds", n, rule.WindowSeconds)
+			}
+		}
+		if reason == "" {
+			continue
+		}
+
+		verdict.Matches = append(verdict.Matches, Match{Rule: rule.AutomodRule, Reason: reason})
+		if severity[rule.Action] > severity[verdict.Action] {
+			verdict.Action, verdict.Rule, verdict.Reason = rule.Action, rule.AutomodRule, reason
+		}
+		if rule.Action == models.AutomodActionMask {
+			masks = append(masks, spans...)
+		}
+	}
+
+	e.remember(msg.UserID, text, now)
+	verdict.Text = mask(msg.Text, masks)
+	return verdict
+}
+
+// countSent returns how often userID sent text since the given time.
+func (e *Engine) countSent(userID, text string, since time.Time) int {
+	if text == "" {
+		return 0
+	}
+	n := 0
+	for _, sent := range e.history[userID] {
+		if sent.text == text && sent.at.After(since) {
+			n++
+		}
+	}
+	return n
+}
+
+// remember records a message for repeat rules, forgetting the user's oldest ones.
+func (e *Engine) remember(userID, text string, now time.Time) {
+	if text == "" {
+		return
+	}
+	history := append(e.history[userID], sentMessage{text: text, at: now})
+	if len(history) > maxHistoryPerUser {
+		history = history[len(history)-maxHistoryPerUser:]
+	}
+	e.history[userID] = history
+}
+
+// Sweep forgets messages too old for any repeat rule and expired mutes.
+func (e *Engine) Sweep() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	window := 0
+	for _, rule := range e.rules {
+		if rule.Type == models.AutomodRepeat {
+			window = max(window, rule.WindowSeconds)
+		}
+	}
+	cutoff := time.Now().Add(-time.Duration(window) * time.Second)
+	for userID, history := range e.history {
+		i := 0
+		for i < len(history) && !history[i].at.After(cutoff) {
+			i++
+		}
+		if i == len(history) {
+			delete(e.history, userID)
+		} else {
+			e.history[userID] = history[i:]
+		}
+	}
+
+	now := time.Now()
+	for userID, until := range e.mutes {
+		if !until.After(now) {
+			delete(e.mutes, userID)
+		}
+	}
+}
+
+// wordsPattern matches any of words, ignoring case. Longer words come first so the longest
+// alternative wins.
+func wordsPattern(words []string) *regexp.Regexp {
+	quoted := make([]string, len(words))
+	for i, word := range words {
+		quoted[i] = regexp.QuoteMeta(word)
+	}
+	sort.SliceStable(quoted, func(i, j int) bool { return len(quoted[i]) > len(quoted[j]) })
+	return regexp.MustCompile(`(?i)` + strings.Join(quoted, "|"))
+}
+
+// wholeWords keeps the spans of text that are not part of a longer word.
+func wholeWords(text string, spans [][]int) [][]int {
+	var kept [][]int
+	for _, span := range spans {
+		before, _ := utf8.DecodeLastRuneInString(text[:span[0]])
+		after, _ := utf8.DecodeRuneInString(text[span[1]:])
+		if !wordRune(before) && !wordRune(after) {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
+
+// nonEmpty drops the empty matches of patterns such as "a*".
+func nonEmpty(spans [][]int) [][]int {
+	var kept [][]int
+	for _, span := range spans {
+		if span[1] > span[0] {
+			kept = append(kept, span)
+		}
+	}
+	return kept
+}
+
+func wordRune(r rune) bool {
+	return r != utf8.RuneError && (unicode.IsLetter(r) || unicode.IsDigit(r) || r == '_')
+}
+
+// maskRune replaces masked characters. Unlike an asterisk it has no meaning in Markdown, so
+// re-rendering masked text cannot produce emphasis.
+const maskRune = '•'
+
+// mask replaces every character within spans with maskRune.
+func mask(text string, spans [][]int) string {
+	if len(spans) == 0 {
+		return text
+	}
+	masked := make([]bool, len(text))
+	for _, span := range spans {
+		for i := span[0]; i < span[1]; i++ {
+			masked[i] = true
+		}
+	}
+
+	var b strings.Builder
+	for i, r := range text {
+		if masked[i] && !unicode.IsSpace(r) {
+			b.WriteRune(maskRune)
+		} else {
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// countCaps counts the letters and capital letters in a message's text, leaving out code
+// and link targets.
+func countCaps(nodes []models.MessageNode) (letters, upper int) {
+	for _, node := range nodes {
+		switch node.Type {
+		case models.NodeCode, models.NodeCodeBlock:
+			continue
+		case models.NodeText, models.NodeMention:
+			for _, r := range node.Text {
+				if unicode.IsLetter(r) {
+					letters++
+					if unicode.IsUpper(r) {
+						upper++
+					}
+				}
+			}
+		}
+		l, u := countCaps(node.Children)
+		letters, upper = letters+l, upper+u
+	}
+	return letters, upper
+}
+
+// normalizeRepeat reduces text to the form compared by repeat rules, ignoring case and spacing.
+func normalizeRepeat(text string) string {
+	return strings.ToLower(strings.Join(strings.Fields(text), " "))
+}
+
+func distinct(values []string) []string {
+	var unique []string
+	for _, value := range values {
+		if !slices.Contains(unique, value) {
+			unique = append(unique, value)
+		}
+	}
+	return unique
+}
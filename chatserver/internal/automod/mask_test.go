@@ -0,0 +1,32 @@
+package automod
+
+import (
+	"testing"
+
+	"onrabble.com/chatserver/internal/format"
+)
+
+func TestMask(t *testing.T) {
+	tests := []struct {
+		text  string
+		spans [][]int
+		want  string
+		html  string // Masked text must render as plain text, never as emphasis
+	}{
+		{"a worst b", [][]int{{2, 7}}, "a ••••• b", "a ••••• b"},
+		{"a bad word b", [][]int{{2, 10}}, "a ••• •••• b", "a ••• •••• b"},
+		{"**a** worst", [][]int{{6, 11}}, "**a** •••••", "<strong>a</strong> •••••"},
+		{"héllo", [][]int{{0, 6}}, "•••••", "•••••"},
+		{"nothing", nil, "nothing", "nothing"},
+	}
+	for _, test := range tests {
+		got := mask(test.text, test.spans)
+		if got != test.want {
+			t.Errorf("mask(%q) = %q, want %q", test.text, got, test.want)
+			continue
+		}
+		if _, html := format.Render(got); html != test.html {
+			t.Errorf("mask(%q) renders as %q, want %q", test.text, html, test.html)
+		}
+	}
+}
@@ -21,6 +21,9 @@ type MessageCache struct {
 
 	WindowSeconds int
 	MessageLimit  int
+
+	HistoryDepth     int // Number of messages kept in each channel's history ring
+	InitialSyncDepth int // Number of messages per channel sent to newly connected clients
 }
 
 // Lua script to handle both circular and flush caches
@@ -53,9 +56,37 @@ var cacheMessageScript = valkey.NewLuaScript(`
 const maxCacheSize = 500
 const flushInterval = 2 * time.Minute
 
-// Caches a chat message in Valkey and triggers a DB flush if max cache size is reached
+// The default ring depth matches maxCacheSize so unflushed messages stay readable from the ring
+const defaultHistoryDepth = maxCacheSize
+const defaultInitialSyncDepth = 50
+
+// channelHistoryPattern matches every per-channel history ring.
+const channelHistoryPattern = "recent_messages:*"
+
+// channelHistoryKey returns the Valkey key of the history ring for a channel.
+func channelHistoryKey(channel string) string {
+	return fmt.Sprintf("recent_messages:%s", channel)
+}
+
+// historyDepth returns the configured ring depth, falling back to the default.
+func (m *MessageCache) historyDepth() int {
+	if m.HistoryDepth > 0 {
+		return m.HistoryDepth
+	}
+	return defaultHistoryDepth
+}
+
+// initialSyncDepth returns the configured initial sync size, falling back to the default.
+func (m *MessageCache) initialSyncDepth() int {
+	if m.InitialSyncDepth > 0 {
+		return m.InitialSyncDepth
+	}
+	return defaultInitialSyncDepth
+}
+
+// Caches a chat message in its channel's history ring and triggers a DB flush if max cache size is reached
 func (m *MessageCache) CacheChatMessage(msg models.ChatMessage) int {
-	recentCacheKey := "recent_messages"
+	recentCacheKey := channelHistoryKey(msg.Channel)
 	flushCacheKey := "flush_messages"
 	counterKey := "cache_message_id" // Key for unique message IDs
 
@@ -72,8 +103,8 @@ func (m *MessageCache) CacheChatMessage(msg models.ChatMessage) int {
 	results, err := cacheMessageScript.Exec(
 		ctx,
 		m.ValkeyClient,
-		[]string{recentCacheKey, flushCacheKey, counterKey},         // Keys
-		[]string{string(jsonData), fmt.Sprintf("%d", maxCacheSize)}, // Arguments
+		[]string{recentCacheKey, flushCacheKey, counterKey},             // Keys
+		[]string{string(jsonData), fmt.Sprintf("%d", m.historyDepth())}, // Arguments
 	).ToArray()
 
 	if err != nil {
@@ -108,18 +139,60 @@ func (m *MessageCache) CacheChatMessage(msg models.ChatMessage) int {
 	return int(cacheID) // Correctly return cacheID
 }
 
-// Retrieves chat messages from the circular cache
-func (m *MessageCache) GetCachedChatMessages() []models.ChatMessage {
-	recentCacheKey := "recent_messages"
+// GetCachedChatMessages retrieves the most recent messages from a channel's history ring.
+// A limit of zero or less uses the configured initial sync depth.
+func (m *MessageCache) GetCachedChatMessages(channel string, limit int) []models.ChatMessage {
+	if limit <= 0 {
+		limit = m.initialSyncDepth()
+	}
+
+	chatMessages := m.readChannelHistory(channel, -int64(limit))
+	log.Printf("Retrieved %d messages from the %s history ring", len(chatMessages), channel)
+	return chatMessages
+}
+
+// GetCachedChatMessagesBefore returns up to limit messages from a channel's history ring
+// whose cacheID is lower than beforeCacheID, oldest first. A beforeCacheID of zero or
+// less starts from the newest message.
+// It returns:
+//  1. The page of messages
+//  2. A boolean indicating whether the ring holds older messages beyond this page
+func (m *MessageCache) GetCachedChatMessagesBefore(channel string, beforeCacheID, limit int) ([]models.ChatMessage, bool) {
+	history := m.readChannelHistory(channel, 0)
+
+	end := len(history)
+	if beforeCacheID > 0 {
+		end = 0
+		for end < len(history) && history[end].CacheID < beforeCacheID {
+			end++
+		}
+	}
+
+	start := end - limit
+	if start < 0 {
+		start = 0
+	}
+
+	return history[start:end], start > 0
+}
+
+// GetChannelHistory returns every message in a channel's history ring, oldest first.
+func (m *MessageCache) GetChannelHistory(channel string) []models.ChatMessage {
+	return m.readChannelHistory(channel, 0)
+}
+
+// readChannelHistory reads a channel's history ring from start to the newest message.
+// A negative start counts back from the newest message.
+func (m *MessageCache) readChannelHistory(channel string, start int64) []models.ChatMessage {
 	ctx := context.Background()
 
 	cachedMessages, err := m.ValkeyClient.Do(
 		ctx,
-		m.ValkeyClient.B().Lrange().Key(recentCacheKey).Start(0).Stop(-1).Build(),
+		m.ValkeyClient.B().Lrange().Key(channelHistoryKey(channel)).Start(start).Stop(-1).Build(),
 	).AsStrSlice()
 
 	if err != nil {
-		log.Printf("Failed to retrieve cached messages from Valkey: %v", err)
+		log.Printf("Failed to retrieve cached messages for %s from Valkey: %v", channel, err)
 		return nil
 	}
 
@@ -143,14 +216,46 @@ func (m *MessageCache) GetCachedChatMessages() []models.ChatMessage {
 		chatMessages = append(chatMessages, cachedMsg.Data)
 	}
 
-	log.Printf("Retrieved %d messages from recent cache", len(chatMessages))
 	return chatMessages
 }
 
+// DropChannelHistory deletes a channel's history ring, e.g. once the channel has been renamed.
+// Its messages stay in the flush list until they are stored.
+func (m *MessageCache) DropChannelHistory(channel string) {
+	err := m.ValkeyClient.Do(context.Background(), m.ValkeyClient.B().Del().Key(channelHistoryKey(channel)).Build()).Error()
+	if err != nil {
+		log.Printf("Failed to drop the %s history ring: %v", channel, err)
+	}
+}
+
+// channelHistoryKeys returns the keys of every channel history ring currently in Valkey.
+func (m *MessageCache) channelHistoryKeys(ctx context.Context) ([]string, error) {
+	return m.scanKeys(ctx, channelHistoryPattern)
+}
+
+// scanKeys returns the keys currently in Valkey that match pattern.
+func (m *MessageCache) scanKeys(ctx context.Context, pattern string) ([]string, error) {
+	var keys []string
+	var cursor uint64
+	for {
+		entry, err := m.ValkeyClient.Do(
+			ctx,
+			m.ValkeyClient.B().Scan().Cursor(cursor).Match(pattern).Count(100).Build(),
+		).AsScanEntry()
+		if err != nil {
+			return nil, err
+		}
+
+		keys = append(keys, entry.Elements...)
+		cursor = entry.Cursor
+		if cursor == 0 {
+			return keys, nil
+		}
+	}
+}
+
 func (m *MessageCache) DeleteCachedMessage(cacheID int) bool {
 	var deleteMessageScript = valkey.NewLuaScript(`
-	local recentKey = KEYS[1]
-	local flushKey = KEYS[2]
 	local cacheID = ARGV[1]
 
 	-- Function to remove the message by cacheID
@@ -166,23 +271,35 @@ func (m *MessageCache) DeleteCachedMessage(cacheID int) bool {
 		return 0  -- Message not found
 	end
 
-	-- Remove from both lists
-	local removedRecent = removeMessage(recentKey, cacheID)
-	local removedFlush = removeMessage(flushKey, cacheID)
+	-- Remove from the flush list and every channel history ring
+	local removed = 0
+	for _, key in ipairs(KEYS) do
+		removed = removed + removeMessage(key, cacheID)
+	end
 
-	return removedRecent + removedFlush  -- Return number of deletions
+	return removed  -- Return number of deletions
 	`)
 
-	recentCacheKey := "recent_messages"
+	// Removing from the flush list mid-flush would shift the entries the flush trims
+	m.flushMutex.Lock()
+	defer m.flushMutex.Unlock()
+
 	flushCacheKey := "flush_messages"
 	ctx := context.Background()
 
+	// The channel is not known here, so search every history ring
+	historyKeys, err := m.channelHistoryKeys(ctx)
+	if err != nil {
+		log.Printf("Failed to list channel history rings: %v", err)
+		return false
+	}
+
 	// Execute the Lua script
 	deleted, err := deleteMessageScript.Exec(
 		ctx,
 		m.ValkeyClient,
-		[]string{recentCacheKey, flushCacheKey}, // KEYS
-		[]string{fmt.Sprintf("%d", cacheID)},    // ARGV (cacheID as string)
+		append(historyKeys, flushCacheKey),   // KEYS
+		[]string{fmt.Sprintf("%d", cacheID)}, // ARGV (cacheID as string)
 	).ToInt64()
 
 	if err != nil {
@@ -200,6 +317,53 @@ func (m *MessageCache) DeleteCachedMessage(cacheID int) bool {
 	return false
 }
 
+// LatestChatCacheID returns the newest cacheID issued to a public chat message.
+func (m *MessageCache) LatestChatCacheID() int {
+	return m.readCounter("cache_message_id")
+}
+
+// reserveCacheIDsScript raises the counter in KEYS[1] to at least ARGV[2], then reserves
+// ARGV[1] IDs above it and returns the last.
+var reserveCacheIDsScript = valkey.NewLuaScript(`
+	local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+	if current < tonumber(ARGV[2]) then
+		redis.call("SET", KEYS[1], ARGV[2])
+	end
+	return redis.call("INCRBY", KEYS[1], ARGV[1])
+`)
+
+// ReserveChatCacheIDs reserves count consecutive cacheIDs for chat messages and returns the
+// first. The IDs lie above both the counter and floor, so they collide neither with IDs
+// already issued nor with stored messages the counter has lost track of.
+func (m *MessageCache) ReserveChatCacheIDs(count, floor int) (int, error) {
+	last, err := reserveCacheIDsScript.Exec(
+		context.Background(),
+		m.ValkeyClient,
+		[]string{"cache_message_id"},
+		[]string{fmt.Sprintf("%d", count), fmt.Sprintf("%d", floor)},
+	).ToInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to reserve %d cacheIDs: %w", count, err)
+	}
+	return int(last) - count + 1, nil
+}
+
+// readCounter returns the current value of a cacheID counter, or 0 if it cannot be read.
+func (m *MessageCache) readCounter(counterKey string) int {
+	value, err := m.ValkeyClient.Do(
+		context.Background(),
+		m.ValkeyClient.B().Get().Key(counterKey).Build(),
+	).AsInt64()
+
+	if err != nil {
+		if !valkey.IsValkeyNil(err) {
+			log.Printf("Failed to read counter %s: %v", counterKey, err)
+		}
+		return 0
+	}
+	return int(value)
+}
+
 func (m *MessageCache) UpdateRateLimitSettings(limit int, window int) {
 	log.Printf("Updating rate limit: limit=%d, window=%ds", limit, window)
 	m.MessageLimit = limit
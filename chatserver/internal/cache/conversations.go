@@ -0,0 +1,99 @@
+package cache
+
+import (
+	"slices"
+
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// conversationPeer returns the other participant of a private message userID took part in,
+// or false if they didn't.
+func conversationPeer(msg models.PrivateChatMessage, userID string) (string, bool) {
+	switch userID {
+	case msg.OwnerID:
+		return msg.RecipientID, true
+	case msg.RecipientID:
+		return msg.OwnerID, true
+	}
+	return "", false
+}
+
+// FetchConversations returns userID's private conversations, most recently active first,
+// combining stored messages with those still waiting to be flushed.
+func (m *MessageCache) FetchConversations(userID string) ([]models.Conversation, error) {
+	conversations, err := database.FetchConversations(m.DB, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	// A message flushed meanwhile may already be counted in its stored conversation
+	stored := make(map[string]int)
+	for _, c := range conversations {
+		stored[c.PeerID] = c.LastMessage.CacheID
+	}
+
+	var peerMarkers map[string]int
+	for _, msg := range m.GetUnflushedPrivateMessages() {
+		peerID, ok := conversationPeer(msg, userID)
+		if !ok || msg.CacheID <= stored[peerID] {
+			continue
+		}
+
+		i := slices.IndexFunc(conversations, func(c models.Conversation) bool { return c.PeerID == peerID })
+		if i < 0 {
+			peerUsername := msg.Username
+			if msg.OwnerID == userID {
+				peerUsername = msg.Recipient
+			}
+			conversations = append(conversations, models.Conversation{PeerID: peerID, PeerUsername: peerUsername})
+			i = len(conversations) - 1
+		}
+
+		c := &conversations[i]
+		c.LastMessage = msg
+
+		if msg.RecipientID == userID && msg.OwnerID != userID {
+			if peerMarkers == nil {
+				if _, peerMarkers, err = database.FetchReadMarkers(m.DB, userID); err != nil {
+					return nil, err
+				}
+			}
+			if msg.CacheID > peerMarkers[peerID] {
+				c.UnreadCount++
+			}
+		}
+	}
+
+	slices.SortStableFunc(conversations, func(a, b models.Conversation) int {
+		return b.LastMessage.Sent.Compare(a.LastMessage.Sent)
+	})
+	return conversations, nil
+}
+
+// FetchPrivateHistory returns a page of the private messages exchanged between userID and
+// peerID, newest first, combining stored messages with those still waiting to be flushed.
+// Offset pages are read from the database alone.
+func (m *MessageCache) FetchPrivateHistory(userID, peerID string, page database.PageRequest) ([]models.PrivateChatMessage, database.PageInfo, error) {
+	// Read the cache first so a message flushed meanwhile is found in the database instead
+	var unflushed []models.PrivateChatMessage
+	if page.Offset == 0 {
+		for _, msg := range m.GetUnflushedPrivateMessages() {
+			if peer, ok := conversationPeer(msg, userID); ok && peer == peerID && inPage(msg.Sent, page) {
+				unflushed = append(unflushed, msg)
+			}
+		}
+	}
+
+	filter := database.PrivateMessageFilter{PeerID: peerID}
+	history, info, err := database.FetchPrivateMessages(m.DB, userID, filter, page)
+	if err != nil || len(unflushed) == 0 {
+		return history, info, err
+	}
+	if err := database.AttachPrivateReactions(m.DB, unflushed); err != nil {
+		return nil, info, err
+	}
+
+	history, info = mergePage(history, unflushed, info, page, privateKey)
+	return history, info, nil
+}
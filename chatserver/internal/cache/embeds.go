@@ -0,0 +1,75 @@
+package cache
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// embedKey returns the key of a link's cached preview. Links are hashed to bound the key size.
+func embedKey(link string) string {
+	sum := sha256.Sum256([]byte(link))
+	return "embed:" + hex.EncodeToString(sum[:])
+}
+
+// SaveEmbed caches a link's preview for ttl. Empty previews are cached too, so links
+// without metadata are not fetched again for every message that repeats them.
+func (m *MessageCache) SaveEmbed(embed models.Embed, ttl time.Duration) error {
+	data, err := json.Marshal(embed)
+	if err != nil {
+		return fmt.Errorf("failed to serialize embed: %w", err)
+	}
+
+	ctx := context.Background()
+	err = m.ValkeyClient.Do(ctx,
+		m.ValkeyClient.B().Set().Key(embedKey(embed.URL)).Value(string(data)).Ex(ttl).Build(),
+	).Error()
+	if err != nil {
+		return fmt.Errorf("failed to cache embed: %w", err)
+	}
+	return nil
+}
+
+// GetEmbeds returns the cached previews of the given links, keyed by link. Links that
+// have not been fetched, or whose preview expired, are omitted.
+func (m *MessageCache) GetEmbeds(links []string) (map[string]models.Embed, error) {
+	embeds := make(map[string]models.Embed)
+	if len(links) == 0 {
+		return embeds, nil
+	}
+
+	keys := make([]string, len(links))
+	for i, link := range links {
+		keys[i] = embedKey(link)
+	}
+
+	ctx := context.Background()
+	values, err := m.ValkeyClient.Do(ctx, m.ValkeyClient.B().Mget().Key(keys...).Build()).ToArray()
+	if err != nil {
+		return nil, fmt.Errorf("failed to read embeds: %w", err)
+	}
+
+	for i, value := range values {
+		data, err := value.ToString()
+		if valkey.IsValkeyNil(err) {
+			continue
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read embed: %w", err)
+		}
+
+		var embed models.Embed
+		if err := json.Unmarshal([]byte(data), &embed); err != nil {
+			return nil, fmt.Errorf("failed to parse embed: %w", err)
+		}
+		embeds[links[i]] = embed
+	}
+	return embeds, nil
+}
@@ -0,0 +1,61 @@
+package cache
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// eraseUserScript removes every message sent or received by the user in ARGV[1] from the
+// lists in KEYS and returns the number removed.
+var eraseUserScript = valkey.NewLuaScript(`
+	local userID = ARGV[1]
+	local removed = 0
+	for _, key in ipairs(KEYS) do
+		for _, msg in ipairs(redis.call("LRANGE", key, 0, -1)) do
+			local data = cjson.decode(msg).data
+			if data and (data.owner_id == userID or data.recipient_id == userID) then
+				removed = removed + redis.call("LREM", key, 0, msg)
+			end
+		end
+	end
+	return removed
+`)
+
+// EraseUser removes a user's messages from every channel history ring, every user's recent
+// private messages and both flush lists, and deletes their rate limit counter and presence.
+// Flushes wait until it is done, so messages it removes from the flush lists are never
+// stored. It returns the number of cached copies removed; a message can have several.
+func (m *MessageCache) EraseUser(userID string) (int64, error) {
+	m.flushMutex.Lock()
+	defer m.flushMutex.Unlock()
+
+	ctx := context.Background()
+
+	keys, err := m.channelHistoryKeys(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list channel history rings: %w", err)
+	}
+	privateKeys, err := m.scanKeys(ctx, "recent_private_messages:*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to list recent private messages: %w", err)
+	}
+	keys = append(keys, privateKeys...)
+	keys = append(keys, "flush_messages", "flush_private_messages")
+
+	removed, err := eraseUserScript.Exec(ctx, m.ValkeyClient, keys, []string{userID}).ToInt64()
+	if err != nil {
+		return 0, fmt.Errorf("failed to remove cached messages of %s: %w", userID, err)
+	}
+
+	for _, cmd := range []valkey.Completed{
+		m.ValkeyClient.B().Del().Key(fmt.Sprintf("recent_private_messages:%s", userID), fmt.Sprintf("ratelimit:%s", userID)).Build(),
+		m.ValkeyClient.B().Hdel().Key(presenceKey).Field(userID).Build(),
+	} {
+		if err := m.ValkeyClient.Do(ctx, cmd).Error(); err != nil {
+			return removed, fmt.Errorf("failed to erase cached state of %s: %w", userID, err)
+		}
+	}
+	return removed, nil
+}
@@ -60,10 +60,12 @@ func (m *MessageCache) FlushCacheToDB() {
 
 		_, err = tx.Exec(
 			ctx,
-			`INSERT INTO chatserver.chat_messages (cache_id, owner_id, channel, message, authored_at)
-			 VALUES ($1, $2, $3, $4, $5)
+			`INSERT INTO chatserver.chat_messages (cache_id, owner_id, channel, message, authored_at, search_language, reply_to_cache_id)
+			 VALUES ($1, $2, $3, $4, $5, COALESCE(
+				(SELECT c.search_language FROM chatserver.channels c WHERE c.name = $3), 'english'
+			 ), NULLIF($6, 0))
 			`,
-			cachedMsg.Data.CacheID, cachedMsg.Data.OwnerID, cachedMsg.Data.Channel, cachedMsg.Data.Message, cachedMsg.Data.Sent,
+			cachedMsg.Data.CacheID, cachedMsg.Data.OwnerID, cachedMsg.Data.Channel, cachedMsg.Data.Message, cachedMsg.Data.Sent, cachedMsg.Data.ReplyTo,
 		)
 
 		if err != nil {
@@ -77,8 +79,8 @@ func (m *MessageCache) FlushCacheToDB() {
 		return
 	}
 
-	// Clear the flush cache to avoid duplicate inserts
-	if _, err := m.ValkeyClient.Do(ctx, m.ValkeyClient.B().Del().Key(flushCacheKey).Build()).AsInt64(); err != nil {
+	// Clear the flushed messages to avoid duplicate inserts
+	if err := m.trimFlushed(ctx, flushCacheKey, len(cachedMessages)); err != nil {
 		log.Printf("Failed to clear flush cache after database flush: %v", err)
 	} else {
 		log.Println("Successfully cleared flush cache after database flush.")
@@ -87,6 +89,42 @@ func (m *MessageCache) FlushCacheToDB() {
 	log.Println("Successfully flushed messages to the database.")
 }
 
+// trimFlushed removes the first n entries of a flush list once they are stored. Messages
+// cached during the flush were appended after them and stay. Everything else that removes
+// entries holds flushMutex, so the first n are exactly the ones that were read.
+func (m *MessageCache) trimFlushed(ctx context.Context, key string, n int) error {
+	return m.ValkeyClient.Do(ctx, m.ValkeyClient.B().Ltrim().Key(key).Start(int64(n)).Stop(-1).Build()).Error()
+}
+
+// GetUnflushedChatMessages returns the public messages still waiting to be flushed to the database.
+func (m *MessageCache) GetUnflushedChatMessages() []models.ChatMessage {
+	cachedMessages, err := m.ValkeyClient.Do(
+		context.Background(),
+		m.ValkeyClient.B().Lrange().Key("flush_messages").Start(0).Stop(-1).Build(),
+	).AsStrSlice()
+
+	if err != nil {
+		log.Printf("Failed to retrieve unflushed messages from Valkey: %v", err)
+		return nil
+	}
+
+	var chatMessages []models.ChatMessage
+	for _, jsonData := range cachedMessages {
+		var cachedMsg struct {
+			CacheID int64              `json:"cache_id"`
+			Data    models.ChatMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(jsonData), &cachedMsg); err != nil {
+			log.Printf("Failed to deserialize chat message: %v", err)
+			continue
+		}
+		cachedMsg.Data.CacheID = int(cachedMsg.CacheID)
+		chatMessages = append(chatMessages, cachedMsg.Data)
+	}
+
+	return chatMessages
+}
+
 // StartPeriodicFlush triggers database flush every interval
 func (m *MessageCache) StartPeriodicFlush() {
 	ticker := time.NewTicker(flushInterval)
@@ -0,0 +1,114 @@
+package cache
+
+import (
+	"slices"
+	"strconv"
+	"time"
+
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// messageKey holds the fields of a chat or private message that history pages are built from.
+type messageKey struct {
+	sent    time.Time
+	cacheID int
+	id      int
+}
+
+func chatKey(msg models.ChatMessage) messageKey {
+	return messageKey{sent: msg.Sent, cacheID: msg.CacheID, id: msg.ID}
+}
+
+func privateKey(msg models.PrivateChatMessage) messageKey {
+	return messageKey{sent: msg.Sent, cacheID: msg.CacheID, id: msg.ID}
+}
+
+// inPage reports whether a message sent at sent falls inside a page's cursor window.
+func inPage(sent time.Time, page database.PageRequest) bool {
+	if page.Before != nil && !sent.Before(page.Before.At) {
+		return false
+	}
+	return page.After == nil || sent.After(page.After.At)
+}
+
+// mergePage adds unflushed messages to a page of stored messages read from the database,
+// newest first, and rebuilds the page's cursors. Messages flushed while the page was read
+// are only kept once. Unflushed messages have no database ID, so their cursors only carry
+// their timestamp.
+func mergePage[T any](stored, unflushed []T, info database.PageInfo, page database.PageRequest, key func(T) messageKey) ([]T, database.PageInfo) {
+	history := stored
+	for _, msg := range unflushed {
+		cacheID := key(msg).cacheID
+		if !slices.ContainsFunc(stored, func(s T) bool { return key(s).cacheID == cacheID }) {
+			history = append(history, msg)
+		}
+	}
+	if len(history) == len(stored) {
+		return history, info
+	}
+
+	slices.SortStableFunc(history, func(a, b T) int {
+		ka, kb := key(a), key(b)
+		if c := kb.sent.Compare(ka.sent); c != 0 {
+			return c
+		}
+		return kb.cacheID - ka.cacheID
+	})
+
+	cursorOf := func(msg T) string {
+		k := key(msg)
+		return database.Cursor{At: k.sent, ID: strconv.Itoa(k.id)}.Encode()
+	}
+	extra := len(history) > page.Limit
+	if page.After != nil {
+		// Keep the messages right after the cursor
+		if extra {
+			history = history[len(history)-page.Limit:]
+		}
+		if extra || info.PrevCursor != "" {
+			info.PrevCursor = cursorOf(history[0])
+		}
+		info.HasMore = true
+	} else {
+		if extra {
+			history = history[:page.Limit]
+		}
+		info.HasMore = info.HasMore || extra
+		if page.Before != nil {
+			info.PrevCursor = cursorOf(history[0])
+		}
+	}
+	info.NextCursor = ""
+	if info.HasMore {
+		info.NextCursor = cursorOf(history[len(history)-1])
+	}
+
+	return history, info
+}
+
+// FetchThreadReplies returns a page of the replies to the thread started by parentCacheID,
+// newest first, combining stored replies with those still waiting to be flushed.
+// Offset pages are read from the database alone.
+func (m *MessageCache) FetchThreadReplies(parentCacheID int, page database.PageRequest) ([]models.ChatMessage, database.PageInfo, error) {
+	// Read the cache first so a reply flushed meanwhile is found in the database instead
+	var unflushed []models.ChatMessage
+	if page.Offset == 0 {
+		for _, msg := range m.GetUnflushedChatMessages() {
+			if msg.ReplyTo == parentCacheID && inPage(msg.Sent, page) {
+				unflushed = append(unflushed, msg)
+			}
+		}
+	}
+
+	replies, info, err := database.FetchMessages(m.DB, database.MessageFilter{ReplyTo: parentCacheID}, page)
+	if err != nil || len(unflushed) == 0 {
+		return replies, info, err
+	}
+	if err := database.AttachChatReactions(m.DB, unflushed); err != nil {
+		return nil, info, err
+	}
+
+	replies, info = mergePage(replies, unflushed, info, page, chatKey)
+	return replies, info, nil
+}
@@ -0,0 +1,27 @@
+package cache
+
+import (
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// FetchMentions returns a page of userID's mentions, newest first, optionally only those
+// not read yet. Mentions of messages still waiting to be flushed carry their text too.
+func (m *MessageCache) FetchMentions(userID string, unreadOnly bool, page database.PageRequest) ([]models.Mention, database.PageInfo, error) {
+	// Read the cache first so a message flushed meanwhile is found in the database instead
+	unflushed := make(map[int]string)
+	for _, msg := range m.GetUnflushedChatMessages() {
+		unflushed[msg.CacheID] = msg.Message
+	}
+
+	mentions, info, err := database.FetchMentions(m.DB, userID, unreadOnly, page)
+	if err != nil {
+		return nil, info, err
+	}
+	for i, mention := range mentions {
+		if mention.Message == "" {
+			mentions[i].Message = unflushed[mention.CacheID]
+		}
+	}
+	return mentions, info, nil
+}
@@ -0,0 +1,48 @@
+package cache
+
+import (
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// FetchChannelPins returns the pinned messages of a channel, or of every channel when
+// channelID is zero, newest pin first, keyed by channel ID. Pinned messages still waiting
+// to be flushed are read from the cache.
+func (m *MessageCache) FetchChannelPins(channelID int) (map[int][]models.Pin, error) {
+	// Read the cache first so a message flushed meanwhile is found in the database instead
+	unflushed := make(map[int]models.ChatMessage)
+	for _, msg := range m.GetUnflushedChatMessages() {
+		unflushed[msg.CacheID] = msg
+	}
+
+	pins, err := database.FetchChannelPins(m.DB, channelID)
+	if err != nil {
+		return nil, err
+	}
+	for id, channelPins := range pins {
+		kept := channelPins[:0]
+		for _, pin := range channelPins {
+			if pin.Message.ID == 0 {
+				msg, ok := unflushed[pin.CacheID]
+				if !ok {
+					continue
+				}
+				pin.Message = msg
+			}
+			kept = append(kept, pin)
+		}
+		pins[id] = kept
+	}
+	return pins, nil
+}
+
+// FindUnflushedChatMessage returns the chat message with the given cacheID if it is still
+// waiting to be flushed.
+func (m *MessageCache) FindUnflushedChatMessage(cacheID int) (models.ChatMessage, bool) {
+	for _, msg := range m.GetUnflushedChatMessages() {
+		if msg.CacheID == cacheID {
+			return msg, true
+		}
+	}
+	return models.ChatMessage{}, false
+}
@@ -0,0 +1,51 @@
+package cache
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/valkey-io/valkey-go"
+)
+
+// presenceKey is the hash holding each user's chosen presence, keyed by user ID.
+const presenceKey = "presence"
+
+// SavePresence stores the presence a user has chosen so it survives reconnects and restarts.
+func (m *MessageCache) SavePresence(userID string, presence models.Presence) error {
+	data, err := json.Marshal(presence)
+	if err != nil {
+		return fmt.Errorf("failed to serialize presence: %w", err)
+	}
+
+	ctx := context.Background()
+	err = m.ValkeyClient.Do(ctx,
+		m.ValkeyClient.B().Hset().Key(presenceKey).FieldValue().FieldValue(userID, string(data)).Build(),
+	).Error()
+	if err != nil {
+		return fmt.Errorf("failed to save presence: %w", err)
+	}
+	return nil
+}
+
+// GetPresence returns the presence a user last chose, if any.
+func (m *MessageCache) GetPresence(userID string) (models.Presence, bool, error) {
+	ctx := context.Background()
+	data, err := m.ValkeyClient.Do(ctx,
+		m.ValkeyClient.B().Hget().Key(presenceKey).Field(userID).Build(),
+	).ToString()
+	if valkey.IsValkeyNil(err) {
+		return models.Presence{}, false, nil
+	}
+	if err != nil {
+		return models.Presence{}, false, fmt.Errorf("failed to read presence: %w", err)
+	}
+
+	var presence models.Presence
+	if err := json.Unmarshal([]byte(data), &presence); err != nil {
+		return models.Presence{}, false, fmt.Errorf("failed to parse presence: %w", err)
+	}
+	return presence, true, nil
+}
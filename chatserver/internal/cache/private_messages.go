@@ -134,7 +134,41 @@ func (m *MessageCache) GetCachedPrivateMessages(userID string) []models.PrivateC
 	return privateMessages
 }
 
-// FlushPrivateMessagesToDB writes Valkey-cached private messages to PostgreSQL and clears the flush list
+// LatestPrivateCacheID returns the newest cacheID issued to a private message.
+func (m *MessageCache) LatestPrivateCacheID() int {
+	return m.readCounter("cache_private_message_id")
+}
+
+// GetUnflushedPrivateMessages returns the private messages still waiting to be flushed to the database.
+func (m *MessageCache) GetUnflushedPrivateMessages() []models.PrivateChatMessage {
+	cachedMessages, err := m.ValkeyClient.Do(
+		context.Background(),
+		m.ValkeyClient.B().Lrange().Key("flush_private_messages").Start(0).Stop(-1).Build(),
+	).AsStrSlice()
+
+	if err != nil {
+		log.Printf("Failed to retrieve unflushed private messages from Valkey: %v", err)
+		return nil
+	}
+
+	var privateMessages []models.PrivateChatMessage
+	for _, jsonData := range cachedMessages {
+		var cached struct {
+			CacheID int64                     `json:"cache_id"`
+			Data    models.PrivateChatMessage `json:"data"`
+		}
+		if err := json.Unmarshal([]byte(jsonData), &cached); err != nil {
+			log.Printf("Failed to deserialize private message: %v", err)
+			continue
+		}
+		cached.Data.CacheID = int(cached.CacheID)
+		privateMessages = append(privateMessages, cached.Data)
+	}
+
+	return privateMessages
+}
+
+// FlushPrivateMessagesToDB writes Valkey-cached private messages to PostgreSQL and removes them from the flush list
 func (m *MessageCache) FlushPrivateMessagesToDB() {
 	m.flushMutex.Lock()
 	defer m.flushMutex.Unlock()
@@ -175,11 +209,47 @@ func (m *MessageCache) FlushPrivateMessagesToDB() {
 		return
 	}
 
-	_, err = m.ValkeyClient.Do(ctx, m.ValkeyClient.B().Del().Key(flushKey).Build()).AsInt64()
-	if err != nil {
+	if err := m.trimFlushed(ctx, flushKey, len(cachedMessages)); err != nil {
 		log.Printf("Failed to clear private message flush cache: %v", err)
 		return
 	}
 
 	log.Printf("Successfully flushed %d private messages to the database.", len(messages))
 }
+
+// deletePrivateMessageScript removes the entry with the given cache ID from every list in KEYS.
+var deletePrivateMessageScript = valkey.NewLuaScript(`
+	local cacheID = tonumber(ARGV[1])
+	local removed = 0
+	for _, key in ipairs(KEYS) do
+		for _, msg in ipairs(redis.call("LRANGE", key, 0, -1)) do
+			if cjson.decode(msg).cache_id == cacheID then
+				removed = removed + redis.call("LREM", key, 1, msg)
+				break
+			end
+		end
+	end
+	return removed
+`)
+
+// DeleteCachedPrivateMessage removes a private message from its participants' recent
+// messages and from the flush list. It returns false if no copy was found.
+func (m *MessageCache) DeleteCachedPrivateMessage(cacheID int, ownerID, recipientID string) bool {
+	m.flushMutex.Lock()
+	defer m.flushMutex.Unlock()
+
+	keys := []string{
+		fmt.Sprintf("recent_private_messages:%s", ownerID),
+		fmt.Sprintf("recent_private_messages:%s", recipientID),
+		"flush_private_messages",
+	}
+
+	removed, err := deletePrivateMessageScript.Exec(
+		context.Background(), m.ValkeyClient, keys, []string{fmt.Sprintf("%d", cacheID)},
+	).ToInt64()
+	if err != nil {
+		log.Printf("Failed to delete private message %d from cache: %v", cacheID, err)
+		return false
+	}
+	return removed > 0
+}
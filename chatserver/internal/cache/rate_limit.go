@@ -3,6 +3,7 @@ package cache
 import (
 	"context"
 	"fmt"
+	"time"
 
 	"onrabble.com/chatserver/internal/models"
 
@@ -53,6 +54,22 @@ func (m *MessageCache) CheckRateLimitValkey(userID string, limit int, ttlSeconds
 	return (result == 1), nil
 }
 
+// StartCooldown starts a cooldown of length ttl for userID's action unless one is already
+// running. It returns false while the action is cooling down.
+func (m *MessageCache) StartCooldown(action, userID string, ttl time.Duration) (bool, error) {
+	key := fmt.Sprintf("cooldown:%s:%s", action, userID)
+	err := m.ValkeyClient.Do(context.Background(),
+		m.ValkeyClient.B().Set().Key(key).Value("1").Nx().Ex(ttl).Build(),
+	).Error()
+	if valkey.IsValkeyNil(err) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("cooldown check failed: %w", err)
+	}
+	return true, nil
+}
+
 func (m *MessageCache) AttemptCacheWithRateLimit(userID string, msg models.ChatMessage) (int, error) {
 	// Allow 10 messages per 60s
 	allowed, err := m.CheckRateLimitValkey(userID, m.MessageLimit, m.WindowSeconds)
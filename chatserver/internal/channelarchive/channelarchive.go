@@ -0,0 +1,271 @@
+package channelarchive
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/cache"
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Version is the archive format version written by Export and accepted by Import.
+const Version = 1
+
+// Record types, one record per line.
+const (
+	TypeChannel = "channel" // First line: the channel's metadata
+	TypeMessage = "message" // One line per message, in cacheID order
+	TypeEnd     = "end"     // Last line: marks the archive as complete
+)
+
+// batchSize is the number of messages imported per statement.
+const batchSize = 1000
+
+// maxChannelName matches the length of channels.name.
+const maxChannelName = 24
+
+// ChannelRecord describes the archived channel.
+type ChannelRecord struct {
+	Type        string    `json:"type"`
+	Version     int       `json:"version"`
+	Name        string    `json:"name"`
+	Description *string   `json:"description,omitempty"`
+	Language    string    `json:"search_language"`
+	ExportedAt  time.Time `json:"exported_at"`
+}
+
+// MessageRecord is one archived message. CacheID and ReplyTo are the source server's
+// cacheIDs; Username is informational.
+type MessageRecord struct {
+	Type       string    `json:"type"`
+	CacheID    int       `json:"cache_id"`
+	OwnerID    string    `json:"owner_id"`
+	Username   string    `json:"username,omitempty"`
+	Message    string    `json:"message"`
+	AuthoredAt time.Time `json:"authored_at"`
+	ReplyTo    int       `json:"reply_to,omitempty"`
+}
+
+// EndRecord closes an archive with the number of messages in it.
+type EndRecord struct {
+	Type         string `json:"type"`
+	MessageCount int    `json:"message_count"`
+}
+
+// FormatError reports an archive that can't be imported.
+type FormatError struct {
+	Line int
+	Err  string
+}
+
+func (e *FormatError) Error() string {
+	return fmt.Sprintf("archive line %d: %s", e.Line, e.Err)
+}
+
+// Export writes a channel and its stored messages to w as JSON Lines. Messages still in
+// the cache are not included, so callers flush it first.
+func Export(pool *pgxpool.Pool, channel models.Channel, w io.Writer) (int, error) {
+	encoder := json.NewEncoder(w)
+
+	err := encoder.Encode(ChannelRecord{
+		Type:        TypeChannel,
+		Version:     Version,
+		Name:        channel.Name,
+		Description: channel.Description,
+		Language:    channel.Language,
+		ExportedAt:  time.Now().UTC(),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	err = db.StreamChannelMessages(pool, channel.Name, func(msg models.ChatMessage) error {
+		count++
+		return encoder.Encode(MessageRecord{
+			Type:       TypeMessage,
+			CacheID:    msg.CacheID,
+			OwnerID:    msg.OwnerID,
+			Username:   msg.Username,
+			Message:    msg.Message,
+			AuthoredAt: msg.Sent,
+			ReplyTo:    msg.ReplyTo,
+		})
+	})
+	if err != nil {
+		return count, err
+	}
+
+	return count, encoder.Encode(EndRecord{Type: TypeEnd, MessageCount: count})
+}
+
+// ImportOptions controls how an archive is imported.
+type ImportOptions struct {
+	Name       string            // Replaces the archived channel name when set
+	Users      map[string]string // Source user IDs mapped to this server's
+	Strict     bool              // Fail on authors missing from Users instead of keeping their IDs
+	ImportedBy string            // Owner of the created channel
+}
+
+// ImportResult describes an imported channel.
+type ImportResult struct {
+	Channel       models.Channel `json:"channel"`
+	Messages      int            `json:"messages"`
+	UnmappedUsers []string       `json:"unmapped_users,omitempty"` // Authors kept under their source IDs
+}
+
+// Import recreates an archived channel with its messages, keeping their authored_at times.
+// Authors are mapped through opts.Users and messages get fresh cacheIDs reserved from the
+// cache's counter; replies follow their parents to the new IDs and lose their parent if it
+// is not in the archive. The archive is read and stored batch by batch in one transaction.
+// It returns a *FormatError for malformed archives, and db.ErrChannelExists or
+// db.ErrUnknownLanguage.
+func Import(pool *pgxpool.Pool, messageCache *cache.MessageCache, r io.Reader, opts ImportOptions) (ImportResult, error) {
+	var result ImportResult
+	decoder := json.NewDecoder(r)
+	line := 0
+
+	// readRecord decodes the next line and returns its type
+	var raw json.RawMessage
+	readRecord := func() (string, error) {
+		line++
+		raw = nil
+		if err := decoder.Decode(&raw); err != nil {
+			if errors.Is(err, io.EOF) {
+				return "", &FormatError{line, "archive ends without an end record"}
+			}
+			return "", &FormatError{line, err.Error()}
+		}
+		var header struct {
+			Type string `json:"type"`
+		}
+		if err := json.Unmarshal(raw, &header); err != nil {
+			return "", &FormatError{line, err.Error()}
+		}
+		return header.Type, nil
+	}
+
+	recordType, err := readRecord()
+	if err != nil {
+		return result, err
+	}
+	var header ChannelRecord
+	if recordType != TypeChannel || json.Unmarshal(raw, &header) != nil {
+		return result, &FormatError{line, "archive must start with a channel record"}
+	}
+	if header.Version != Version {
+		return result, &FormatError{line, fmt.Sprintf("unsupported archive version %d", header.Version)}
+	}
+	if opts.Name != "" {
+		header.Name = opts.Name
+	}
+	if header.Name == "" || utf8.RuneCountInString(header.Name) > maxChannelName {
+		return result, &FormatError{line, "channel name must be between 1 and 24 characters"}
+	}
+	if header.Language == "" {
+		header.Language = "english"
+	}
+
+	floor, err := db.MaxChatCacheID(pool)
+	if err != nil {
+		return result, err
+	}
+
+	cacheIDs := make(map[int]int) // Source cacheIDs to new ones, for replies
+	unmapped := make(map[string]bool)
+	done := false
+
+	next := func() ([]models.ChatMessage, error) {
+		var batch []models.ChatMessage
+		for !done && len(batch) < batchSize {
+			recordType, err := readRecord()
+			if err != nil {
+				return nil, err
+			}
+
+			switch recordType {
+			case TypeMessage:
+				var record MessageRecord
+				if err := json.Unmarshal(raw, &record); err != nil {
+					return nil, &FormatError{line, err.Error()}
+				}
+				if record.OwnerID == "" || record.AuthoredAt.IsZero() {
+					return nil, &FormatError{line, "message needs an owner_id and authored_at"}
+				}
+
+				ownerID, ok := opts.Users[record.OwnerID]
+				if !ok {
+					if opts.Strict {
+						return nil, &FormatError{line, fmt.Sprintf("user %s is not mapped", record.OwnerID)}
+					}
+					ownerID = record.OwnerID
+					unmapped[record.OwnerID] = true
+				}
+
+				batch = append(batch, models.ChatMessage{
+					CacheID: record.CacheID, // Replaced below
+					OwnerID: ownerID,
+					Message: record.Message,
+					Sent:    record.AuthoredAt,
+					ReplyTo: record.ReplyTo,
+				})
+
+			case TypeEnd:
+				var record EndRecord
+				if err := json.Unmarshal(raw, &record); err != nil {
+					return nil, &FormatError{line, err.Error()}
+				}
+				if record.MessageCount != result.Messages+len(batch) {
+					return nil, &FormatError{line, fmt.Sprintf("archive holds %d messages but its end record counts %d",
+						result.Messages+len(batch), record.MessageCount)}
+				}
+				done = true
+
+			default:
+				return nil, &FormatError{line, fmt.Sprintf("unexpected %q record", recordType)}
+			}
+		}
+		if len(batch) == 0 {
+			return nil, nil
+		}
+
+		first, err := messageCache.ReserveChatCacheIDs(len(batch), floor)
+		if err != nil {
+			return nil, err
+		}
+		for i := range batch {
+			sourceID := batch[i].CacheID
+			batch[i].CacheID = first + i
+			batch[i].ReplyTo = cacheIDs[batch[i].ReplyTo] // 0 when the parent is not in the archive
+			if sourceID != 0 {
+				cacheIDs[sourceID] = batch[i].CacheID
+			}
+		}
+		result.Messages += len(batch)
+		return batch, nil
+	}
+
+	channel, imported, err := db.ImportChannel(pool, models.Channel{
+		Name:        header.Name,
+		Description: header.Description,
+		Language:    header.Language,
+	}, opts.ImportedBy, next)
+	if err != nil {
+		return result, err
+	}
+
+	result.Channel, result.Messages = channel, imported
+	for userID := range unmapped {
+		result.UnmappedUsers = append(result.UnmappedUsers, userID)
+	}
+	sort.Strings(result.UnmappedUsers)
+	return result, nil
+}
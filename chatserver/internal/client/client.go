@@ -1,17 +1,25 @@
 package client
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"errors"
 	"log"
+	"sync/atomic"
 	"time"
 
 	"onrabble.com/chatserver/internal/interfaces"
 	"onrabble.com/chatserver/internal/messages"
 	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
 
 	"github.com/gorilla/websocket"
 )
 
+// maxStatusExpiry caps how far ahead a custom status may be set to expire.
+const maxStatusExpiry = 30 * 24 * time.Hour
+
 // Client represents a single WebSocket connection from a user.
 // It manages receiving and sending messages to/from the server.
 type Client struct {
@@ -21,7 +29,10 @@ type Client struct {
 	Hub         interfaces.HubInterface
 	Sub         string // Keycloak stable user ID
 	ClientID    string // OAuth client ID, e.g., "ChatClient" or "WebClient"
+	ConnID      string // Unique to this connection, see NewConnectionID
+	Moderator   bool   // The token carried the moderator realm role
 	ConnectedAt time.Time
+	lastActive  atomic.Int64 // Unix nanoseconds of the last inbound message
 }
 
 // GetUsername returns the client's username.
@@ -30,7 +41,14 @@ func (c *Client) GetUsername() string {
 }
 
 // SendMessage places a message into the send channel to be picked up by WritePump().
+// The hub may still hold the client for a moment after it unregisters, so a send on the
+// closed channel is dropped rather than panicking.
 func (c *Client) SendMessage(msg messages.BaseMessage) {
+	defer func() {
+		if r := recover(); r != nil {
+			log.Printf("Dropped message for closed connection %s", c.ConnID)
+		}
+	}()
 	c.Send <- msg
 }
 
@@ -44,6 +62,21 @@ func (c *Client) GetID() string {
 	return c.Sub
 }
 
+// NewConnectionID returns a random ID identifying a single connection.
+func NewConnectionID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return hex.EncodeToString(b)
+}
+
+// GetConnectionID returns the ID unique to this connection.
+func (c *Client) GetConnectionID() string {
+	return c.ConnID
+}
+
 // GetClientID returns the OAuth client ID used to identify the source application.
 func (c *Client) GetClientID() string {
 	return c.ClientID
@@ -52,6 +85,7 @@ func (c *Client) GetClientID() string {
 // StartConnectionTimer records the time when the client connects.
 func (c *Client) StartConnectionTimer() {
 	c.ConnectedAt = time.Now()
+	c.lastActive.Store(c.ConnectedAt.UnixNano())
 }
 
 // GetConnectedAt returns the timestamp when the client connected.
@@ -59,11 +93,21 @@ func (c *Client) GetConnectedAt() time.Time {
 	return c.ConnectedAt
 }
 
+// GetLastActive returns when the client last sent a message.
+func (c *Client) GetLastActive() time.Time {
+	return time.Unix(0, c.lastActive.Load())
+}
+
+// IsModerator reports whether the client connected with the moderator realm role.
+func (c *Client) IsModerator() bool {
+	return c.Moderator
+}
+
 // ReadPump listens for incoming messages from the WebSocket and processes them.
 // Parsed messages are sent to the hub for broadcast or private delivery.
 func (c *Client) ReadPump() {
 	defer func() {
-		c.Hub.UnregisterClient(c, c.ClientID)
+		c.Hub.UnregisterClient(c)
 		c.Conn.Close()
 	}()
 
@@ -77,13 +121,30 @@ func (c *Client) ReadPump() {
 			}
 			break
 		}
+		c.lastActive.Store(time.Now().UnixNano())
 
 		// Unmarshal the JSON message into a struct
 		var receivedMessage struct {
-			Type        string `json:"type"`
-			Channel     string `json:"channel,omitempty"`
-			RecipientID string `json:"recipient_id,omitempty"`
-			Message     string `json:"message"`
+			Type        string   `json:"type"`
+			Channel     string   `json:"channel,omitempty"`
+			RecipientID string   `json:"recipient_id,omitempty"`
+			Message     string   `json:"message"`
+			Before      int      `json:"before,omitempty"`  // cacheID to page back from in history requests
+			Cursor      string   `json:"cursor,omitempty"`  // Page token for private history requests
+			CacheID     int      `json:"cacheID,omitempty"` // Newest message read in mark_read requests, thread parent in thread requests
+			Limit       int      `json:"limit,omitempty"`
+			State       string   `json:"state,omitempty"`       // Presence chosen in set_presence requests
+			StatusText  string   `json:"status_text,omitempty"` // Custom status in set_presence requests
+			ExpiresIn   int      `json:"expires_in,omitempty"`  // Seconds until the custom status is cleared
+			Target      string   `json:"target,omitempty"`      // "chat" or "private" in reaction requests
+			MessageID   int      `json:"message_id,omitempty"`  // Stored message ID, accepted in place of cacheID
+			Emoji       string   `json:"emoji,omitempty"`
+			ReplyTo     int      `json:"reply_to,omitempty"`    // cacheID of the thread parent in chat_message requests
+			ReplyToID   int      `json:"reply_to_id,omitempty"` // Parent's database ID, accepted in place of reply_to
+			Attachments []string `json:"attachments,omitempty"` // IDs of uploads sent with chat and private messages
+			UserID      string   `json:"user_id,omitempty"`     // Reported user in report_user requests
+			Reason      string   `json:"reason,omitempty"`      // Category of report_message and report_user requests
+			Details     string   `json:"details,omitempty"`     // Reporter's explanation
 		}
 		if err := json.Unmarshal(p, &receivedMessage); err != nil {
 			log.Printf("Invalid message from %s: %v", c.Username, err)
@@ -97,13 +158,94 @@ func (c *Client) ReadPump() {
 		// Process received message
 		if receivedMessage.Type == chat.ChatMessageType {
 			msg = chat.NewChatMessage(c.Sub, c.Username, receivedMessage.Channel, receivedMessage.Message, time.Now())
+			payload := msg.Payload.(models.ChatMessage)
+			payload.ReplyTo = receivedMessage.ReplyTo
+			payload.ReplyToID = receivedMessage.ReplyToID
+			payload.Attachments = attachmentRefs(receivedMessage.Attachments)
+			msg.Payload = payload
 		} else if receivedMessage.Type == chat.PrivateChatMessageType {
-			username, ok := c.Hub.FindUsernameByUserID(receivedMessage.RecipientID)
+			// Recipients may be offline; they receive the message from the cache on their next connect
+			username, ok := c.Hub.LookupUsername(receivedMessage.RecipientID)
 			if ok {
 				msg = chat.NewPrivateChatMessage(c.Sub, c.Username, receivedMessage.RecipientID, username, receivedMessage.Message, time.Now())
+				payload := msg.Payload.(models.PrivateChatMessage)
+				payload.Attachments = attachmentRefs(receivedMessage.Attachments)
+				msg.Payload = payload
 			} else {
+				log.Printf("Dropping private message from %s to unknown user %s", c.Username, receivedMessage.RecipientID)
 				continue
 			}
+		} else if receivedMessage.Type == chat.HistoryMessageType {
+			// History is answered directly to this client rather than routed through the hub
+			history, hasMore := c.Hub.GetChannelHistory(receivedMessage.Channel, receivedMessage.Before, receivedMessage.Limit)
+			c.SendMessage(chat.NewHistoryMessage(receivedMessage.Channel, history, hasMore))
+			continue
+		} else if receivedMessage.Type == chat.TypingStartMessageType || receivedMessage.Type == chat.TypingStopMessageType {
+			msg = chat.NewTypingMessage(receivedMessage.Type, c.Sub, c.Username, receivedMessage.Channel, receivedMessage.RecipientID)
+		} else if receivedMessage.Type == chat.SetPresenceMessageType {
+			presence := models.Presence{State: receivedMessage.State, StatusText: receivedMessage.StatusText}
+			if receivedMessage.ExpiresIn > 0 {
+				expiresIn := maxStatusExpiry
+				if receivedMessage.ExpiresIn < int(maxStatusExpiry/time.Second) {
+					expiresIn = time.Duration(receivedMessage.ExpiresIn) * time.Second
+				}
+				expiresAt := time.Now().Add(expiresIn)
+				presence.StatusExpiresAt = &expiresAt
+			}
+			msg = chat.NewSetPresenceMessage(c.Sub, c.Username, presence)
+		} else if receivedMessage.Type == chat.AddReactionMessageType || receivedMessage.Type == chat.RemoveReactionMessageType {
+			msg = chat.NewReactionMessage(receivedMessage.Type, c.Username, models.Reaction{
+				Target:    receivedMessage.Target,
+				CacheID:   receivedMessage.CacheID,
+				MessageID: receivedMessage.MessageID,
+				UserID:    c.Sub,
+				Emoji:     receivedMessage.Emoji,
+			})
+		} else if receivedMessage.Type == chat.MarkReadMessageType {
+			msg = chat.NewMarkReadMessage(c.Username, models.ReadMarker{
+				UserID:  c.Sub,
+				Channel: receivedMessage.Channel,
+				PeerID:  receivedMessage.RecipientID,
+				CacheID: receivedMessage.CacheID,
+			})
+		} else if receivedMessage.Type == chat.ConversationsMessageType {
+			c.SendMessage(chat.NewConversationsMessage(c.Hub.GetConversations(c.Sub)))
+			continue
+		} else if receivedMessage.Type == chat.PrivateHistoryMessageType {
+			// Private history is always scoped to the authenticated user's own conversations
+			history, hasMore, nextCursor := c.Hub.GetPrivateHistory(c.Sub, receivedMessage.RecipientID, receivedMessage.Cursor, receivedMessage.Limit)
+			c.SendMessage(chat.NewPrivateHistoryMessage(receivedMessage.RecipientID, history, hasMore, nextCursor))
+			continue
+		} else if receivedMessage.Type == chat.OpenThreadMessageType {
+			// Opening a thread also subscribes this connection to its new replies
+			parent, replies, hasMore, ok := c.Hub.OpenThread(c, receivedMessage.CacheID, receivedMessage.Before, receivedMessage.Limit)
+			if ok {
+				c.SendMessage(chat.NewThreadMessage(parent, replies, hasMore))
+			} else {
+				log.Printf("%s tried to open unknown thread %d", c.Username, receivedMessage.CacheID)
+			}
+			continue
+		} else if receivedMessage.Type == chat.CloseThreadMessageType {
+			c.Hub.CloseThread(c, receivedMessage.CacheID)
+			continue
+		} else if receivedMessage.Type == chat.ReportMessageMessageType || receivedMessage.Type == chat.ReportUserMessageType {
+			// Reports are answered directly to this client; moderators review them over REST
+			report := models.Report{
+				ReporterID:       c.Sub,
+				ReporterUsername: c.Username,
+				Kind:             models.ReportUser,
+				ReportedUserID:   receivedMessage.UserID,
+				Reason:           receivedMessage.Reason,
+				Details:          receivedMessage.Details,
+			}
+			if receivedMessage.Type == chat.ReportMessageMessageType {
+				report.Kind = models.ReportMessage
+				report.Target = receivedMessage.Target
+				report.CacheID = receivedMessage.CacheID
+				report.MessageID = receivedMessage.MessageID
+			}
+			c.SendMessage(chat.NewReportResultMessage(reportResult(c.Hub.FileReport(report))))
+			continue
 		}
 		log.Printf("Message received from %s", c.Username)
 
@@ -112,6 +254,31 @@ func (c *Client) ReadPump() {
 	}
 }
 
+// attachmentRefs turns the attachment IDs sent with a message into references for the
+// hub to resolve.
+func attachmentRefs(ids []string) []models.Attachment {
+	if len(ids) == 0 {
+		return nil
+	}
+	refs := make([]models.Attachment, len(ids))
+	for i, id := range ids {
+		refs[i] = models.Attachment{ID: id}
+	}
+	return refs
+}
+
+// reportResult describes the outcome of filing a report for the reporter.
+func reportResult(report models.Report, created bool, err error) chat.ReportResultPayload {
+	switch {
+	case errors.Is(err, models.ErrInvalidReport), errors.Is(err, models.ErrReportTargetNotFound):
+		return chat.ReportResultPayload{Error: err.Error()}
+	case err != nil:
+		log.Printf("Failed to file report from %s: %v", report.ReporterUsername, err)
+		return chat.ReportResultPayload{Error: "The report could not be filed"}
+	}
+	return chat.ReportResultPayload{ReportID: report.ID, Status: report.Status, Duplicate: !created}
+}
+
 // WritePump listens for messages on the send channel and writes them to the WebSocket.
 // It ensures that outgoing messages are sent asynchronously.
 func (c *Client) WritePump() {
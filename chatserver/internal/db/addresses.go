@@ -0,0 +1,150 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// RecordUserAddress notes that a user connected from an address and, if not empty, a device.
+func RecordUserAddress(db *pgxpool.Pool, userID, ip, deviceID string) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO chatserver.user_addresses (user_id, ip, device_id)
+		VALUES ($1, $2::inet, $3)
+		ON CONFLICT (user_id, ip, device_id) DO UPDATE SET last_seen = now()
+	`, userID, ip, deviceID)
+	if err != nil {
+		return fmt.Errorf("failed to record address of %s: %w", userID, err)
+	}
+	return nil
+}
+
+// LastUserAddress returns the address and device a user most recently connected from. The
+// device is empty if that connection sent none.
+func LastUserAddress(db *pgxpool.Pool, userID string) (ip, deviceID string, found bool, err error) {
+	err = db.QueryRow(context.Background(), `
+		SELECT host(ip), device_id
+		FROM chatserver.user_addresses
+		WHERE user_id = $1
+		ORDER BY last_seen DESC
+		LIMIT 1
+	`, userID).Scan(&ip, &deviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", "", false, nil
+	}
+	if err != nil {
+		return "", "", false, fmt.Errorf("failed to look up last address of %s: %w", userID, err)
+	}
+	return ip, deviceID, true, nil
+}
+
+// DetectBanEvasion flags the user if their Keycloak account was created after an active ban
+// started and they are connecting from an address or device the banned user has used. Each ban is flagged
+// once per user. It returns the new flags.
+func DetectBanEvasion(db *pgxpool.Pool, userID, username, ip, deviceID string) ([]models.BanEvasion, error) {
+	rows, err := db.Query(context.Background(), `
+		INSERT INTO chatserver.ban_evasions (user_id, username, ban_id, banished_id, ip, device_id)
+		SELECT DISTINCT ON (b.id) $1, $2, b.id, b.banished_id,
+			CASE WHEN a.ip = $3::inet THEN a.ip END,
+			CASE WHEN a.device_id = $4 AND a.device_id <> '' THEN a.device_id END
+		FROM chatserver.bans b
+		JOIN chatserver.user_addresses a ON a.user_id = b.banished_id
+		JOIN keycloak.public.user_entity u ON u.id = $1
+		WHERE b.banished_id <> $1
+			AND (b.end_time IS NULL OR b.end_time > NOW())
+			AND (b.pardoned IS NULL OR b.pardoned = FALSE)
+			AND (a.ip = $3::inet OR (a.device_id = $4 AND a.device_id <> ''))
+			-- Ban times are stored in UTC without a zone
+			AND to_timestamp(u.created_timestamp / 1000.0) AT TIME ZONE 'UTC' >= b.start_time
+		ORDER BY b.id
+		ON CONFLICT (user_id, ban_id) DO NOTHING
+		RETURNING id, user_id, username, ban_id, banished_id, COALESCE(host(ip), ''), COALESCE(device_id, ''),
+			dismissed, created_at
+	`, userID, username, ip, deviceID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check %s for ban evasion: %w", userID, err)
+	}
+	defer rows.Close()
+
+	var evasions []models.BanEvasion
+	for rows.Next() {
+		evasion, err := scanBanEvasion(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan ban evasion: %w", err)
+		}
+		evasions = append(evasions, evasion)
+	}
+	return evasions, rows.Err()
+}
+
+func scanBanEvasion(row pgx.Row) (models.BanEvasion, error) {
+	var e models.BanEvasion
+	err := row.Scan(&e.ID, &e.UserID, &e.Username, &e.BanID, &e.BanishedID, &e.IP, &e.DeviceID,
+		&e.Dismissed, &e.CreatedAt)
+	return e, err
+}
+
+// FetchBanEvasions retrieves suspected ban evasions newest first, leaving out dismissed ones
+// unless all is set.
+// It returns:
+//  1. A slice of BanEvasion objects
+//  2. PageInfo describing whether more evasions exist and the cursors around this page
+//  3. An error, if any
+func FetchBanEvasions(db *pgxpool.Pool, all bool, page PageRequest) ([]models.BanEvasion, PageInfo, error) {
+	var conditions []string
+	if !all {
+		conditions = append(conditions, "dismissed = FALSE")
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, nil)
+
+	query := `SELECT id, user_id, username, ban_id, banished_id, COALESCE(host(ip), ''), COALESCE(device_id, ''),
+		dismissed, created_at
+		FROM chatserver.ban_evasions`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch ban evasions: %w", err)
+	}
+	defer rows.Close()
+
+	evasions := []models.BanEvasion{}
+	for rows.Next() {
+		evasion, err := scanBanEvasion(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan ban evasion: %w", err)
+		}
+		evasions = append(evasions, evasion)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over ban evasion rows: %w", err)
+	}
+
+	evasions, info := finishPage(evasions, page, func(evasion models.BanEvasion) Cursor {
+		return Cursor{At: evasion.CreatedAt, ID: strconv.Itoa(evasion.ID)}
+	})
+	return evasions, info, nil
+}
+
+// DismissBanEvasion marks a suspected evasion as reviewed. It returns false if it does not
+// exist or was already dismissed.
+func DismissBanEvasion(db *pgxpool.Pool, id int) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `
+		UPDATE chatserver.ban_evasions SET dismissed = TRUE WHERE id = $1 AND dismissed = FALSE
+	`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to dismiss ban evasion %d: %w", id, err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
@@ -0,0 +1,146 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// appealColumns lists the columns scanned by scanAppeal.
+const appealColumns = `id, ban_id, user_id, username, message, status, decided_by, decision_note, decided_at, created_at`
+
+func scanAppeal(row pgx.Row) (models.Appeal, error) {
+	var a models.Appeal
+	err := row.Scan(&a.ID, &a.BanID, &a.UserID, &a.Username, &a.Message, &a.Status, &a.DecidedBy,
+		&a.DecisionNote, &a.DecidedAt, &a.CreatedAt)
+	return a, err
+}
+
+// SaveAppeal files an appeal against a ban. It returns false if the ban was already
+// appealed.
+func SaveAppeal(db *pgxpool.Pool, appeal models.Appeal) (models.Appeal, bool, error) {
+	saved, err := scanAppeal(db.QueryRow(context.Background(), `
+		INSERT INTO chatserver.appeals (ban_id, user_id, username, message)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (ban_id) DO NOTHING
+		RETURNING `+appealColumns,
+		appeal.BanID, appeal.UserID, appeal.Username, appeal.Message))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return saved, false, nil
+	}
+	if err != nil {
+		return saved, false, fmt.Errorf("failed to save appeal: %w", err)
+	}
+	return saved, true, nil
+}
+
+// FindAppealByBan returns the appeal against the given ban, if any.
+func FindAppealByBan(db *pgxpool.Pool, banID int) (models.Appeal, bool, error) {
+	appeal, err := scanAppeal(db.QueryRow(context.Background(),
+		`SELECT `+appealColumns+` FROM chatserver.appeals WHERE ban_id = $1`, banID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return appeal, false, nil
+	}
+	if err != nil {
+		return appeal, false, fmt.Errorf("failed to look up appeal of ban %d: %w", banID, err)
+	}
+	return appeal, true, nil
+}
+
+// FetchAppeals retrieves appeals newest first, optionally only one user's or only those
+// with the given status.
+// It returns:
+//  1. A slice of Appeal objects
+//  2. PageInfo describing whether more appeals exist and the cursors around this page
+//  3. An error, if any
+func FetchAppeals(db *pgxpool.Pool, userID, status string, page PageRequest) ([]models.Appeal, PageInfo, error) {
+	var conditions []string
+	var args []interface{}
+	if userID != "" {
+		args = append(args, userID)
+		conditions = append(conditions, fmt.Sprintf("user_id = $%d", len(args)))
+	}
+	if status != "" {
+		args = append(args, status)
+		conditions = append(conditions, fmt.Sprintf("status = $%d", len(args)))
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, args)
+
+	query := `SELECT ` + appealColumns + ` FROM chatserver.appeals`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch appeals: %w", err)
+	}
+	defer rows.Close()
+
+	appeals := []models.Appeal{}
+	for rows.Next() {
+		appeal, err := scanAppeal(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan appeal: %w", err)
+		}
+		appeals = append(appeals, appeal)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over appeal rows: %w", err)
+	}
+
+	appeals, info := finishPage(appeals, page, func(appeal models.Appeal) Cursor {
+		return Cursor{At: appeal.CreatedAt, ID: strconv.Itoa(appeal.ID)}
+	})
+	return appeals, info, nil
+}
+
+// DecideAppeal approves or denies a pending appeal. Approving it pardons the ban in the same
+// transaction, recording the moderator and the appeal on the ban. It returns false if the
+// appeal does not exist or was already decided.
+func DecideAppeal(db *pgxpool.Pool, id int, moderatorID, status, note string) (models.Appeal, bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return models.Appeal{}, false, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	appeal, err := scanAppeal(tx.QueryRow(ctx, `
+		UPDATE chatserver.appeals
+		SET status = $2, decided_by = $3, decision_note = $4, decided_at = now()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+appealColumns, id, status, moderatorID, note))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return appeal, false, nil
+	}
+	if err != nil {
+		return appeal, false, fmt.Errorf("failed to decide appeal %d: %w", id, err)
+	}
+
+	if status == models.AppealApproved {
+		_, err := tx.Exec(ctx, `
+			UPDATE chatserver.bans
+			SET pardoned = TRUE, pardoned_at = now(), pardoned_by = $2, appeal_id = $3
+			WHERE id = $1
+		`, appeal.BanID, moderatorID, appeal.ID)
+		if err != nil {
+			return appeal, false, fmt.Errorf("failed to pardon ban %d: %w", appeal.BanID, err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return appeal, false, fmt.Errorf("failed to commit appeal %d: %w", id, err)
+	}
+	return appeal, true, nil
+}
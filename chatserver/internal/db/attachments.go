@@ -0,0 +1,196 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// attachmentColumns lists the columns scanned by scanAttachment.
+const attachmentColumns = `id, owner_id, filename, content_type, size_bytes, COALESCE(width, 0), COALESCE(height, 0),
+	storage_key, COALESCE(thumbnail_key, ''), COALESCE(target, ''), COALESCE(cache_id, 0),
+	COALESCE(channel, ''), COALESCE(recipient_id, ''), created_at`
+
+func scanAttachment(row pgx.Row) (models.Attachment, error) {
+	var a models.Attachment
+	err := row.Scan(&a.ID, &a.OwnerID, &a.Filename, &a.ContentType, &a.Size, &a.Width, &a.Height,
+		&a.StorageKey, &a.ThumbnailKey, &a.Target, &a.CacheID, &a.Channel, &a.RecipientID, &a.CreatedAt)
+	a.HasThumbnail = a.ThumbnailKey != ""
+	return a, err
+}
+
+// SaveAttachment records a newly uploaded attachment that has not been sent yet.
+func SaveAttachment(db *pgxpool.Pool, a models.Attachment) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO chatserver.attachments
+			(id, owner_id, filename, content_type, size_bytes, width, height, storage_key, thumbnail_key, created_at)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, 0), $8, NULLIF($9, ''), $10)
+	`, a.ID, a.OwnerID, a.Filename, a.ContentType, a.Size, a.Width, a.Height, a.StorageKey, a.ThumbnailKey, a.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save attachment: %w", err)
+	}
+	return nil
+}
+
+// FindAttachment returns the attachment with the given ID.
+func FindAttachment(db *pgxpool.Pool, id string) (models.Attachment, bool, error) {
+	a, err := scanAttachment(db.QueryRow(context.Background(),
+		`SELECT `+attachmentColumns+` FROM chatserver.attachments WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return a, false, nil
+	}
+	if err != nil {
+		return a, false, fmt.Errorf("failed to look up attachment %s: %w", id, err)
+	}
+	return a, true, nil
+}
+
+// FetchUnsentAttachments returns the attachments among ids that the owner uploaded and has
+// not sent yet, in the order of ids. Unknown, foreign and already sent IDs are skipped.
+func FetchUnsentAttachments(db *pgxpool.Pool, ownerID string, ids []string) ([]models.Attachment, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT `+attachmentColumns+`
+		FROM chatserver.attachments
+		WHERE id::TEXT = ANY($1) AND owner_id = $2 AND cache_id IS NULL
+		ORDER BY array_position($1, id::TEXT)
+	`, ids, ownerID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// LinkAttachments marks unsent attachments as sent with a message, which makes them visible
+// to the message's audience. It returns how many were linked.
+func LinkAttachments(db *pgxpool.Pool, ids []string, target string, cacheID int, channel, recipientID string) (int64, error) {
+	cmd, err := db.Exec(context.Background(), `
+		UPDATE chatserver.attachments
+		SET target = $2, cache_id = $3, channel = NULLIF($4, ''), recipient_id = NULLIF($5, '')
+		WHERE id::TEXT = ANY($1) AND cache_id IS NULL
+	`, ids, target, cacheID, channel, recipientID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to link attachments: %w", err)
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// unlinkAttachmentsQuery detaches the attachments of deleted messages so they are removed
+// from storage by the next sweep.
+const unlinkAttachmentsQuery = `
+	UPDATE chatserver.attachments
+	SET target = NULL, cache_id = NULL, channel = NULL, recipient_id = NULL, created_at = to_timestamp(0)
+`
+
+// FetchAttachments returns the attachments sent with the given messages of one target kind,
+// keyed by cacheID and in upload order.
+func FetchAttachments(db *pgxpool.Pool, target string, cacheIDs []int) (map[int][]models.Attachment, error) {
+	attachments := make(map[int][]models.Attachment)
+	if len(cacheIDs) == 0 {
+		return attachments, nil
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT `+attachmentColumns+`
+		FROM chatserver.attachments
+		WHERE target = $1 AND cache_id = ANY($2)
+		ORDER BY cache_id, created_at, id
+	`, target, cacheIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch attachments: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments[a.CacheID] = append(attachments[a.CacheID], a)
+	}
+	return attachments, rows.Err()
+}
+
+// AttachChatAttachments fills in the attachments of each public message.
+func AttachChatAttachments(db *pgxpool.Pool, msgs []models.ChatMessage) error {
+	cacheIDs := make([]int, len(msgs))
+	for i, msg := range msgs {
+		cacheIDs[i] = msg.CacheID
+	}
+
+	attachments, err := FetchAttachments(db, models.ReactionTargetChat, cacheIDs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].Attachments = attachments[msgs[i].CacheID]
+	}
+	return nil
+}
+
+// AttachPrivateAttachments fills in the attachments of each private message.
+func AttachPrivateAttachments(db *pgxpool.Pool, msgs []models.PrivateChatMessage) error {
+	cacheIDs := make([]int, len(msgs))
+	for i, msg := range msgs {
+		cacheIDs[i] = msg.CacheID
+	}
+
+	attachments, err := FetchAttachments(db, models.ReactionTargetPrivate, cacheIDs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].Attachments = attachments[msgs[i].CacheID]
+	}
+	return nil
+}
+
+// FetchStaleAttachments returns up to limit attachments that were never sent, or whose
+// message was deleted, and were uploaded before the cutoff.
+func FetchStaleAttachments(db *pgxpool.Pool, before time.Time, limit int) ([]models.Attachment, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT `+attachmentColumns+`
+		FROM chatserver.attachments
+		WHERE cache_id IS NULL AND created_at < $1
+		ORDER BY created_at
+		LIMIT $2
+	`, before, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch stale attachments: %w", err)
+	}
+	defer rows.Close()
+
+	var attachments []models.Attachment
+	for rows.Next() {
+		a, err := scanAttachment(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan attachment: %w", err)
+		}
+		attachments = append(attachments, a)
+	}
+	return attachments, rows.Err()
+}
+
+// DeleteAttachment removes an attachment's record. Its blobs must be deleted separately.
+func DeleteAttachment(db *pgxpool.Pool, id string) error {
+	_, err := db.Exec(context.Background(), `DELETE FROM chatserver.attachments WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete attachment %s: %w", id, err)
+	}
+	return nil
+}
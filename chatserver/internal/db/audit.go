@@ -0,0 +1,92 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// auditColumns lists the columns scanned by scanAuditEntry.
+const auditColumns = `id, COALESCE(actor_id, ''), COALESCE(actor_username, ''), COALESCE(client_id, ''), action, target,
+	details, created_at`
+
+func scanAuditEntry(row pgx.Row) (models.AuditEntry, error) {
+	var e models.AuditEntry
+	var details []byte
+	err := row.Scan(&e.ID, &e.ActorID, &e.ActorUsername, &e.ClientID, &e.Action, &e.Target, &details, &e.CreatedAt)
+	if string(details) != "{}" {
+		e.Details = details
+	}
+	return e, err
+}
+
+// RecordAudit appends an entry to the audit log. details is stored as JSON and may be nil.
+func RecordAudit(db *pgxpool.Pool, entry models.AuditEntry, details any) error {
+	encoded := []byte("{}")
+	if details != nil {
+		var err error
+		if encoded, err = json.Marshal(details); err != nil {
+			return fmt.Errorf("failed to encode audit details: %w", err)
+		}
+	}
+
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO chatserver.audit_log (actor_id, actor_username, client_id, action, target, details)
+		VALUES (NULLIF($1, ''), NULLIF($2, ''), NULLIF($3, ''), $4, $5, $6::JSONB)
+	`, entry.ActorID, entry.ActorUsername, entry.ClientID, entry.Action, entry.Target, string(encoded))
+	if err != nil {
+		return fmt.Errorf("failed to record %s: %w", entry.Action, err)
+	}
+	return nil
+}
+
+// FetchAuditLog returns audit entries newest first, optionally filtered by actor, action and
+// target.
+func FetchAuditLog(db *pgxpool.Pool, actorID, action, target string, page PageRequest) ([]models.AuditEntry, PageInfo, error) {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range [][2]string{{"actor_id", actorID}, {"action", action}, {"target", target}} {
+		if filter[1] != "" {
+			args = append(args, filter[1])
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter[0], len(args)))
+		}
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, args)
+
+	query := `SELECT ` + auditColumns + ` FROM chatserver.audit_log`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch audit log: %w", err)
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		entry, err := scanAuditEntry(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan audit entry: %w", err)
+		}
+		entries = append(entries, entry)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over audit log rows: %w", err)
+	}
+
+	entries, info := finishPage(entries, page, func(entry models.AuditEntry) Cursor {
+		return Cursor{At: entry.CreatedAt, ID: strconv.Itoa(entry.ID)}
+	})
+	return entries, info, nil
+}
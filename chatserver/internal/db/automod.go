@@ -0,0 +1,264 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// automodRuleColumns lists the columns scanned by scanAutomodRule.
+const automodRuleColumns = `id, name, type, words, pattern, max_count, ratio, window_seconds, channels,
+	action, mute_seconds, enabled, created_by, created_at, updated_at`
+
+func scanAutomodRule(row pgx.Row) (models.AutomodRule, error) {
+	var r models.AutomodRule
+	err := row.Scan(&r.ID, &r.Name, &r.Type, &r.Words, &r.Pattern, &r.Limit, &r.Ratio, &r.WindowSeconds,
+		&r.Channels, &r.Action, &r.MuteSeconds, &r.Enabled, &r.CreatedBy, &r.CreatedAt, &r.UpdatedAt)
+	return r, err
+}
+
+// automodFlagColumns lists the columns scanned by scanAutomodFlag.
+const automodFlagColumns = `id, rule_id, rule_name, reason, target, cache_id, COALESCE(channel, ''),
+	COALESCE(recipient_id, ''), owner_id, username, message, status, created_at, reviewed_by, reviewed_at`
+
+func scanAutomodFlag(row pgx.Row) (models.AutomodFlag, error) {
+	var f models.AutomodFlag
+	err := row.Scan(&f.ID, &f.RuleID, &f.RuleName, &f.Reason, &f.Target, &f.CacheID, &f.Channel,
+		&f.RecipientID, &f.OwnerID, &f.Username, &f.Message, &f.Status, &f.CreatedAt, &f.ReviewedBy, &f.ReviewedAt)
+	return f, err
+}
+
+// nonNil keeps empty lists from being stored as NULL.
+func nonNil(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// FetchAutomodRules returns every automod rule, oldest first.
+func FetchAutomodRules(db *pgxpool.Pool) ([]models.AutomodRule, error) {
+	rows, err := db.Query(context.Background(),
+		`SELECT `+automodRuleColumns+` FROM chatserver.automod_rules ORDER BY id`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch automod rules: %w", err)
+	}
+	defer rows.Close()
+
+	rules := []models.AutomodRule{}
+	for rows.Next() {
+		rule, err := scanAutomodRule(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan automod rule: %w", err)
+		}
+		rules = append(rules, rule)
+	}
+	return rules, rows.Err()
+}
+
+// FindAutomodRule returns the automod rule with the given ID.
+func FindAutomodRule(db *pgxpool.Pool, id int) (models.AutomodRule, bool, error) {
+	rule, err := scanAutomodRule(db.QueryRow(context.Background(),
+		`SELECT `+automodRuleColumns+` FROM chatserver.automod_rules WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return rule, false, nil
+	}
+	if err != nil {
+		return rule, false, fmt.Errorf("failed to look up automod rule %d: %w", id, err)
+	}
+	return rule, true, nil
+}
+
+// CreateAutomodRule stores a new rule and returns it with its ID and timestamps.
+func CreateAutomodRule(db *pgxpool.Pool, rule models.AutomodRule) (models.AutomodRule, error) {
+	created, err := scanAutomodRule(db.QueryRow(context.Background(), `
+		INSERT INTO chatserver.automod_rules
+			(name, type, words, pattern, max_count, ratio, window_seconds, channels, action, mute_seconds, enabled, created_by)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12)
+		RETURNING `+automodRuleColumns,
+		rule.Name, rule.Type, nonNil(rule.Words), rule.Pattern, rule.Limit, rule.Ratio, rule.WindowSeconds,
+		nonNil(rule.Channels), rule.Action, rule.MuteSeconds, rule.Enabled, rule.CreatedBy))
+	if err != nil {
+		return created, fmt.Errorf("failed to create automod rule: %w", err)
+	}
+	return created, nil
+}
+
+// UpdateAutomodRule replaces the settings of an existing rule. It returns false if the
+// rule does not exist.
+func UpdateAutomodRule(db *pgxpool.Pool, rule models.AutomodRule) (models.AutomodRule, bool, error) {
+	updated, err := scanAutomodRule(db.QueryRow(context.Background(), `
+		UPDATE chatserver.automod_rules
+		SET name = $2, type = $3, words = $4, pattern = $5, max_count = $6, ratio = $7,
+			window_seconds = $8, channels = $9, action = $10, mute_seconds = $11, enabled = $12
+		WHERE id = $1
+		RETURNING `+automodRuleColumns,
+		rule.ID, rule.Name, rule.Type, nonNil(rule.Words), rule.Pattern, rule.Limit, rule.Ratio,
+		rule.WindowSeconds, nonNil(rule.Channels), rule.Action, rule.MuteSeconds, rule.Enabled))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return updated, false, nil
+	}
+	if err != nil {
+		return updated, false, fmt.Errorf("failed to update automod rule %d: %w", rule.ID, err)
+	}
+	return updated, true, nil
+}
+
+// DeleteAutomodRule deletes a rule. Flags and mutes it caused are kept. It returns false
+// if the rule does not exist.
+func DeleteAutomodRule(db *pgxpool.Pool, id int) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `DELETE FROM chatserver.automod_rules WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete automod rule %d: %w", id, err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// SaveAutomodFlag queues a delivered message for moderator review.
+func SaveAutomodFlag(db *pgxpool.Pool, flag models.AutomodFlag) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO chatserver.automod_flags
+			(rule_id, rule_name, reason, target, cache_id, channel, recipient_id, owner_id, username, message)
+		VALUES ($1, $2, $3, $4, $5, NULLIF($6, ''), NULLIF($7, ''), $8, $9, $10)
+	`, flag.RuleID, flag.RuleName, flag.Reason, flag.Target, flag.CacheID, flag.Channel, flag.RecipientID,
+		flag.OwnerID, flag.Username, flag.Message)
+	if err != nil {
+		return fmt.Errorf("failed to save automod flag: %w", err)
+	}
+	return nil
+}
+
+// FetchAutomodFlags retrieves flagged messages newest first, optionally only those with
+// the given status.
+// It returns:
+//  1. A slice of AutomodFlag objects
+//  2. PageInfo describing whether more flags exist and the cursors around this page
+//  3. An error, if any
+func FetchAutomodFlags(db *pgxpool.Pool, status string, page PageRequest) ([]models.AutomodFlag, PageInfo, error) {
+	var conditions []string
+	var args []interface{}
+	if status != "" {
+		conditions = append(conditions, "status = $1")
+		args = append(args, status)
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, args)
+
+	query := `SELECT ` + automodFlagColumns + ` FROM chatserver.automod_flags`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch automod flags: %w", err)
+	}
+	defer rows.Close()
+
+	flags := []models.AutomodFlag{}
+	for rows.Next() {
+		flag, err := scanAutomodFlag(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan automod flag: %w", err)
+		}
+		flags = append(flags, flag)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over automod flag rows: %w", err)
+	}
+
+	flags, info := finishPage(flags, page, func(flag models.AutomodFlag) Cursor {
+		return Cursor{At: flag.CreatedAt, ID: strconv.Itoa(flag.ID)}
+	})
+	return flags, info, nil
+}
+
+// FindAutomodFlag returns the flag with the given ID.
+func FindAutomodFlag(db *pgxpool.Pool, id int) (models.AutomodFlag, bool, error) {
+	flag, err := scanAutomodFlag(db.QueryRow(context.Background(),
+		`SELECT `+automodFlagColumns+` FROM chatserver.automod_flags WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return flag, false, nil
+	}
+	if err != nil {
+		return flag, false, fmt.Errorf("failed to look up automod flag %d: %w", id, err)
+	}
+	return flag, true, nil
+}
+
+// ReviewAutomodFlag records a moderator's decision on a pending flag. It returns false if
+// the flag does not exist or was already reviewed.
+func ReviewAutomodFlag(db *pgxpool.Pool, id int, status, reviewerID string) (models.AutomodFlag, bool, error) {
+	flag, err := scanAutomodFlag(db.QueryRow(context.Background(), `
+		UPDATE chatserver.automod_flags
+		SET status = $2, reviewed_by = $3, reviewed_at = now()
+		WHERE id = $1 AND status = 'pending'
+		RETURNING `+automodFlagColumns, id, status, reviewerID))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return flag, false, nil
+	}
+	if err != nil {
+		return flag, false, fmt.Errorf("failed to review automod flag %d: %w", id, err)
+	}
+	return flag, true, nil
+}
+
+// MuteUser stops a user from posting until mute.Until. An existing mute that lasts longer
+// is kept.
+func MuteUser(db *pgxpool.Pool, mute models.AutomodMute) error {
+	_, err := db.Exec(context.Background(), `
+		INSERT INTO chatserver.automod_mutes (user_id, until, reason, rule_id)
+		VALUES ($1, $2, $3, $4)
+		ON CONFLICT (user_id) DO UPDATE
+		SET until = EXCLUDED.until, reason = EXCLUDED.reason, rule_id = EXCLUDED.rule_id, created_at = now()
+		WHERE chatserver.automod_mutes.until < EXCLUDED.until
+	`, mute.UserID, mute.Until, mute.Reason, mute.RuleID)
+	if err != nil {
+		return fmt.Errorf("failed to mute %s: %w", mute.UserID, err)
+	}
+	return nil
+}
+
+// FetchActiveMutes returns the mutes that have not expired, soonest to expire first.
+func FetchActiveMutes(db *pgxpool.Pool) ([]models.AutomodMute, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT user_id, until, reason, rule_id, created_at
+		FROM chatserver.automod_mutes
+		WHERE until > $1
+		ORDER BY until
+	`, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch mutes: %w", err)
+	}
+	defer rows.Close()
+
+	mutes := []models.AutomodMute{}
+	for rows.Next() {
+		var mute models.AutomodMute
+		if err := rows.Scan(&mute.UserID, &mute.Until, &mute.Reason, &mute.RuleID, &mute.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan mute: %w", err)
+		}
+		mutes = append(mutes, mute)
+	}
+	return mutes, rows.Err()
+}
+
+// UnmuteUser lifts a user's mute. It returns false if the user was not muted.
+func UnmuteUser(db *pgxpool.Pool, userID string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `
+		DELETE FROM chatserver.automod_mutes WHERE user_id = $1 AND until > $2
+	`, userID, time.Now())
+	if err != nil {
+		return false, fmt.Errorf("failed to unmute %s: %w", userID, err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
@@ -3,16 +3,22 @@ package db
 import (
 	"context"
 	"database/sql"
+	"errors"
 	"fmt"
 	"log"
+	"strings"
 	"time"
 
 	"onrabble.com/chatserver/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func BanUser(db *pgxpool.Pool, ownerID, banishedID, reason string, duration int) error {
+// BanUser records a ban lasting duration hours, or indefinitely when duration is 0, and
+// returns its ID. The scope's IP range and device, when set, are refused along with the
+// banished account.
+func BanUser(db *pgxpool.Pool, ownerID, banishedID, reason string, duration int, scope models.BanScope) (int, error) {
 	ctx := context.Background()
 
 	// Determine endTime based on duration
@@ -31,53 +37,133 @@ func BanUser(db *pgxpool.Pool, ownerID, banishedID, reason string, duration int)
 	}
 
 	query := `
-		INSERT INTO chatserver.bans (owner_id, banished_id, reason, end_time)
-		VALUES ($1, $2, $3, $4)
+		INSERT INTO chatserver.bans (owner_id, banished_id, reason, end_time, ip_range, device_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, '')::cidr, NULLIF($6, ''))
+		RETURNING id
 	`
 
-	_, err := db.Exec(ctx, query, ownerID, banishedID, reasonSQL, endTime)
+	var id int
+	err := db.QueryRow(ctx, query, ownerID, banishedID, reasonSQL, endTime, scope.IPRange, scope.DeviceID).Scan(&id)
 	if err != nil {
 		log.Printf("Failed to insert ban record: %v", err)
-		return err
+		return 0, err
 	}
 
 	log.Printf("User %s banned by %s for %d hours. Reason: %s", banishedID, ownerID, duration, reason)
-	return nil
+	return id, nil
 }
 
 func PardonUser(db *pgxpool.Pool, banishedID int) error {
 	query := `
 		UPDATE chatserver.bans
-		SET pardoned = TRUE
+		SET pardoned = TRUE, pardoned_at = COALESCE(pardoned_at, now())
 		WHERE id = $1;
 	`
 	_, err := db.Exec(context.Background(), query, banishedID)
 	return err
 }
 
-func IsUserBanned(db *pgxpool.Pool, banishedID string) (bool, error) {
+// FindActiveBan returns the unexpired, unpardoned ban that refuses a connection from the
+// user at the given address and device, preferring the longest. A ban matches when it
+// banished the user or when its IP range or device covers the connection; ip and deviceID
+// may be empty when unknown.
+func FindActiveBan(db *pgxpool.Pool, userID, ip, deviceID string) (models.BanRecord, bool, error) {
 	ctx := context.Background()
 
-	// Check if the user is banned or pardoned
 	query := `
-		SELECT COUNT(*)
+		SELECT id, owner_id, banished_id, reason, start_time, end_time,
+			COALESCE(ip_range::TEXT, ''), COALESCE(device_id, '')
 		FROM chatserver.bans
-		WHERE banished_id = $1
-		AND (end_time is NULL OR end_time > NOW())
+		WHERE (banished_id = $1
+			OR ip_range >>= NULLIF($2, '')::inet
+			OR device_id = NULLIF($3, ''))
+		AND (end_time IS NULL OR end_time > NOW())
 		AND (pardoned IS NULL OR pardoned = FALSE)
+		ORDER BY end_time DESC NULLS FIRST
+		LIMIT 1
 	`
 
-	var count int
-	err := db.QueryRow(ctx, query, banishedID).Scan(&count)
+	var ban models.BanRecord
+	err := db.QueryRow(ctx, query, userID, ip, deviceID).Scan(&ban.ID, &ban.OwnerID, &ban.BanishedID,
+		&ban.Reason, &ban.Start, &ban.End, &ban.IPRange, &ban.DeviceID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ban, false, nil
+	}
 	if err != nil {
-		log.Printf("Failed to check ban status for user %s: %v", banishedID, err)
-		return false, err
+		log.Printf("Failed to check ban status for user %s: %v", userID, err)
+		return ban, false, err
 	}
+	return ban, true, nil
+}
 
-	return count > 0, nil
+// FindBan returns the ban with the given ID.
+func FindBan(db *pgxpool.Pool, id int) (models.BanRecord, bool, error) {
+	var ban models.BanRecord
+	err := db.QueryRow(context.Background(), `
+		SELECT id, owner_id, banished_id, reason, start_time, end_time, COALESCE(pardoned, FALSE),
+			COALESCE(ip_range::TEXT, ''), COALESCE(device_id, ''), pardoned_at, pardoned_by, appeal_id
+		FROM chatserver.bans
+		WHERE id = $1
+	`, id).Scan(&ban.ID, &ban.OwnerID, &ban.BanishedID, &ban.Reason, &ban.Start, &ban.End, &ban.Pardoned,
+		&ban.IPRange, &ban.DeviceID, &ban.PardonedAt, &ban.PardonedBy, &ban.AppealID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return ban, false, nil
+	}
+	if err != nil {
+		return ban, false, fmt.Errorf("failed to look up ban %d: %w", id, err)
+	}
+	return ban, true, nil
 }
 
-func FetchBanRecords(db *pgxpool.Pool, limit, offset int) ([]models.BanRecord, bool, error) {
+// ProcessEndedBans marks the bans that have run out or been pardoned since the last call as
+// processed, and closes their pending appeals as expired. It returns the ended bans and the
+// number of appeals closed.
+func ProcessEndedBans(db *pgxpool.Pool) ([]models.BanRecord, int, error) {
+	rows, err := db.Query(context.Background(), `
+		WITH ended AS (
+			UPDATE chatserver.bans
+			SET expiry_processed = TRUE
+			WHERE expiry_processed = FALSE AND (end_time <= now() OR pardoned = TRUE)
+			RETURNING id, banished_id, pardoned
+		), closed AS (
+			UPDATE chatserver.appeals a
+			SET status = 'expired', decided_at = now()
+			FROM ended e
+			WHERE a.ban_id = e.id AND a.status = 'pending'
+			RETURNING a.ban_id
+		)
+		SELECT e.id, e.banished_id, COALESCE(u.username, '[Unknown]'), e.pardoned, c.ban_id IS NOT NULL
+		FROM ended e
+		LEFT JOIN closed c ON c.ban_id = e.id
+		LEFT JOIN keycloak.public.user_entity u ON u.id = e.banished_id
+	`)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to process ended bans: %w", err)
+	}
+	defer rows.Close()
+
+	var ended []models.BanRecord
+	closed := 0
+	for rows.Next() {
+		var ban models.BanRecord
+		var appealClosed bool
+		if err := rows.Scan(&ban.ID, &ban.BanishedID, &ban.BanishedUsername, &ban.Pardoned, &appealClosed); err != nil {
+			return nil, 0, fmt.Errorf("failed to scan ended ban: %w", err)
+		}
+		ended = append(ended, ban)
+		if appealClosed {
+			closed++
+		}
+	}
+	return ended, closed, rows.Err()
+}
+
+// FetchBanRecords retrieves ban records newest first, paginated by the page's keyset cursors.
+// It returns:
+//  1. A slice of BanRecord models
+//  2. PageInfo describing whether more records exist and the cursors around this page
+//  3. An error, if any
+func FetchBanRecords(db *pgxpool.Pool, page PageRequest) ([]models.BanRecord, PageInfo, error) {
 	ctx := context.Background()
 
 	query := `
@@ -90,17 +176,26 @@ func FetchBanRecords(db *pgxpool.Pool, limit, offset int) ([]models.BanRecord, b
 			b.reason, 
 			b.end_time, 
 			b.duration::TEXT, 
-			b.pardoned
+			b.pardoned,
+			COALESCE(b.ip_range::TEXT, ''),
+			COALESCE(b.device_id, ''),
+			b.pardoned_at,
+			b.pardoned_by,
+			b.appeal_id
 		FROM chatserver.bans b
 		LEFT JOIN keycloak.public.user_entity u 
 			ON b.banished_id = u.id
-		ORDER BY b.start_time DESC
-		LIMIT $1 OFFSET $2
 	`
 
-	rows, err := db.Query(ctx, query, limit+1, offset) // Fetch one extra row to check for more results
+	conditions, args, pageClause := page.keyset("b.start_time", "b.id", "INT", nil, nil)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to fetch ban records: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch ban records: %w", err)
 	}
 	defer rows.Close()
 
@@ -121,9 +216,14 @@ func FetchBanRecords(db *pgxpool.Pool, limit, offset int) ([]models.BanRecord, b
 			&ban.End,
 			&duration,
 			&ban.Pardoned,
+			&ban.IPRange,
+			&ban.DeviceID,
+			&ban.PardonedAt,
+			&ban.PardonedBy,
+			&ban.AppealID,
 		)
 		if err != nil {
-			return nil, false, fmt.Errorf("failed to scan ban record: %w", err)
+			return nil, PageInfo{}, fmt.Errorf("failed to scan ban record: %w", err)
 		}
 
 		if reason.Valid {
@@ -147,12 +247,11 @@ func FetchBanRecords(db *pgxpool.Pool, limit, offset int) ([]models.BanRecord, b
 		bans = append(bans, ban)
 	}
 
-	// Check if there are more results beyond this page
-	hasMore := len(bans) > limit
-	if hasMore {
-		bans = bans[:limit] // Remove the extra record used for checking
-	}
+	// Remove the extra record used for checking and build the surrounding cursors
+	bans, info := finishPage(bans, page, func(ban models.BanRecord) Cursor {
+		return Cursor{At: ban.Start, ID: ban.ID}
+	})
 
-	log.Printf("Fetched %d ban records (limit: %d, offset: %d)", len(bans), limit, offset)
-	return bans, hasMore, nil
+	log.Printf("Fetched %d ban records (limit: %d, has more: %v)", len(bans), page.Limit, info.HasMore)
+	return bans, info, nil
 }
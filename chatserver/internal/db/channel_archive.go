@@ -0,0 +1,151 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrChannelExists is returned when importing a channel whose name is taken.
+var ErrChannelExists = errors.New("channel already exists")
+
+// FindChannel returns the channel with the given ID.
+func FindChannel(db *pgxpool.Pool, id int) (models.Channel, bool, error) {
+	var channel models.Channel
+	err := db.QueryRow(context.Background(), `
+		SELECT id, name, description, sort_order, category_id, search_language::TEXT FROM chatserver.channels WHERE id = $1
+	`, id).Scan(&channel.ID, &channel.Name, &channel.Description, &channel.SortOrder, &channel.CategoryID, &channel.Language)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return channel, false, nil
+	}
+	if err != nil {
+		return channel, false, fmt.Errorf("failed to look up channel %d: %w", id, err)
+	}
+	return channel, true, nil
+}
+
+// StreamChannelMessages calls fn with each stored message of a channel in cacheID order,
+// with the author's username where the user directory knows it. It stops at the first
+// error fn returns.
+func StreamChannelMessages(db *pgxpool.Pool, channel string, fn func(models.ChatMessage) error) error {
+	rows, err := db.Query(context.Background(), `
+		SELECT m.cache_id, m.owner_id, COALESCE(u.username, ''), m.message, m.authored_at, COALESCE(m.reply_to_cache_id, 0)
+		FROM chatserver.chat_messages m
+		LEFT JOIN keycloak.public.user_entity u ON u.id = m.owner_id
+		WHERE m.channel = $1
+		ORDER BY m.cache_id
+	`, channel)
+	if err != nil {
+		return fmt.Errorf("failed to stream messages of %s: %w", channel, err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		msg := models.ChatMessage{Channel: channel}
+		if err := rows.Scan(&msg.CacheID, &msg.OwnerID, &msg.Username, &msg.Message, &msg.Sent, &msg.ReplyTo); err != nil {
+			return fmt.Errorf("failed to scan message: %w", err)
+		}
+		if err := fn(msg); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("failed to stream messages of %s: %w", channel, err)
+	}
+	return nil
+}
+
+// MaxChatCacheID returns the highest cacheID stored for a chat message, archived or not.
+func MaxChatCacheID(db *pgxpool.Pool) (int, error) {
+	var maxID int
+	err := db.QueryRow(context.Background(), `
+		SELECT GREATEST(
+			(SELECT COALESCE(MAX(cache_id), 0) FROM chatserver.chat_messages),
+			(SELECT COALESCE(MAX(cache_id), 0) FROM chatserver.chat_messages_archive)
+		)
+	`).Scan(&maxID)
+	if err != nil {
+		return 0, fmt.Errorf("failed to read the highest cacheID: %w", err)
+	}
+	return maxID, nil
+}
+
+// ImportChannel creates a channel owned by ownerID after the uncategorized channels and
+// stores the messages returned by next, which carry their final cacheIDs, until it returns
+// an empty batch. Everything happens in one transaction, so a failed import leaves nothing
+// behind. It returns the created channel and the number of messages stored, or
+// ErrChannelExists or ErrUnknownLanguage.
+func ImportChannel(db *pgxpool.Pool, channel models.Channel, ownerID string, next func() ([]models.ChatMessage, error)) (models.Channel, int, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return channel, 0, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := checkLanguage(ctx, tx, channel.Language); err != nil {
+		return channel, 0, err
+	}
+
+	// Not locked, since imports run long; a tie with a concurrent move only falls back to IDs
+	slot, err := channelScope(0).slot(ctx, tx, 0, 0)
+	if err != nil {
+		return channel, 0, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO chatserver.channels (name, description, owner_id, sort_order, search_language)
+		VALUES ($1, $2, $3, $4, $5::REGCONFIG)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, sort_order
+	`, channel.Name, channel.Description, ownerID, slot, channel.Language).Scan(&channel.ID, &channel.SortOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return channel, 0, ErrChannelExists
+	}
+	if err != nil {
+		return channel, 0, fmt.Errorf("failed to create channel %s: %w", channel.Name, err)
+	}
+
+	imported := 0
+	for {
+		batch, err := next()
+		if err != nil {
+			return channel, imported, err
+		}
+		if len(batch) == 0 {
+			break
+		}
+
+		cacheIDs := make([]int, len(batch))
+		owners := make([]string, len(batch))
+		texts := make([]string, len(batch))
+		authored := make([]time.Time, len(batch))
+		replies := make([]int, len(batch))
+		for i, msg := range batch {
+			cacheIDs[i], owners[i], texts[i], authored[i], replies[i] = msg.CacheID, msg.OwnerID, msg.Message, msg.Sent, msg.ReplyTo
+		}
+
+		_, err = tx.Exec(ctx, `
+			INSERT INTO chatserver.chat_messages (cache_id, owner_id, channel, message, authored_at, search_language, reply_to_cache_id)
+			SELECT m.cache_id, m.owner_id, $6, m.message, m.authored_at, $7::REGCONFIG, NULLIF(m.reply_to, 0)
+			FROM unnest($1::BIGINT[], $2::TEXT[], $3::TEXT[], $4::TIMESTAMP[], $5::BIGINT[])
+				AS m(cache_id, owner_id, message, authored_at, reply_to)
+		`, cacheIDs, owners, texts, authored, replies, channel.Name, channel.Language)
+		if err != nil {
+			return channel, imported, fmt.Errorf("failed to import messages into %s: %w", channel.Name, err)
+		}
+		imported += len(batch)
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return channel, imported, fmt.Errorf("failed to commit import of %s: %w", channel.Name, err)
+	}
+	return channel, imported, nil
+}
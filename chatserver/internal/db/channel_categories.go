@@ -0,0 +1,368 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// ErrChannelNotFound is returned when moving a channel, or before a channel, that doesn't exist.
+	ErrChannelNotFound = errors.New("channel not found")
+	// ErrCategoryNotFound is returned for a channel category that doesn't exist.
+	ErrCategoryNotFound = errors.New("channel category not found")
+	// ErrCategoryExists is returned when a category name is taken.
+	ErrCategoryExists = errors.New("channel category already exists")
+	// ErrCategoryMismatch is returned when moving a channel into one category before a
+	// channel of another.
+	ErrCategoryMismatch = errors.New("channel is in another category")
+)
+
+// orderGap is the distance between neighbouring sort_orders of appended or renumbered rows,
+// leaving room to move rows between them without touching their neighbours.
+const orderGap = 1 << 16
+
+// orderScope is a set of rows ordered together by sort_order: all categories, or the
+// channels of one category.
+type orderScope struct {
+	table string
+	where string // Condition selecting the scope's rows, using args as $1...
+	args  []any
+}
+
+var categoryScope = orderScope{table: "chatserver.channel_categories", where: "TRUE"}
+
+// channelScope returns the channels of a category, or the uncategorized ones for 0.
+func channelScope(categoryID int) orderScope {
+	return orderScope{
+		table: "chatserver.channels",
+		where: "category_id IS NOT DISTINCT FROM NULLIF($1::INT, 0)",
+		args:  []any{categoryID},
+	}
+}
+
+// lock serializes moves within the scope's table for the rest of the transaction.
+func (s orderScope) lock(ctx context.Context, tx pgx.Tx) error {
+	if _, err := tx.Exec(ctx, `LOCK TABLE `+s.table+` IN SHARE ROW EXCLUSIVE MODE`); err != nil {
+		return fmt.Errorf("failed to lock %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// orderedRow is a row's ID and sort_order within an orderScope.
+type orderedRow struct {
+	id, sortOrder int
+}
+
+// rows returns the scope's rows in display order.
+func (s orderScope) rows(ctx context.Context, tx pgx.Tx) ([]orderedRow, error) {
+	rows, err := tx.Query(ctx, fmt.Sprintf(`
+		SELECT id, sort_order FROM %s WHERE %s ORDER BY sort_order, id
+	`, s.table, s.where), s.args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the order of %s: %w", s.table, err)
+	}
+	defer rows.Close()
+
+	var ordered []orderedRow
+	for rows.Next() {
+		var row orderedRow
+		if err := rows.Scan(&row.id, &row.sortOrder); err != nil {
+			return nil, fmt.Errorf("failed to scan the order of %s: %w", s.table, err)
+		}
+		ordered = append(ordered, row)
+	}
+	return ordered, rows.Err()
+}
+
+// slot returns the sort_order placing the row movedID right before beforeID, or after the
+// scope's last row when beforeID is 0. The neighbours keep their sort_orders unless the gap
+// between them is used up, in which case the scope is renumbered first.
+func (s orderScope) slot(ctx context.Context, tx pgx.Tx, movedID, beforeID int) (int, error) {
+	rows, err := s.rows(ctx, tx)
+	if err != nil {
+		return 0, err
+	}
+	order, ok, err := place(rows, movedID, beforeID)
+	if err != nil || ok {
+		return order, err
+	}
+
+	rows = spread(rows)
+	if err := s.renumber(ctx, tx, rows); err != nil {
+		return 0, err
+	}
+	if order, ok, err = place(rows, movedID, beforeID); !ok && err == nil {
+		err = fmt.Errorf("no room before row %d in %s after renumbering", beforeID, s.table)
+	}
+	return order, err
+}
+
+// place returns the sort_order placing movedID right before beforeID among rows in display
+// order, or after the last row when beforeID is 0. Placing a row before itself keeps its
+// sort_order. ok is false when there is no room left before beforeID.
+func place(rows []orderedRow, movedID, beforeID int) (order int, ok bool, err error) {
+	prev := -1
+	for i, row := range rows {
+		switch {
+		case row.id == beforeID && beforeID == movedID:
+			return row.sortOrder, true, nil
+		case row.id == beforeID && prev < 0:
+			return row.sortOrder - orderGap, true, nil
+		case row.id == beforeID:
+			if row.sortOrder-rows[prev].sortOrder < 2 {
+				return 0, false, nil
+			}
+			return rows[prev].sortOrder + (row.sortOrder-rows[prev].sortOrder)/2, true, nil
+		case row.id != movedID:
+			prev = i
+		}
+	}
+	if beforeID != 0 {
+		return 0, false, fmt.Errorf("row %d not found", beforeID)
+	}
+	if prev < 0 {
+		return orderGap, true, nil
+	}
+	return rows[prev].sortOrder + orderGap, true, nil
+}
+
+// spread returns rows, in the same order, with sort_orders orderGap apart.
+func spread(rows []orderedRow) []orderedRow {
+	spread := make([]orderedRow, len(rows))
+	for i, row := range rows {
+		spread[i] = orderedRow{id: row.id, sortOrder: (i + 1) * orderGap}
+	}
+	return spread
+}
+
+// renumber stores the sort_orders of the scope's rows given by spread.
+func (s orderScope) renumber(ctx context.Context, tx pgx.Tx, rows []orderedRow) error {
+	ids, orders := make([]int, len(rows)), make([]int, len(rows))
+	for i, row := range rows {
+		ids[i], orders[i] = row.id, row.sortOrder
+	}
+	_, err := tx.Exec(ctx, fmt.Sprintf(`
+		UPDATE %s t SET sort_order = o.sort_order
+		FROM UNNEST($1::INT[], $2::BIGINT[]) AS o (id, sort_order)
+		WHERE t.id = o.id
+	`, s.table), ids, orders)
+	if err != nil {
+		return fmt.Errorf("failed to renumber %s: %w", s.table, err)
+	}
+	return nil
+}
+
+// FetchChannelCategories returns the channel categories in display order, each with the
+// IDs of its channels in display order.
+func FetchChannelCategories(db *pgxpool.Pool) ([]models.ChannelCategory, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT g.id, g.name, g.sort_order, g.collapsed,
+			COALESCE(ARRAY_AGG(c.id ORDER BY c.sort_order, c.id) FILTER (WHERE c.id IS NOT NULL), '{}')
+		FROM chatserver.channel_categories g
+		LEFT JOIN chatserver.channels c ON c.category_id = g.id
+		GROUP BY g.id
+		ORDER BY g.sort_order, g.id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch channel categories: %w", err)
+	}
+	defer rows.Close()
+
+	categories := []models.ChannelCategory{}
+	for rows.Next() {
+		var category models.ChannelCategory
+		if err := rows.Scan(&category.ID, &category.Name, &category.SortOrder, &category.Collapsed, &category.ChannelIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan channel category: %w", err)
+		}
+		categories = append(categories, category)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over channel category rows: %w", err)
+	}
+	return categories, nil
+}
+
+// CreateChannelCategory adds a category after the existing ones. It returns
+// ErrCategoryExists if the name is taken.
+func CreateChannelCategory(db *pgxpool.Pool, name string, collapsed bool) (models.ChannelCategory, error) {
+	category := models.ChannelCategory{Name: name, Collapsed: collapsed, ChannelIDs: []int{}}
+
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return category, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := categoryScope.lock(ctx, tx); err != nil {
+		return category, err
+	}
+	slot, err := categoryScope.slot(ctx, tx, 0, 0)
+	if err != nil {
+		return category, err
+	}
+
+	err = tx.QueryRow(ctx, `
+		INSERT INTO chatserver.channel_categories (name, sort_order, collapsed)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (name) DO NOTHING
+		RETURNING id, sort_order
+	`, name, slot, collapsed).Scan(&category.ID, &category.SortOrder)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return category, ErrCategoryExists
+	}
+	if err != nil {
+		return category, fmt.Errorf("failed to create channel category %s: %w", name, err)
+	}
+	return category, tx.Commit(ctx)
+}
+
+// UpdateChannelCategory renames a category or changes whether it starts collapsed. Nil
+// fields are left unchanged. It returns ErrCategoryNotFound or ErrCategoryExists.
+func UpdateChannelCategory(db *pgxpool.Pool, id int, name *string, collapsed *bool) error {
+	clauses := []string{}
+	params := []interface{}{}
+	if name != nil {
+		params = append(params, *name)
+		clauses = append(clauses, "name = $"+strconv.Itoa(len(params)))
+	}
+	if collapsed != nil {
+		params = append(params, *collapsed)
+		clauses = append(clauses, "collapsed = $"+strconv.Itoa(len(params)))
+	}
+	if len(clauses) == 0 {
+		return errors.New("no fields provided to update")
+	}
+	params = append(params, id)
+
+	ctx := context.Background()
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if name != nil {
+		var taken bool
+		err := tx.QueryRow(ctx, `
+			SELECT EXISTS (SELECT 1 FROM chatserver.channel_categories WHERE name = $1 AND id <> $2)
+		`, *name, id).Scan(&taken)
+		if err != nil {
+			return fmt.Errorf("failed to check category name: %w", err)
+		}
+		if taken {
+			return ErrCategoryExists
+		}
+	}
+
+	cmd, err := tx.Exec(ctx, `
+		UPDATE chatserver.channel_categories SET `+strings.Join(clauses, ", ")+`
+		WHERE id = $`+strconv.Itoa(len(params)), params...)
+	if err != nil {
+		return fmt.Errorf("failed to update channel category %d: %w", id, err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// MoveChannelCategory moves a category before another one, or to the end when beforeID
+// is 0. Only the moved category's row changes unless its new neighbours have no room
+// left between them. It returns ErrCategoryNotFound.
+func MoveChannelCategory(db *pgxpool.Pool, id, beforeID int) error {
+	if id == beforeID {
+		return nil
+	}
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if err := categoryScope.lock(ctx, tx); err != nil {
+		return err
+	}
+	for _, categoryID := range []int{id, beforeID} {
+		if err := checkCategory(ctx, tx, categoryID); err != nil {
+			return err
+		}
+	}
+
+	slot, err := categoryScope.slot(ctx, tx, id, beforeID)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `UPDATE chatserver.channel_categories SET sort_order = $1 WHERE id = $2`, slot, id); err != nil {
+		return fmt.Errorf("failed to move channel category %d: %w", id, err)
+	}
+	return tx.Commit(ctx)
+}
+
+// RemoveChannelCategory deletes a category. Its channels keep their order and follow the
+// uncategorized ones. It returns ErrCategoryNotFound.
+func RemoveChannelCategory(db *pgxpool.Pool, id int) error {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	uncategorized := channelScope(0)
+	if err := uncategorized.lock(ctx, tx); err != nil {
+		return err
+	}
+	base, err := uncategorized.slot(ctx, tx, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(ctx, `
+		UPDATE chatserver.channels c SET category_id = NULL, sort_order = $2 + (o.position - 1) * $3
+		FROM (
+			SELECT id, ROW_NUMBER() OVER (ORDER BY sort_order, id) AS position
+			FROM chatserver.channels WHERE category_id = $1
+		) o
+		WHERE c.id = o.id
+	`, id, base, orderGap)
+	if err != nil {
+		return fmt.Errorf("failed to uncategorize channels of category %d: %w", id, err)
+	}
+
+	cmd, err := tx.Exec(ctx, `DELETE FROM chatserver.channel_categories WHERE id = $1`, id)
+	if err != nil {
+		return fmt.Errorf("failed to delete channel category %d: %w", id, err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return ErrCategoryNotFound
+	}
+	return tx.Commit(ctx)
+}
+
+// checkCategory returns ErrCategoryNotFound unless the category exists; 0 always does.
+func checkCategory(ctx context.Context, tx pgx.Tx, id int) error {
+	if id == 0 {
+		return nil
+	}
+	var found bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM chatserver.channel_categories WHERE id = $1)`, id).Scan(&found)
+	if err != nil {
+		return fmt.Errorf("failed to look up channel category %d: %w", id, err)
+	}
+	if !found {
+		return ErrCategoryNotFound
+	}
+	return nil
+}
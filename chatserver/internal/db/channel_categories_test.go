@@ -0,0 +1,77 @@
+package db
+
+import (
+	"testing"
+)
+
+func TestPlace(t *testing.T) {
+	rows := []orderedRow{{1, orderGap}, {2, 2 * orderGap}, {3, 3 * orderGap}}
+	tests := []struct {
+		name              string
+		rows              []orderedRow
+		movedID, beforeID int
+		want              int
+		ok                bool
+	}{
+		{"append to empty scope", nil, 0, 0, orderGap, true},
+		{"append new row", rows, 0, 0, 4 * orderGap, true},
+		{"move to end", rows, 1, 0, 4 * orderGap, true},
+		{"move last to end", rows, 3, 0, 3 * orderGap, true},
+		{"move to front", rows, 3, 1, 0, true},
+		{"move first to front", rows, 1, 1, orderGap, true},
+		{"move before self", rows, 2, 2, 2 * orderGap, true},
+		{"move between neighbours", rows, 3, 2, orderGap + orderGap/2, true},
+		{"move into place", rows, 2, 3, 2 * orderGap, true},
+		{"move forward", rows, 1, 3, 2*orderGap + orderGap/2, true},
+		{"new row before", rows, 0, 2, orderGap + orderGap/2, true},
+		{"equal orders", []orderedRow{{1, 5}, {2, 5}}, 0, 2, 0, false},
+		{"no room", []orderedRow{{1, 5}, {2, 6}, {3, 7}}, 3, 2, 0, false},
+		{"room of two", []orderedRow{{1, 5}, {2, 7}}, 0, 2, 6, true},
+		{"no room but moved row between", []orderedRow{{1, 5}, {2, 6}, {3, 7}}, 2, 3, 6, true},
+	}
+	for _, test := range tests {
+		got, ok, err := place(test.rows, test.movedID, test.beforeID)
+		if err != nil {
+			t.Errorf("%s: place(%d, %d) failed: %v", test.name, test.movedID, test.beforeID, err)
+			continue
+		}
+		if ok != test.ok || (ok && got != test.want) {
+			t.Errorf("%s: place(%d, %d) = %d, %v, want %d, %v", test.name, test.movedID, test.beforeID, got, ok, test.want, test.ok)
+		}
+	}
+}
+
+func TestPlaceUnknownRow(t *testing.T) {
+	rows := []orderedRow{{1, orderGap}}
+	if _, _, err := place(rows, 1, 9); err == nil {
+		t.Error("place before a missing row succeeded")
+	}
+}
+
+func TestSpread(t *testing.T) {
+	rows := []orderedRow{{4, -3}, {2, 5}, {7, 5}, {1, 6}}
+	got := spread(rows)
+	for i, row := range got {
+		if row.id != rows[i].id || row.sortOrder != (i+1)*orderGap {
+			t.Errorf("spread()[%d] = %+v, want {id:%d sortOrder:%d}", i, row, rows[i].id, (i+1)*orderGap)
+		}
+	}
+}
+
+// TestRenumberWhenOutOfRoom follows slot when the gap before a row is used up: the scope is
+// spread out and the row placed again.
+func TestRenumberWhenOutOfRoom(t *testing.T) {
+	rows := []orderedRow{{1, 5}, {2, 6}, {3, 7}, {4, 8}}
+	if _, ok, err := place(rows, 4, 2); ok || err != nil {
+		t.Fatalf("place(4, 2) = %v, %v, want no room", ok, err)
+	}
+
+	rows = spread(rows)
+	got, ok, err := place(rows, 4, 2)
+	if err != nil || !ok {
+		t.Fatalf("place(4, 2) after spread = %v, %v, want room", ok, err)
+	}
+	if got <= rows[0].sortOrder || got >= rows[1].sortOrder {
+		t.Errorf("place(4, 2) after spread = %d, want between %d and %d", got, rows[0].sortOrder, rows[1].sortOrder)
+	}
+}
@@ -16,28 +16,49 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func CreateChannel(db *pgxpool.Pool, name string, description string) error {
+// ErrUnknownLanguage is returned for a text search configuration this database does not have.
+var ErrUnknownLanguage = errors.New("unknown text search language")
+
+// reindexBatchSize is how many messages each statement re-indexes after a language change.
+const reindexBatchSize = 1000
+
+// CreateChannel adds a channel at the end of a category, or of the uncategorized channels
+// when categoryID is 0. It returns ErrCategoryNotFound.
+func CreateChannel(db *pgxpool.Pool, name string, description string, categoryID int) error {
+	ctx := context.Background()
 	placeholderOwner := "00000000-0000-0000-0000-000000000000"
 
-	// Get current max sort_order
-	var maxOrder int
-	err := db.QueryRow(context.Background(),
-		`SELECT COALESCE(MAX(sort_order), 0) FROM chatserver.channels`,
-	).Scan(&maxOrder)
+	tx, err := db.Begin(ctx)
 	if err != nil {
-		return fmt.Errorf("failed to get max sort_order: %w", err)
+		return fmt.Errorf("failed to begin tx: %w", err)
 	}
+	defer tx.Rollback(ctx)
 
-	_, err = db.Exec(context.Background(), `
-		INSERT INTO chatserver.channels (name, description, owner_id, sort_order)
-		VALUES ($1, $2, $3, $4)
-		ON CONFLICT (name) DO NOTHING
-	`, name, description, placeholderOwner, maxOrder+1)
+	scope := channelScope(categoryID)
+	if err := scope.lock(ctx, tx); err != nil {
+		return err
+	}
+	if err := checkCategory(ctx, tx, categoryID); err != nil {
+		return err
+	}
+	slot, err := scope.slot(ctx, tx, 0, 0)
+	if err != nil {
+		return err
+	}
 
-	return err
+	_, err = tx.Exec(ctx, `
+		INSERT INTO chatserver.channels (name, description, owner_id, sort_order, category_id)
+		VALUES ($1, $2, $3, $4, NULLIF($5, 0))
+		ON CONFLICT (name) DO NOTHING
+	`, name, description, placeholderOwner, slot, categoryID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit(ctx)
 }
 
-// FetchChannels retrieves all channels from the database's `channels` table.
+// FetchChannels retrieves all channels from the database's `channels` table, uncategorized
+// channels first and then category by category.
 // For each channel, if the `description` column is NULL, the Channel.Description
 // field will be set to nil in the returned slice. Otherwise, it contains the
 // description as a pointer to a string.
@@ -45,7 +66,12 @@ func CreateChannel(db *pgxpool.Pool, name string, description string) error {
 //  1. A slice of Channel models
 //  2. An error, if any
 func FetchChannels(db *pgxpool.Pool) ([]models.Channel, error) {
-	rows, err := db.Query(context.Background(), "SELECT id, name, description, sort_order FROM chatserver.channels ORDER BY sort_order, id")
+	rows, err := db.Query(context.Background(), `
+		SELECT c.id, c.name, c.description, c.sort_order, c.category_id, c.search_language::TEXT
+		FROM chatserver.channels c
+		LEFT JOIN chatserver.channel_categories g ON g.id = c.category_id
+		ORDER BY g.sort_order NULLS FIRST, g.id NULLS FIRST, c.sort_order, c.id
+	`)
 	if err != nil {
 		return nil, fmt.Errorf("failed to fetch channels: %w", err)
 	}
@@ -56,7 +82,7 @@ func FetchChannels(db *pgxpool.Pool) ([]models.Channel, error) {
 		var channel models.Channel
 		var description sql.NullString
 
-		if err := rows.Scan(&channel.ID, &channel.Name, &description, &channel.SortOrder); err != nil {
+		if err := rows.Scan(&channel.ID, &channel.Name, &description, &channel.SortOrder, &channel.CategoryID, &channel.Language); err != nil {
 			return nil, fmt.Errorf("failed to scan channel row: %w", err)
 		}
 
@@ -78,7 +104,24 @@ func FetchChannels(db *pgxpool.Pool) ([]models.Channel, error) {
 	return channels, nil
 }
 
-func UpdateChannel(db *pgxpool.Pool, ID int, name *string, description *string) error {
+// ChannelExists reports whether a channel with the given name exists.
+func ChannelExists(db *pgxpool.Pool, name string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM chatserver.channels WHERE name = $1)
+	`, name).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up channel %s: %w", name, err)
+	}
+	return exists, nil
+}
+
+// UpdateChannel updates a channel's name, description and text search language.
+// Nil fields are left unchanged. Changing the language also re-indexes the channel's
+// stored messages under the new text search configuration, in batches so rows are only
+// locked briefly. It returns ErrUnknownLanguage.
+func UpdateChannel(db *pgxpool.Pool, ID int, name *string, description *string, language *string) error {
+	ctx := context.Background()
 	clauses := []string{}
 	params := []interface{}{}
 	paramIndex := 1
@@ -95,19 +138,95 @@ func UpdateChannel(db *pgxpool.Pool, ID int, name *string, description *string)
 		paramIndex++
 	}
 
+	if language != nil {
+		clauses = append(clauses, "search_language = $"+strconv.Itoa(paramIndex)+"::REGCONFIG")
+		params = append(params, *language)
+		paramIndex++
+	}
+
 	if len(clauses) == 0 {
 		return errors.New("no fields provided to update")
 	}
 
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if language != nil {
+		if err := checkLanguage(ctx, tx, *language); err != nil {
+			return err
+		}
+	}
+
+	var oldName string
+	if name != nil {
+		err := tx.QueryRow(ctx, `SELECT name FROM chatserver.channels WHERE id = $1 FOR UPDATE`, ID).Scan(&oldName)
+		if err != nil {
+			return fmt.Errorf("failed to update channel: %w", err)
+		}
+	}
+
 	query := `
         UPDATE chatserver.channels
         SET ` + strings.Join(clauses, ", ") + ` 
-        WHERE id = $` + strconv.Itoa(paramIndex)
+        WHERE id = $` + strconv.Itoa(paramIndex) + `
+        RETURNING name, search_language::TEXT`
 
 	params = append(params, ID)
 
-	_, err := db.Exec(context.Background(), query, params...)
-	return err
+	var channelName, channelLanguage string
+	if err := tx.QueryRow(ctx, query, params...).Scan(&channelName, &channelLanguage); err != nil {
+		return fmt.Errorf("failed to update channel: %w", err)
+	}
+
+	if name != nil && oldName != channelName {
+		if err := renameRetention(ctx, tx, oldName, channelName); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return err
+	}
+
+	// Regenerate the search vectors of messages already stored for this channel. Messages
+	// flushed meanwhile already get the new language from the channel.
+	if language != nil {
+		for {
+			cmd, err := db.Exec(ctx, `
+				UPDATE chatserver.chat_messages
+				SET search_language = $1::REGCONFIG
+				WHERE id IN (
+					SELECT id FROM chatserver.chat_messages
+					WHERE channel = $2 AND search_language <> $1::REGCONFIG
+					LIMIT $3
+				)
+			`, channelLanguage, channelName, reindexBatchSize)
+			if err != nil {
+				return fmt.Errorf("failed to re-index messages for channel '%s': %w", channelName, err)
+			}
+			if cmd.RowsAffected() < reindexBatchSize {
+				break
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkLanguage returns ErrUnknownLanguage unless the text search configuration exists.
+func checkLanguage(ctx context.Context, tx pgx.Tx, language string) error {
+	var known bool
+	err := tx.QueryRow(ctx, `SELECT EXISTS (SELECT 1 FROM pg_ts_config WHERE cfgname = $1)`, language).Scan(&known)
+	if err != nil {
+		return fmt.Errorf("failed to check text search language: %w", err)
+	}
+	if !known {
+		return ErrUnknownLanguage
+	}
+	return nil
 }
 
 // FetchMessageCountByChannel returns the total number of chat messages per channel.
@@ -144,12 +263,16 @@ func FetchMessageCountByChannel(db *pgxpool.Pool) ([]api.ChannelMessageCount, er
 	return counts, nil
 }
 
-// MoveChannelBefore reorders a channel to appear before another channel.
-// If beforeID is nil, it moves the channel to the end.
-func MoveChannelBefore(db *pgxpool.Pool, movedID int, beforeID *int) error {
+// MoveChannel moves a channel right before the channel beforeID, into that channel's
+// category, or to the end of a category when beforeID is 0. categoryID picks that
+// category, 0 for the uncategorized channels, and defaults to the channel's current one.
+// Only the moved channel's row changes unless its new neighbours have no room left
+// between them. It returns ErrChannelNotFound, ErrCategoryNotFound or ErrCategoryMismatch
+// when beforeID is not in categoryID.
+func MoveChannel(db *pgxpool.Pool, movedID int, categoryID *int, beforeID int) error {
 	ctx := context.Background()
 
-	if beforeID != nil && *beforeID == movedID {
+	if beforeID == movedID {
 		return nil
 	}
 
@@ -159,56 +282,53 @@ func MoveChannelBefore(db *pgxpool.Pool, movedID int, beforeID *int) error {
 	}
 	defer tx.Rollback(ctx)
 
-	// Step 1: Fetch current ordered list of channel IDs
-	rows, err := tx.Query(ctx, `SELECT id FROM chatserver.channels ORDER BY sort_order, id`)
-	if err != nil {
-		return fmt.Errorf("failed to fetch channel order: %w", err)
+	if err := channelScope(0).lock(ctx, tx); err != nil {
+		return err
 	}
-	defer rows.Close()
 
-	var ordered []int
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return fmt.Errorf("failed to scan channel ID: %w", err)
+	// channelCategory returns the category of a channel, 0 when it has none
+	channelCategory := func(id int) (int, error) {
+		var category int
+		err := tx.QueryRow(ctx, `SELECT COALESCE(category_id, 0) FROM chatserver.channels WHERE id = $1`, id).Scan(&category)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return 0, ErrChannelNotFound
 		}
-		ordered = append(ordered, id)
-	}
-
-	// Step 2: Remove movedID from the list
-	newOrder := make([]int, 0, len(ordered))
-	for _, id := range ordered {
-		if id != movedID {
-			newOrder = append(newOrder, id)
+		if err != nil {
+			return 0, fmt.Errorf("failed to look up channel %d: %w", id, err)
 		}
+		return category, nil
 	}
 
-	// Step 3: Insert movedID before target or at end
-	inserted := false
-	if beforeID != nil {
-		for i, id := range newOrder {
-			if id == *beforeID {
-				// insert movedID before this index
-				newOrder = append(newOrder[:i], append([]int{movedID}, newOrder[i:]...)...)
-				inserted = true
-				break
-			}
-		}
+	target, err := channelCategory(movedID)
+	if err != nil {
+		return err
 	}
-	if !inserted {
-		newOrder = append(newOrder, movedID)
+	if categoryID != nil {
+		target = *categoryID
 	}
-
-	// Step 4: Reassign sort_order based on new list
-	for index, id := range newOrder {
-		_, err := tx.Exec(ctx, `
-			UPDATE chatserver.channels
-			SET sort_order = $1
-			WHERE id = $2
-		`, index+1, id)
+	if beforeID != 0 {
+		beforeCategory, err := channelCategory(beforeID)
 		if err != nil {
-			return fmt.Errorf("failed to update sort_order for id %d: %w", id, err)
+			return err
 		}
+		if categoryID != nil && *categoryID != beforeCategory {
+			return ErrCategoryMismatch
+		}
+		target = beforeCategory
+	}
+	if err := checkCategory(ctx, tx, target); err != nil {
+		return err
+	}
+
+	slot, err := channelScope(target).slot(ctx, tx, movedID, beforeID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(ctx, `
+		UPDATE chatserver.channels SET category_id = NULLIF($1, 0), sort_order = $2 WHERE id = $3
+	`, target, slot, movedID)
+	if err != nil {
+		return fmt.Errorf("failed to move channel %d: %w", movedID, err)
 	}
 
 	return tx.Commit(ctx)
@@ -249,40 +369,31 @@ func RemoveChannelByID(db *pgxpool.Pool, channelID int, purgeMessages bool) erro
 		}
 	}
 
-	// Step 4: Renumber sort_order
-	rows, err := tx.Query(ctx, `
-		SELECT id FROM chatserver.channels ORDER BY sort_order, id
-	`)
+	// The remaining channels keep their sort_order; gaps between them are expected
+	return tx.Commit(ctx)
+}
+
+// Called inside RemoveChannelByID, already in a tx
+func removeMessagesByChannelTx(tx pgx.Tx, channelName string) (int64, error) {
+	_, err := tx.Exec(context.Background(), `
+		DELETE FROM chatserver.message_reactions r
+		USING chatserver.chat_messages m
+		WHERE r.target = $1 AND r.cache_id = m.cache_id AND m.channel = $2
+	`, models.ReactionTargetChat, channelName)
 	if err != nil {
-		return fmt.Errorf("failed to fetch remaining channels: %w", err)
+		return 0, fmt.Errorf("failed to delete reactions for channel '%s': %w", channelName, err)
 	}
-	defer rows.Close()
 
-	var ids []int
-	for rows.Next() {
-		var id int
-		if err := rows.Scan(&id); err != nil {
-			return fmt.Errorf("failed to scan remaining channel ID: %w", err)
-		}
-		ids = append(ids, id)
+	_, err = tx.Exec(context.Background(), `DELETE FROM chatserver.mentions WHERE channel = $1`, channelName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to delete mentions for channel '%s': %w", channelName, err)
 	}
 
-	for i, id := range ids {
-		_, err := tx.Exec(ctx, `
-			UPDATE chatserver.channels
-			SET sort_order = $1
-			WHERE id = $2
-		`, i+1, id)
-		if err != nil {
-			return fmt.Errorf("failed to renumber sort_order: %w", err)
-		}
+	_, err = tx.Exec(context.Background(), unlinkAttachmentsQuery+`WHERE target = $1 AND channel = $2`, models.ReactionTargetChat, channelName)
+	if err != nil {
+		return 0, fmt.Errorf("failed to unlink attachments for channel '%s': %w", channelName, err)
 	}
 
-	return tx.Commit(ctx)
-}
-
-// Called inside RemoveChannelByID, already in a tx
-func removeMessagesByChannelTx(tx pgx.Tx, channelName string) (int64, error) {
 	cmd, err := tx.Exec(context.Background(), `
 		DELETE FROM chatserver.chat_messages
 		WHERE channel = $1
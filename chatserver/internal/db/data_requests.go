@@ -0,0 +1,170 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// dataRequestColumns lists the columns scanned by scanDataRequest.
+const dataRequestColumns = `id, kind, user_id, mode, COALESCE(pseudonym, ''), status, counts, error, requested_by,
+	created_at, started_at, finished_at`
+
+func scanDataRequest(row pgx.Row) (models.DataRequest, error) {
+	var r models.DataRequest
+	err := row.Scan(&r.ID, &r.Kind, &r.UserID, &r.Mode, &r.Pseudonym, &r.Status, &r.Counts, &r.Error,
+		&r.RequestedBy, &r.CreatedAt, &r.StartedAt, &r.FinishedAt)
+	return r, err
+}
+
+// CreateDataRequest records an export or erasure. Requests created running are marked as
+// started. It returns false if the user already has an unfinished erasure.
+func CreateDataRequest(db *pgxpool.Pool, request models.DataRequest) (models.DataRequest, bool, error) {
+	created, err := scanDataRequest(db.QueryRow(context.Background(), `
+		INSERT INTO chatserver.data_requests (kind, user_id, mode, pseudonym, status, requested_by, started_at)
+		VALUES ($1, $2, $3, NULLIF($4, ''), $5, $6, CASE WHEN $5 = 'running' THEN now() END)
+		ON CONFLICT DO NOTHING
+		RETURNING `+dataRequestColumns,
+		request.Kind, request.UserID, request.Mode, request.Pseudonym, request.Status, request.RequestedBy))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return created, false, nil
+	}
+	if err != nil {
+		return created, false, fmt.Errorf("failed to create data request: %w", err)
+	}
+	return created, true, nil
+}
+
+// ClaimDataRequest marks a pending request as running. Requests left running for over an
+// hour, by a server that stopped, can be claimed again. It returns false if the request
+// is finished or running elsewhere.
+func ClaimDataRequest(db *pgxpool.Pool, id int) (models.DataRequest, bool, error) {
+	request, err := scanDataRequest(db.QueryRow(context.Background(), `
+		UPDATE chatserver.data_requests
+		SET status = 'running', started_at = now()
+		WHERE id = $1
+			AND (status = 'pending' OR (status = 'running' AND started_at < now() - INTERVAL '1 hour'))
+		RETURNING `+dataRequestColumns, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return request, false, nil
+	}
+	if err != nil {
+		return request, false, fmt.Errorf("failed to claim data request %d: %w", id, err)
+	}
+	return request, true, nil
+}
+
+// FinishDataRequest records the outcome of a request: completed with counts, or failed
+// with the error.
+func FinishDataRequest(db *pgxpool.Pool, id int, counts map[string]int64, failure error) error {
+	status, message := models.DataRequestCompleted, ""
+	if failure != nil {
+		status, message = models.DataRequestFailed, failure.Error()
+	}
+	if counts == nil {
+		counts = map[string]int64{}
+	}
+
+	_, err := db.Exec(context.Background(), `
+		UPDATE chatserver.data_requests
+		SET status = $2, counts = $3, error = $4, finished_at = now()
+		WHERE id = $1
+	`, id, status, counts, message)
+	if err != nil {
+		return fmt.Errorf("failed to finish data request %d: %w", id, err)
+	}
+	return nil
+}
+
+// FindDataRequest returns the request with the given ID.
+func FindDataRequest(db *pgxpool.Pool, id int) (models.DataRequest, bool, error) {
+	request, err := scanDataRequest(db.QueryRow(context.Background(),
+		`SELECT `+dataRequestColumns+` FROM chatserver.data_requests WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return request, false, nil
+	}
+	if err != nil {
+		return request, false, fmt.Errorf("failed to look up data request %d: %w", id, err)
+	}
+	return request, true, nil
+}
+
+// FetchDataRequests retrieves requests newest first, optionally only one user's, one kind
+// or those with the given status.
+// It returns:
+//  1. A slice of DataRequest objects
+//  2. PageInfo describing whether more requests exist and the cursors around this page
+//  3. An error, if any
+func FetchDataRequests(db *pgxpool.Pool, userID, kind, status string, page PageRequest) ([]models.DataRequest, PageInfo, error) {
+	var conditions []string
+	var args []interface{}
+	for _, filter := range [][2]string{{"user_id", userID}, {"kind", kind}, {"status", status}} {
+		if filter[1] != "" {
+			args = append(args, filter[1])
+			conditions = append(conditions, fmt.Sprintf("%s = $%d", filter[0], len(args)))
+		}
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, args)
+
+	query := `SELECT ` + dataRequestColumns + ` FROM chatserver.data_requests`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch data requests: %w", err)
+	}
+	defer rows.Close()
+
+	requests := []models.DataRequest{}
+	for rows.Next() {
+		request, err := scanDataRequest(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan data request: %w", err)
+		}
+		requests = append(requests, request)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over data request rows: %w", err)
+	}
+
+	requests, info := finishPage(requests, page, func(request models.DataRequest) Cursor {
+		return Cursor{At: request.CreatedAt, ID: strconv.Itoa(request.ID)}
+	})
+	return requests, info, nil
+}
+
+// FetchUnfinishedErasures returns the IDs of erasures that are pending or were left running
+// for over an hour, oldest first.
+func FetchUnfinishedErasures(db *pgxpool.Pool) ([]int, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT id FROM chatserver.data_requests
+		WHERE kind = 'erase'
+			AND (status = 'pending' OR (status = 'running' AND started_at < now() - INTERVAL '1 hour'))
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch unfinished erasures: %w", err)
+	}
+	defer rows.Close()
+
+	var ids []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("failed to scan erasure ID: %w", err)
+		}
+		ids = append(ids, id)
+	}
+	return ids, rows.Err()
+}
@@ -0,0 +1,165 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SaveMentions stores mentions, skipping users already mentioned by the same message.
+// It returns the mentions that were stored, with their IDs and creation times.
+func SaveMentions(db *pgxpool.Pool, mentions []models.Mention) ([]models.Mention, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var saved []models.Mention
+	for _, mention := range mentions {
+		rows, err := tx.Query(ctx, `
+			INSERT INTO chatserver.mentions (user_id, cache_id, channel, author_id, author_username, kind)
+			VALUES ($1, $2, $3, $4, $5, $6)
+			ON CONFLICT (user_id, cache_id) DO NOTHING
+			RETURNING id, created_at
+		`, mention.UserID, mention.CacheID, mention.Channel, mention.AuthorID, mention.AuthorUsername, mention.Kind)
+		if err != nil {
+			return nil, fmt.Errorf("failed to save mention: %w", err)
+		}
+
+		// No row comes back when the mention already existed
+		inserted := false
+		for rows.Next() {
+			if err := rows.Scan(&mention.ID, &mention.CreatedAt); err != nil {
+				rows.Close()
+				return nil, fmt.Errorf("failed to scan mention: %w", err)
+			}
+			inserted = true
+		}
+		rows.Close()
+		if err := rows.Err(); err != nil {
+			return nil, fmt.Errorf("failed to save mention: %w", err)
+		}
+
+		if inserted {
+			saved = append(saved, mention)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit mentions: %w", err)
+	}
+	return saved, nil
+}
+
+// FetchMentions retrieves the mentions of userID, newest first, optionally only those
+// not read yet. Each mention includes the text of its message once the message has
+// been flushed to the database.
+// It returns:
+//  1. A slice of Mention objects
+//  2. PageInfo describing whether more mentions exist and the cursors around this page
+//  3. An error, if any
+func FetchMentions(db *pgxpool.Pool, userID string, unreadOnly bool, page PageRequest) ([]models.Mention, PageInfo, error) {
+	conditions := []string{"n.user_id = $1"}
+	args := []interface{}{userID}
+	if unreadOnly {
+		conditions = append(conditions, "n.read_at IS NULL")
+	}
+
+	conditions, args, pageClause := page.keyset("n.created_at", "n.id", "INT", conditions, args)
+
+	query := fmt.Sprintf(`
+		SELECT n.id, n.user_id, n.cache_id, n.channel, n.author_id, n.author_username, n.kind,
+			COALESCE(m.message, ''), n.created_at, n.read_at
+		FROM chatserver.mentions n
+		LEFT JOIN chatserver.chat_messages m ON m.cache_id = n.cache_id
+		WHERE %s
+	`, strings.Join(conditions, " AND "))
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch mentions: %w", err)
+	}
+	defer rows.Close()
+
+	mentions := []models.Mention{}
+	for rows.Next() {
+		var mention models.Mention
+		err := rows.Scan(
+			&mention.ID, &mention.UserID, &mention.CacheID, &mention.Channel, &mention.AuthorID,
+			&mention.AuthorUsername, &mention.Kind, &mention.Message, &mention.CreatedAt, &mention.ReadAt,
+		)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan mention row: %w", err)
+		}
+		mentions = append(mentions, mention)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over mention rows: %w", err)
+	}
+
+	mentions, info := finishPage(mentions, page, func(mention models.Mention) Cursor {
+		return Cursor{At: mention.CreatedAt, ID: strconv.Itoa(mention.ID)}
+	})
+	return mentions, info, nil
+}
+
+// CountUnreadMentions returns how many of userID's mentions have not been read.
+func CountUnreadMentions(db *pgxpool.Pool, userID string) (int, error) {
+	var count int
+	err := db.QueryRow(context.Background(), `
+		SELECT COUNT(*) FROM chatserver.mentions WHERE user_id = $1 AND read_at IS NULL
+	`, userID).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count unread mentions: %w", err)
+	}
+	return count, nil
+}
+
+// MarkMentionsRead marks the given mentions of userID as read, or all of them if no IDs
+// are given. It returns the number of mentions that changed.
+func MarkMentionsRead(db *pgxpool.Pool, userID string, ids []int) (int64, error) {
+	query := `UPDATE chatserver.mentions SET read_at = now() WHERE user_id = $1 AND read_at IS NULL`
+	args := []interface{}{userID}
+	if len(ids) > 0 {
+		query += ` AND id = ANY($2)`
+		args = append(args, ids)
+	}
+
+	cmd, err := db.Exec(context.Background(), query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("failed to mark mentions read: %w", err)
+	}
+	return cmd.RowsAffected(), nil
+}
+
+// FetchChannelAudience returns the users following a channel, which are those who have
+// read it at least once.
+func FetchChannelAudience(db *pgxpool.Pool, channel string) ([]string, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT user_id FROM chatserver.read_markers WHERE channel = $1
+	`, channel)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch channel audience: %w", err)
+	}
+	defer rows.Close()
+
+	var userIDs []string
+	for rows.Next() {
+		var userID string
+		if err := rows.Scan(&userID); err != nil {
+			return nil, fmt.Errorf("failed to scan channel audience: %w", err)
+		}
+		userIDs = append(userIDs, userID)
+	}
+	return userIDs, rows.Err()
+}
@@ -4,50 +4,65 @@ import (
 	"context"
 	"fmt"
 	"log"
+	"strconv"
 	"strings"
+	"time"
 
+	"onrabble.com/chatserver/internal/format"
 	"onrabble.com/chatserver/internal/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// FetchMessages retrieves cchat messages from the database.
-// Filters can be applied via userID, channels, and keywords.
-// Pagination is controlled by 'limit' and 'offset'.
+// MessageFilter narrows the chat messages returned by FetchMessages.
+// Zero values disable the corresponding filter.
+type MessageFilter struct {
+	UserID        string     // Only messages authored by this user
+	Channels      []string   // Only messages posted in these channels
+	Keyword       string     // Web search syntax: quoted phrases, OR and -negation
+	From          *time.Time // Only messages authored at or after this time
+	To            *time.Time // Only messages authored before this time
+	BeforeCacheID int        // Only messages cached before this cacheID
+	ReplyTo       int        // Only replies in the thread started by this cacheID
+	Relevance     bool       // Order keyword matches by rank instead of recency
+	ByCacheID     bool       // Order by cacheID, newest first, to page consistently with BeforeCacheID
+}
+
+// headlineOptions controls the snippets produced by ts_headline.
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxWords=35, MinWords=15, MaxFragments=2"
+
+// escapedMessage escapes HTML in the message column so highlighted snippets are safe to render.
+const escapedMessage = "replace(replace(replace(m.message, '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+
+// FetchMessages retrieves cchat messages from the database, newest first.
+// Filters can be applied via userID, channels, keywords, date bounds and cacheID.
+// Keywords are matched with each message's channel text search language, and matches
+// carry a rank and a highlighted snippet. Pagination is controlled by the page's keyset
+// cursors and limit, or by limit and offset when ordering by relevance or cacheID.
 // It returns:
 // 1) A slice of ChatMessage objects.
-// 2) A boolean indicating whether there are more results beyond this page.
+// 2) PageInfo describing whether more results exist and the cursors around this page.
 // 3) An error, if any occurred.
-func FetchMessages(db *pgxpool.Pool, userID string, channels []string, keyword string, limit, offset int) ([]models.ChatMessage, bool, error) {
-	var query string
+func FetchMessages(db *pgxpool.Pool, filter MessageFilter, page PageRequest) ([]models.ChatMessage, PageInfo, error) {
 	var args []interface{}
 	var conditions []string
 
-	query = `
-		SELECT 
-			m.id, 
-			m.owner_id, 
-			COALESCE(u.username, '[Unknown]') AS username, 
-			m.channel, 
-			m.message, 
-			m.authored_at
-		FROM chatserver.chat_messages m
-		LEFT JOIN keycloak.public.user_entity u ON m.owner_id::TEXT = u.id
-	`
+	rankColumn := "0::REAL"
+	snippetColumn := "''"
 
 	argIndex := 1
 
 	// Filter by user if provided
-	if userID != "" {
+	if filter.UserID != "" {
 		conditions = append(conditions, fmt.Sprintf("m.owner_id = $%d", argIndex))
-		args = append(args, userID)
+		args = append(args, filter.UserID)
 		argIndex++
 	}
 
 	// Filter by channels if provided
-	if len(channels) > 0 {
+	if len(filter.Channels) > 0 {
 		placeholders := []string{}
-		for _, channel := range channels {
+		for _, channel := range filter.Channels {
 			placeholders = append(placeholders, fmt.Sprintf("$%d", argIndex))
 			args = append(args, channel)
 			argIndex++
@@ -56,49 +71,163 @@ func FetchMessages(db *pgxpool.Pool, userID string, channels []string, keyword s
 	}
 
 	// Filter by keyword if provided
-	if keyword != "" {
-		conditions = append(conditions, fmt.Sprintf("m.search_vector @@ plainto_tsquery('english', $%d)", argIndex))
-		args = append(args, keyword)
+	if filter.Keyword != "" {
+		languages, err := searchLanguages(db, filter.Channels)
+		if err != nil {
+			return nil, PageInfo{}, err
+		}
+
+		keywordIndex := argIndex
+		args = append(args, filter.Keyword)
+		argIndex++
+
+		// Match each language separately so every branch can use the GIN index
+		var matches []string
+		for _, language := range languages {
+			matches = append(matches, fmt.Sprintf(
+				"(m.search_language = $%d::REGCONFIG AND m.search_vector @@ websearch_to_tsquery($%d::REGCONFIG, $%d))",
+				argIndex, argIndex, keywordIndex,
+			))
+			args = append(args, language)
+			argIndex++
+		}
+		conditions = append(conditions, "("+strings.Join(matches, " OR ")+")")
+
+		query := fmt.Sprintf("websearch_to_tsquery(m.search_language, $%d)", keywordIndex)
+		rankColumn = fmt.Sprintf("ts_rank(m.search_vector, %s)", query)
+		snippetColumn = fmt.Sprintf("ts_headline(m.search_language, %s, %s, '%s')", escapedMessage, query, headlineOptions)
+	}
+
+	// Filter by date bounds if provided
+	if filter.From != nil {
+		conditions = append(conditions, fmt.Sprintf("m.authored_at >= $%d", argIndex))
+		args = append(args, *filter.From)
+		argIndex++
+	}
+
+	if filter.To != nil {
+		conditions = append(conditions, fmt.Sprintf("m.authored_at < $%d", argIndex))
+		args = append(args, *filter.To)
+		argIndex++
+	}
+
+	// Only include messages older than the given cacheID if provided
+	if filter.BeforeCacheID > 0 {
+		conditions = append(conditions, fmt.Sprintf("m.cache_id < $%d", argIndex))
+		args = append(args, filter.BeforeCacheID)
+		argIndex++
+	}
+
+	// Only include replies to the given thread parent if provided
+	if filter.ReplyTo > 0 {
+		conditions = append(conditions, fmt.Sprintf("m.reply_to_cache_id = $%d", argIndex))
+		args = append(args, filter.ReplyTo)
 		argIndex++
 	}
 
+	ranked := filter.Relevance && filter.Keyword != ""
+
+	// Bound the page by its cursor and order by newest first, or by rank or cacheID when requested
+	var pageClause string
+	switch {
+	case ranked:
+		args, pageClause = page.offset("rank DESC, m.authored_at DESC, m.id DESC", args)
+	case filter.ByCacheID:
+		args, pageClause = page.offset("m.cache_id DESC", args)
+	default:
+		conditions, args, pageClause = page.keyset("m.authored_at", "m.id", "INT", conditions, args)
+	}
+
+	query := fmt.Sprintf(`
+		SELECT 
+			m.id, 
+			m.cache_id, 
+			m.owner_id, 
+			COALESCE(u.username, '[Unknown]') AS username, 
+			m.channel, 
+			m.message, 
+			m.authored_at,
+			COALESCE(m.reply_to_cache_id, 0),
+			%s AS rank,
+			%s AS snippet
+		FROM chatserver.chat_messages m
+		LEFT JOIN keycloak.public.user_entity u ON m.owner_id::TEXT = u.id
+	`, rankColumn, snippetColumn)
+
 	// Combine WHERE conditions
 	if len(conditions) > 0 {
 		query += " WHERE " + strings.Join(conditions, " AND ")
 	}
-
-	// Order by newest first, then apply limit and offset
-	query += fmt.Sprintf(`
-		ORDER BY m.authored_at DESC
-		LIMIT $%d OFFSET $%d;
-	`, argIndex, argIndex+1)
-
-	// Request one extra row to see if more results exist
-	args = append(args, limit+1, offset)
+	query += pageClause
 
 	rows, err := db.Query(context.Background(), query, args...)
 	if err != nil {
-		return nil, false, fmt.Errorf("failed to fetch chat messages: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch chat messages: %w", err)
 	}
 	defer rows.Close()
 
 	searchMessages := []models.ChatMessage{}
 	for rows.Next() {
 		var msg models.ChatMessage
-		if err := rows.Scan(&msg.ID, &msg.OwnerID, &msg.Username, &msg.Channel, &msg.Message, &msg.Sent); err != nil {
-			return nil, false, fmt.Errorf("failed to scan chat message row: %w", err)
+		if err := rows.Scan(&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username, &msg.Channel, &msg.Message, &msg.Sent, &msg.ReplyTo, &msg.Rank, &msg.Snippet); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan chat message row: %w", err)
 		}
+		msg.Content, msg.HTML = format.Render(msg.Message)
 		searchMessages = append(searchMessages, msg)
 	}
 
-	// Determine if there are more messages beyond this 'page'
-	hasMore := len(searchMessages) > limit
-	if hasMore {
-		searchMessages = searchMessages[:limit]
+	var info PageInfo
+	if ranked || filter.ByCacheID {
+		searchMessages, info = finishOffsetPage(searchMessages, page)
+	} else {
+		searchMessages, info = finishPage(searchMessages, page, func(msg models.ChatMessage) Cursor {
+			return Cursor{At: msg.Sent, ID: strconv.Itoa(msg.ID)}
+		})
 	}
 
-	log.Printf("Fetched %d messages from database (user: %s, channels: %v, keyword: %s)", len(searchMessages), userID, channels, keyword)
-	return searchMessages, hasMore, nil
+	if err := AttachChatReactions(db, searchMessages); err != nil {
+		return nil, PageInfo{}, err
+	}
+	if err := AttachThreadSummaries(db, searchMessages); err != nil {
+		return nil, PageInfo{}, err
+	}
+	if err := AttachChatAttachments(db, searchMessages); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	log.Printf("Fetched %d messages from database (user: %s, channels: %v, keyword: %s)", len(searchMessages), filter.UserID, filter.Channels, filter.Keyword)
+	return searchMessages, info, nil
+}
+
+// searchLanguages returns the distinct text search languages used by the given channels,
+// or by every channel when none are given. English is always included since it is the
+// default for messages whose channel no longer exists.
+func searchLanguages(db *pgxpool.Pool, channels []string) ([]string, error) {
+	query := `SELECT DISTINCT search_language::TEXT FROM chatserver.channels`
+	var args []interface{}
+	if len(channels) > 0 {
+		query += ` WHERE name = ANY($1)`
+		args = append(args, channels)
+	}
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch channel search languages: %w", err)
+	}
+	defer rows.Close()
+
+	languages := []string{"english"}
+	for rows.Next() {
+		var language string
+		if err := rows.Scan(&language); err != nil {
+			return nil, fmt.Errorf("failed to scan search language: %w", err)
+		}
+		if language != "english" {
+			languages = append(languages, language)
+		}
+	}
+
+	return languages, rows.Err()
 }
 
 // RemoveMessage is currently unused.
@@ -163,9 +292,43 @@ func RemoveMessages(db *pgxpool.Pool, messageIDs []int) (int64, []int, error) {
 		return 0, nil, fmt.Errorf("failed to delete messages: %w", err)
 	}
 
+	if err := removeChatMessageReferences(db, cacheIDs); err != nil {
+		return 0, nil, err
+	}
+
 	return cmd.RowsAffected(), cacheIDs, nil
 }
 
+// removeChatMessageReferences deletes the reactions, mentions and pins of deleted chat
+// messages and detaches their attachments. These reference messages by cacheID, so they are
+// not removed along with the messages.
+func removeChatMessageReferences(db execer, cacheIDs []int) error {
+	ctx := context.Background()
+
+	_, err := db.Exec(ctx, `
+		DELETE FROM chatserver.message_reactions WHERE target = $1 AND cache_id = ANY($2)
+	`, models.ReactionTargetChat, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+
+	_, err = db.Exec(ctx, `DELETE FROM chatserver.mentions WHERE cache_id = ANY($1)`, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete mentions: %w", err)
+	}
+
+	_, err = db.Exec(ctx, `DELETE FROM chatserver.channel_pins WHERE cache_id = ANY($1)`, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete pins: %w", err)
+	}
+
+	_, err = db.Exec(ctx, unlinkAttachmentsQuery+`WHERE target = $1 AND cache_id = ANY($2)`, models.ReactionTargetChat, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to unlink attachments: %w", err)
+	}
+	return nil
+}
+
 // FlushPrivateMessages inserts a batch of private messages into the database.
 func FlushPrivateMessages(db *pgxpool.Pool, messages []models.PrivateChatMessage) error {
 	ctx := context.Background()
@@ -0,0 +1,153 @@
+package db
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"slices"
+	"time"
+)
+
+// Cursor marks a row's position in a listing ordered newest first by (timestamp, id).
+type Cursor struct {
+	At time.Time
+	ID string
+}
+
+// cursorToken is the JSON shape wrapped inside an encoded cursor.
+type cursorToken struct {
+	At int64  `json:"t"`
+	ID string `json:"id"`
+}
+
+// Encode returns the opaque token handed to API clients for this cursor.
+func (c Cursor) Encode() string {
+	data, _ := json.Marshal(cursorToken{At: c.At.UnixNano(), ID: c.ID})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// DecodeCursor parses a token produced by Cursor.Encode.
+func DecodeCursor(token string) (Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor encoding: %w", err)
+	}
+
+	var decoded cursorToken
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return Cursor{}, fmt.Errorf("invalid cursor contents: %w", err)
+	}
+	if decoded.ID == "" {
+		return Cursor{}, errors.New("cursor is missing an ID")
+	}
+
+	// Timestamps are stored without a zone, so keep the wall clock in UTC as pgx scans it
+	return Cursor{At: time.Unix(0, decoded.At).UTC(), ID: decoded.ID}, nil
+}
+
+// PageRequest describes one page of a listing ordered newest first.
+// Before pages towards older rows and After towards newer rows; at most one may be set.
+// Offset is only honoured when neither cursor is set, for clients that predate cursors.
+type PageRequest struct {
+	Before *Cursor
+	After  *Cursor
+	Limit  int
+	Offset int
+}
+
+// PageInfo describes where a page sits within its listing.
+type PageInfo struct {
+	HasMore    bool   // Older rows exist beyond this page
+	NextCursor string // Token for the next (older) page, if any
+	PrevCursor string // Token for the previous (newer) page, if any
+}
+
+// keyset appends the cursor bound for a listing ordered by (timeColumn, idColumn) to
+// conditions and args, and returns the ORDER BY and LIMIT/OFFSET clauses to use.
+// idType is the SQL type the cursor ID is cast to before comparison.
+func (p PageRequest) keyset(timeColumn, idColumn, idType string, conditions []string, args []interface{}) ([]string, []interface{}, string) {
+	argIndex := len(args) + 1
+	direction := "DESC"
+
+	switch {
+	case p.Before != nil:
+		conditions = append(conditions, fmt.Sprintf("(%s, %s) < ($%d, $%d::%s)", timeColumn, idColumn, argIndex, argIndex+1, idType))
+		args = append(args, p.Before.At, p.Before.ID)
+		argIndex += 2
+	case p.After != nil:
+		// Read forwards from the cursor and flip the rows back once scanned
+		conditions = append(conditions, fmt.Sprintf("(%s, %s) > ($%d, $%d::%s)", timeColumn, idColumn, argIndex, argIndex+1, idType))
+		args = append(args, p.After.At, p.After.ID)
+		argIndex += 2
+		direction = "ASC"
+	}
+
+	// Request one extra row to see if more results exist
+	clause := fmt.Sprintf(" ORDER BY %s %s, %s %s LIMIT $%d", timeColumn, direction, idColumn, direction, argIndex)
+	args = append(args, p.Limit+1)
+
+	if p.Before == nil && p.After == nil && p.Offset > 0 {
+		clause += fmt.Sprintf(" OFFSET $%d", argIndex+1)
+		args = append(args, p.Offset)
+	}
+
+	return conditions, args, clause
+}
+
+// offset returns the ORDER BY and LIMIT/OFFSET clauses for listings that cannot be paged
+// by cursor, such as search results ordered by relevance. Cursors are ignored.
+func (p PageRequest) offset(order string, args []interface{}) ([]interface{}, string) {
+	// Request one extra row to see if more results exist
+	clause := fmt.Sprintf(" ORDER BY %s LIMIT $%d OFFSET $%d", order, len(args)+1, len(args)+2)
+	return append(args, p.Limit+1, p.Offset), clause
+}
+
+// finishOffsetPage trims the extra row requested by offset. Offset pages carry no cursors.
+func finishOffsetPage[T any](rows []T, p PageRequest) ([]T, PageInfo) {
+	extra := len(rows) > p.Limit
+	if extra {
+		rows = rows[:p.Limit]
+	}
+	return rows, PageInfo{HasMore: extra}
+}
+
+// finishPage trims the extra row requested by keyset, restores newest-first order and
+// builds the cursors surrounding the page.
+func finishPage[T any](rows []T, p PageRequest, cursorOf func(T) Cursor) ([]T, PageInfo) {
+	extra := len(rows) > p.Limit
+	if extra {
+		rows = rows[:p.Limit]
+	}
+	if p.After != nil {
+		slices.Reverse(rows)
+	}
+
+	var info PageInfo
+	if len(rows) == 0 {
+		info.HasMore = extra && p.After == nil
+		return rows, info
+	}
+
+	newest := cursorOf(rows[0]).Encode()
+	oldest := cursorOf(rows[len(rows)-1]).Encode()
+
+	if p.After != nil {
+		// The row the cursor points at is older than this page
+		info.HasMore = true
+		if extra {
+			info.PrevCursor = newest
+		}
+	} else {
+		info.HasMore = extra
+		if p.Before != nil || p.Offset > 0 {
+			info.PrevCursor = newest
+		}
+	}
+
+	if info.HasMore {
+		info.NextCursor = oldest
+	}
+
+	return rows, info
+}
@@ -0,0 +1,132 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxPinsPerChannel caps how many messages a channel can have pinned at once.
+const maxPinsPerChannel = 50
+
+// ErrPinLimitReached is returned by PinMessage when the channel already has maxPinsPerChannel pins.
+var ErrPinLimitReached = errors.New("channel has reached its pin limit")
+
+// PinMessage pins the message with the given cacheID to a channel. cachedChannel names the
+// channel of a message still waiting to be flushed, and is empty for stored messages.
+// Pinning a message that is already pinned succeeds without changes.
+// It returns false if the message does not exist in that channel.
+func PinMessage(db *pgxpool.Pool, channelID, cacheID int, pinnedBy, cachedChannel string) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Lock the channel so concurrent pins cannot exceed the limit
+	var exists, pinned bool
+	var count int
+	err = tx.QueryRow(ctx, `
+		SELECT
+			($3 <> '' AND c.name = $3) OR EXISTS (
+				SELECT 1 FROM chatserver.chat_messages m
+				WHERE m.cache_id = $2 AND m.channel = c.name
+			),
+			EXISTS (
+				SELECT 1 FROM chatserver.channel_pins p
+				WHERE p.channel_id = c.id AND p.cache_id = $2
+			),
+			(SELECT COUNT(*) FROM chatserver.channel_pins p WHERE p.channel_id = c.id)
+		FROM chatserver.channels c
+		WHERE c.id = $1
+		FOR UPDATE
+	`, channelID, cacheID, cachedChannel).Scan(&exists, &pinned, &count)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to check message %d in channel %d: %w", cacheID, channelID, err)
+	}
+	if !exists {
+		return false, nil
+	}
+	if pinned {
+		return true, nil
+	}
+	if count >= maxPinsPerChannel {
+		return false, ErrPinLimitReached
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO chatserver.channel_pins (channel_id, cache_id, pinned_by)
+		VALUES ($1, $2, $3)
+	`, channelID, cacheID, pinnedBy)
+	if err != nil {
+		return false, fmt.Errorf("failed to pin message: %w", err)
+	}
+
+	return true, tx.Commit(ctx)
+}
+
+// UnpinMessage removes a pin. It returns false if the message was not pinned.
+func UnpinMessage(db *pgxpool.Pool, channelID, cacheID int) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `
+		DELETE FROM chatserver.channel_pins WHERE channel_id = $1 AND cache_id = $2
+	`, channelID, cacheID)
+	if err != nil {
+		return false, fmt.Errorf("failed to unpin message: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// FetchChannelPins returns the pinned messages of a channel, or of every channel when
+// channelID is zero, newest pin first. Pins of messages not flushed yet only carry the
+// message's cacheID.
+// It returns the pins keyed by channel ID.
+func FetchChannelPins(db *pgxpool.Pool, channelID int) (map[int][]models.Pin, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT p.channel_id, p.cache_id, p.pinned_by, p.pinned_at,
+			m.id IS NOT NULL, COALESCE(m.id, 0), COALESCE(m.owner_id, ''), COALESCE(u.username, '[Unknown]'),
+			COALESCE(m.channel, ''), COALESCE(m.message, ''), COALESCE(m.authored_at, p.pinned_at)
+		FROM chatserver.channel_pins p
+		LEFT JOIN chatserver.chat_messages m ON m.cache_id = p.cache_id
+		LEFT JOIN keycloak.public.user_entity u ON m.owner_id::TEXT = u.id
+		WHERE $1 = 0 OR p.channel_id = $1
+		ORDER BY p.pinned_at DESC, p.id DESC
+	`, channelID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch pins: %w", err)
+	}
+	defer rows.Close()
+
+	pins := make(map[int][]models.Pin)
+	for rows.Next() {
+		var pin models.Pin
+		var stored bool
+		err := rows.Scan(
+			&pin.ChannelID, &pin.CacheID, &pin.PinnedBy, &pin.PinnedAt,
+			&stored, &pin.Message.ID, &pin.Message.OwnerID, &pin.Message.Username, &pin.Message.Channel,
+			&pin.Message.Message, &pin.Message.Sent,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan pin row: %w", err)
+		}
+		if stored {
+			pin.Message.Content, pin.Message.HTML = format.Render(pin.Message.Message)
+		} else {
+			pin.Message = models.ChatMessage{}
+		}
+		pin.Message.CacheID = pin.CacheID
+		pins[pin.ChannelID] = append(pins[pin.ChannelID], pin)
+	}
+
+	return pins, rows.Err()
+}
@@ -0,0 +1,249 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// PrivateMessageFilter narrows the private messages returned by FetchPrivateMessages.
+// Zero values disable the corresponding filter.
+type PrivateMessageFilter struct {
+	PeerID  string     // Only messages exchanged with this user
+	Keyword string     // Web search syntax: quoted phrases, OR and -negation
+	From    *time.Time // Only messages authored at or after this time
+	To      *time.Time // Only messages authored before this time
+}
+
+// FetchPrivateMessages retrieves stored private messages sent or received by userID,
+// newest first. Results are always scoped to conversations the user took part in.
+// Keyword matches carry a rank and a highlighted snippet.
+// It returns:
+//  1. A slice of PrivateChatMessage objects
+//  2. PageInfo describing whether more results exist and the cursors around this page
+//  3. An error, if any
+func FetchPrivateMessages(db *pgxpool.Pool, userID string, filter PrivateMessageFilter, page PageRequest) ([]models.PrivateChatMessage, PageInfo, error) {
+	args := []interface{}{userID}
+	conditions := []string{"(m.owner_id = $1 OR m.recipient_id = $1)"}
+	argIndex := 2
+
+	rankColumn := "0::REAL"
+	snippetColumn := "''"
+
+	// Narrow to a single conversation if a peer is provided
+	if filter.PeerID != "" {
+		conditions = append(conditions, fmt.Sprintf(
+			"((m.owner_id = $1 AND m.recipient_id = $%d) OR (m.owner_id = $%d AND m.recipient_id = $1))",
+			argIndex, argIndex,
+		))
+		args = append(args, filter.PeerID)
+		argIndex++
+	}
+
+	// Private messages are indexed with the English configuration
+	if filter.Keyword != "" {
+		query := fmt.Sprintf("websearch_to_tsquery('english', $%d)", argIndex)
+		conditions = append(conditions, "m.search_vector @@ "+query)
+		args = append(args, filter.Keyword)
+		argIndex++
+
+		rankColumn = fmt.Sprintf("ts_rank(m.search_vector, %s)", query)
+		snippetColumn = fmt.Sprintf("ts_headline('english', %s, %s, '%s')", escapedMessage, query, headlineOptions)
+	}
+
+	if filter.From != nil {
+		conditions = append(conditions, fmt.Sprintf("m.authored_at >= $%d", argIndex))
+		args = append(args, *filter.From)
+		argIndex++
+	}
+
+	if filter.To != nil {
+		conditions = append(conditions, fmt.Sprintf("m.authored_at < $%d", argIndex))
+		args = append(args, *filter.To)
+		argIndex++
+	}
+
+	conditions, args, pageClause := page.keyset("m.authored_at", "m.id", "INT", conditions, args)
+
+	query := fmt.Sprintf(`
+		SELECT
+			m.id,
+			m.cache_id,
+			m.owner_id,
+			m.username,
+			m.recipient_id,
+			m.recipient,
+			m.message,
+			m.authored_at,
+			%s AS rank,
+			%s AS snippet
+		FROM chatserver.private_messages m
+		WHERE %s
+	`, rankColumn, snippetColumn, strings.Join(conditions, " AND "))
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch private messages: %w", err)
+	}
+	defer rows.Close()
+
+	privateMessages := []models.PrivateChatMessage{}
+	for rows.Next() {
+		var msg models.PrivateChatMessage
+		err := rows.Scan(
+			&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username, &msg.RecipientID,
+			&msg.Recipient, &msg.Message, &msg.Sent, &msg.Rank, &msg.Snippet,
+		)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan private message row: %w", err)
+		}
+		msg.Content, msg.HTML = format.Render(msg.Message)
+		privateMessages = append(privateMessages, msg)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over private message rows: %w", err)
+	}
+
+	privateMessages, info := finishPage(privateMessages, page, func(msg models.PrivateChatMessage) Cursor {
+		return Cursor{At: msg.Sent, ID: strconv.Itoa(msg.ID)}
+	})
+
+	if err := AttachPrivateReactions(db, privateMessages); err != nil {
+		return nil, PageInfo{}, err
+	}
+	if err := AttachPrivateAttachments(db, privateMessages); err != nil {
+		return nil, PageInfo{}, err
+	}
+
+	log.Printf("Fetched %d private messages for %s (peer: %s, keyword: %s)", len(privateMessages), userID, filter.PeerID, filter.Keyword)
+	return privateMessages, info, nil
+}
+
+// FetchConversations lists every private conversation userID has taken part in, most
+// recently active first, with the last message exchanged and the number of messages
+// from the peer that userID has not read yet.
+func FetchConversations(db *pgxpool.Pool, userID string) ([]models.Conversation, error) {
+	query := `
+		SELECT * FROM (
+			SELECT DISTINCT ON (peer_id)
+				peer_id,
+				CASE WHEN m.owner_id = $1 THEN m.recipient ELSE m.username END AS peer_username,
+				m.id,
+				m.cache_id,
+				m.owner_id,
+				m.username,
+				m.recipient_id,
+				m.recipient,
+				m.message,
+				m.authored_at,
+				(
+					SELECT COUNT(*)
+					FROM chatserver.private_messages u
+					LEFT JOIN chatserver.read_markers r
+						ON r.user_id = u.recipient_id AND r.peer_id = u.owner_id
+					WHERE u.recipient_id = $1
+					AND u.owner_id = peer_id
+					AND u.owner_id <> u.recipient_id
+					AND u.cache_id > COALESCE(r.last_read_cache_id, 0)
+				) AS unread_count
+			FROM chatserver.private_messages m
+			CROSS JOIN LATERAL (
+				SELECT CASE WHEN m.owner_id = $1 THEN m.recipient_id ELSE m.owner_id END AS peer_id
+			) p
+			WHERE m.owner_id = $1 OR m.recipient_id = $1
+			ORDER BY peer_id, m.authored_at DESC, m.id DESC
+		) conversations
+		ORDER BY authored_at DESC
+	`
+
+	rows, err := db.Query(context.Background(), query, userID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch conversations: %w", err)
+	}
+	defer rows.Close()
+
+	conversations := []models.Conversation{}
+	for rows.Next() {
+		var c models.Conversation
+		msg := &c.LastMessage
+		err := rows.Scan(
+			&c.PeerID, &c.PeerUsername, &msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username,
+			&msg.RecipientID, &msg.Recipient, &msg.Message, &msg.Sent, &c.UnreadCount,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan conversation row: %w", err)
+		}
+		msg.Content, msg.HTML = format.Render(msg.Message)
+		conversations = append(conversations, c)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("error iterating over conversation rows: %w", err)
+	}
+
+	log.Printf("Fetched %d conversations for %s", len(conversations), userID)
+	return conversations, nil
+}
+
+// ConversationExists reports whether userID and peerID have exchanged a stored private message.
+func ConversationExists(db *pgxpool.Pool, userID, peerID string) (bool, error) {
+	var exists bool
+	err := db.QueryRow(context.Background(), `
+		SELECT EXISTS (
+			SELECT 1 FROM chatserver.private_messages
+			WHERE (owner_id = $1 AND recipient_id = $2) OR (owner_id = $2 AND recipient_id = $1)
+		)
+	`, userID, peerID).Scan(&exists)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up conversation with %s: %w", peerID, err)
+	}
+	return exists, nil
+}
+
+// RemovePrivateMessage deletes a stored private message by cacheID along with its reactions,
+// detaching its attachments. It returns false if no such message is stored.
+func RemovePrivateMessage(db *pgxpool.Pool, cacheID int) (bool, error) {
+	ctx := context.Background()
+
+	cmd, err := db.Exec(ctx, `DELETE FROM chatserver.private_messages WHERE cache_id = $1`, cacheID)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete private message %d: %w", cacheID, err)
+	}
+	if cmd.RowsAffected() == 0 {
+		return false, nil
+	}
+
+	if err := removePrivateMessageReferences(db, []int{cacheID}); err != nil {
+		return false, err
+	}
+	return true, nil
+}
+
+// removePrivateMessageReferences deletes the reactions of deleted private messages and
+// detaches their attachments.
+func removePrivateMessageReferences(db execer, cacheIDs []int) error {
+	ctx := context.Background()
+
+	_, err := db.Exec(ctx, `
+		DELETE FROM chatserver.message_reactions WHERE target = $1 AND cache_id = ANY($2)
+	`, models.ReactionTargetPrivate, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to delete reactions: %w", err)
+	}
+
+	_, err = db.Exec(ctx, unlinkAttachmentsQuery+`WHERE target = $1 AND cache_id = ANY($2)`, models.ReactionTargetPrivate, cacheIDs)
+	if err != nil {
+		return fmt.Errorf("failed to unlink attachments: %w", err)
+	}
+	return nil
+}
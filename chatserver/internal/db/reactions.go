@@ -0,0 +1,209 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxReactionsPerUser caps how many different emojis one user can react to a message with.
+const maxReactionsPerUser = 10
+
+// maxEmojisPerMessage caps how many different emojis a message can be reacted to with.
+const maxEmojisPerMessage = 20
+
+// ErrReactionLimitReached is returned by AddReaction when the user or the message already
+// has as many different reactions as allowed.
+var ErrReactionLimitReached = errors.New("reaction limit reached")
+
+// AddReaction records a reaction. It returns false if the user had already reacted to the
+// message with the same emoji, and ErrReactionLimitReached if the reaction would take the
+// user past maxReactionsPerUser or the message past maxEmojisPerMessage.
+func AddReaction(db *pgxpool.Pool, reaction models.Reaction) (bool, error) {
+	ctx := context.Background()
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return false, fmt.Errorf("failed to start transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	// Serialize reactions to the same message so concurrent ones cannot exceed the limits
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock(hashtext($1), $2::INT)`, reaction.Target, reaction.CacheID)
+	if err != nil {
+		return false, fmt.Errorf("failed to lock message %d: %w", reaction.CacheID, err)
+	}
+
+	var exists, newEmoji bool
+	var userCount, emojiCount int
+	err = tx.QueryRow(ctx, `
+		SELECT
+			COALESCE(BOOL_OR(user_id = $3 AND emoji = $4), FALSE),
+			NOT COALESCE(BOOL_OR(emoji = $4), FALSE),
+			COUNT(*) FILTER (WHERE user_id = $3),
+			COUNT(DISTINCT emoji)
+		FROM chatserver.message_reactions
+		WHERE target = $1 AND cache_id = $2
+	`, reaction.Target, reaction.CacheID, reaction.UserID, reaction.Emoji).Scan(&exists, &newEmoji, &userCount, &emojiCount)
+	if err != nil {
+		return false, fmt.Errorf("failed to count reactions: %w", err)
+	}
+	if exists {
+		return false, nil
+	}
+	if userCount >= maxReactionsPerUser || (newEmoji && emojiCount >= maxEmojisPerMessage) {
+		return false, ErrReactionLimitReached
+	}
+
+	_, err = tx.Exec(ctx, `
+		INSERT INTO chatserver.message_reactions (target, cache_id, user_id, emoji)
+		VALUES ($1, $2, $3, $4)
+	`, reaction.Target, reaction.CacheID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return false, fmt.Errorf("failed to add reaction: %w", err)
+	}
+	return true, tx.Commit(ctx)
+}
+
+// RemoveReaction deletes a reaction. It returns false if there was nothing to remove.
+func RemoveReaction(db *pgxpool.Pool, reaction models.Reaction) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `
+		DELETE FROM chatserver.message_reactions
+		WHERE target = $1 AND cache_id = $2 AND user_id = $3 AND emoji = $4
+	`, reaction.Target, reaction.CacheID, reaction.UserID, reaction.Emoji)
+	if err != nil {
+		return false, fmt.Errorf("failed to remove reaction: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// FetchReactionCounts aggregates the reactions to the given messages of one target kind.
+// Emojis are ordered by when they were first used on each message.
+// It returns the counts keyed by cacheID; messages without reactions are omitted.
+func FetchReactionCounts(db *pgxpool.Pool, target string, cacheIDs []int) (map[int][]models.ReactionCount, error) {
+	counts := make(map[int][]models.ReactionCount)
+	if len(cacheIDs) == 0 {
+		return counts, nil
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT cache_id, emoji, COUNT(*), array_agg(user_id ORDER BY created_at, id)
+		FROM chatserver.message_reactions
+		WHERE target = $1 AND cache_id = ANY($2)
+		GROUP BY cache_id, emoji
+		ORDER BY cache_id, MIN(created_at), emoji
+	`, target, cacheIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch reactions: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cacheID int
+		var count models.ReactionCount
+		if err := rows.Scan(&cacheID, &count.Emoji, &count.Count, &count.UserIDs); err != nil {
+			return nil, fmt.Errorf("failed to scan reaction count: %w", err)
+		}
+		counts[cacheID] = append(counts[cacheID], count)
+	}
+
+	return counts, rows.Err()
+}
+
+// FindCacheIDByMessageID returns the cacheID of a stored message given its database ID.
+func FindCacheIDByMessageID(db *pgxpool.Pool, target string, messageID int) (int, bool, error) {
+	table := "chatserver.chat_messages"
+	if target == models.ReactionTargetPrivate {
+		table = "chatserver.private_messages"
+	}
+
+	var cacheID int
+	err := db.QueryRow(context.Background(),
+		fmt.Sprintf(`SELECT cache_id FROM %s WHERE id = $1`, table), messageID,
+	).Scan(&cacheID)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return 0, false, nil
+	}
+	if err != nil {
+		return 0, false, fmt.Errorf("failed to look up message %d: %w", messageID, err)
+	}
+	return cacheID, true, nil
+}
+
+// FindChatMessageByCacheID returns the stored public message with the given cacheID.
+func FindChatMessageByCacheID(db *pgxpool.Pool, cacheID int) (models.ChatMessage, bool, error) {
+	var msg models.ChatMessage
+	err := db.QueryRow(context.Background(), `
+		SELECT m.id, m.cache_id, m.owner_id, COALESCE(u.username, '[Unknown]'), m.channel, m.message,
+			m.authored_at, COALESCE(m.reply_to_cache_id, 0)
+		FROM chatserver.chat_messages m
+		LEFT JOIN keycloak.public.user_entity u ON m.owner_id::TEXT = u.id
+		WHERE m.cache_id = $1
+	`, cacheID).Scan(&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username, &msg.Channel, &msg.Message, &msg.Sent, &msg.ReplyTo)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return msg, false, nil
+	}
+	if err != nil {
+		return msg, false, fmt.Errorf("failed to look up message %d: %w", cacheID, err)
+	}
+	msg.Content, msg.HTML = format.Render(msg.Message)
+	return msg, true, nil
+}
+
+// FindPrivateMessageByCacheID returns the stored private message with the given cacheID.
+func FindPrivateMessageByCacheID(db *pgxpool.Pool, cacheID int) (models.PrivateChatMessage, bool, error) {
+	var msg models.PrivateChatMessage
+	err := db.QueryRow(context.Background(), `
+		SELECT id, cache_id, owner_id, username, recipient_id, recipient, message, authored_at
+		FROM chatserver.private_messages
+		WHERE cache_id = $1
+	`, cacheID).Scan(&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username, &msg.RecipientID, &msg.Recipient, &msg.Message, &msg.Sent)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return msg, false, nil
+	}
+	if err != nil {
+		return msg, false, fmt.Errorf("failed to look up private message %d: %w", cacheID, err)
+	}
+	msg.Content, msg.HTML = format.Render(msg.Message)
+	return msg, true, nil
+}
+
+// AttachChatReactions fills in the reaction counts of each public message.
+func AttachChatReactions(db *pgxpool.Pool, msgs []models.ChatMessage) error {
+	cacheIDs := make([]int, len(msgs))
+	for i, msg := range msgs {
+		cacheIDs[i] = msg.CacheID
+	}
+
+	counts, err := FetchReactionCounts(db, models.ReactionTargetChat, cacheIDs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].Reactions = counts[msgs[i].CacheID]
+	}
+	return nil
+}
+
+// AttachPrivateReactions fills in the reaction counts of each private message.
+func AttachPrivateReactions(db *pgxpool.Pool, msgs []models.PrivateChatMessage) error {
+	cacheIDs := make([]int, len(msgs))
+	for i, msg := range msgs {
+		cacheIDs[i] = msg.CacheID
+	}
+
+	counts, err := FetchReactionCounts(db, models.ReactionTargetPrivate, cacheIDs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		msgs[i].Reactions = counts[msgs[i].CacheID]
+	}
+	return nil
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// SaveReadMarker records that marker.UserID has read up to marker.CacheID in the marker's
+// channel or private conversation. Markers never move backwards.
+// It returns the stored marker, including its read time.
+func SaveReadMarker(db *pgxpool.Pool, marker models.ReadMarker) (models.ReadMarker, error) {
+	column, target := "channel", marker.Channel
+	if marker.PeerID != "" {
+		column, target = "peer_id", marker.PeerID
+	}
+
+	// The conflict target must name the partial unique index for this kind of marker
+	query := fmt.Sprintf(`
+		INSERT INTO chatserver.read_markers (user_id, %[1]s, last_read_cache_id)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (user_id, %[1]s) WHERE %[1]s IS NOT NULL DO UPDATE
+		SET last_read_cache_id = GREATEST(read_markers.last_read_cache_id, EXCLUDED.last_read_cache_id),
+			read_at = now()
+		RETURNING last_read_cache_id, read_at
+	`, column)
+
+	err := db.QueryRow(context.Background(), query, marker.UserID, target, marker.CacheID).Scan(&marker.CacheID, &marker.ReadAt)
+	if err != nil {
+		return marker, fmt.Errorf("failed to save read marker for %s: %w", marker.UserID, err)
+	}
+
+	return marker, nil
+}
+
+// FetchReadMarkers returns userID's read positions, keyed by channel name and by peer ID.
+func FetchReadMarkers(db *pgxpool.Pool, userID string) (map[string]int, map[string]int, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT COALESCE(channel, ''), COALESCE(peer_id, ''), last_read_cache_id
+		FROM chatserver.read_markers
+		WHERE user_id = $1
+	`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to fetch read markers: %w", err)
+	}
+	defer rows.Close()
+
+	channels := make(map[string]int)
+	peers := make(map[string]int)
+	for rows.Next() {
+		var channel, peerID string
+		var cacheID int
+		if err := rows.Scan(&channel, &peerID, &cacheID); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan read marker: %w", err)
+		}
+		if channel != "" {
+			channels[channel] = cacheID
+		} else {
+			peers[peerID] = cacheID
+		}
+	}
+
+	return channels, peers, rows.Err()
+}
+
+// FetchUnreadCounts counts the stored messages userID has not read, keyed by channel name
+// and by the peer ID of each private conversation. Channels are only counted once the user
+// has a read marker for them, so joining a server does not flag its entire history.
+func FetchUnreadCounts(db *pgxpool.Pool, userID string) (map[string]int, map[string]int, error) {
+	ctx := context.Background()
+
+	channels := make(map[string]int)
+	rows, err := db.Query(ctx, `
+		SELECT m.channel, COUNT(*)
+		FROM chatserver.read_markers r
+		JOIN chatserver.chat_messages m
+			ON m.channel = r.channel AND m.cache_id > r.last_read_cache_id
+		WHERE r.user_id = $1
+		GROUP BY m.channel
+	`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count unread channel messages: %w", err)
+	}
+	for rows.Next() {
+		var channel string
+		var count int
+		if err := rows.Scan(&channel, &count); err != nil {
+			rows.Close()
+			return nil, nil, fmt.Errorf("failed to scan unread channel count: %w", err)
+		}
+		channels[channel] = count
+	}
+	rows.Close()
+
+	peers := make(map[string]int)
+	rows, err = db.Query(ctx, `
+		SELECT m.owner_id, COUNT(*)
+		FROM chatserver.private_messages m
+		LEFT JOIN chatserver.read_markers r
+			ON r.user_id = m.recipient_id AND r.peer_id = m.owner_id
+		WHERE m.recipient_id = $1
+		AND m.owner_id <> m.recipient_id
+		AND m.cache_id > COALESCE(r.last_read_cache_id, 0)
+		GROUP BY m.owner_id
+	`, userID)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to count unread private messages: %w", err)
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var peerID string
+		var count int
+		if err := rows.Scan(&peerID, &count); err != nil {
+			return nil, nil, fmt.Errorf("failed to scan unread private count: %w", err)
+		}
+		peers[peerID] = count
+	}
+
+	return channels, peers, rows.Err()
+}
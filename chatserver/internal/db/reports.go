@@ -0,0 +1,175 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reportColumns lists the columns scanned by scanReport.
+const reportColumns = `id, reporter_id, reporter_username, kind, COALESCE(target, ''), COALESCE(cache_id, 0),
+	COALESCE(channel, ''), reported_user_id, reported_username, snapshot, reason, details, status,
+	claimed_by, claimed_at, escalated_by, escalation_note, COALESCE(resolution, ''), resolution_note,
+	ban_id, resolved_by, resolved_at, created_at`
+
+func scanReport(row pgx.Row) (models.Report, error) {
+	var r models.Report
+	var snapshot []byte
+	err := row.Scan(&r.ID, &r.ReporterID, &r.ReporterUsername, &r.Kind, &r.Target, &r.CacheID,
+		&r.Channel, &r.ReportedUserID, &r.ReportedUsername, &snapshot, &r.Reason, &r.Details, &r.Status,
+		&r.ClaimedBy, &r.ClaimedAt, &r.EscalatedBy, &r.EscalationNote, &r.Resolution, &r.ResolutionNote,
+		&r.BanID, &r.ResolvedBy, &r.ResolvedAt, &r.CreatedAt)
+	if len(snapshot) > 0 {
+		r.Snapshot = snapshot
+	}
+	return r, err
+}
+
+// SaveReport files a new report. If the reporter already has an unresolved report about
+// the same message or user, that report is returned instead and created is false.
+func SaveReport(db *pgxpool.Pool, report models.Report) (saved models.Report, created bool, err error) {
+	ctx := context.Background()
+
+	var snapshot []byte
+	if len(report.Snapshot) > 0 {
+		snapshot = report.Snapshot
+	}
+
+	saved, err = scanReport(db.QueryRow(ctx, `
+		INSERT INTO chatserver.reports
+			(reporter_id, reporter_username, kind, target, cache_id, channel, reported_user_id,
+			reported_username, snapshot, reason, details)
+		VALUES ($1, $2, $3, NULLIF($4, ''), NULLIF($5, 0), NULLIF($6, ''), $7, $8, $9, $10, $11)
+		ON CONFLICT (reporter_id, kind, COALESCE(target, ''), COALESCE(cache_id, 0), reported_user_id)
+			WHERE status <> 'resolved'
+			DO NOTHING
+		RETURNING `+reportColumns,
+		report.ReporterID, report.ReporterUsername, report.Kind, report.Target, report.CacheID, report.Channel,
+		report.ReportedUserID, report.ReportedUsername, snapshot, report.Reason, report.Details))
+	if err == nil {
+		return saved, true, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return saved, false, fmt.Errorf("failed to save report: %w", err)
+	}
+
+	saved, err = scanReport(db.QueryRow(ctx, `
+		SELECT `+reportColumns+`
+		FROM chatserver.reports
+		WHERE reporter_id = $1 AND kind = $2 AND COALESCE(target, '') = $3 AND COALESCE(cache_id, 0) = $4
+			AND reported_user_id = $5 AND status <> 'resolved'
+	`, report.ReporterID, report.Kind, report.Target, report.CacheID, report.ReportedUserID))
+	if err != nil {
+		return saved, false, fmt.Errorf("failed to find existing report: %w", err)
+	}
+	return saved, false, nil
+}
+
+// FetchReports retrieves reports newest first, optionally only those with the given status.
+// It returns:
+//  1. A slice of Report objects
+//  2. PageInfo describing whether more reports exist and the cursors around this page
+//  3. An error, if any
+func FetchReports(db *pgxpool.Pool, status string, page PageRequest) ([]models.Report, PageInfo, error) {
+	var conditions []string
+	var args []interface{}
+	if status != "" {
+		conditions = append(conditions, "status = $1")
+		args = append(args, status)
+	}
+
+	conditions, args, pageClause := page.keyset("created_at", "id", "INT", conditions, args)
+
+	query := `SELECT ` + reportColumns + ` FROM chatserver.reports`
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
+
+	rows, err := db.Query(context.Background(), query, args...)
+	if err != nil {
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch reports: %w", err)
+	}
+	defer rows.Close()
+
+	reports := []models.Report{}
+	for rows.Next() {
+		report, err := scanReport(rows)
+		if err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan report: %w", err)
+		}
+		reports = append(reports, report)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, PageInfo{}, fmt.Errorf("error iterating over report rows: %w", err)
+	}
+
+	reports, info := finishPage(reports, page, func(report models.Report) Cursor {
+		return Cursor{At: report.CreatedAt, ID: strconv.Itoa(report.ID)}
+	})
+	return reports, info, nil
+}
+
+// FindReport returns the report with the given ID.
+func FindReport(db *pgxpool.Pool, id int) (models.Report, bool, error) {
+	report, err := scanReport(db.QueryRow(context.Background(),
+		`SELECT `+reportColumns+` FROM chatserver.reports WHERE id = $1`, id))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return report, false, nil
+	}
+	if err != nil {
+		return report, false, fmt.Errorf("failed to look up report %d: %w", id, err)
+	}
+	return report, true, nil
+}
+
+// updateReport applies an update to a report and returns it, or false if the update's
+// conditions did not match.
+func updateReport(db *pgxpool.Pool, id int, query string, args ...interface{}) (models.Report, bool, error) {
+	report, err := scanReport(db.QueryRow(context.Background(), query+` RETURNING `+reportColumns, append([]interface{}{id}, args...)...))
+	if errors.Is(err, pgx.ErrNoRows) {
+		return report, false, nil
+	}
+	if err != nil {
+		return report, false, fmt.Errorf("failed to update report %d: %w", id, err)
+	}
+	return report, true, nil
+}
+
+// ClaimReport assigns an open or escalated report to a moderator. It returns false if the
+// report is claimed by someone else or resolved.
+func ClaimReport(db *pgxpool.Pool, id int, moderatorID string) (models.Report, bool, error) {
+	return updateReport(db, id, `
+		UPDATE chatserver.reports
+		SET status = 'claimed', claimed_by = $2, claimed_at = now()
+		WHERE id = $1 AND status IN ('open', 'escalated')
+	`, moderatorID)
+}
+
+// EscalateReport hands an unresolved report on for another moderator to claim. A claimed
+// report can only be escalated by the moderator who claimed it. It returns false otherwise.
+func EscalateReport(db *pgxpool.Pool, id int, moderatorID, note string) (models.Report, bool, error) {
+	return updateReport(db, id, `
+		UPDATE chatserver.reports
+		SET status = 'escalated', escalated_by = $2, escalation_note = $3, claimed_by = NULL, claimed_at = NULL
+		WHERE id = $1 AND (status IN ('open', 'escalated') OR (status = 'claimed' AND claimed_by = $2))
+	`, moderatorID, note)
+}
+
+// ResolveReport closes an unresolved report. A claimed report can only be resolved by the
+// moderator who claimed it. It returns false otherwise.
+func ResolveReport(db *pgxpool.Pool, id int, moderatorID, resolution, note string, banID *int) (models.Report, bool, error) {
+	return updateReport(db, id, `
+		UPDATE chatserver.reports
+		SET status = 'resolved', resolution = $3, resolution_note = $4, ban_id = $5,
+			resolved_by = $2, resolved_at = now()
+		WHERE id = $1 AND (status IN ('open', 'escalated') OR (status = 'claimed' AND claimed_by = $2))
+	`, moderatorID, resolution, note, banID)
+}
@@ -0,0 +1,291 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FetchRetentionPolicies returns every retention policy.
+func FetchRetentionPolicies(db *pgxpool.Pool) ([]models.RetentionPolicy, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT scope, channel, max_age_days, max_messages, archive, updated_by, updated_at
+		FROM chatserver.retention_policies
+		ORDER BY scope, channel
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch retention policies: %w", err)
+	}
+	defer rows.Close()
+
+	policies := []models.RetentionPolicy{}
+	for rows.Next() {
+		var p models.RetentionPolicy
+		if err := rows.Scan(&p.Scope, &p.Channel, &p.MaxAgeDays, &p.MaxMessages, &p.Archive, &p.UpdatedBy, &p.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan retention policy: %w", err)
+		}
+		policies = append(policies, p)
+	}
+	return policies, rows.Err()
+}
+
+// SaveRetentionPolicy creates or replaces the policy for its scope and channel.
+func SaveRetentionPolicy(db *pgxpool.Pool, policy models.RetentionPolicy) (models.RetentionPolicy, error) {
+	err := db.QueryRow(context.Background(), `
+		INSERT INTO chatserver.retention_policies (scope, channel, max_age_days, max_messages, archive, updated_by)
+		VALUES ($1, $2, $3, $4, $5, $6)
+		ON CONFLICT (scope, channel) DO UPDATE
+		SET max_age_days = EXCLUDED.max_age_days, max_messages = EXCLUDED.max_messages,
+			archive = EXCLUDED.archive, updated_by = EXCLUDED.updated_by, updated_at = now()
+		RETURNING updated_at
+	`, policy.Scope, policy.Channel, policy.MaxAgeDays, policy.MaxMessages, policy.Archive, policy.UpdatedBy).Scan(&policy.UpdatedAt)
+	if err != nil {
+		return policy, fmt.Errorf("failed to save retention policy: %w", err)
+	}
+	return policy, nil
+}
+
+// DeleteRetentionPolicy removes a policy. It returns false if there was none.
+func DeleteRetentionPolicy(db *pgxpool.Pool, scope, channel string) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `
+		DELETE FROM chatserver.retention_policies WHERE scope = $1 AND channel = $2
+	`, scope, channel)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete retention policy: %w", err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// FetchLegalHolds returns every legal hold, oldest first.
+func FetchLegalHolds(db *pgxpool.Pool) ([]models.LegalHold, error) {
+	rows, err := db.Query(context.Background(), `
+		SELECT id, COALESCE(channel, ''), COALESCE(user_id, ''), reason, created_by, created_at
+		FROM chatserver.legal_holds
+		ORDER BY id
+	`)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch legal holds: %w", err)
+	}
+	defer rows.Close()
+
+	holds := []models.LegalHold{}
+	for rows.Next() {
+		var h models.LegalHold
+		if err := rows.Scan(&h.ID, &h.Channel, &h.UserID, &h.Reason, &h.CreatedBy, &h.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan legal hold: %w", err)
+		}
+		holds = append(holds, h)
+	}
+	return holds, rows.Err()
+}
+
+// CreateLegalHold places a hold on a channel or a user.
+func CreateLegalHold(db *pgxpool.Pool, hold models.LegalHold) (models.LegalHold, error) {
+	err := db.QueryRow(context.Background(), `
+		INSERT INTO chatserver.legal_holds (channel, user_id, reason, created_by)
+		VALUES (NULLIF($1, ''), NULLIF($2, ''), $3, $4)
+		RETURNING id, created_at
+	`, hold.Channel, hold.UserID, hold.Reason, hold.CreatedBy).Scan(&hold.ID, &hold.CreatedAt)
+	if err != nil {
+		return hold, fmt.Errorf("failed to create legal hold: %w", err)
+	}
+	return hold, nil
+}
+
+// DeleteLegalHold lifts a hold. It returns false if it does not exist.
+func DeleteLegalHold(db *pgxpool.Pool, id int) (bool, error) {
+	cmd, err := db.Exec(context.Background(), `DELETE FROM chatserver.legal_holds WHERE id = $1`, id)
+	if err != nil {
+		return false, fmt.Errorf("failed to delete legal hold %d: %w", id, err)
+	}
+	return cmd.RowsAffected() > 0, nil
+}
+
+// renameRetention moves a channel's retention policy and legal holds to its new name, so a
+// rename neither drops the policy nor lets the janitor purge held messages. A policy left
+// under the new name gives way to the renamed channel's own.
+func renameRetention(ctx context.Context, tx pgx.Tx, oldName, newName string) error {
+	if _, err := tx.Exec(ctx, `
+		DELETE FROM chatserver.retention_policies
+		WHERE scope = 'channel' AND channel = $2
+			AND EXISTS (SELECT 1 FROM chatserver.retention_policies WHERE scope = 'channel' AND channel = $1)
+	`, oldName, newName); err != nil {
+		return fmt.Errorf("failed to replace retention policy of %s: %w", newName, err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE chatserver.retention_policies SET channel = $2 WHERE scope = 'channel' AND channel = $1
+	`, oldName, newName); err != nil {
+		return fmt.Errorf("failed to move retention policy of %s: %w", oldName, err)
+	}
+	if _, err := tx.Exec(ctx, `
+		UPDATE chatserver.legal_holds SET channel = $2 WHERE channel = $1
+	`, oldName, newName); err != nil {
+		return fmt.Errorf("failed to move legal holds of %s: %w", oldName, err)
+	}
+	return nil
+}
+
+// ChannelHeld reports whether a channel is under legal hold.
+func ChannelHeld(db *pgxpool.Pool, channel string) (bool, error) {
+	var held bool
+	err := db.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM chatserver.legal_holds WHERE channel = $1)
+	`, channel).Scan(&held)
+	if err != nil {
+		return false, fmt.Errorf("failed to check legal hold on %s: %w", channel, err)
+	}
+	return held, nil
+}
+
+// PurgeChatMessages deletes up to limit of a channel's messages that were authored before
+// olderThan, if set, or fall outside its newest keepLast messages, if positive. Pinned
+// messages and messages by users under legal hold are kept. With archive set, the messages
+// are copied to chat_messages_archive first. Each batch is a single statement, so rows are
+// only locked briefly. It returns the cacheIDs of the deleted messages.
+func PurgeChatMessages(db *pgxpool.Pool, channel string, olderThan time.Time, keepLast int, archive bool, limit int) ([]int, error) {
+	ctx := context.Background()
+
+	args := []interface{}{channel, archive, limit}
+	var expired []string
+	if !olderThan.IsZero() {
+		args = append(args, olderThan)
+		expired = append(expired, fmt.Sprintf("m.authored_at < $%d", len(args)))
+	}
+	if keepLast > 0 {
+		// Messages older than the keepLast-th newest; NULL, matching nothing, when there are fewer
+		args = append(args, keepLast-1)
+		expired = append(expired, fmt.Sprintf(`m.cache_id < (
+			SELECT cache_id FROM chatserver.chat_messages
+			WHERE channel = $1 ORDER BY cache_id DESC OFFSET $%d LIMIT 1)`, len(args)))
+	}
+	if len(expired) == 0 {
+		return nil, nil
+	}
+
+	rows, err := db.Query(ctx, `
+		WITH doomed AS (
+			SELECT m.id FROM chatserver.chat_messages m
+			WHERE m.channel = $1 AND (`+strings.Join(expired, " OR ")+`)
+				AND NOT EXISTS (SELECT 1 FROM chatserver.channel_pins p WHERE p.cache_id = m.cache_id)
+				AND NOT EXISTS (SELECT 1 FROM chatserver.legal_holds h WHERE h.user_id = m.owner_id)
+			ORDER BY m.id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		), archived AS (
+			INSERT INTO chatserver.chat_messages_archive
+				(id, cache_id, owner_id, channel, message, authored_at, reply_to_cache_id)
+			SELECT m.id, m.cache_id, m.owner_id, m.channel, m.message, m.authored_at, m.reply_to_cache_id
+			FROM chatserver.chat_messages m JOIN doomed d ON d.id = m.id
+			WHERE $2
+			ON CONFLICT (id) DO NOTHING
+		)
+		DELETE FROM chatserver.chat_messages m
+		USING doomed d
+		WHERE m.id = d.id
+		RETURNING m.cache_id
+	`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge messages of %s: %w", channel, err)
+	}
+	defer rows.Close()
+
+	var cacheIDs []int
+	for rows.Next() {
+		var cacheID int
+		if err := rows.Scan(&cacheID); err != nil {
+			return nil, fmt.Errorf("failed to scan purged cacheID: %w", err)
+		}
+		cacheIDs = append(cacheIDs, cacheID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to purge messages of %s: %w", channel, err)
+	}
+
+	if len(cacheIDs) > 0 {
+		if err := removeChatMessageReferences(db, cacheIDs); err != nil {
+			return cacheIDs, err
+		}
+	}
+	return cacheIDs, nil
+}
+
+// PurgePrivateMessages deletes up to limit private messages authored before olderThan,
+// keeping those sent or received by users under legal hold. With archive set, the messages
+// are copied to private_messages_archive first. It returns the deleted messages with their
+// cacheIDs and participants.
+func PurgePrivateMessages(db *pgxpool.Pool, olderThan time.Time, archive bool, limit int) ([]models.PrivateChatMessage, error) {
+	rows, err := db.Query(context.Background(), `
+		WITH doomed AS (
+			SELECT m.id FROM chatserver.private_messages m
+			WHERE m.authored_at < $1
+				AND NOT EXISTS (
+					SELECT 1 FROM chatserver.legal_holds h
+					WHERE h.user_id = m.owner_id OR h.user_id = m.recipient_id
+				)
+			ORDER BY m.id
+			LIMIT $3
+			FOR UPDATE SKIP LOCKED
+		), archived AS (
+			INSERT INTO chatserver.private_messages_archive
+				(id, cache_id, owner_id, username, recipient_id, recipient, message, authored_at)
+			SELECT m.id, m.cache_id, m.owner_id, m.username, m.recipient_id, m.recipient, m.message, m.authored_at
+			FROM chatserver.private_messages m JOIN doomed d ON d.id = m.id
+			WHERE $2
+			ON CONFLICT (id) DO NOTHING
+		)
+		DELETE FROM chatserver.private_messages m
+		USING doomed d
+		WHERE m.id = d.id
+		RETURNING m.cache_id, m.owner_id, m.recipient_id
+	`, olderThan, archive, limit)
+	if err != nil {
+		return nil, fmt.Errorf("failed to purge private messages: %w", err)
+	}
+	defer rows.Close()
+
+	var purged []models.PrivateChatMessage
+	var cacheIDs []int
+	for rows.Next() {
+		var msg models.PrivateChatMessage
+		if err := rows.Scan(&msg.CacheID, &msg.OwnerID, &msg.RecipientID); err != nil {
+			return nil, fmt.Errorf("failed to scan purged private message: %w", err)
+		}
+		purged = append(purged, msg)
+		cacheIDs = append(cacheIDs, msg.CacheID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to purge private messages: %w", err)
+	}
+
+	if len(cacheIDs) > 0 {
+		if err := removePrivateMessageReferences(db, cacheIDs); err != nil {
+			return purged, err
+		}
+	}
+	return purged, nil
+}
+
+// PurgeSessions deletes up to limit session records that ended before olderThan, keeping
+// those of users under legal hold. It returns the number deleted.
+func PurgeSessions(db *pgxpool.Pool, olderThan time.Time, limit int) (int64, error) {
+	cmd, err := db.Exec(context.Background(), `
+		DELETE FROM chatserver.chat_sessions
+		WHERE id IN (
+			SELECT s.id FROM chatserver.chat_sessions s
+			WHERE s.end_time < $1
+				AND NOT EXISTS (SELECT 1 FROM chatserver.legal_holds h WHERE h.user_id = s.owner_id)
+			LIMIT $2
+			FOR UPDATE SKIP LOCKED
+		)
+	`, olderThan, limit)
+	if err != nil {
+		return 0, fmt.Errorf("failed to purge sessions: %w", err)
+	}
+	return cmd.RowsAffected(), nil
+}
@@ -43,10 +43,24 @@ CREATE TABLE IF NOT EXISTS chatserver.channels (
     is_private BOOLEAN DEFAULT FALSE,       -- If true, not shown to all users
     owner_id VARCHAR(36) NOT NULL,          -- Creator of the channel
     sort_order INT NOT NULL DEFAULT 0,      -- Used for custom sorting in UI
+    search_language REGCONFIG NOT NULL DEFAULT 'english', -- Text search configuration for messages
     created_at TIMESTAMP DEFAULT now(),
     updated_at TIMESTAMP DEFAULT now()
 );
 
+ALTER TABLE chatserver.channels ADD COLUMN IF NOT EXISTS search_language REGCONFIG NOT NULL DEFAULT 'english';
+
+-- Stores messages pinned to channels by moderators. cache_id may refer to a message that
+-- has not been flushed yet
+CREATE TABLE IF NOT EXISTS chatserver.channel_pins (
+    id SERIAL PRIMARY KEY,
+    channel_id INT NOT NULL REFERENCES chatserver.channels(id) ON DELETE CASCADE,
+    cache_id BIGINT NOT NULL,
+    pinned_by VARCHAR(36) NOT NULL,         -- Moderator's ID
+    pinned_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (channel_id, cache_id)
+);
+
 -- ====================================
 -- Messages
 -- ====================================
@@ -59,12 +73,42 @@ CREATE TABLE IF NOT EXISTS chatserver.chat_messages (
     channel VARCHAR(24) NOT NULL,           -- Denormalized channel name (not a foreign key)
     message TEXT NOT NULL,
     authored_at TIMESTAMP NOT NULL,
-    search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector('english', message)) STORED
+    search_language REGCONFIG NOT NULL DEFAULT 'english', -- Copied from the channel when flushed
+    search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector(search_language, message)) STORED,
+    reply_to_cache_id BIGINT NULL           -- cacheID of the thread parent, set on replies
 );
 
+ALTER TABLE chatserver.chat_messages ADD COLUMN IF NOT EXISTS reply_to_cache_id BIGINT NULL;
+
+-- Older installs indexed every message as English; rebuild the vector from the per-message language
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'chatserver' AND table_name = 'chat_messages' AND column_name = 'search_language'
+    ) THEN
+        ALTER TABLE chatserver.chat_messages ADD COLUMN search_language REGCONFIG NOT NULL DEFAULT 'english';
+        ALTER TABLE chatserver.chat_messages DROP COLUMN search_vector;
+        ALTER TABLE chatserver.chat_messages
+            ADD COLUMN search_vector TSVECTOR GENERATED ALWAYS AS (to_tsvector(search_language, message)) STORED;
+    END IF;
+END $$;
+
 -- GIN index for fast full-text search
 CREATE INDEX IF NOT EXISTS chat_messages_search_idx ON chatserver.chat_messages USING GIN(search_vector);
 
+-- Composite indexes backing keyset pagination on (authored_at, id)
+CREATE INDEX IF NOT EXISTS chat_messages_authored_idx ON chatserver.chat_messages (authored_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS chat_messages_channel_authored_idx ON chatserver.chat_messages (channel, authored_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS chat_messages_owner_authored_idx ON chatserver.chat_messages (owner_id, authored_at DESC, id DESC);
+
+-- Index backing thread replies and reply counts
+CREATE INDEX IF NOT EXISTS chat_messages_thread_idx ON chatserver.chat_messages (reply_to_cache_id, authored_at DESC, id DESC)
+    WHERE reply_to_cache_id IS NOT NULL;
+
+-- Index backing unread counts per channel
+CREATE INDEX IF NOT EXISTS chat_messages_channel_cache_idx ON chatserver.chat_messages (channel, cache_id);
+
 -- Stores private messages between two users
 CREATE TABLE IF NOT EXISTS chatserver.private_messages (
     id SERIAL PRIMARY KEY,
@@ -80,6 +124,98 @@ CREATE TABLE IF NOT EXISTS chatserver.private_messages (
 
 CREATE INDEX IF NOT EXISTS private_messages_search_idx ON chatserver.private_messages USING GIN(search_vector);
 
+-- Index backing unread counts per conversation
+CREATE INDEX IF NOT EXISTS private_messages_conversation_cache_idx ON chatserver.private_messages (recipient_id, owner_id, cache_id);
+
+-- Indexes backing per-user conversation lookups ordered by (authored_at, id)
+CREATE INDEX IF NOT EXISTS private_messages_owner_authored_idx ON chatserver.private_messages (owner_id, authored_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS private_messages_recipient_authored_idx ON chatserver.private_messages (recipient_id, authored_at DESC, id DESC);
+
+-- ====================================
+-- Reactions
+-- ====================================
+
+-- Stores emoji reactions. Messages are referenced by cacheID, which is assigned in Valkey
+-- and kept when flushed, so messages can be reacted to before they are persisted
+CREATE TABLE IF NOT EXISTS chatserver.message_reactions (
+    id SERIAL PRIMARY KEY,
+    target VARCHAR(8) NOT NULL CHECK (target IN ('chat', 'private')), -- Which cacheID counter cache_id comes from
+    cache_id BIGINT NOT NULL,
+    user_id VARCHAR(36) NOT NULL,           -- Reacting user's ID
+    emoji VARCHAR(64) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (target, cache_id, user_id, emoji)
+);
+
+CREATE INDEX IF NOT EXISTS message_reactions_message_idx ON chatserver.message_reactions (target, cache_id);
+
+-- ====================================
+-- Attachments
+-- ====================================
+
+-- Stores uploaded files. Blobs live in the configured storage backend; a row is linked to
+-- its message by cacheID when the message is sent, which also decides who may download it
+CREATE TABLE IF NOT EXISTS chatserver.attachments (
+    id UUID PRIMARY KEY,
+    owner_id VARCHAR(36) NOT NULL,          -- Uploader's ID
+    filename VARCHAR(255) NOT NULL,
+    content_type VARCHAR(128) NOT NULL,     -- Sniffed from the contents
+    size_bytes BIGINT NOT NULL,
+    width INT NULL,                         -- Set for images
+    height INT NULL,
+    storage_key VARCHAR(255) NOT NULL,
+    thumbnail_key VARCHAR(255) NULL,
+    target VARCHAR(8) NULL CHECK (target IN ('chat', 'private')), -- NULL until sent
+    cache_id BIGINT NULL,
+    channel VARCHAR(24) NULL,               -- Set for attachments sent to a channel
+    recipient_id VARCHAR(36) NULL,          -- Set for attachments sent privately
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK ((target IS NULL) = (cache_id IS NULL))
+);
+
+CREATE INDEX IF NOT EXISTS attachments_message_idx ON chatserver.attachments (target, cache_id) WHERE cache_id IS NOT NULL;
+CREATE INDEX IF NOT EXISTS attachments_unsent_idx ON chatserver.attachments (created_at) WHERE cache_id IS NULL;
+
+-- ====================================
+-- Mentions
+-- ====================================
+
+-- Stores @mentions so users can catch up on them after being offline
+CREATE TABLE IF NOT EXISTS chatserver.mentions (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,           -- Mentioned user's ID
+    cache_id BIGINT NOT NULL,               -- Message containing the mention
+    channel VARCHAR(24) NOT NULL,
+    author_id VARCHAR(36) NOT NULL,
+    author_username VARCHAR(64) NOT NULL,   -- Denormalized
+    kind VARCHAR(8) NOT NULL CHECK (kind IN ('user', 'here', 'channel')),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    read_at TIMESTAMP NULL,                 -- NULL until the user has seen the mention
+    UNIQUE (user_id, cache_id)
+);
+
+-- Indexes backing the mention inbox ordered by (created_at, id) and unread counts
+CREATE INDEX IF NOT EXISTS mentions_user_created_idx ON chatserver.mentions (user_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS mentions_unread_idx ON chatserver.mentions (user_id) WHERE read_at IS NULL;
+
+-- ====================================
+-- Read State
+-- ====================================
+
+-- Stores how far each user has read a channel or a private conversation
+CREATE TABLE IF NOT EXISTS chatserver.read_markers (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,           -- Reader's ID
+    channel VARCHAR(24) NULL,               -- Set for channel markers
+    peer_id VARCHAR(36) NULL,               -- Set for private conversation markers
+    last_read_cache_id BIGINT NOT NULL DEFAULT 0, -- Newest cacheID read (public or private counter)
+    read_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK ((channel IS NULL) <> (peer_id IS NULL))
+);
+
+CREATE UNIQUE INDEX IF NOT EXISTS read_markers_channel_idx ON chatserver.read_markers (user_id, channel) WHERE channel IS NOT NULL;
+CREATE UNIQUE INDEX IF NOT EXISTS read_markers_peer_idx ON chatserver.read_markers (user_id, peer_id) WHERE peer_id IS NOT NULL;
+
 -- ====================================
 -- Session and Moderation Records
 -- ====================================
@@ -106,6 +242,154 @@ CREATE TABLE IF NOT EXISTS chatserver.bans (
     pardoned BOOLEAN DEFAULT FALSE          -- If true, ban is forgiven
 );
 
+-- Composite index backing keyset pagination on (start_time, id)
+CREATE INDEX IF NOT EXISTS bans_start_time_idx ON chatserver.bans (start_time DESC, id DESC);
+
+-- Optional ban scopes: an address range or a client-provided device fingerprint that is
+-- refused whichever account connects from it
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS ip_range CIDR NULL;
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS device_id VARCHAR(128) NULL;
+
+CREATE INDEX IF NOT EXISTS bans_banished_idx ON chatserver.bans (banished_id);
+
+-- Who lifted a ban and when; appeal_id is set when an approved appeal lifted it
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS pardoned_at TIMESTAMP NULL;
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS pardoned_by VARCHAR(36) NULL;
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS appeal_id INT NULL;
+
+-- Set once the expiry sweep has processed a ban that ran out
+ALTER TABLE chatserver.bans ADD COLUMN IF NOT EXISTS expiry_processed BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- Banned users' requests to lift their ban; each ban can be appealed once
+CREATE TABLE IF NOT EXISTS chatserver.appeals (
+    id SERIAL PRIMARY KEY,
+    ban_id INT NOT NULL UNIQUE REFERENCES chatserver.bans(id) ON DELETE CASCADE,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    message TEXT NOT NULL,
+    status VARCHAR(8) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'denied', 'expired')),
+    decided_by VARCHAR(36) NULL,
+    decision_note TEXT NOT NULL DEFAULT '',
+    decided_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS appeals_status_idx ON chatserver.appeals (status, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS appeals_user_idx ON chatserver.appeals (user_id, created_at DESC, id DESC);
+
+-- Addresses and devices each user has connected from, for scoped bans and evasion checks
+CREATE TABLE IF NOT EXISTS chatserver.user_addresses (
+    user_id VARCHAR(36) NOT NULL,
+    ip INET NOT NULL,
+    device_id VARCHAR(128) NOT NULL DEFAULT '', -- Empty when the client sent none
+    first_seen TIMESTAMP NOT NULL DEFAULT now(),
+    last_seen TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (user_id, ip, device_id)
+);
+
+CREATE INDEX IF NOT EXISTS user_addresses_ip_idx ON chatserver.user_addresses (ip);
+CREATE INDEX IF NOT EXISTS user_addresses_device_idx ON chatserver.user_addresses (device_id) WHERE device_id <> '';
+
+-- Accounts created after a ban, connecting from an address or device the banned user used
+CREATE TABLE IF NOT EXISTS chatserver.ban_evasions (
+    id SERIAL PRIMARY KEY,
+    user_id VARCHAR(36) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    ban_id INT NOT NULL REFERENCES chatserver.bans(id) ON DELETE CASCADE,
+    banished_id VARCHAR(36) NOT NULL,
+    ip INET NULL,
+    device_id VARCHAR(128) NULL,
+    dismissed BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    UNIQUE (user_id, ban_id)
+);
+
+CREATE INDEX IF NOT EXISTS ban_evasions_created_idx ON chatserver.ban_evasions (created_at DESC, id DESC);
+
+-- Stores user reports about messages and users for the moderation queue
+CREATE TABLE IF NOT EXISTS chatserver.reports (
+    id SERIAL PRIMARY KEY,
+    reporter_id VARCHAR(36) NOT NULL,
+    reporter_username VARCHAR(64) NOT NULL,
+    kind VARCHAR(8) NOT NULL CHECK (kind IN ('message', 'user')),
+    target VARCHAR(8) NULL CHECK (target IN ('chat', 'private')), -- Set for message reports
+    cache_id BIGINT NULL,
+    channel VARCHAR(24) NULL,
+    reported_user_id VARCHAR(36) NOT NULL,
+    reported_username VARCHAR(64) NOT NULL,
+    snapshot JSONB NULL,                    -- Copy of the message, kept after it is deleted
+    reason VARCHAR(16) NOT NULL,
+    details VARCHAR(1000) NOT NULL DEFAULT '',
+    status VARCHAR(10) NOT NULL DEFAULT 'open' CHECK (status IN ('open', 'claimed', 'escalated', 'resolved')),
+    claimed_by VARCHAR(36) NULL,
+    claimed_at TIMESTAMP NULL,
+    escalated_by VARCHAR(36) NULL,
+    escalation_note VARCHAR(1000) NOT NULL DEFAULT '',
+    resolution VARCHAR(16) NULL CHECK (resolution IN ('dismissed', 'message_removed', 'user_banned')),
+    resolution_note VARCHAR(1000) NOT NULL DEFAULT '',
+    ban_id INT NULL REFERENCES chatserver.bans(id) ON DELETE SET NULL,
+    resolved_by VARCHAR(36) NULL,
+    resolved_at TIMESTAMP NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS reports_status_idx ON chatserver.reports (status, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS reports_created_idx ON chatserver.reports (created_at DESC, id DESC);
+
+-- A user has at most one unresolved report about the same message or user
+CREATE UNIQUE INDEX IF NOT EXISTS reports_pending_idx ON chatserver.reports
+    (reporter_id, kind, COALESCE(target, ''), COALESCE(cache_id, 0), reported_user_id)
+    WHERE status <> 'resolved';
+
+-- Stores the automod rules checked against every message before it is cached
+CREATE TABLE IF NOT EXISTS chatserver.automod_rules (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(64) NOT NULL,
+    type VARCHAR(16) NOT NULL CHECK (type IN ('words', 'regex', 'links', 'caps', 'repeat', 'mentions')),
+    words TEXT[] NOT NULL DEFAULT '{}',     -- For 'words' rules
+    pattern TEXT NOT NULL DEFAULT '',       -- For 'regex' rules
+    max_count INT NOT NULL DEFAULT 0,       -- Threshold of 'links', 'caps', 'repeat' and 'mentions' rules
+    ratio REAL NOT NULL DEFAULT 0,          -- For 'caps' rules
+    window_seconds INT NOT NULL DEFAULT 0,  -- For 'repeat' rules
+    channels TEXT[] NOT NULL DEFAULT '{}',  -- Empty applies everywhere, including private messages
+    action VARCHAR(8) NOT NULL CHECK (action IN ('flag', 'mask', 'block', 'mute')),
+    mute_seconds INT NOT NULL DEFAULT 0,
+    enabled BOOLEAN NOT NULL DEFAULT TRUE,
+    created_by VARCHAR(36) NOT NULL,        -- Moderator's ID
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    updated_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Stores delivered messages that automod queued for moderator review
+CREATE TABLE IF NOT EXISTS chatserver.automod_flags (
+    id SERIAL PRIMARY KEY,
+    rule_id INT NULL REFERENCES chatserver.automod_rules(id) ON DELETE SET NULL,
+    rule_name VARCHAR(64) NOT NULL,         -- Denormalized so the queue survives rule deletion
+    reason VARCHAR(256) NOT NULL,
+    target VARCHAR(8) NOT NULL CHECK (target IN ('chat', 'private')),
+    cache_id BIGINT NOT NULL,
+    channel VARCHAR(24) NULL,
+    recipient_id VARCHAR(36) NULL,
+    owner_id VARCHAR(36) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    message TEXT NOT NULL,                  -- Text as sent, kept after the message is removed
+    status VARCHAR(8) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'approved', 'removed')),
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    reviewed_by VARCHAR(36) NULL,
+    reviewed_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS automod_flags_status_idx ON chatserver.automod_flags (status, created_at DESC, id DESC);
+
+-- Stores users automod has stopped from posting
+CREATE TABLE IF NOT EXISTS chatserver.automod_mutes (
+    user_id VARCHAR(36) PRIMARY KEY,
+    until TIMESTAMP NOT NULL,
+    reason VARCHAR(256) NOT NULL,
+    rule_id INT NULL REFERENCES chatserver.automod_rules(id) ON DELETE SET NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
 -- ====================================
 -- Auto-Update Triggers
 -- ====================================
@@ -122,8 +406,154 @@ BEFORE UPDATE ON chatserver.channels
 FOR EACH ROW
 EXECUTE FUNCTION update_updated_at_column();
 
+DROP TRIGGER IF EXISTS update_automod_rules_updated_at ON chatserver.automod_rules;
+CREATE TRIGGER update_automod_rules_updated_at
+BEFORE UPDATE ON chatserver.automod_rules
+FOR EACH ROW
+EXECUTE FUNCTION update_updated_at_column();
+
 DROP TRIGGER IF EXISTS update_rate_limiter_updated_at ON chatserver.rate_limiter;
 CREATE TRIGGER update_rate_limiter_updated_at
 BEFORE UPDATE ON chatserver.rate_limiter
 FOR EACH ROW
 EXECUTE FUNCTION update_updated_at_column();
+
+-- ====================================
+-- Retention
+-- ====================================
+
+-- How long messages and sessions are kept. channel is empty except for 'channel' policies,
+-- which replace the 'channels' default for that channel
+CREATE TABLE IF NOT EXISTS chatserver.retention_policies (
+    scope VARCHAR(8) NOT NULL CHECK (scope IN ('channels', 'channel', 'private', 'sessions')),
+    channel VARCHAR(24) NOT NULL DEFAULT '',
+    max_age_days INT NOT NULL DEFAULT 0 CHECK (max_age_days >= 0),  -- 0 keeps rows regardless of age
+    max_messages INT NOT NULL DEFAULT 0 CHECK (max_messages >= 0),  -- 0 keeps any number of messages
+    archive BOOLEAN NOT NULL DEFAULT FALSE,
+    updated_by VARCHAR(36) NOT NULL,
+    updated_at TIMESTAMP NOT NULL DEFAULT now(),
+    PRIMARY KEY (scope, channel),
+    CHECK ((scope = 'channel') = (channel <> ''))
+);
+
+-- Channels or users whose data must not be purged. Channel policies and holds follow the
+-- channel when it is renamed
+CREATE TABLE IF NOT EXISTS chatserver.legal_holds (
+    id SERIAL PRIMARY KEY,
+    channel VARCHAR(24) NULL,
+    user_id VARCHAR(36) NULL,
+    reason TEXT NOT NULL,
+    created_by VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    CHECK ((channel IS NULL) <> (user_id IS NULL))
+);
+
+-- Expired messages moved out of the live tables by archiving retention policies
+CREATE TABLE IF NOT EXISTS chatserver.chat_messages_archive (
+    id INT PRIMARY KEY,
+    cache_id BIGINT NOT NULL,
+    owner_id VARCHAR(36) NOT NULL,
+    channel VARCHAR(24) NOT NULL,
+    message TEXT NOT NULL,
+    authored_at TIMESTAMP NOT NULL,
+    reply_to_cache_id BIGINT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE TABLE IF NOT EXISTS chatserver.private_messages_archive (
+    id INT PRIMARY KEY,
+    cache_id BIGINT NOT NULL,
+    owner_id VARCHAR(36) NOT NULL,
+    username VARCHAR(64) NOT NULL,
+    recipient_id VARCHAR(36) NOT NULL,
+    recipient VARCHAR(64) NOT NULL,
+    message TEXT NOT NULL,
+    authored_at TIMESTAMP NOT NULL,
+    archived_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Indexes backing age-based purges
+CREATE INDEX IF NOT EXISTS private_messages_authored_idx ON chatserver.private_messages (authored_at);
+CREATE INDEX IF NOT EXISTS chat_sessions_end_idx ON chatserver.chat_sessions (end_time);
+
+-- ====================================
+-- Data Subject Requests
+-- ====================================
+
+-- Exports and erasures of a user's data, kept as an audit trail. pseudonym replaces the
+-- user's ID and name in the records an erasure keeps
+CREATE TABLE IF NOT EXISTS chatserver.data_requests (
+    id SERIAL PRIMARY KEY,
+    kind VARCHAR(8) NOT NULL CHECK (kind IN ('export', 'erase')),
+    user_id VARCHAR(36) NOT NULL,
+    mode VARCHAR(16) NOT NULL CHECK (mode IN ('zip', 'json', 'delete', 'pseudonymize')),
+    pseudonym VARCHAR(36) NULL,
+    status VARCHAR(10) NOT NULL DEFAULT 'pending' CHECK (status IN ('pending', 'running', 'completed', 'failed')),
+    counts JSONB NOT NULL DEFAULT '{}',
+    error TEXT NOT NULL DEFAULT '',
+    requested_by VARCHAR(36) NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT now(),
+    started_at TIMESTAMP NULL,
+    finished_at TIMESTAMP NULL
+);
+
+CREATE INDEX IF NOT EXISTS data_requests_created_idx ON chatserver.data_requests (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS data_requests_user_idx ON chatserver.data_requests (user_id, created_at DESC, id DESC);
+
+-- A user has at most one unfinished erasure
+CREATE UNIQUE INDEX IF NOT EXISTS data_requests_erasing_idx ON chatserver.data_requests (user_id)
+    WHERE kind = 'erase' AND status IN ('pending', 'running');
+
+-- ====================================
+-- Audit Log
+-- ====================================
+
+-- Administrative changes made through the REST API. actor_id is NULL when the request
+-- carried no bearer token
+CREATE TABLE IF NOT EXISTS chatserver.audit_log (
+    id SERIAL PRIMARY KEY,
+    actor_id VARCHAR(36) NULL,
+    actor_username VARCHAR(255) NULL,
+    client_id VARCHAR(255) NULL,
+    action VARCHAR(32) NOT NULL,
+    target VARCHAR(255) NOT NULL DEFAULT '',
+    details JSONB NOT NULL DEFAULT '{}',
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_idx ON chatserver.audit_log (created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON chatserver.audit_log (actor_id, created_at DESC, id DESC);
+CREATE INDEX IF NOT EXISTS audit_log_action_idx ON chatserver.audit_log (action, created_at DESC, id DESC);
+
+-- ====================================
+-- Channel Categories
+-- ====================================
+
+-- Groups of channels in the channel list. sort_order leaves gaps so moving a category or
+-- channel only rewrites the moved row
+CREATE TABLE IF NOT EXISTS chatserver.channel_categories (
+    id SERIAL PRIMARY KEY,
+    name VARCHAR(32) NOT NULL UNIQUE,
+    sort_order BIGINT NOT NULL,
+    collapsed BOOLEAN NOT NULL DEFAULT FALSE,  -- Shown collapsed until the user expands it
+    created_at TIMESTAMP NOT NULL DEFAULT now()
+);
+
+-- Channels are ordered within their category, or among the uncategorized channels listed
+-- first. Older installs numbered channels 1, 2, 3...; spread them out once
+DO $$
+BEGIN
+    IF NOT EXISTS (
+        SELECT 1 FROM information_schema.columns
+        WHERE table_schema = 'chatserver' AND table_name = 'channels' AND column_name = 'category_id'
+    ) THEN
+        ALTER TABLE chatserver.channels
+            ADD COLUMN category_id INT NULL REFERENCES chatserver.channel_categories(id) ON DELETE SET NULL;
+        ALTER TABLE chatserver.channels ALTER COLUMN sort_order TYPE BIGINT;
+        UPDATE chatserver.channels c SET sort_order = o.position * 65536
+        FROM (SELECT id, ROW_NUMBER() OVER (ORDER BY sort_order, id) AS position FROM chatserver.channels) o
+        WHERE c.id = o.id;
+    END IF;
+END $$;
+
+CREATE INDEX IF NOT EXISTS channels_category_order_idx ON chatserver.channels (category_id, sort_order, id);
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ThreadSummary describes the stored replies to a thread parent.
+type ThreadSummary struct {
+	ReplyCount  int
+	LastReplyAt time.Time
+}
+
+// FetchThreadSummaries counts the stored replies to each of the given parent cacheIDs.
+// Parents without replies are omitted.
+func FetchThreadSummaries(db *pgxpool.Pool, cacheIDs []int) (map[int]ThreadSummary, error) {
+	summaries := make(map[int]ThreadSummary)
+	if len(cacheIDs) == 0 {
+		return summaries, nil
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT reply_to_cache_id, COUNT(*), MAX(authored_at)
+		FROM chatserver.chat_messages
+		WHERE reply_to_cache_id = ANY($1)
+		GROUP BY reply_to_cache_id
+	`, cacheIDs)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch thread summaries: %w", err)
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var cacheID int
+		var summary ThreadSummary
+		if err := rows.Scan(&cacheID, &summary.ReplyCount, &summary.LastReplyAt); err != nil {
+			return nil, fmt.Errorf("failed to scan thread summary: %w", err)
+		}
+		summaries[cacheID] = summary
+	}
+
+	return summaries, rows.Err()
+}
+
+// AttachThreadSummaries fills in the reply count and last reply time of each message
+// that has stored replies.
+func AttachThreadSummaries(db *pgxpool.Pool, msgs []models.ChatMessage) error {
+	cacheIDs := make([]int, 0, len(msgs))
+	for _, msg := range msgs {
+		// Threads are one level deep, so replies never have replies of their own
+		if msg.ReplyTo == 0 {
+			cacheIDs = append(cacheIDs, msg.CacheID)
+		}
+	}
+
+	summaries, err := FetchThreadSummaries(db, cacheIDs)
+	if err != nil {
+		return err
+	}
+	for i := range msgs {
+		if summary, ok := summaries[msgs[i].CacheID]; ok {
+			msgs[i].ReplyCount = summary.ReplyCount
+			msgs[i].LastReplyAt = &summary.LastReplyAt
+		}
+	}
+	return nil
+}
@@ -0,0 +1,295 @@
+package db
+
+import (
+	"context"
+	"fmt"
+
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// FetchUserData collects the chat messages, private messages, sessions, bans and reactions
+// stored about a user, oldest first, including archived messages. Messages still waiting
+// in the cache are not included.
+func FetchUserData(db *pgxpool.Pool, userID string) (models.UserDataExport, error) {
+	ctx := context.Background()
+	export := models.UserDataExport{
+		UserID:          userID,
+		ChatMessages:    []models.ChatMessage{},
+		PrivateMessages: []models.PrivateChatMessage{},
+		Sessions:        []models.UserSession{},
+		Bans:            []models.BanRecord{},
+		Reactions:       []models.Reaction{},
+	}
+
+	rows, err := db.Query(ctx, `
+		SELECT id, cache_id, owner_id, channel, message, authored_at, COALESCE(reply_to_cache_id, 0)
+		FROM chatserver.chat_messages WHERE owner_id = $1
+		UNION ALL
+		SELECT id, cache_id, owner_id, channel, message, authored_at, COALESCE(reply_to_cache_id, 0)
+		FROM chatserver.chat_messages_archive WHERE owner_id = $1
+		ORDER BY authored_at, id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export chat messages: %w", err)
+	}
+	for rows.Next() {
+		var msg models.ChatMessage
+		if err := rows.Scan(&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Channel, &msg.Message, &msg.Sent, &msg.ReplyTo); err != nil {
+			rows.Close()
+			return export, fmt.Errorf("failed to scan chat message: %w", err)
+		}
+		export.ChatMessages = append(export.ChatMessages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return export, fmt.Errorf("failed to export chat messages: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT id, cache_id, owner_id, username, recipient_id, recipient, message, authored_at
+		FROM chatserver.private_messages WHERE owner_id = $1 OR recipient_id = $1
+		UNION ALL
+		SELECT id, cache_id, owner_id, username, recipient_id, recipient, message, authored_at
+		FROM chatserver.private_messages_archive WHERE owner_id = $1 OR recipient_id = $1
+		ORDER BY authored_at, id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export private messages: %w", err)
+	}
+	for rows.Next() {
+		var msg models.PrivateChatMessage
+		if err := rows.Scan(&msg.ID, &msg.CacheID, &msg.OwnerID, &msg.Username, &msg.RecipientID, &msg.Recipient,
+			&msg.Message, &msg.Sent); err != nil {
+			rows.Close()
+			return export, fmt.Errorf("failed to scan private message: %w", err)
+		}
+		export.PrivateMessages = append(export.PrivateMessages, msg)
+	}
+	if err := rows.Err(); err != nil {
+		return export, fmt.Errorf("failed to export private messages: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT id, start_time, end_time, duration::TEXT
+		FROM chatserver.chat_sessions WHERE owner_id = $1
+		ORDER BY start_time, id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export sessions: %w", err)
+	}
+	for rows.Next() {
+		var session models.UserSession
+		if err := rows.Scan(&session.ID, &session.Start, &session.End, &session.Duration); err != nil {
+			rows.Close()
+			return export, fmt.Errorf("failed to scan session: %w", err)
+		}
+		export.Sessions = append(export.Sessions, session)
+	}
+	if err := rows.Err(); err != nil {
+		return export, fmt.Errorf("failed to export sessions: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT id, owner_id, banished_id, reason, start_time, end_time, duration::TEXT, COALESCE(pardoned, FALSE),
+			COALESCE(ip_range::TEXT, ''), COALESCE(device_id, ''), pardoned_at, pardoned_by, appeal_id
+		FROM chatserver.bans WHERE banished_id = $1
+		ORDER BY start_time, id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export bans: %w", err)
+	}
+	for rows.Next() {
+		var ban models.BanRecord
+		if err := rows.Scan(&ban.ID, &ban.OwnerID, &ban.BanishedID, &ban.Reason, &ban.Start, &ban.End, &ban.Duration,
+			&ban.Pardoned, &ban.IPRange, &ban.DeviceID, &ban.PardonedAt, &ban.PardonedBy, &ban.AppealID); err != nil {
+			rows.Close()
+			return export, fmt.Errorf("failed to scan ban: %w", err)
+		}
+		export.Bans = append(export.Bans, ban)
+	}
+	if err := rows.Err(); err != nil {
+		return export, fmt.Errorf("failed to export bans: %w", err)
+	}
+
+	rows, err = db.Query(ctx, `
+		SELECT target, cache_id, user_id, emoji, created_at
+		FROM chatserver.message_reactions WHERE user_id = $1
+		ORDER BY created_at, id
+	`, userID)
+	if err != nil {
+		return export, fmt.Errorf("failed to export reactions: %w", err)
+	}
+	for rows.Next() {
+		var reaction models.Reaction
+		if err := rows.Scan(&reaction.Target, &reaction.CacheID, &reaction.UserID, &reaction.Emoji, &reaction.CreatedAt); err != nil {
+			rows.Close()
+			return export, fmt.Errorf("failed to scan reaction: %w", err)
+		}
+		export.Reactions = append(export.Reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return export, fmt.Errorf("failed to export reactions: %w", err)
+	}
+
+	return export, nil
+}
+
+// UserHeld reports whether a user is under legal hold.
+func UserHeld(db *pgxpool.Pool, userID string) (bool, error) {
+	var held bool
+	err := db.QueryRow(context.Background(), `
+		SELECT EXISTS (SELECT 1 FROM chatserver.legal_holds WHERE user_id = $1)
+	`, userID).Scan(&held)
+	if err != nil {
+		return false, fmt.Errorf("failed to check legal hold on %s: %w", userID, err)
+	}
+	return held, nil
+}
+
+// erasureStep is one statement of EraseUserData, counted under name.
+type erasureStep struct {
+	name  string
+	query string
+	args  []any
+}
+
+// EraseUserData removes a user's data in one transaction. Their chat and private messages,
+// including archived ones, and their reactions are deleted, or with pseudonymize set kept
+// under the pseudonym; deleted messages lose their reactions, mentions, pins and
+// attachments. In either mode their sessions, addresses, read markers, mention inbox and
+// mutes are deleted, and the pseudonym replaces their ID and name in received private
+// messages and in moderation records, which are kept for accountability with the text the
+// user wrote cleared unless messages are kept. It returns the rows affected by kind.
+func EraseUserData(db *pgxpool.Pool, userID, pseudonym string, pseudonymize bool) (map[string]int64, error) {
+	ctx := context.Background()
+	counts := make(map[string]int64)
+
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin tx: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	var steps []erasureStep
+	if pseudonymize {
+		steps = []erasureStep{
+			{"chat_messages", `UPDATE chatserver.chat_messages SET owner_id = $2 WHERE owner_id = $1`, []any{userID, pseudonym}},
+			{"archived_chat_messages", `UPDATE chatserver.chat_messages_archive SET owner_id = $2 WHERE owner_id = $1`, []any{userID, pseudonym}},
+			{"private_messages", `UPDATE chatserver.private_messages SET owner_id = $2, username = $2 WHERE owner_id = $1`, []any{userID, pseudonym}},
+			{"archived_private_messages", `UPDATE chatserver.private_messages_archive SET owner_id = $2, username = $2 WHERE owner_id = $1`, []any{userID, pseudonym}},
+			{"reactions", `UPDATE chatserver.message_reactions SET user_id = $2 WHERE user_id = $1`, []any{userID, pseudonym}},
+			{"attachments", `UPDATE chatserver.attachments SET owner_id = $2 WHERE owner_id = $1`, []any{userID, pseudonym}},
+		}
+	} else {
+		// Deleted messages are referenced by cacheID elsewhere, so delete them first
+		for _, target := range []struct {
+			table  string
+			remove func(execer, []int) error
+		}{
+			{"chat_messages", removeChatMessageReferences},
+			{"private_messages", removePrivateMessageReferences},
+		} {
+			rows, err := tx.Query(ctx, `DELETE FROM chatserver.`+target.table+` WHERE owner_id = $1 RETURNING cache_id`, userID)
+			if err != nil {
+				return nil, fmt.Errorf("failed to erase %s: %w", target.table, err)
+			}
+			var cacheIDs []int
+			for rows.Next() {
+				var cacheID int
+				if err := rows.Scan(&cacheID); err != nil {
+					rows.Close()
+					return nil, fmt.Errorf("failed to scan erased cacheID: %w", err)
+				}
+				cacheIDs = append(cacheIDs, cacheID)
+			}
+			if err := rows.Err(); err != nil {
+				return nil, fmt.Errorf("failed to erase %s: %w", target.table, err)
+			}
+			if len(cacheIDs) > 0 {
+				if err := target.remove(tx, cacheIDs); err != nil {
+					return nil, err
+				}
+			}
+			counts[target.table] = int64(len(cacheIDs))
+		}
+
+		steps = []erasureStep{
+			{"archived_chat_messages", `DELETE FROM chatserver.chat_messages_archive WHERE owner_id = $1`, []any{userID}},
+			{"archived_private_messages", `DELETE FROM chatserver.private_messages_archive WHERE owner_id = $1`, []any{userID}},
+			{"reactions", `DELETE FROM chatserver.message_reactions WHERE user_id = $1`, []any{userID}},
+			// Unlinked attachments are swept along with their blobs
+			{"attachments", unlinkAttachmentsQuery + `WHERE owner_id = $1`, []any{userID}},
+		}
+	}
+
+	steps = append(steps, []erasureStep{
+		{"sessions", `DELETE FROM chatserver.chat_sessions WHERE owner_id = $1`, []any{userID}},
+		{"addresses", `DELETE FROM chatserver.user_addresses WHERE user_id = $1`, []any{userID}},
+		{"read_markers", `DELETE FROM chatserver.read_markers WHERE user_id = $1`, []any{userID}},
+		{"peer_read_markers", `UPDATE chatserver.read_markers SET peer_id = $2 WHERE peer_id = $1`, []any{userID, pseudonym}},
+		{"mentions", `DELETE FROM chatserver.mentions WHERE user_id = $1`, []any{userID}},
+		{"authored_mentions", `
+			UPDATE chatserver.mentions SET author_id = $2, author_username = $2 WHERE author_id = $1
+		`, []any{userID, pseudonym}},
+		{"automod_mutes", `DELETE FROM chatserver.automod_mutes WHERE user_id = $1`, []any{userID}},
+		{"received_private_messages", `
+			UPDATE chatserver.private_messages SET recipient_id = $2, recipient = $2 WHERE recipient_id = $1
+		`, []any{userID, pseudonym}},
+		{"received_archived_private_messages", `
+			UPDATE chatserver.private_messages_archive SET recipient_id = $2, recipient = $2 WHERE recipient_id = $1
+		`, []any{userID, pseudonym}},
+		{"bans", `UPDATE chatserver.bans SET banished_id = $2 WHERE banished_id = $1`, []any{userID, pseudonym}},
+		{"appeals", `
+			UPDATE chatserver.appeals
+			SET user_id = $2, username = $2, message = CASE WHEN $3 THEN message ELSE '' END
+			WHERE user_id = $1
+		`, []any{userID, pseudonym, pseudonymize}},
+		{"ban_evasions", `
+			UPDATE chatserver.ban_evasions
+			SET user_id = CASE WHEN user_id = $1 THEN $2 ELSE user_id END,
+				username = CASE WHEN user_id = $1 THEN $2 ELSE username END,
+				banished_id = CASE WHEN banished_id = $1 THEN $2 ELSE banished_id END,
+				ip = NULL, device_id = NULL
+			WHERE user_id = $1 OR banished_id = $1
+		`, []any{userID, pseudonym}},
+		{"filed_reports", `
+			UPDATE chatserver.reports
+			SET reporter_id = $2, reporter_username = $2, details = CASE WHEN $3 THEN details ELSE '' END
+			WHERE reporter_id = $1
+		`, []any{userID, pseudonym, pseudonymize}},
+		{"received_reports", `
+			UPDATE chatserver.reports
+			SET reported_user_id = $2, reported_username = $2, snapshot = CASE WHEN $3 THEN snapshot END
+			WHERE reported_user_id = $1
+		`, []any{userID, pseudonym, pseudonymize}},
+		{"automod_flags", `
+			UPDATE chatserver.automod_flags
+			SET owner_id = $2, username = $2, message = CASE WHEN $3 THEN message ELSE '' END
+			WHERE owner_id = $1
+		`, []any{userID, pseudonym, pseudonymize}},
+		{"received_automod_flags", `
+			UPDATE chatserver.automod_flags SET recipient_id = $2 WHERE recipient_id = $1
+		`, []any{userID, pseudonym}},
+		{"audit_log", `
+			UPDATE chatserver.audit_log
+			SET actor_id = CASE WHEN actor_id = $1 THEN $2 ELSE actor_id END,
+				actor_username = CASE WHEN actor_id = $1 THEN $2 ELSE actor_username END,
+				target = CASE WHEN target = $1 THEN $2 ELSE target END
+			WHERE actor_id = $1 OR target = $1
+		`, []any{userID, pseudonym}},
+	}...)
+
+	for _, step := range steps {
+		cmd, err := tx.Exec(ctx, step.query, step.args...)
+		if err != nil {
+			return nil, fmt.Errorf("failed to erase %s: %w", step.name, err)
+		}
+		counts[step.name] = cmd.RowsAffected()
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit erasure of %s: %w", userID, err)
+	}
+	return counts, nil
+}
@@ -2,59 +2,135 @@ package db
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"strings"
+	"time"
 
 	"onrabble.com/chatserver/internal/models"
 
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-func FetchUsers(db *pgxpool.Pool, username string) ([]models.User, error) {
+// FetchUsers retrieves users from the Keycloak user directory, newest accounts first,
+// optionally filtered by username and paginated by the page's keyset cursors.
+// It returns:
+//  1. A slice of User models
+//  2. PageInfo describing whether more users exist and the cursors around this page
+//  3. An error, if any
+func FetchUsers(db *pgxpool.Pool, username string, page PageRequest) ([]models.User, PageInfo, error) {
 	ctx := context.Background()
 
 	query := `
-		SELECT DISTINCT ON (u.id) 
+		SELECT 
 			u.id, 
 			u.username,
-			CASE 
-				WHEN b.id IS NOT NULL THEN TRUE 
-				ELSE FALSE 
-			END AS banned
+			COALESCE(u.created_timestamp, 0),
+			EXISTS (
+				SELECT 1
+				FROM chatserver.bans b
+				WHERE b.banished_id = u.id
+				AND b.pardoned = FALSE
+				AND (
+					b.end_time IS NULL OR b.end_time > NOW()
+				)
+			) AS banned
 		FROM keycloak.public.user_entity u
-		LEFT JOIN chatserver.bans b 
-			ON u.id = b.banished_id 
-			AND b.pardoned = FALSE
-			AND (
-				b.end_time IS NULL OR b.end_time > NOW()
-			)
 	`
 
+	var conditions []string
 	var args []interface{}
 	if username != "" {
-		query += " WHERE u.username = $1"
+		conditions = append(conditions, "u.username = $1")
 		args = append(args, username)
 	}
 
-	query += " ORDER BY u.id, b.start_time DESC"
+	// Keycloak stores creation time in epoch milliseconds
+	conditions, args, pageClause := page.keyset("to_timestamp(COALESCE(u.created_timestamp, 0) / 1000.0)", "u.id", "TEXT", conditions, args)
+	if len(conditions) > 0 {
+		query += " WHERE " + strings.Join(conditions, " AND ")
+	}
+	query += pageClause
 
 	rows, err := db.Query(ctx, query, args...)
 	if err != nil {
-		return nil, fmt.Errorf("failed to fetch users: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("failed to fetch users: %w", err)
 	}
 	defer rows.Close()
 
 	var users []models.User
 	for rows.Next() {
 		var user models.User
-		if err := rows.Scan(&user.ID, &user.Username, &user.Banned); err != nil {
-			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		var createdMillis int64
+		if err := rows.Scan(&user.ID, &user.Username, &createdMillis, &user.Banned); err != nil {
+			return nil, PageInfo{}, fmt.Errorf("failed to scan user row: %w", err)
 		}
+		user.CreatedAt = time.UnixMilli(createdMillis).UTC()
 		users = append(users, user)
 	}
 
 	if err := rows.Err(); err != nil {
-		return nil, fmt.Errorf("error iterating over user rows: %w", err)
+		return nil, PageInfo{}, fmt.Errorf("error iterating over user rows: %w", err)
+	}
+
+	users, info := finishPage(users, page, func(user models.User) Cursor {
+		return Cursor{At: user.CreatedAt, ID: user.ID}
+	})
+
+	return users, info, nil
+}
+
+// FindUsersByUsernames looks up users in the Keycloak user directory by username.
+// Keycloak stores usernames in lower case, so the lookup is case-insensitive.
+// Usernames that do not exist are left out of the result.
+func FindUsersByUsernames(db *pgxpool.Pool, usernames []string) ([]models.User, error) {
+	if len(usernames) == 0 {
+		return nil, nil
+	}
+
+	lowered := make([]string, len(usernames))
+	for i, username := range usernames {
+		lowered[i] = strings.ToLower(username)
+	}
+
+	rows, err := db.Query(context.Background(), `
+		SELECT id, username FROM keycloak.public.user_entity WHERE username = ANY($1)
+	`, lowered)
+	if err != nil {
+		return nil, fmt.Errorf("failed to look up users: %w", err)
+	}
+	defer rows.Close()
+
+	var users []models.User
+	for rows.Next() {
+		var user models.User
+		if err := rows.Scan(&user.ID, &user.Username); err != nil {
+			return nil, fmt.Errorf("failed to scan user row: %w", err)
+		}
+		users = append(users, user)
+	}
+
+	return users, rows.Err()
+}
+
+// FindUsernameByID looks up a username in the Keycloak user directory by user ID.
+// It returns:
+//  1. The username, if found
+//  2. A boolean indicating whether the user exists
+//  3. An error, if the lookup failed
+func FindUsernameByID(db *pgxpool.Pool, userID string) (string, bool, error) {
+	var username string
+	err := db.QueryRow(context.Background(), `
+		SELECT username FROM keycloak.public.user_entity WHERE id = $1
+	`, userID).Scan(&username)
+
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("failed to look up user %s: %w", userID, err)
 	}
 
-	return users, nil
+	return username, true, nil
 }
@@ -0,0 +1,112 @@
+package format
+
+import (
+	"errors"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"golang.org/x/text/unicode/norm"
+)
+
+const (
+	// MaxLength caps a message's length in characters after normalization.
+	MaxLength = 4000
+
+	// maxCombiningMarks caps consecutive combining marks on one character, enough for
+	// any real script but not for "Zalgo" text that spills over neighbouring lines.
+	maxCombiningMarks = 4
+)
+
+// Reasons a message is rejected by Normalize.
+var (
+	ErrInvalidUTF8      = errors.New("message is not valid UTF-8")
+	ErrTooLong          = errors.New("message is too long")
+	ErrControlCharacter = errors.New("message contains control characters")
+	ErrInvisibleText    = errors.New("message contains invisible or direction-changing characters")
+	ErrCombiningMarks   = errors.New("message stacks too many combining marks")
+)
+
+// Normalize prepares a message's text for storage: line endings become "\n", the text is
+// put in Unicode NFC form so equal-looking text compares equal, and trailing whitespace is
+// trimmed. Text that could render differently on different clients or hide its content is
+// rejected: control characters other than newlines and tabs, bidirectional overrides,
+// zero-width spaces and other invisible characters, misplaced or repeated zero-width
+// joiners, and long runs of combining marks.
+func Normalize(text string) (string, error) {
+	if !utf8.ValidString(text) {
+		return "", ErrInvalidUTF8
+	}
+
+	text = strings.ReplaceAll(text, "\r\n", "\n")
+	text = strings.ReplaceAll(text, "\r", "\n")
+	text = norm.NFC.String(text)
+	text = strings.TrimRightFunc(text, unicode.IsSpace)
+
+	if utf8.RuneCountInString(text) > MaxLength {
+		return "", ErrTooLong
+	}
+
+	var prev rune
+	marks := 0
+	for i, r := range text {
+		switch {
+		case r == '\n' || r == '\t':
+		case unicode.IsControl(r):
+			return "", ErrControlCharacter
+		case invisible(r):
+			return "", ErrInvisibleText
+		case r == '\u200c' || r == '\u200d':
+			// Joiners are needed for emoji sequences and some scripts, but only between
+			// two visible characters
+			next, _ := utf8.DecodeRuneInString(text[i+utf8.RuneLen(r):])
+			if !visible(prev) || !visible(next) {
+				return "", ErrInvisibleText
+			}
+		}
+
+		if unicode.Is(unicode.Mn, r) {
+			marks++
+			if marks > maxCombiningMarks {
+				return "", ErrCombiningMarks
+			}
+		} else {
+			marks = 0
+		}
+		prev = r
+	}
+
+	return text, nil
+}
+
+// invisibleRanges lists the characters that are never allowed: bidirectional embeddings,
+// overrides and isolates, and characters that render as nothing.
+var invisibleRanges = [][2]rune{
+	{0x034f, 0x034f},   // Combining grapheme joiner
+	{0x115f, 0x1160},   // Hangul fillers
+	{0x180e, 0x180e},   // Mongolian vowel separator
+	{0x200b, 0x200b},   // Zero-width space
+	{0x202a, 0x202e},   // Bidirectional embeddings and overrides
+	{0x2060, 0x2064},   // Word joiner and invisible operators
+	{0x2066, 0x2069},   // Bidirectional isolates
+	{0x3164, 0x3164},   // Hangul filler
+	{0xfeff, 0xfeff},   // Zero-width no-break space
+	{0xffa0, 0xffa0},   // Halfwidth Hangul filler
+	{0xfff9, 0xfffb},   // Interlinear annotations
+	{0xe0001, 0xe0001}, // Language tag
+}
+
+// invisible reports whether r is in invisibleRanges.
+func invisible(r rune) bool {
+	for _, span := range invisibleRanges {
+		if r >= span[0] && r <= span[1] {
+			return true
+		}
+	}
+	return false
+}
+
+// visible reports whether r can sit on either side of a zero-width joiner.
+func visible(r rune) bool {
+	return r != 0 && !unicode.IsSpace(r) && !unicode.IsControl(r) && r != '\u200c' && r != '\u200d'
+}
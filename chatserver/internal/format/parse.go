@@ -0,0 +1,346 @@
+package format
+
+import (
+	"net/url"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	// maxDepth limits how deeply bold, italic, spoiler and link nodes may nest.
+	maxDepth = 4
+
+	maxURLLength = 2048
+)
+
+var (
+	languagePattern = regexp.MustCompile(`^[A-Za-z0-9+#._-]{1,20}$`)
+	mentionPattern  = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9._-]{0,63}`)
+)
+
+// delimiters are the markers of the nodes that wrap other inline content. Longer markers
+// come first so "**" is not read as two italics.
+var delimiters = []struct {
+	marker   string
+	nodeType string
+}{
+	{"**", models.NodeBold},
+	{"||", models.NodeSpoiler},
+	{"*", models.NodeItalic},
+	{"_", models.NodeItalic},
+}
+
+// Parse reads text as the Markdown subset supported in chat: **bold**, *italic* or
+// _italic_, `code`, fenced code blocks, ||spoilers||, [links](https://...) and bare
+// http(s) links, and @mentions. Everything else, including HTML, is plain text. Markers
+// can be escaped with a backslash, and nothing inside code is interpreted.
+func Parse(text string) []models.MessageNode {
+	var nodes []models.MessageNode
+	for {
+		start := strings.Index(text, "```")
+		if start < 0 {
+			break
+		}
+		end := strings.Index(text[start+3:], "```")
+		if end < 0 {
+			break
+		}
+		// Code blocks are blocks of their own, so the line breaks around them are dropped
+		nodes = append(nodes, parseInline(strings.TrimSuffix(text[:start], "\n"), 0, false)...)
+		nodes = append(nodes, codeBlock(text[start+3:start+3+end]))
+		text = strings.TrimPrefix(text[start+3+end+3:], "\n")
+	}
+	nodes = append(nodes, parseInline(text, 0, false)...)
+	return mergeText(nodes)
+}
+
+// codeBlock builds a code block node, taking a single word on the opening fence's line
+// as the language.
+func codeBlock(body string) models.MessageNode {
+	node := models.MessageNode{Type: models.NodeCodeBlock}
+	if first, rest, found := strings.Cut(body, "\n"); found && languagePattern.MatchString(first) {
+		node.Language = first
+		body = rest
+	} else {
+		body = strings.TrimPrefix(body, "\n")
+	}
+	node.Text = strings.TrimSuffix(body, "\n")
+	return node
+}
+
+// parseInline parses the inline nodes of s. Links cannot contain links or mentions.
+func parseInline(s string, depth int, inLink bool) []models.MessageNode {
+	var nodes []models.MessageNode
+	var text strings.Builder
+	flush := func() {
+		if text.Len() > 0 {
+			nodes = append(nodes, models.MessageNode{Type: models.NodeText, Text: text.String()})
+			text.Reset()
+		}
+	}
+	emit := func(node models.MessageNode) {
+		flush()
+		nodes = append(nodes, node)
+	}
+
+	for i := 0; i < len(s); {
+		c := s[i]
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_|[]()@~>#-", s[i+1]) >= 0:
+			text.WriteByte(s[i+1])
+			i += 2
+			continue
+
+		case c == '`':
+			if end := strings.IndexByte(s[i+1:], '`'); end > 0 {
+				emit(models.MessageNode{Type: models.NodeCode, Text: s[i+1 : i+1+end]})
+				i += end + 2
+				continue
+			}
+
+		case (c == '*' || c == '_' || c == '|') && depth < maxDepth:
+			if node, length, ok := parseDelimited(s, i, depth, inLink); ok {
+				emit(node)
+				i += length
+				continue
+			}
+
+		case c == '[' && !inLink && depth < maxDepth:
+			if node, length, ok := parseLink(s, i, depth); ok {
+				emit(node)
+				i += length
+				continue
+			}
+
+		case c == 'h' && !inLink && !wordByte(s, i-1):
+			if link, length := autolink(s[i:]); length > 0 {
+				emit(models.MessageNode{
+					Type:     models.NodeLink,
+					URL:      link,
+					Children: []models.MessageNode{{Type: models.NodeText, Text: s[i : i+length]}},
+				})
+				i += length
+				continue
+			}
+
+		case c == '@' && !inLink && !wordByte(s, i-1) && (i == 0 || s[i-1] != '@'):
+			if name := strings.TrimRight(mentionPattern.FindString(s[i+1:]), ".-"); name != "" {
+				emit(models.MessageNode{Type: models.NodeMention, Text: name})
+				i += 1 + len(name)
+				continue
+			}
+		}
+
+		_, size := utf8.DecodeRuneInString(s[i:])
+		text.WriteString(s[i : i+size])
+		i += size
+	}
+
+	flush()
+	return nodes
+}
+
+// parseDelimited parses bold, italic or spoiler content opened at s[i]. It returns the
+// node and the length of s it spans.
+func parseDelimited(s string, i, depth int, inLink bool) (models.MessageNode, int, bool) {
+	for _, d := range delimiters {
+		if !strings.HasPrefix(s[i:], d.marker) {
+			continue
+		}
+		// Underscores inside words, as in snake_case, are not markers
+		if d.marker == "_" && wordByte(s, i-1) {
+			continue
+		}
+
+		start := i + len(d.marker)
+		end := findClose(s, start, d.marker)
+		if end < 0 {
+			continue
+		}
+		inner := s[start:end]
+		if inner == "" {
+			continue
+		}
+		if d.nodeType == models.NodeItalic || d.nodeType == models.NodeBold {
+			if strings.TrimSpace(inner[:1]) == "" || strings.TrimSpace(inner[len(inner)-1:]) == "" {
+				continue
+			}
+		}
+		if d.marker == "_" && wordByte(s, end+1) {
+			continue
+		}
+
+		return models.MessageNode{
+			Type:     d.nodeType,
+			Children: parseInline(inner, depth+1, inLink),
+		}, end + len(d.marker) - i, true
+	}
+	return models.MessageNode{}, 0, false
+}
+
+// findClose returns the index of the marker that closes one opened before from, skipping
+// escaped characters and code spans. A run of marker characters closes at its end, so
+// "***text***" is bold around italic, and single markers skip over doubled ones so
+// "*a **b** c*" is italic around bold.
+func findClose(s string, from int, marker string) int {
+	repeatable := strings.IndexByte("*_|", marker[0]) >= 0
+	for j := from; j < len(s); {
+		switch {
+		case s[j] == '\\':
+			j += 2
+			continue
+		case s[j] == '`':
+			if end := strings.IndexByte(s[j+1:], '`'); end >= 0 {
+				j += end + 2
+				continue
+			}
+		case strings.HasPrefix(s[j:], marker):
+			after := j + len(marker)
+			if repeatable && after < len(s) && s[after] == marker[0] {
+				if len(marker) == 1 {
+					// Step over the whole doubled marker
+					for j < len(s) && s[j] == marker[0] {
+						j++
+					}
+					continue
+				}
+				j++
+				continue
+			}
+			return j
+		}
+		j++
+	}
+	return -1
+}
+
+// parseLink parses a [text](url) link opened at s[i].
+func parseLink(s string, i, depth int) (models.MessageNode, int, bool) {
+	closeText := findClose(s, i+1, "]")
+	if closeText < 0 || closeText+1 >= len(s) || s[closeText+1] != '(' {
+		return models.MessageNode{}, 0, false
+	}
+	closeURL := strings.IndexByte(s[closeText+2:], ')')
+	if closeURL < 0 {
+		return models.MessageNode{}, 0, false
+	}
+
+	label := s[i+1 : closeText]
+	link, ok := safeURL(s[closeText+2 : closeText+2+closeURL])
+	if !ok || strings.TrimSpace(label) == "" {
+		return models.MessageNode{}, 0, false
+	}
+
+	return models.MessageNode{
+		Type:     models.NodeLink,
+		URL:      link,
+		Children: parseInline(label, depth+1, true),
+	}, closeText + 2 + closeURL + 1 - i, true
+}
+
+// autolink returns the bare http(s) link at the start of s and its length. Trailing
+// punctuation is left out unless it closes a bracket opened inside the link.
+func autolink(s string) (string, int) {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return "", 0
+	}
+	end := strings.IndexFunc(s, func(r rune) bool {
+		return r == ' ' || r == '\n' || r == '\t' || r == '<' || r == '>' || r == '"' || r == '`'
+	})
+	if end < 0 {
+		end = len(s)
+	}
+
+	candidate := trimLink(s[:end])
+	link, ok := safeURL(candidate)
+	if !ok {
+		return "", 0
+	}
+	return link, len(candidate)
+}
+
+// trimLink drops sentence punctuation and unbalanced closing brackets from the end of a link.
+func trimLink(link string) string {
+	for {
+		trimmed := strings.TrimRight(link, ".,;:!?'*_|")
+		for _, pair := range []string{"()", "[]"} {
+			if strings.HasSuffix(trimmed, pair[1:]) && strings.Count(trimmed, pair[1:]) > strings.Count(trimmed, pair[:1]) {
+				trimmed = trimmed[:len(trimmed)-1]
+			}
+		}
+		if trimmed == link {
+			return link
+		}
+		link = trimmed
+	}
+}
+
+// safeURL returns the canonical form of an absolute http or https URL.
+func safeURL(raw string) (string, bool) {
+	if raw == "" || len(raw) > maxURLLength || strings.ContainsAny(raw, " \t\n") {
+		return "", false
+	}
+	parsed, err := url.Parse(raw)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" || parsed.User != nil {
+		return "", false
+	}
+	return parsed.String(), true
+}
+
+// wordByte reports whether s[i] is an ASCII letter, digit or underscore.
+func wordByte(s string, i int) bool {
+	if i < 0 || i >= len(s) {
+		return false
+	}
+	c := s[i]
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9'
+}
+
+// mergeText joins adjacent text nodes.
+func mergeText(nodes []models.MessageNode) []models.MessageNode {
+	merged := nodes[:0]
+	for _, node := range nodes {
+		if last := len(merged) - 1; node.Type == models.NodeText && last >= 0 && merged[last].Type == models.NodeText {
+			merged[last].Text += node.Text
+			continue
+		}
+		merged = append(merged, node)
+	}
+	return merged
+}
+
+// Links returns the distinct targets of the links in nodes, in order of appearance, up to limit.
+func Links(nodes []models.MessageNode, limit int) []string {
+	var links []string
+	var walk func([]models.MessageNode)
+	walk = func(nodes []models.MessageNode) {
+		for _, node := range nodes {
+			if len(links) == limit {
+				return
+			}
+			if node.Type == models.NodeLink && !slices.Contains(links, node.URL) {
+				links = append(links, node.URL)
+			}
+			walk(node.Children)
+		}
+	}
+	walk(nodes)
+	return links
+}
+
+// Mentions returns the names mentioned in nodes, in order of appearance. Names in code or
+// link text are not mentions.
+func Mentions(nodes []models.MessageNode) []string {
+	var names []string
+	for _, node := range nodes {
+		if node.Type == models.NodeMention {
+			names = append(names, node.Text)
+		}
+		names = append(names, Mentions(node.Children)...)
+	}
+	return names
+}
@@ -0,0 +1,58 @@
+package format
+
+import (
+	"html"
+	"strings"
+
+	"onrabble.com/chatserver/internal/models"
+)
+
+// Render parses text and returns its nodes along with their HTML.
+func Render(text string) ([]models.MessageNode, string) {
+	nodes := Parse(text)
+	return nodes, HTML(nodes)
+}
+
+// HTML renders nodes as HTML. All text is escaped, so the only markup in the result is
+// the fixed set of tags below: <strong>, <em>, <code>, <pre>, <br>, <a> with an http(s)
+// href, and <span> for spoilers and mentions.
+func HTML(nodes []models.MessageNode) string {
+	var b strings.Builder
+	writeHTML(&b, nodes)
+	return b.String()
+}
+
+func writeHTML(b *strings.Builder, nodes []models.MessageNode) {
+	for _, node := range nodes {
+		switch node.Type {
+		case models.NodeText:
+			b.WriteString(strings.ReplaceAll(html.EscapeString(node.Text), "\n", "<br>"))
+		case models.NodeBold:
+			wrapHTML(b, "<strong>", node.Children, "</strong>")
+		case models.NodeItalic:
+			wrapHTML(b, "<em>", node.Children, "</em>")
+		case models.NodeSpoiler:
+			wrapHTML(b, `<span class="spoiler">`, node.Children, "</span>")
+		case models.NodeCode:
+			b.WriteString("<code>" + html.EscapeString(node.Text) + "</code>")
+		case models.NodeCodeBlock:
+			if node.Language != "" {
+				b.WriteString(`<pre><code class="language-` + html.EscapeString(node.Language) + `">`)
+			} else {
+				b.WriteString("<pre><code>")
+			}
+			b.WriteString(html.EscapeString(node.Text) + "</code></pre>")
+		case models.NodeLink:
+			wrapHTML(b, `<a href="`+html.EscapeString(node.URL)+`" rel="nofollow noopener noreferrer ugc" target="_blank">`, node.Children, "</a>")
+		case models.NodeMention:
+			name := html.EscapeString(node.Text)
+			b.WriteString(`<span class="mention" data-username="` + name + `">@` + name + `</span>`)
+		}
+	}
+}
+
+func wrapHTML(b *strings.Builder, open string, children []models.MessageNode, close string) {
+	b.WriteString(open)
+	writeHTML(b, children)
+	b.WriteString(close)
+}
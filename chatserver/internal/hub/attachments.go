@@ -0,0 +1,65 @@
+package hub
+
+import (
+	"log"
+	"slices"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// maxAttachmentsPerMessage caps the number of files sent with a single message.
+const maxAttachmentsPerMessage = 10
+
+// resolveAttachments looks up the attachments a sender listed by ID on a new message. Every
+// one must be the sender's own upload that has not been sent yet, otherwise the message is
+// rejected by returning false.
+func (h *Hub) resolveAttachments(ownerID string, requested []models.Attachment) ([]models.Attachment, bool) {
+	if len(requested) == 0 {
+		return nil, true
+	}
+
+	ids := make([]string, 0, len(requested))
+	for _, attachment := range requested {
+		if !slices.Contains(ids, attachment.ID) {
+			ids = append(ids, attachment.ID)
+		}
+	}
+	if len(ids) > maxAttachmentsPerMessage {
+		log.Printf("%s tried to send %d attachments with one message", ownerID, len(ids))
+		return nil, false
+	}
+
+	attachments, err := db.FetchUnsentAttachments(h.db, ownerID, ids)
+	if err != nil {
+		log.Printf("Failed to resolve attachments for %s: %v", ownerID, err)
+		return nil, false
+	}
+	if len(attachments) != len(ids) {
+		log.Printf("%s sent attachments that are unknown, already sent or not theirs", ownerID)
+		return nil, false
+	}
+	return attachments, true
+}
+
+// linkAttachments records which message the attachments were sent with, granting the
+// message's audience access to them.
+func (h *Hub) linkAttachments(attachments []models.Attachment, target string, cacheID int, channel, recipientID string) {
+	if len(attachments) == 0 {
+		return
+	}
+
+	ids := make([]string, len(attachments))
+	for i, attachment := range attachments {
+		ids[i] = attachment.ID
+	}
+
+	linked, err := db.LinkAttachments(h.db, ids, target, cacheID, channel, recipientID)
+	if err != nil {
+		log.Printf("Failed to link attachments to message %d: %v", cacheID, err)
+		return
+	}
+	if linked != int64(len(ids)) {
+		log.Printf("Only %d of %d attachments were linked to message %d", linked, len(ids), cacheID)
+	}
+}
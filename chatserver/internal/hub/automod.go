@@ -0,0 +1,88 @@
+package hub
+
+import (
+	"fmt"
+	"log"
+	"time"
+
+	"onrabble.com/chatserver/internal/automod"
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// automodSweepInterval is how often automod forgets old messages and expired mutes.
+const automodSweepInterval = time.Minute
+
+// ReloadAutomod loads the automod rules and active mutes from the database, replacing
+// those in use.
+func (h *Hub) ReloadAutomod() error {
+	rules, err := db.FetchAutomodRules(h.db)
+	if err != nil {
+		return err
+	}
+	mutes, err := db.FetchActiveMutes(h.db)
+	if err != nil {
+		return err
+	}
+
+	h.automod.SetRules(rules)
+	h.automod.SetMutes(mutes)
+	log.Printf("Loaded %d automod rules and %d mutes", len(rules), len(mutes))
+	return nil
+}
+
+// moderate checks a new message against the automod rules before it is cached. Refused
+// messages, and any message from a muted sender, are answered with message_rejected and
+// false is returned. Otherwise the verdict holds the text to deliver.
+func (h *Hub) moderate(msg automod.Message, rejected chat.MessageRejectedPayload) (automod.Verdict, bool) {
+	if until, muted := h.automod.MutedUntil(msg.UserID); muted {
+		rejected.Reason = "You are muted"
+		rejected.MutedUntil = &until
+		h.deliverTo(chat.NewMessageRejectedMessage(rejected), msg.UserID)
+		return automod.Verdict{}, false
+	}
+
+	verdict := h.automod.Check(msg)
+	switch verdict.Action {
+	case models.AutomodActionMute:
+		until := time.Now().Add(time.Duration(verdict.Rule.MuteSeconds) * time.Second)
+		ruleID := verdict.Rule.ID
+		mute := models.AutomodMute{
+			UserID: msg.UserID,
+			Until:  until,
+			Reason: fmt.Sprintf("%s: message %s", verdict.Rule.Name, verdict.Reason),
+			RuleID: &ruleID,
+		}
+		if err := db.MuteUser(h.db, mute); err != nil {
+			log.Printf("Failed to record mute of %s: %v", msg.UserID, err)
+		}
+		h.automod.Mute(msg.UserID, until)
+		rejected.MutedUntil = &until
+		fallthrough
+
+	case models.AutomodActionBlock:
+		log.Printf("Automod rule %q refused a message from %s: %s", verdict.Rule.Name, msg.UserID, verdict.Reason)
+		rejected.Reason = fmt.Sprintf("Your message %s", verdict.Reason)
+		h.deliverTo(chat.NewMessageRejectedMessage(rejected), msg.UserID)
+		return verdict, false
+	}
+
+	return verdict, true
+}
+
+// flagMessage queues a delivered message for review once for every flagging rule it broke.
+func (h *Hub) flagMessage(verdict automod.Verdict, flag models.AutomodFlag) {
+	for _, match := range verdict.Matches {
+		if match.Rule.Action != models.AutomodActionFlag {
+			continue
+		}
+		ruleID := match.Rule.ID
+		flag.RuleID = &ruleID
+		flag.RuleName = match.Rule.Name
+		flag.Reason = match.Reason
+		if err := db.SaveAutomodFlag(h.db, flag); err != nil {
+			log.Printf("Failed to flag message %d: %v", flag.CacheID, err)
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package hub
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+	"onrabble.com/chatserver/internal/unfurl"
+)
+
+const (
+	// maxEmbedsPerMessage caps the links previewed in one message.
+	maxEmbedsPerMessage = 3
+
+	// maxConcurrentUnfurls bounds how many messages have links being fetched at once.
+	maxConcurrentUnfurls = 8
+
+	embedTTL        = 24 * time.Hour // How long a fetched preview is reused
+	failedEmbedTTL  = time.Hour      // How long to wait before retrying a link that failed to load
+	blockedEmbedTTL = 24 * time.Hour // Blocked links stay blocked, but the lists may change
+)
+
+// unfurlLinks fetches previews of the links in a channel message in the background and
+// broadcasts them as message_embed once ready. Previews are cached in Valkey by link.
+func (h *Hub) unfurlLinks(msg models.ChatMessage) {
+	if h.unfurler == nil {
+		return
+	}
+	links := format.Links(msg.Content, maxEmbedsPerMessage)
+	if len(links) == 0 {
+		return
+	}
+
+	go func() {
+		// Skip rather than queue when busy; these are best-effort decorations
+		select {
+		case h.unfurlSlots <- struct{}{}:
+			defer func() { <-h.unfurlSlots }()
+		default:
+			log.Printf("Skipping link previews for message %d: too many in progress", msg.CacheID)
+			return
+		}
+
+		cached, err := h.MessageCache.GetEmbeds(links)
+		if err != nil {
+			log.Printf("Failed to read cached link previews: %v", err)
+			cached = nil
+		}
+
+		var embeds []models.Embed
+		for _, link := range links {
+			embed, ok := cached[link]
+			if !ok {
+				embed = h.fetchEmbed(link)
+			}
+			if !embed.Empty() {
+				embeds = append(embeds, embed)
+			}
+		}
+
+		if len(embeds) > 0 {
+			h.SendMessage(chat.NewMessageEmbedMessage(msg, embeds))
+		}
+	}()
+}
+
+// fetchEmbed fetches a link's preview and caches the outcome, including failures.
+func (h *Hub) fetchEmbed(link string) models.Embed {
+	embed, err := h.unfurler.Fetch(context.Background(), link)
+	ttl := embedTTL
+	if err != nil {
+		log.Printf("No preview for %s: %v", link, err)
+		embed = models.Embed{URL: link}
+		ttl = failedEmbedTTL
+		if unfurl.IsBlocked(err) {
+			ttl = blockedEmbedTTL
+		}
+	}
+
+	if err := h.MessageCache.SaveEmbed(embed, ttl); err != nil {
+		log.Printf("Failed to cache preview for %s: %v", link, err)
+	}
+	return embed
+}
+
+// attachEmbeds fills in the link previews of messages from the Valkey cache. Links whose
+// preview was never fetched or has expired are left out rather than fetched again.
+func (h *Hub) attachEmbeds(msgs []models.ChatMessage) {
+	if h.unfurler == nil {
+		return
+	}
+
+	perMessage := make([][]string, len(msgs))
+	var links []string
+	for i, msg := range msgs {
+		perMessage[i] = format.Links(msg.Content, maxEmbedsPerMessage)
+		links = append(links, perMessage[i]...)
+	}
+	if len(links) == 0 {
+		return
+	}
+
+	cached, err := h.MessageCache.GetEmbeds(links)
+	if err != nil {
+		log.Printf("Failed to read cached link previews: %v", err)
+		return
+	}
+	for i := range msgs {
+		msgs[i].Embeds = nil
+		for _, link := range perMessage[i] {
+			if embed, ok := cached[link]; ok && !embed.Empty() {
+				msgs[i].Embeds = append(msgs[i].Embeds, embed)
+			}
+		}
+	}
+}
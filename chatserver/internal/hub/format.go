@@ -0,0 +1,26 @@
+package hub
+
+import (
+	"log"
+
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// formatText normalizes the text of a new message and parses its formatting. Messages whose
+// text is rejected, or that are left with neither text nor attachments, are dropped by
+// returning false.
+func formatText(username, text string, hasAttachments bool) (string, []models.MessageNode, string, bool) {
+	text, err := format.Normalize(text)
+	if err != nil {
+		log.Printf("Dropping message from %s: %v", username, err)
+		return "", nil, "", false
+	}
+	if text == "" && !hasAttachments {
+		log.Printf("Dropping empty message from %s", username)
+		return "", nil, "", false
+	}
+
+	content, html := format.Render(text)
+	return text, content, html, true
+}
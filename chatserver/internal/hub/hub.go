@@ -1,84 +1,208 @@
 package hub
 
 import (
-	"fmt"
 	"log"
+	"slices"
+	"sync"
 	"time"
 
+	"onrabble.com/chatserver/internal/automod"
 	"onrabble.com/chatserver/internal/cache"
 	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/format"
 	"onrabble.com/chatserver/internal/interfaces"
 	"onrabble.com/chatserver/internal/messages"
 	"onrabble.com/chatserver/internal/messages/chat"
 	"onrabble.com/chatserver/internal/models"
+	"onrabble.com/chatserver/internal/unfurl"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// maxHistoryPageSize caps the number of messages returned by a single history request.
+const maxHistoryPageSize = 100
+
+// markReadThrottle is the minimum gap between saved read markers for the same user.
+const markReadThrottle = 250 * time.Millisecond
+
 // Hub manages all active client connections, routes messages,
 // and handles broadcasting, registration, and unregistration.
 type Hub struct {
-	Connections  map[string]interfaces.ClientInterface
+	Connections  map[string]interfaces.ClientInterface            // Every connection, keyed by connection ID
+	userConns    map[string]map[string]interfaces.ClientInterface // Connections of each user, keyed by user ID then connection ID
+	connMu       sync.RWMutex                                     // Guards Connections and userConns
 	Messages     chan messages.BaseMessage
 	Register     chan interfaces.ClientInterface
 	Unregister   chan interfaces.ClientInterface
 	MessageCache *cache.MessageCache
 	db           *pgxpool.Pool
+	typing       map[string]*typingState // Active typing indicators keyed by typingKey
+	typingSent   map[string]time.Time    // When each user last started an indicator, keyed by user ID
+	typingMu     sync.Mutex
+	presence     map[string]*presenceState // Presence of users with connections, keyed by user ID
+	presenceMu   sync.Mutex
+	threadSubs   map[int]map[string]interfaces.ClientInterface // Connections following each thread, keyed by parent cacheID then connection ID
+	threadMu     sync.Mutex
+	lastRead     map[string]time.Time // When each user last saved a read marker, keyed by user ID
+	lastReaction map[string]time.Time // When each user last changed a reaction, keyed by user ID
+	throttleMu   sync.Mutex           // Guards lastRead and lastReaction
+	unfurler     *unfurl.Unfurler     // Fetches link previews; nil disables them
+	unfurlSlots  chan struct{}        // Limits concurrent link preview fetches
+	automod      *automod.Engine      // Checks messages against the automod rules
 }
 
-// NewHub creates and returns a new Hub instance.
-func NewHub(db *pgxpool.Pool, cache *cache.MessageCache) *Hub {
+// NewHub creates and returns a new Hub instance. Link previews are disabled when unfurler is nil.
+func NewHub(db *pgxpool.Pool, cache *cache.MessageCache, unfurler *unfurl.Unfurler) *Hub {
 	return &Hub{
 		Connections:  make(map[string]interfaces.ClientInterface),
+		userConns:    make(map[string]map[string]interfaces.ClientInterface),
 		Messages:     make(chan messages.BaseMessage),
 		Register:     make(chan interfaces.ClientInterface),
 		Unregister:   make(chan interfaces.ClientInterface),
 		MessageCache: cache,
 		db:           db,
+		typing:       make(map[string]*typingState),
+		typingSent:   make(map[string]time.Time),
+		presence:     make(map[string]*presenceState),
+		threadSubs:   make(map[int]map[string]interfaces.ClientInterface),
+		lastRead:     make(map[string]time.Time),
+		lastReaction: make(map[string]time.Time),
+		unfurler:     unfurler,
+		unfurlSlots:  make(chan struct{}, maxConcurrentUnfurls),
+		automod:      automod.NewEngine(),
 	}
 }
 
 // RegisterClient adds a client to the hub and tracks its connection start time.
-func (h *Hub) RegisterClient(client interfaces.ClientInterface, clientID string) {
-	key := fmt.Sprintf("%s:%s", client.GetID(), clientID)
-	log.Println("Hub Registered:", key)
+// A user may hold any number of connections at once, including several from the same app.
+func (h *Hub) RegisterClient(client interfaces.ClientInterface) {
+	key := client.GetConnectionID()
+	log.Printf("Hub Registered: %s:%s (%s)", client.GetID(), client.GetClientID(), key)
+	h.connMu.Lock()
 	h.Connections[key] = client
+	conns, ok := h.userConns[client.GetID()]
+	if !ok {
+		conns = make(map[string]interfaces.ClientInterface)
+		h.userConns[client.GetID()] = conns
+	}
+	conns[key] = client
+	h.connMu.Unlock()
 	client.StartConnectionTimer()
 	log.Printf("User registered: %s", client.GetUsername())
 
+	// Announce the user unless they connected through the dashboard
+	if tracksPresence(client.GetClientID()) {
+		h.updatePresence(client.GetID(), client.GetUsername())
+	}
+
 	privateMessages := h.MessageCache.GetCachedPrivateMessages(client.GetID())
 	if len(privateMessages) > 0 {
+		h.markUnread(client.GetID(), privateMessages)
+		if err := db.AttachPrivateReactions(h.db, privateMessages); err != nil {
+			log.Printf("Failed to attach reactions to private messages: %v", err)
+		}
 		bulk := chat.NewBulkPrivateMessages(privateMessages)
 		client.SendMessage(bulk)
 		log.Printf("Sent %d cached private messages to %s", len(privateMessages), client.GetUsername())
 	}
 }
 
-// UnregisterClient removes a client from the hub and logs the session duration.
-func (h *Hub) UnregisterClient(client interfaces.ClientInterface, clientID string) {
-	key := fmt.Sprintf("%s:%s", client.GetID(), clientID)
-	if _, ok := h.Connections[key]; ok {
-		delete(h.Connections, key)
+// markUnread flags the private messages userID received but has not read yet, including
+// those delivered while they were offline.
+func (h *Hub) markUnread(userID string, privateMessages []models.PrivateChatMessage) {
+	_, peerMarkers, err := db.FetchReadMarkers(h.db, userID)
+	if err != nil {
+		log.Printf("Failed to determine unread private messages for %s: %v", userID, err)
+		return
+	}
+
+	for i, msg := range privateMessages {
+		if msg.RecipientID == userID && msg.OwnerID != userID && msg.CacheID > peerMarkers[msg.OwnerID] {
+			privateMessages[i].Unread = true
+		}
+	}
+}
 
-		sessionStart := client.GetConnectedAt()
-		sessionEnd := time.Now()
+// GetUnreadCounts returns how many messages userID has not read, keyed by channel name and
+// by private conversation peer ID. Counts cover both stored messages and those still
+// waiting in the cache to be flushed.
+func (h *Hub) GetUnreadCounts(userID string) (map[string]int, map[string]int) {
+	channels, peers, err := db.FetchUnreadCounts(h.db, userID)
+	if err != nil {
+		log.Printf("Failed to count unread messages for %s: %v", userID, err)
+		return nil, nil
+	}
 
-		err := db.RecordUserSession(h.db, client.GetID(), sessionStart, sessionEnd)
-		if err != nil {
-			log.Printf("Failed to record session for %s: %v", client.GetUsername(), err)
-		} else {
-			log.Printf("Session recorded for %s (duration: %v)", client.GetUsername(), sessionEnd.Sub(sessionStart))
+	channelMarkers, peerMarkers, err := db.FetchReadMarkers(h.db, userID)
+	if err != nil {
+		log.Printf("Failed to fetch read markers for %s: %v", userID, err)
+		return channels, peers
+	}
+
+	// Channels are only counted once the user has a marker for them
+	for _, msg := range h.MessageCache.GetUnflushedChatMessages() {
+		if marker, ok := channelMarkers[msg.Channel]; ok && msg.CacheID > marker {
+			channels[msg.Channel]++
 		}
+	}
 
-		// Safely close the channel only if it's not already closed
-		closeClientSendChannel(client)
+	for _, msg := range h.MessageCache.GetUnflushedPrivateMessages() {
+		if msg.RecipientID == userID && msg.OwnerID != userID && msg.CacheID > peerMarkers[msg.OwnerID] {
+			peers[msg.OwnerID]++
+		}
+	}
 
-		// Broadcast the disconnected message
-		msg := chat.NewUserStatusMessage(client.GetUsername(), client.GetID(), false)
-		h.Broadcast(msg)
+	return channels, peers
+}
 
-		log.Printf("User unregistered: %s", client.GetUsername())
+// UnregisterClient removes a client from the hub and logs the session duration.
+// The user's other connections are left untouched.
+func (h *Hub) UnregisterClient(client interfaces.ClientInterface) {
+	key := client.GetConnectionID()
+	h.connMu.Lock()
+	if _, ok := h.Connections[key]; !ok {
+		h.connMu.Unlock()
+		return
+	}
+	delete(h.Connections, key)
+	if conns := h.userConns[client.GetID()]; conns != nil {
+		delete(conns, key)
+		if len(conns) == 0 {
+			delete(h.userConns, client.GetID())
+		}
+	}
+	lastConnection := len(h.userConns[client.GetID()]) == 0
+	h.connMu.Unlock()
+
+	sessionStart := client.GetConnectedAt()
+	sessionEnd := time.Now()
+
+	err := db.RecordUserSession(h.db, client.GetID(), sessionStart, sessionEnd)
+	if err != nil {
+		log.Printf("Failed to record session for %s: %v", client.GetUsername(), err)
+	} else {
+		log.Printf("Session recorded for %s (duration: %v)", client.GetUsername(), sessionEnd.Sub(sessionStart))
+	}
+
+	// Safely close the channel only if it's not already closed
+	closeClientSendChannel(client)
+	h.closeThreads(client)
+
+	// Don't leave a stale typing indicator behind once the user's last connection is gone
+	if lastConnection {
+		h.clearTyping(client.GetID())
+		h.throttleMu.Lock()
+		delete(h.lastRead, client.GetID())
+		delete(h.lastReaction, client.GetID())
+		h.throttleMu.Unlock()
 	}
+
+	// Announce the user's presence now this connection is gone
+	if tracksPresence(client.GetClientID()) {
+		h.updatePresence(client.GetID(), client.GetUsername())
+	}
+
+	log.Printf("User unregistered: %s", client.GetUsername())
 }
 
 // closeClientSendChannel safely closes a client’s send channel, recovering from any panic.
@@ -91,22 +215,64 @@ func closeClientSendChannel(client interfaces.ClientInterface) {
 	client.CloseSendChannel()
 }
 
+// connections returns every connection. The snapshot can be used without holding connMu.
+func (h *Hub) connections() []interfaces.ClientInterface {
+	h.connMu.RLock()
+	defer h.connMu.RUnlock()
+
+	clients := make([]interfaces.ClientInterface, 0, len(h.Connections))
+	for _, client := range h.Connections {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// connectionsOf returns userID's connections. The snapshot can be used without holding connMu.
+func (h *Hub) connectionsOf(userID string) []interfaces.ClientInterface {
+	h.connMu.RLock()
+	defer h.connMu.RUnlock()
+
+	clients := make([]interfaces.ClientInterface, 0, len(h.userConns[userID]))
+	for _, client := range h.userConns[userID] {
+		clients = append(clients, client)
+	}
+	return clients
+}
+
+// connectedUsers returns the connections of every connected user, keyed by user ID.
+// The snapshot can be used without holding connMu.
+func (h *Hub) connectedUsers() map[string][]interfaces.ClientInterface {
+	h.connMu.RLock()
+	defer h.connMu.RUnlock()
+
+	users := make(map[string][]interfaces.ClientInterface, len(h.userConns))
+	for userID, conns := range h.userConns {
+		for _, client := range conns {
+			users[userID] = append(users[userID], client)
+		}
+	}
+	return users
+}
+
 // SendMessage sends a message into the hub’s internal message loop for handling.
 func (h *Hub) SendMessage(msg messages.BaseMessage) {
 	h.Messages <- msg
 }
 
-// GetConnectedUsers returns a list of currently connected user payloads,
-// excluding clients identified as "WebClient".
+// GetConnectedUsers returns one entry per connected user with their presence, excluding
+// users only connected through "WebClient" and users who are invisible.
 func (h *Hub) GetConnectedUsers() []chat.UserStatusPayload {
 	var users []chat.UserStatusPayload
-	for _, v := range h.Connections {
-		if v.GetClientID() != "WebClient" {
-			users = append(users, chat.UserStatusPayload{
-				Username:    v.GetUsername(),
-				ID:          v.GetID(),
-				IsConnected: true,
-			})
+	for userID, conns := range h.connectedUsers() {
+		presence := h.publicPresenceOf(userID)
+		if presence.State == models.PresenceOffline {
+			continue
+		}
+		for _, v := range conns {
+			if tracksPresence(v.GetClientID()) {
+				users = append(users, chat.NewUserStatusPayload(v.GetUsername(), userID, presence))
+				break
+			}
 		}
 	}
 	return users
@@ -127,6 +293,38 @@ func (h *Hub) handleMessage(msg messages.BaseMessage) {
 			break
 		}
 
+		if payload.Message, payload.Content, payload.HTML, ok = formatText(payload.Username, payload.Message, len(payload.Attachments) > 0); !ok {
+			break
+		}
+
+		sentText := payload.Message
+		verdict, ok := h.moderate(
+			automod.Message{UserID: payload.OwnerID, Channel: payload.Channel, Text: payload.Message, Content: payload.Content},
+			chat.MessageRejectedPayload{Channel: payload.Channel},
+		)
+		if !ok {
+			break
+		}
+		if verdict.Text != payload.Message {
+			payload.Message = verdict.Text
+			payload.Content, payload.HTML = format.Render(verdict.Text)
+		}
+
+		// Replies must belong to an existing thread
+		var parent models.ChatMessage
+		isReply := payload.ReplyTo > 0 || payload.ReplyToID > 0
+		if isReply {
+			if parent, ok = h.resolveReply(&payload); !ok {
+				log.Printf("Dropping reply from %s to unknown message", payload.Username)
+				break
+			}
+		}
+
+		if payload.Attachments, ok = h.resolveAttachments(payload.OwnerID, payload.Attachments); !ok {
+			log.Printf("Dropping message from %s with invalid attachments", payload.Username)
+			break
+		}
+
 		// Get cacheID from CacheChatMessage
 		cacheID, err := h.MessageCache.AttemptCacheWithRateLimit(payload.OwnerID, payload)
 		if err != nil {
@@ -135,13 +333,31 @@ func (h *Hub) handleMessage(msg messages.BaseMessage) {
 			// Possibly send a “rate limit exceeded” message back to the client
 			break
 		}
+		h.linkAttachments(payload.Attachments, models.ReactionTargetChat, cacheID, payload.Channel, "")
+		h.flagMessage(verdict, models.AutomodFlag{
+			Target:   models.ReactionTargetChat,
+			CacheID:  cacheID,
+			Channel:  payload.Channel,
+			OwnerID:  payload.OwnerID,
+			Username: payload.Username,
+			Message:  sentText,
+		})
 
 		// Attach cacheID to msg.Payload for broadcasting
 		payload.CacheID = cacheID
 		msg.Payload = payload // Update BaseMessage with new payload
 
-		log.Printf("Broadcasting message with cacheID %d", cacheID)
-		h.Broadcast(msg)
+		// Replies only go to the thread's followers
+		if isReply {
+			log.Printf("Delivering reply %d to thread %d", cacheID, parent.CacheID)
+			h.deliverReply(payload, parent)
+		} else {
+			log.Printf("Broadcasting message with cacheID %d", cacheID)
+			h.Broadcast(msg)
+		}
+
+		h.notifyMentions(payload)
+		h.unfurlLinks(payload)
 
 	case chat.UserStatusMessageType:
 		log.Printf("Handling user status message for: %s - %v", msg.Sender, msg.Payload)
@@ -151,6 +367,54 @@ func (h *Hub) handleMessage(msg messages.BaseMessage) {
 		log.Println("Sending connected users list")
 		h.Broadcast(msg)
 
+	case chat.MessageEmbedMessageType:
+		log.Println("Broadcasting link previews")
+		h.Broadcast(msg)
+
+	case chat.BanEndedMessageType:
+		payload, ok := msg.Payload.(chat.BanEndedPayload)
+		if !ok {
+			log.Println("invalid ban ended payload")
+			break
+		}
+		h.deliverToModerators(msg, payload.UserID)
+
+	case chat.PinsUpdatedMessageType:
+		log.Println("Broadcasting updated pins")
+		h.Broadcast(msg)
+
+	case chat.TypingStartMessageType, chat.TypingStopMessageType:
+		payload, ok := msg.Payload.(chat.TypingPayload)
+		if !ok {
+			log.Println("invalid typing payload")
+			break
+		}
+		h.handleTyping(msg.Type, payload)
+
+	case chat.SetPresenceMessageType:
+		payload, ok := msg.Payload.(chat.SetPresencePayload)
+		if !ok {
+			log.Println("invalid set presence payload")
+			break
+		}
+		h.setPresence(payload)
+
+	case chat.AddReactionMessageType, chat.RemoveReactionMessageType:
+		reaction, ok := msg.Payload.(models.Reaction)
+		if !ok {
+			log.Println("invalid reaction payload")
+			break
+		}
+		h.handleReaction(msg.Type, reaction)
+
+	case chat.MarkReadMessageType:
+		marker, ok := msg.Payload.(models.ReadMarker)
+		if !ok {
+			log.Println("invalid mark read payload")
+			break
+		}
+		h.markRead(msg.Sender, marker)
+
 	case chat.PrivateChatMessageType:
 		// log.Println("Received a private chat message")
 		// h.Whisper(msg)
@@ -162,11 +426,42 @@ func (h *Hub) handleMessage(msg messages.BaseMessage) {
 			break
 		}
 
+		if payload.Message, payload.Content, payload.HTML, ok = formatText(payload.Username, payload.Message, len(payload.Attachments) > 0); !ok {
+			break
+		}
+
+		sentText := payload.Message
+		verdict, ok := h.moderate(
+			automod.Message{UserID: payload.OwnerID, Text: payload.Message, Content: payload.Content},
+			chat.MessageRejectedPayload{RecipientID: payload.RecipientID},
+		)
+		if !ok {
+			break
+		}
+		if verdict.Text != payload.Message {
+			payload.Message = verdict.Text
+			payload.Content, payload.HTML = format.Render(verdict.Text)
+		}
+
+		if payload.Attachments, ok = h.resolveAttachments(payload.OwnerID, payload.Attachments); !ok {
+			log.Printf("Dropping private message from %s with invalid attachments", payload.Username)
+			break
+		}
+
 		cacheID, err := h.MessageCache.AttemptCachePrivateWithRateLimit(payload.OwnerID, payload)
 		if err != nil {
 			log.Printf("Rate limited or error (private): %v", err)
 			break
 		}
+		h.linkAttachments(payload.Attachments, models.ReactionTargetPrivate, cacheID, "", payload.RecipientID)
+		h.flagMessage(verdict, models.AutomodFlag{
+			Target:      models.ReactionTargetPrivate,
+			CacheID:     cacheID,
+			RecipientID: payload.RecipientID,
+			OwnerID:     payload.OwnerID,
+			Username:    payload.Username,
+			Message:     sentText,
+		})
 
 		payload.CacheID = cacheID
 		msg.Payload = payload
@@ -178,67 +473,306 @@ func (h *Hub) handleMessage(msg messages.BaseMessage) {
 	}
 }
 
-// GetCachedChatMessages returns a slice of chat messages from the message cache.
-func (h *Hub) GetCachedChatMessages() []models.ChatMessage {
-	chatMessages := h.MessageCache.GetCachedChatMessages()
-	for i := 0; i < len(chatMessages); i++ {
-		log.Printf("Message %d: %v", i, chatMessages[i])
+// markRead saves a user's read marker and sends a read receipt to the user's connections
+// and, for private conversations, to the peer's. A marker without a cacheID, or past the
+// latest message, marks everything sent so far as read. Markers for channels that don't
+// exist, for peers the user has no conversation with, or arriving faster than
+// markReadThrottle are dropped.
+func (h *Hub) markRead(username string, marker models.ReadMarker) {
+	if marker.Channel == "" && marker.PeerID == "" {
+		log.Printf("Ignoring read marker from %s without a channel or peer", username)
+		return
+	}
+	if marker.Channel != "" && marker.PeerID != "" {
+		marker.Channel = ""
+	}
+
+	if !h.allow(h.lastRead, marker.UserID, markReadThrottle) {
+		return
+	}
+
+	var latest int
+	var exists bool
+	var err error
+	if marker.PeerID != "" {
+		latest = h.MessageCache.LatestPrivateCacheID()
+		exists, err = h.conversationExists(marker.UserID, marker.PeerID)
+	} else {
+		latest = h.MessageCache.LatestChatCacheID()
+		exists, err = db.ChannelExists(h.db, marker.Channel)
+	}
+	if err != nil {
+		log.Printf("Failed to check read marker target: %v", err)
+		return
+	}
+	if !exists {
+		log.Printf("Ignoring read marker from %s for an unknown channel or conversation", username)
+		return
+	}
+
+	if marker.CacheID <= 0 || marker.CacheID > latest {
+		marker.CacheID = latest
+	}
+
+	saved, err := db.SaveReadMarker(h.db, marker)
+	if err != nil {
+		log.Printf("Failed to save read marker: %v", err)
+		return
+	}
+
+	receipt := chat.NewReadReceiptMessage(username, saved)
+	if saved.PeerID != "" {
+		h.deliverTo(receipt, saved.UserID, saved.PeerID)
+	} else {
+		h.deliverTo(receipt, saved.UserID)
+	}
+}
+
+// allow reports whether userID's last action recorded in last was at least gap ago, and
+// records this one if so. last must be guarded by throttleMu.
+func (h *Hub) allow(last map[string]time.Time, userID string, gap time.Duration) bool {
+	h.throttleMu.Lock()
+	defer h.throttleMu.Unlock()
+
+	now := time.Now()
+	if now.Sub(last[userID]) < gap {
+		return false
+	}
+	last[userID] = now
+	return true
+}
+
+// conversationExists reports whether userID and peerID have exchanged a private message,
+// stored or still waiting to be flushed.
+func (h *Hub) conversationExists(userID, peerID string) (bool, error) {
+	for _, msg := range h.MessageCache.GetUnflushedPrivateMessages() {
+		if (msg.OwnerID == userID && msg.RecipientID == peerID) || (msg.OwnerID == peerID && msg.RecipientID == userID) {
+			return true, nil
+		}
 	}
-	return chatMessages
+	return db.ConversationExists(h.db, userID, peerID)
+}
+
+// GetCachedChatMessages returns up to limit of a channel's most recent messages from the message cache.
+// Reaction counts, thread metadata and cached link previews are included.
+func (h *Hub) GetCachedChatMessages(channel string, limit int) []models.ChatMessage {
+	msgs := h.MessageCache.GetCachedChatMessages(channel, limit)
+	h.attachChatReactions(msgs)
+	h.attachThreads(msgs)
+	h.attachEmbeds(msgs)
+	return msgs
+}
+
+// GetChannelHistory returns up to limit messages from a channel that are older than
+// beforeCacheID, oldest first. The channel's history ring is read first, then the
+// messages still waiting to be flushed, and any remainder is loaded from the database.
+// It returns:
+//  1. The page of messages
+//  2. A boolean indicating whether older messages exist beyond this page
+func (h *Hub) GetChannelHistory(channel string, beforeCacheID, limit int) ([]models.ChatMessage, bool) {
+	if limit <= 0 || limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+
+	cached, hasMore := h.MessageCache.GetCachedChatMessagesBefore(channel, beforeCacheID, limit)
+	if !hasMore {
+		// Continue from the oldest cached message so nothing is returned twice
+		if len(cached) > 0 {
+			beforeCacheID = cached[0].CacheID
+		}
+
+		// A ring shallower than the flush list leaves unflushed messages only in the latter
+		var unflushed []models.ChatMessage
+		for _, msg := range h.MessageCache.GetUnflushedChatMessages() {
+			if msg.Channel == channel && (beforeCacheID <= 0 || msg.CacheID < beforeCacheID) {
+				unflushed = append(unflushed, msg)
+			}
+		}
+		if missing := limit - len(cached); len(unflushed) > missing {
+			unflushed, hasMore = unflushed[len(unflushed)-missing:], true
+		}
+		cached = append(unflushed, cached...)
+	}
+
+	h.attachChatReactions(cached)
+	if hasMore {
+		h.attachThreads(cached)
+		h.attachEmbeds(cached)
+		return cached, true
+	}
+
+	if len(cached) > 0 {
+		beforeCacheID = cached[0].CacheID
+	}
+
+	filter := db.MessageFilter{Channels: []string{channel}, BeforeCacheID: beforeCacheID, ByCacheID: true}
+	stored, info, err := db.FetchMessages(h.db, filter, db.PageRequest{Limit: limit - len(cached)})
+	if err != nil {
+		log.Printf("Failed to fetch history for %s from database: %v", channel, err)
+		h.attachThreads(cached)
+		h.attachEmbeds(cached)
+		return cached, false
+	}
+
+	// The database returns newest first; history pages are oldest first
+	history := make([]models.ChatMessage, 0, len(stored)+len(cached))
+	for i := len(stored) - 1; i >= 0; i-- {
+		history = append(history, stored[i])
+	}
+	history = append(history, cached...)
+
+	// Stored messages only count stored replies, so include the unflushed ones too
+	h.attachThreads(history)
+	h.attachEmbeds(history)
+
+	return history, info.HasMore
+}
+
+// GetConversations returns userID's private conversations, most recently active first,
+// including messages not yet flushed to the database.
+func (h *Hub) GetConversations(userID string) []models.Conversation {
+	conversations, err := h.MessageCache.FetchConversations(userID)
+	if err != nil {
+		log.Printf("Failed to fetch conversations for %s: %v", userID, err)
+		return nil
+	}
+	return conversations
+}
+
+// GetPrivateHistory returns a page of the private messages exchanged between userID and
+// peerID, newest first, continuing from cursor when one is given. Messages not yet
+// flushed to the database are included.
+// It returns:
+//  1. The page of messages
+//  2. A boolean indicating whether older messages exist beyond this page
+//  3. The cursor for the next (older) page, if any
+func (h *Hub) GetPrivateHistory(userID, peerID, cursor string, limit int) ([]models.PrivateChatMessage, bool, string) {
+	if limit <= 0 || limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+
+	page := db.PageRequest{Limit: limit}
+	if cursor != "" {
+		before, err := db.DecodeCursor(cursor)
+		if err != nil {
+			log.Printf("Invalid private history cursor from %s: %v", userID, err)
+			return nil, false, ""
+		}
+		page.Before = &before
+	}
+
+	history, info, err := h.MessageCache.FetchPrivateHistory(userID, peerID, page)
+	if err != nil {
+		log.Printf("Failed to fetch private history between %s and %s: %v", userID, peerID, err)
+		return nil, false, ""
+	}
+
+	return history, info.HasMore, info.NextCursor
 }
 
 // Broadcast sends the given message to all connected clients in the hub.
 func (h *Hub) Broadcast(msg messages.BaseMessage) {
 	log.Printf("Broadcasting message of type: %s", msg.Type)
-	for _, client := range h.Connections {
+	for _, client := range h.connections() {
 		log.Printf("Sending message to: %s", client.GetUsername())
 		client.SendMessage(msg)
 	}
 }
 
-// Whisper sends a private message only to the sender and recipient clients.
+// deliverTo sends a message to every connection belonging to the given users.
+func (h *Hub) deliverTo(msg messages.BaseMessage, userIDs ...string) {
+	for i, userID := range userIDs {
+		// Don't deliver twice when the same user is listed more than once
+		if slices.Contains(userIDs[:i], userID) {
+			continue
+		}
+		for _, client := range h.connectionsOf(userID) {
+			client.SendMessage(msg)
+		}
+	}
+}
+
+// deliverToModerators sends a message to every moderator connection and to the connections
+// of the given users.
+func (h *Hub) deliverToModerators(msg messages.BaseMessage, userIDs ...string) {
+	for _, client := range h.connections() {
+		if client.IsModerator() || slices.Contains(userIDs, client.GetID()) {
+			client.SendMessage(msg)
+		}
+	}
+}
+
+// Whisper sends a private message, or a typing indicator within a private conversation,
+// only to the sender and recipient clients.
 func (h *Hub) Whisper(msg messages.BaseMessage) {
 	log.Printf("Whispering message of type: %s", msg.Type)
 
-	// Extract private message payload
-	payload, ok := msg.Payload.(models.PrivateChatMessage)
-	if !ok {
+	// Extract the conversation's participants from the payload
+	var senderID, recipientID string
+	switch payload := msg.Payload.(type) {
+	case models.PrivateChatMessage:
+		senderID, recipientID = payload.OwnerID, payload.RecipientID
+	case chat.TypingPayload:
+		senderID, recipientID = payload.UserID, payload.PeerID
+	default:
 		log.Println("Invalid private chat message payload")
 		return
 	}
 
-	senderID := payload.OwnerID
-	recipientID := payload.RecipientID
-
-	for key, client := range h.Connections {
-		clientID := client.GetID()
-		if clientID == senderID || clientID == recipientID {
-			log.Printf("Sending whisper to: %s (key: %s)", client.GetUsername(), key)
-			client.SendMessage(msg)
-		}
-	}
+	log.Printf("Sending whisper from %s to %s", senderID, recipientID)
+	h.deliverTo(msg, senderID, recipientID)
 }
 
 // Run starts the hub's main loop and handles registration, unregistration, and messages.
 func (h *Hub) Run() {
+	typingTicker := time.NewTicker(typingSweepInterval)
+	defer typingTicker.Stop()
+	presenceTicker := time.NewTicker(presenceSweepInterval)
+	defer presenceTicker.Stop()
+	automodTicker := time.NewTicker(automodSweepInterval)
+	defer automodTicker.Stop()
+
+	if err := h.ReloadAutomod(); err != nil {
+		log.Printf("Failed to load automod rules: %v", err)
+	}
+
 	for {
 		select {
 		case client := <-h.Register:
-			h.RegisterClient(client, client.GetClientID())
+			h.RegisterClient(client)
 		case client := <-h.Unregister:
-			h.UnregisterClient(client, client.GetClientID())
+			h.UnregisterClient(client)
 		case message := <-h.Messages:
 			h.handleMessage(message)
+		case <-typingTicker.C:
+			h.expireTyping()
+		case <-presenceTicker.C:
+			h.sweepPresence()
+		case <-automodTicker.C:
+			h.automod.Sweep()
 		}
 	}
 }
 
+// LookupUsername resolves a user ID to a username, checking connected clients first and
+// falling back to the Keycloak user directory so offline users can be addressed.
+func (h *Hub) LookupUsername(userID string) (string, bool) {
+	if username, ok := h.FindUsernameByUserID(userID); ok {
+		return username, true
+	}
+
+	username, ok, err := db.FindUsernameByID(h.db, userID)
+	if err != nil {
+		log.Printf("Failed to look up user %s in the directory: %v", userID, err)
+		return "", false
+	}
+	return username, ok
+}
+
 // FindUsernameByUserID returns the username for a given user ID, if connected.
 func (h *Hub) FindUsernameByUserID(userID string) (string, bool) {
-	for _, client := range h.Connections {
-		if client.GetID() == userID {
-			return client.GetUsername(), true
-		}
+	for _, client := range h.connectionsOf(userID) {
+		return client.GetUsername(), true
 	}
 	return "", false
 }
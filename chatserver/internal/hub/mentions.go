@@ -0,0 +1,131 @@
+package hub
+
+import (
+	"log"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/format"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// maxMentionsPerMessage caps how many distinct @names in one message are resolved.
+const maxMentionsPerMessage = 20
+
+// broadcastMentionCooldown is how long a user must wait between @here or @channel mentions.
+const broadcastMentionCooldown = 5 * time.Minute
+
+// parseMentions extracts the distinct usernames mentioned in a message's formatted
+// content, in lower case, and whether it mentions @here or @channel. Names inside code
+// and links are not mentions.
+func parseMentions(content []models.MessageNode) ([]string, bool, bool) {
+	var usernames []string
+	here, channel := false, false
+	seen := make(map[string]bool)
+
+	for _, mention := range format.Mentions(content) {
+		name := strings.ToLower(mention)
+		switch {
+		case name == "here":
+			here = true
+		case name == "channel":
+			channel = true
+		case name != "" && !seen[name] && len(usernames) < maxMentionsPerMessage:
+			seen[name] = true
+			usernames = append(usernames, name)
+		}
+	}
+
+	return usernames, here, channel
+}
+
+// notifyMentions stores the mentions in a chat message and sends a mention notification
+// to the live connections of each mentioned user. @here reaches everyone online and
+// @channel everyone following the channel as well; each user may only use them once per
+// broadcastMentionCooldown, and they are ignored until then. Authors are never notified of
+// their own messages, and a user mentioned in several ways is notified once.
+func (h *Hub) notifyMentions(msg models.ChatMessage) {
+	usernames, here, channel := parseMentions(msg.Content)
+	if here || channel {
+		allowed, err := h.MessageCache.StartCooldown("broadcast_mention", msg.OwnerID, broadcastMentionCooldown)
+		if err != nil {
+			log.Printf("Failed to check @here/@channel cooldown for %s: %v", msg.Username, err)
+		}
+		if !allowed {
+			log.Printf("Ignoring @here/@channel from %s during their cooldown", msg.Username)
+			here, channel = false, false
+		}
+	}
+	if len(usernames) == 0 && !here && !channel {
+		return
+	}
+
+	var mentions []models.Mention
+	mentioned := map[string]bool{msg.OwnerID: true}
+	add := func(userID, kind string) {
+		if mentioned[userID] {
+			return
+		}
+		mentioned[userID] = true
+		mentions = append(mentions, models.Mention{
+			UserID:         userID,
+			CacheID:        msg.CacheID,
+			Channel:        msg.Channel,
+			AuthorID:       msg.OwnerID,
+			AuthorUsername: msg.Username,
+			Kind:           kind,
+		})
+	}
+
+	users, err := db.FindUsersByUsernames(h.db, usernames)
+	if err != nil {
+		log.Printf("Failed to resolve mentions: %v", err)
+	}
+	for _, user := range users {
+		add(user.ID, models.MentionUser)
+	}
+
+	if here || channel {
+		for userID, conns := range h.connectedUsers() {
+			// Users only on the dashboard are not in the chat
+			online := false
+			for _, client := range conns {
+				online = online || tracksPresence(client.GetClientID())
+			}
+			if !online {
+				continue
+			}
+			if here {
+				add(userID, models.MentionHere)
+			} else {
+				add(userID, models.MentionChannel)
+			}
+		}
+	}
+	if channel {
+		audience, err := db.FetchChannelAudience(h.db, msg.Channel)
+		if err != nil {
+			log.Printf("Failed to fetch audience of %s: %v", msg.Channel, err)
+		}
+		for _, userID := range audience {
+			add(userID, models.MentionChannel)
+		}
+	}
+
+	if len(mentions) == 0 {
+		return
+	}
+
+	saved, err := db.SaveMentions(h.db, mentions)
+	if err != nil {
+		log.Printf("Failed to save mentions: %v", err)
+		return
+	}
+
+	for _, mention := range saved {
+		h.deliverTo(chat.NewMentionMessage(mention, msg), mention.UserID)
+	}
+	log.Printf("Message %d mentioned %d users", msg.CacheID, len(saved))
+}
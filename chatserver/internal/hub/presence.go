@@ -0,0 +1,200 @@
+package hub
+
+import (
+	"log"
+	"time"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// idleTimeout is how long all of a user's connections must be inactive before an online
+// user is reported as idle.
+const idleTimeout = 5 * time.Minute
+
+// presenceSweepInterval controls how often idle transitions and expired statuses are checked.
+const presenceSweepInterval = 10 * time.Second
+
+// maxStatusTextLength caps the custom status text, in characters.
+const maxStatusTextLength = 128
+
+// presenceState tracks the presence of a user with at least one connection.
+type presenceState struct {
+	username  string
+	chosen    models.Presence // What the user asked for, persisted in Valkey
+	effective models.Presence // Last presence announced to the user's own connections
+}
+
+// publicPresence returns the presence other users see. Invisible users appear offline.
+func publicPresence(presence models.Presence) models.Presence {
+	if presence.State == models.PresenceInvisible {
+		return models.Presence{State: models.PresenceOffline}
+	}
+	return presence
+}
+
+// samePresence reports whether two presences would be announced identically.
+func samePresence(a, b models.Presence) bool {
+	if a.State != b.State || a.StatusText != b.StatusText {
+		return false
+	}
+	if a.StatusExpiresAt == nil || b.StatusExpiresAt == nil {
+		return a.StatusExpiresAt == b.StatusExpiresAt
+	}
+	return a.StatusExpiresAt.Equal(*b.StatusExpiresAt)
+}
+
+// tracksPresence reports whether a connection counts towards its user's presence.
+// Dashboard connections do not.
+func tracksPresence(clientID string) bool {
+	return clientID != "WebClient"
+}
+
+// presenceFor returns the tracked state for userID, loading the presence they last chose
+// from Valkey the first time they are seen. The caller must hold presenceMu.
+func (h *Hub) presenceFor(userID, username string) *presenceState {
+	if state, ok := h.presence[userID]; ok {
+		return state
+	}
+
+	chosen, ok, err := h.MessageCache.GetPresence(userID)
+	if err != nil {
+		log.Printf("Failed to load presence for %s: %v", username, err)
+	}
+	if !ok || !models.ValidPresenceState(chosen.State) {
+		chosen = models.Presence{State: models.PresenceOnline}
+	}
+
+	state := &presenceState{
+		username:  username,
+		chosen:    chosen,
+		effective: models.Presence{State: models.PresenceOffline},
+	}
+	h.presence[userID] = state
+	return state
+}
+
+// aggregatePresence combines the chosen presence with activity across all of userID's
+// connections: no connections means offline, and an online user whose connections have
+// all been inactive for idleTimeout is idle.
+func (h *Hub) aggregatePresence(userID string, chosen models.Presence) models.Presence {
+	connected := false
+	var lastActive time.Time
+	for _, client := range h.connectionsOf(userID) {
+		if !tracksPresence(client.GetClientID()) {
+			continue
+		}
+		connected = true
+		if active := client.GetLastActive(); active.After(lastActive) {
+			lastActive = active
+		}
+	}
+
+	if !connected {
+		return models.Presence{State: models.PresenceOffline}
+	}
+	if chosen.State == models.PresenceOnline && time.Since(lastActive) > idleTimeout {
+		chosen.State = models.PresenceIdle
+	}
+	return chosen
+}
+
+// refreshPresence recomputes userID's presence and announces it if it changed. The user's
+// own connections receive their real presence; everyone else receives the public one.
+// The caller must hold presenceMu.
+func (h *Hub) refreshPresence(state *presenceState, userID string) {
+	if state.chosen.StatusExpired(time.Now()) {
+		state.chosen.StatusText = ""
+		state.chosen.StatusExpiresAt = nil
+		if err := h.MessageCache.SavePresence(userID, state.chosen); err != nil {
+			log.Printf("Failed to clear expired status for %s: %v", state.username, err)
+		}
+	}
+
+	previous := state.effective
+	current := h.aggregatePresence(userID, state.chosen)
+	if samePresence(previous, current) {
+		return
+	}
+	state.effective = current
+
+	public := publicPresence(current)
+	publicChanged := !samePresence(publicPresence(previous), public)
+
+	own := chat.NewUserStatusMessage(state.username, userID, current)
+	others := chat.NewUserStatusMessage(state.username, userID, public)
+	for _, client := range h.connections() {
+		if client.GetID() == userID {
+			client.SendMessage(own)
+		} else if publicChanged {
+			client.SendMessage(others)
+		}
+	}
+	log.Printf("Presence of %s is now %s", state.username, current.State)
+
+	// Nothing left to track once the user has gone
+	if current.State == models.PresenceOffline {
+		delete(h.presence, userID)
+	}
+}
+
+// updatePresence recomputes a user's presence after one of their connections came or went.
+func (h *Hub) updatePresence(userID, username string) {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	h.refreshPresence(h.presenceFor(userID, username), userID)
+}
+
+// setPresence applies a set_presence request and persists the choice.
+func (h *Hub) setPresence(payload chat.SetPresencePayload) {
+	presence := payload.Presence
+	if !models.ValidPresenceState(presence.State) {
+		log.Printf("Ignoring invalid presence %q from %s", presence.State, payload.Username)
+		return
+	}
+	if utf8.RuneCountInString(presence.StatusText) > maxStatusTextLength {
+		log.Printf("Ignoring status text from %s longer than %d characters", payload.Username, maxStatusTextLength)
+		return
+	}
+	if presence.StatusText == "" {
+		presence.StatusExpiresAt = nil
+	}
+
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	state, ok := h.presence[payload.UserID]
+	if !ok {
+		// Only connected users can change their presence
+		return
+	}
+	state.chosen = presence
+	if err := h.MessageCache.SavePresence(payload.UserID, presence); err != nil {
+		log.Printf("Failed to save presence for %s: %v", payload.Username, err)
+	}
+	h.refreshPresence(state, payload.UserID)
+}
+
+// sweepPresence moves users between online and idle and clears expired statuses.
+func (h *Hub) sweepPresence() {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	for userID, state := range h.presence {
+		h.refreshPresence(state, userID)
+	}
+}
+
+// publicPresenceOf returns the presence other users currently see for userID.
+func (h *Hub) publicPresenceOf(userID string) models.Presence {
+	h.presenceMu.Lock()
+	defer h.presenceMu.Unlock()
+
+	state, ok := h.presence[userID]
+	if !ok {
+		return models.Presence{State: models.PresenceOffline}
+	}
+	return publicPresence(state.effective)
+}
@@ -0,0 +1,200 @@
+package hub
+
+import (
+	"errors"
+	"log"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// maxEmojiLength caps a reaction's size in bytes, enough for long emoji sequences and
+// custom :shortcodes:.
+const maxEmojiLength = 64
+
+// reactionThrottle is the minimum gap between reaction changes by the same user.
+const reactionThrottle = 250 * time.Millisecond
+
+// shortcodePattern matches custom emoji names such as :party_parrot:.
+var shortcodePattern = regexp.MustCompile(`^:[a-z0-9_+-]{1,32}:$`)
+
+// validEmoji reports whether emoji can be stored as a reaction: an emoji sequence or a
+// :shortcode: name.
+func validEmoji(emoji string) bool {
+	if emoji == "" || len(emoji) > maxEmojiLength {
+		return false
+	}
+	return shortcodePattern.MatchString(emoji) || isEmojiSequence(emoji)
+}
+
+// isEmojiSequence reports whether s is a keycap such as 1️⃣, or starts with a pictographic
+// symbol and otherwise only holds symbols and the joiners, variation selectors, skin tone
+// modifiers and tags that emoji sequences are built from.
+func isEmojiSequence(s string) bool {
+	runes := []rune(s)
+	if strings.ContainsRune("0123456789#*", runes[0]) {
+		rest := runes[1:]
+		if len(rest) > 0 && rest[0] == '\uFE0F' {
+			rest = rest[1:]
+		}
+		return len(rest) == 1 && rest[0] == '\u20E3'
+	}
+	if !unicode.Is(unicode.So, runes[0]) {
+		return false
+	}
+
+	for _, r := range runes[1:] {
+		switch {
+		case unicode.Is(unicode.So, r):
+		case r == '\u200D', r == '\uFE0E', r == '\uFE0F':
+		case r >= 0x1F3FB && r <= 0x1F3FF: // Skin tone modifiers
+		case r >= 0xE0020 && r <= 0xE007F: // Tags, used by subdivision flags
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// handleReaction adds or removes a reaction and, if that changed anything, announces the
+// message's new reaction counts with reaction_updated. Public message updates go to every
+// client; private message updates only go to the two participants. Changes arriving faster
+// than reactionThrottle are dropped.
+func (h *Hub) handleReaction(messageType string, reaction models.Reaction) {
+	if reaction.Target == "" {
+		reaction.Target = models.ReactionTargetChat
+	}
+	if reaction.Target != models.ReactionTargetChat && reaction.Target != models.ReactionTargetPrivate {
+		log.Printf("Ignoring reaction from %s to unknown target %q", reaction.UserID, reaction.Target)
+		return
+	}
+	if !validEmoji(reaction.Emoji) {
+		log.Printf("Ignoring invalid reaction from %s", reaction.UserID)
+		return
+	}
+	if !h.allow(h.lastReaction, reaction.UserID, reactionThrottle) {
+		return
+	}
+
+	// Stored messages may be addressed by their database ID
+	if reaction.CacheID <= 0 && reaction.MessageID > 0 {
+		cacheID, ok, err := db.FindCacheIDByMessageID(h.db, reaction.Target, reaction.MessageID)
+		if err != nil {
+			log.Printf("Failed to resolve reaction target: %v", err)
+			return
+		}
+		if ok {
+			reaction.CacheID = cacheID
+		}
+	}
+	if reaction.CacheID <= 0 {
+		log.Printf("Ignoring reaction from %s without a message", reaction.UserID)
+		return
+	}
+
+	update := chat.ReactionUpdatedPayload{
+		Target:  reaction.Target,
+		CacheID: reaction.CacheID,
+		UserID:  reaction.UserID,
+		Emoji:   reaction.Emoji,
+		Added:   messageType == chat.AddReactionMessageType,
+	}
+
+	// Make sure the message exists and, for private messages, that the user took part in it
+	var participants []string
+	if reaction.Target == models.ReactionTargetPrivate {
+		msg, ok := h.findPrivateMessage(reaction.CacheID)
+		if !ok || (msg.OwnerID != reaction.UserID && msg.RecipientID != reaction.UserID) {
+			log.Printf("Ignoring reaction from %s to private message %d", reaction.UserID, reaction.CacheID)
+			return
+		}
+		participants = []string{msg.OwnerID, msg.RecipientID}
+	} else {
+		msg, ok := h.findChatMessage(reaction.CacheID)
+		if !ok {
+			log.Printf("Ignoring reaction from %s to unknown message %d", reaction.UserID, reaction.CacheID)
+			return
+		}
+		update.Channel = msg.Channel
+	}
+
+	var changed bool
+	var err error
+	if update.Added {
+		changed, err = db.AddReaction(h.db, reaction)
+	} else {
+		changed, err = db.RemoveReaction(h.db, reaction)
+	}
+	if errors.Is(err, db.ErrReactionLimitReached) {
+		log.Printf("Ignoring reaction from %s to message %d over the reaction limit", reaction.UserID, reaction.CacheID)
+		return
+	}
+	if err != nil {
+		log.Printf("Failed to update reaction: %v", err)
+		return
+	}
+	if !changed {
+		return
+	}
+
+	counts, err := db.FetchReactionCounts(h.db, reaction.Target, []int{reaction.CacheID})
+	if err != nil {
+		log.Printf("Failed to count reactions: %v", err)
+		return
+	}
+	update.Reactions = counts[reaction.CacheID]
+	if update.Reactions == nil {
+		update.Reactions = []models.ReactionCount{}
+	}
+
+	msg := chat.NewReactionUpdatedMessage(update)
+	if participants != nil {
+		h.deliverTo(msg, participants...)
+	} else {
+		h.Broadcast(msg)
+	}
+}
+
+// findChatMessage looks a public message up by cacheID, first among the messages waiting
+// to be flushed and then in the database. Flushed messages are removed from the queue only
+// after they are committed, so a message is always found in one or the other.
+func (h *Hub) findChatMessage(cacheID int) (models.ChatMessage, bool) {
+	for _, msg := range h.MessageCache.GetUnflushedChatMessages() {
+		if msg.CacheID == cacheID {
+			return msg, true
+		}
+	}
+
+	msg, ok, err := db.FindChatMessageByCacheID(h.db, cacheID)
+	if err != nil {
+		log.Printf("Failed to find message %d: %v", cacheID, err)
+	}
+	return msg, ok
+}
+
+// findPrivateMessage looks a private message up by cacheID, like findChatMessage.
+func (h *Hub) findPrivateMessage(cacheID int) (models.PrivateChatMessage, bool) {
+	for _, msg := range h.MessageCache.GetUnflushedPrivateMessages() {
+		if msg.CacheID == cacheID {
+			return msg, true
+		}
+	}
+
+	msg, ok, err := db.FindPrivateMessageByCacheID(h.db, cacheID)
+	if err != nil {
+		log.Printf("Failed to find private message %d: %v", cacheID, err)
+	}
+	return msg, ok
+}
+
+// attachChatReactions fills in reaction counts on messages read from the cache.
+func (h *Hub) attachChatReactions(msgs []models.ChatMessage) {
+	if err := db.AttachChatReactions(h.db, msgs); err != nil {
+		log.Printf("Failed to attach reactions: %v", err)
+	}
+}
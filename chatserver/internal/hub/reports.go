@@ -0,0 +1,102 @@
+package hub
+
+import (
+	"encoding/json"
+	"fmt"
+	"slices"
+	"strings"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// maxReportDetailsLength caps the free text a reporter can add, in characters.
+const maxReportDetailsLength = 1000
+
+// FileReport validates a user's report and stores it with a snapshot of the reported
+// message, so the evidence survives the message being deleted. Private messages can only
+// be reported by their participants. If the reporter already has an unresolved report
+// about the same message or user, that one is returned and created is false.
+func (h *Hub) FileReport(report models.Report) (models.Report, bool, error) {
+	if !slices.Contains(models.ReportReasons, report.Reason) {
+		return report, false, fmt.Errorf("%w: unknown reason %q", models.ErrInvalidReport, report.Reason)
+	}
+	report.Details = strings.TrimSpace(report.Details)
+	if utf8.RuneCountInString(report.Details) > maxReportDetailsLength {
+		return report, false, fmt.Errorf("%w: details are too long", models.ErrInvalidReport)
+	}
+
+	switch report.Kind {
+	case models.ReportMessage:
+		if err := h.snapshotReportedMessage(&report); err != nil {
+			return report, false, err
+		}
+	case models.ReportUser:
+		report.Target, report.CacheID, report.Channel, report.Snapshot = "", 0, "", nil
+		username, ok := h.LookupUsername(report.ReportedUserID)
+		if report.ReportedUserID == "" || !ok {
+			return report, false, models.ErrReportTargetNotFound
+		}
+		report.ReportedUsername = username
+	default:
+		return report, false, fmt.Errorf("%w: unknown kind %q", models.ErrInvalidReport, report.Kind)
+	}
+
+	if report.ReportedUserID == report.ReporterID {
+		return report, false, fmt.Errorf("%w: you cannot report yourself", models.ErrInvalidReport)
+	}
+
+	return db.SaveReport(h.db, report)
+}
+
+// snapshotReportedMessage finds the message a report is about and copies it, along with
+// its author, into the report.
+func (h *Hub) snapshotReportedMessage(report *models.Report) error {
+	if report.Target == "" {
+		report.Target = models.ReactionTargetChat
+	}
+	if report.Target != models.ReactionTargetChat && report.Target != models.ReactionTargetPrivate {
+		return fmt.Errorf("%w: unknown target %q", models.ErrInvalidReport, report.Target)
+	}
+
+	// Stored messages may be addressed by their database ID
+	if report.CacheID <= 0 && report.MessageID > 0 {
+		cacheID, ok, err := db.FindCacheIDByMessageID(h.db, report.Target, report.MessageID)
+		if err != nil {
+			return err
+		}
+		if ok {
+			report.CacheID = cacheID
+		}
+	}
+	if report.CacheID <= 0 {
+		return models.ErrReportTargetNotFound
+	}
+
+	var snapshot any
+	if report.Target == models.ReactionTargetPrivate {
+		msg, ok := h.findPrivateMessage(report.CacheID)
+		if !ok || (msg.OwnerID != report.ReporterID && msg.RecipientID != report.ReporterID) {
+			return models.ErrReportTargetNotFound
+		}
+		report.Channel = ""
+		report.ReportedUserID, report.ReportedUsername = msg.OwnerID, msg.Username
+		snapshot = msg
+	} else {
+		msg, ok := h.findChatMessage(report.CacheID)
+		if !ok {
+			return models.ErrReportTargetNotFound
+		}
+		report.Channel = msg.Channel
+		report.ReportedUserID, report.ReportedUsername = msg.OwnerID, msg.Username
+		snapshot = msg
+	}
+
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return fmt.Errorf("failed to snapshot message %d: %w", report.CacheID, err)
+	}
+	report.Snapshot = data
+	return nil
+}
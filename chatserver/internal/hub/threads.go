@@ -0,0 +1,216 @@
+package hub
+
+import (
+	"log"
+	"slices"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/interfaces"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+)
+
+// resolveReply points a reply at its thread parent's cacheID and channel. Replies to a
+// reply join the parent's thread, since threads are one level deep.
+// It returns the parent, or false if it does not exist.
+func (h *Hub) resolveReply(reply *models.ChatMessage) (models.ChatMessage, bool) {
+	if reply.ReplyTo <= 0 && reply.ReplyToID > 0 {
+		cacheID, ok, err := db.FindCacheIDByMessageID(h.db, models.ReactionTargetChat, reply.ReplyToID)
+		if err != nil {
+			log.Printf("Failed to resolve reply parent %d: %v", reply.ReplyToID, err)
+		}
+		if !ok {
+			return models.ChatMessage{}, false
+		}
+		reply.ReplyTo = cacheID
+	}
+
+	parent, ok := h.findChatMessage(reply.ReplyTo)
+	if !ok {
+		return parent, false
+	}
+	if parent.ReplyTo > 0 {
+		if parent, ok = h.findChatMessage(parent.ReplyTo); !ok {
+			return parent, false
+		}
+	}
+
+	reply.ReplyTo = parent.CacheID
+	reply.ReplyToID = parent.ID
+	reply.Channel = parent.Channel
+	return parent, true
+}
+
+// deliverReply sends a new reply to the connections following its thread, which are those
+// that opened it plus every connection of the parent's and the reply's authors. Everyone
+// else receives thread_updated so they can refresh the parent's reply count.
+func (h *Hub) deliverReply(reply models.ChatMessage, parent models.ChatMessage) {
+	msg := chat.NewThreadReplyMessage(reply)
+
+	h.threadMu.Lock()
+	recipients := make(map[string]interfaces.ClientInterface)
+	for connID, client := range h.threadSubs[parent.CacheID] {
+		recipients[connID] = client
+	}
+	h.threadMu.Unlock()
+
+	for _, userID := range []string{parent.OwnerID, reply.OwnerID} {
+		for _, client := range h.connectionsOf(userID) {
+			recipients[client.GetConnectionID()] = client
+		}
+	}
+	for _, client := range recipients {
+		client.SendMessage(msg)
+	}
+
+	summary := h.threadSummaries([]int{parent.CacheID})[parent.CacheID]
+	h.Broadcast(chat.NewThreadUpdatedMessage(chat.ThreadUpdatedPayload{
+		Channel:     parent.Channel,
+		CacheID:     parent.CacheID,
+		ReplyCount:  summary.ReplyCount,
+		LastReplyAt: summary.LastReplyAt,
+	}))
+}
+
+// threadSummaries counts the replies to each parent, combining stored replies with those
+// still waiting to be flushed.
+func (h *Hub) threadSummaries(cacheIDs []int) map[int]db.ThreadSummary {
+	summaries, err := db.FetchThreadSummaries(h.db, cacheIDs)
+	if err != nil {
+		log.Printf("Failed to fetch thread summaries: %v", err)
+		summaries = make(map[int]db.ThreadSummary)
+	}
+
+	for _, msg := range h.MessageCache.GetUnflushedChatMessages() {
+		if msg.ReplyTo == 0 || !slices.Contains(cacheIDs, msg.ReplyTo) {
+			continue
+		}
+		summary := summaries[msg.ReplyTo]
+		summary.ReplyCount++
+		if msg.Sent.After(summary.LastReplyAt) {
+			summary.LastReplyAt = msg.Sent
+		}
+		summaries[msg.ReplyTo] = summary
+	}
+
+	return summaries
+}
+
+// attachThreads fills in the reply metadata of the thread parents among msgs.
+func (h *Hub) attachThreads(msgs []models.ChatMessage) {
+	var cacheIDs []int
+	for _, msg := range msgs {
+		if msg.ReplyTo == 0 {
+			cacheIDs = append(cacheIDs, msg.CacheID)
+		}
+	}
+
+	summaries := h.threadSummaries(cacheIDs)
+	for i := range msgs {
+		if summary, ok := summaries[msgs[i].CacheID]; ok {
+			msgs[i].ReplyCount = summary.ReplyCount
+			msgs[i].LastReplyAt = &summary.LastReplyAt
+		}
+	}
+}
+
+// OpenThread subscribes a connection to a thread's replies and returns the thread parent
+// with up to limit replies older than beforeCacheID, oldest first. Opening a reply opens
+// the thread it belongs to. Replies still waiting to be flushed are read from the cache
+// and the rest from the database.
+// It returns:
+//  1. The thread parent
+//  2. The page of replies
+//  3. A boolean indicating whether older replies exist beyond this page
+//  4. A boolean indicating whether the thread exists
+func (h *Hub) OpenThread(client interfaces.ClientInterface, cacheID, beforeCacheID, limit int) (models.ChatMessage, []models.ChatMessage, bool, bool) {
+	if limit <= 0 || limit > maxHistoryPageSize {
+		limit = maxHistoryPageSize
+	}
+
+	parent, ok := h.findChatMessage(cacheID)
+	if ok && parent.ReplyTo > 0 {
+		parent, ok = h.findChatMessage(parent.ReplyTo)
+	}
+	if !ok {
+		return parent, nil, false, false
+	}
+	parentCacheID := parent.CacheID
+
+	h.threadMu.Lock()
+	subs, ok := h.threadSubs[parentCacheID]
+	if !ok {
+		subs = make(map[string]interfaces.ClientInterface)
+		h.threadSubs[parentCacheID] = subs
+	}
+	subs[client.GetConnectionID()] = client
+	h.threadMu.Unlock()
+
+	// Unflushed replies are always newer than stored ones
+	var cached []models.ChatMessage
+	for _, msg := range h.MessageCache.GetUnflushedChatMessages() {
+		if msg.ReplyTo == parentCacheID && (beforeCacheID <= 0 || msg.CacheID < beforeCacheID) {
+			cached = append(cached, msg)
+		}
+	}
+	h.attachChatReactions(cached)
+
+	var replies []models.ChatMessage
+	hasMore := false
+	if len(cached) > limit {
+		replies, hasMore = cached[len(cached)-limit:], true
+	} else {
+		if len(cached) > 0 {
+			beforeCacheID = cached[0].CacheID
+		}
+
+		filter := db.MessageFilter{ReplyTo: parentCacheID, BeforeCacheID: beforeCacheID, ByCacheID: true}
+		stored, info, err := db.FetchMessages(h.db, filter, db.PageRequest{Limit: limit - len(cached)})
+		if err != nil {
+			log.Printf("Failed to fetch replies to %d from database: %v", parentCacheID, err)
+		}
+
+		// The database returns newest first; thread pages are oldest first
+		replies = make([]models.ChatMessage, 0, len(stored)+len(cached))
+		for i := len(stored) - 1; i >= 0; i-- {
+			replies = append(replies, stored[i])
+		}
+		replies = append(replies, cached...)
+		hasMore = info.HasMore
+	}
+
+	parents := []models.ChatMessage{parent}
+	h.attachChatReactions(parents)
+	h.attachThreads(parents)
+	h.attachThreads(replies)
+	h.attachEmbeds(parents)
+	h.attachEmbeds(replies)
+
+	return parents[0], replies, hasMore, true
+}
+
+// CloseThread stops delivering a thread's replies to a connection.
+func (h *Hub) CloseThread(client interfaces.ClientInterface, parentCacheID int) {
+	h.threadMu.Lock()
+	defer h.threadMu.Unlock()
+
+	if subs, ok := h.threadSubs[parentCacheID]; ok {
+		delete(subs, client.GetConnectionID())
+		if len(subs) == 0 {
+			delete(h.threadSubs, parentCacheID)
+		}
+	}
+}
+
+// closeThreads drops every thread subscription held by a connection.
+func (h *Hub) closeThreads(client interfaces.ClientInterface) {
+	h.threadMu.Lock()
+	defer h.threadMu.Unlock()
+
+	for parentCacheID, subs := range h.threadSubs {
+		delete(subs, client.GetConnectionID())
+		if len(subs) == 0 {
+			delete(h.threadSubs, parentCacheID)
+		}
+	}
+}
@@ -0,0 +1,150 @@
+package hub
+
+import (
+	"log"
+	"time"
+
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/chat"
+)
+
+// typingTTL is how long a typing indicator stays active without being refreshed.
+const typingTTL = 6 * time.Second
+
+// typingThrottle is the minimum gap between a user's typing_start broadcasts, whatever their target.
+const typingThrottle = 1 * time.Second
+
+// typingSweepInterval controls how often expired typing indicators are cleared.
+const typingSweepInterval = 1 * time.Second
+
+// typingState tracks a single user's typing indicator in one channel or conversation.
+type typingState struct {
+	payload   chat.TypingPayload
+	active    bool
+	expiresAt time.Time
+	lastSent  time.Time
+}
+
+// typingKey identifies a user's indicator within a channel or private conversation.
+func typingKey(payload chat.TypingPayload) string {
+	if payload.PeerID != "" {
+		return payload.UserID + "|@" + payload.PeerID
+	}
+	return payload.UserID + "|#" + payload.Channel
+}
+
+// handleTyping applies a typing_start or typing_stop update. Starts refresh the expiry of an
+// active indicator without another broadcast, and a user's new indicators arriving faster
+// than typingThrottle are dropped so they cannot be used to flood other clients. Indicators
+// for channels that don't exist are ignored.
+func (h *Hub) handleTyping(messageType string, payload chat.TypingPayload) {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	if payload.Channel == "" && payload.PeerID == "" {
+		return
+	}
+	if payload.PeerID != "" {
+		payload.Channel = ""
+	}
+
+	now := time.Now()
+	key := typingKey(payload)
+	state, ok := h.typing[key]
+
+	switch messageType {
+	case chat.TypingStartMessageType:
+		if ok && state.active {
+			state.expiresAt = now.Add(typingTTL)
+			return
+		}
+		if now.Sub(h.typingSent[payload.UserID]) < typingThrottle {
+			return
+		}
+		if !ok {
+			if payload.Channel != "" && !h.channelExists(payload.Channel) {
+				return
+			}
+			state = &typingState{payload: payload}
+			h.typing[key] = state
+		}
+		state.active = true
+		state.expiresAt = now.Add(typingTTL)
+		h.typingSent[payload.UserID] = now
+
+	case chat.TypingStopMessageType:
+		if !ok || !state.active {
+			return
+		}
+		state.active = false
+
+	default:
+		return
+	}
+
+	state.lastSent = now
+	h.sendTyping(messageType, state.payload)
+}
+
+// channelExists reports whether a channel exists, treating lookup failures as a no.
+func (h *Hub) channelExists(channel string) bool {
+	exists, err := db.ChannelExists(h.db, channel)
+	if err != nil {
+		log.Printf("Failed to look up channel %s: %v", channel, err)
+		return false
+	}
+	return exists
+}
+
+// expireTyping stops indicators that were not refreshed in time and forgets idle entries.
+func (h *Hub) expireTyping() {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	now := time.Now()
+	for key, state := range h.typing {
+		if state.active && now.After(state.expiresAt) {
+			state.active = false
+			state.lastSent = now
+			h.sendTyping(chat.TypingStopMessageType, state.payload)
+			continue
+		}
+		if !state.active && now.Sub(state.lastSent) > typingThrottle {
+			delete(h.typing, key)
+		}
+	}
+	for userID, sent := range h.typingSent {
+		if now.Sub(sent) > typingThrottle {
+			delete(h.typingSent, userID)
+		}
+	}
+}
+
+// clearTyping stops every active indicator belonging to userID, e.g. when they disconnect.
+func (h *Hub) clearTyping(userID string) {
+	h.typingMu.Lock()
+	defer h.typingMu.Unlock()
+
+	for key, state := range h.typing {
+		if state.payload.UserID != userID {
+			continue
+		}
+		if state.active {
+			h.sendTyping(chat.TypingStopMessageType, state.payload)
+		}
+		delete(h.typing, key)
+	}
+	delete(h.typingSent, userID)
+}
+
+// sendTyping fans a typing update out to the channel's audience, or to the peer through
+// the whisper path for private conversations. Indicators never touch the message cache.
+func (h *Hub) sendTyping(messageType string, payload chat.TypingPayload) {
+	msg := chat.NewTypingMessage(messageType, payload.UserID, payload.Username, payload.Channel, payload.PeerID)
+	if payload.PeerID != "" {
+		h.Whisper(msg)
+		return
+	}
+	log.Printf("%s %s in %s", payload.Username, messageType, payload.Channel)
+	h.Broadcast(msg)
+}
@@ -21,6 +21,10 @@ type ClientInterface interface {
 	// GetID returns the stable user ID (e.g., from Keycloak).
 	GetID() string
 
+	// GetConnectionID returns the ID unique to this connection. A user may hold several
+	// connections at once, even from the same client application.
+	GetConnectionID() string
+
 	// GetClientID returns the OAuth client ID used to identify the source application,
 	// such as "ChatClient" or "WebClient".
 	GetClientID() string
@@ -30,4 +34,10 @@ type ClientInterface interface {
 
 	// GetConnectedAt returns the timestamp when the client connected.
 	GetConnectedAt() time.Time
+
+	// GetLastActive returns when the client last sent a message, used for idle detection.
+	GetLastActive() time.Time
+
+	// IsModerator reports whether the client's token carried the moderator realm role.
+	IsModerator() bool
 }
@@ -15,11 +15,11 @@ type HubInterface interface {
 	// Whisper sends a private message to a specific client.
 	Whisper(messages.BaseMessage)
 
-	// RegisterClient adds a client to the hub, associating it with a unique client ID.
-	RegisterClient(ClientInterface, string)
+	// RegisterClient adds a connection to the hub under its unique connection ID.
+	RegisterClient(ClientInterface)
 
-	// UnregisterClient removes a client from the hub using the provided client ID.
-	UnregisterClient(ClientInterface, string)
+	// UnregisterClient removes a connection from the hub, leaving the user's other connections in place.
+	UnregisterClient(ClientInterface)
 
 	// SendMessage sends a message into the hub’s internal message loop for processing.
 	SendMessage(messages.BaseMessage)
@@ -27,9 +27,41 @@ type HubInterface interface {
 	// GetConnectedUsers returns a list of users currently connected to the hub.
 	GetConnectedUsers() []chat.UserStatusPayload
 
-	// GetCachedChatMessages returns a list of recent chat messages from the cache.
-	GetCachedChatMessages() []models.ChatMessage
+	// GetCachedChatMessages returns up to limit recent chat messages for a channel from the cache.
+	GetCachedChatMessages(channel string, limit int) []models.ChatMessage
+
+	// GetChannelHistory returns a page of a channel's messages older than beforeCacheID,
+	// reading from the cache first and falling back to the database.
+	GetChannelHistory(channel string, beforeCacheID, limit int) ([]models.ChatMessage, bool)
+
+	// OpenThread subscribes a connection to the thread of the message with the given cacheID
+	// and returns the parent with a page of replies older than beforeCacheID, whether older
+	// replies exist and whether the thread exists. A reply opens its parent's thread.
+	OpenThread(client ClientInterface, cacheID, beforeCacheID, limit int) (models.ChatMessage, []models.ChatMessage, bool, bool)
+
+	// CloseThread stops delivering a thread's replies to a connection.
+	CloseThread(client ClientInterface, parentCacheID int)
+
+	// GetConversations returns the private conversations the given user has taken part in.
+	GetConversations(userID string) []models.Conversation
+
+	// GetPrivateHistory returns a page of private messages between a user and a peer,
+	// along with whether older messages exist and the cursor for the next page.
+	GetPrivateHistory(userID, peerID, cursor string, limit int) ([]models.PrivateChatMessage, bool, string)
+
+	// GetUnreadCounts returns a user's unread message counts keyed by channel name and by peer ID.
+	GetUnreadCounts(userID string) (map[string]int, map[string]int)
 
 	// FindUsernameByUserID returns the username associated with the given user ID, if any.
 	FindUsernameByUserID(userID string) (string, bool)
+
+	// FileReport validates and stores a user's report about a message or another user,
+	// returning the existing report instead if the reporter already filed one.
+	FileReport(report models.Report) (models.Report, bool, error)
+
+	// ReloadAutomod reloads the automod rules and mutes after they change in the database.
+	ReloadAutomod() error
+
+	// LookupUsername resolves a user ID to a username whether or not the user is connected.
+	LookupUsername(userID string) (string, bool)
 }
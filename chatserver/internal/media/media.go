@@ -0,0 +1,150 @@
+package media
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"mime"
+	"net/http"
+	"strings"
+
+	// Register the decoders used to read image sizes and make thumbnails
+	_ "image/gif"
+	_ "image/png"
+)
+
+const (
+	// ThumbnailSize bounds the width and height of generated thumbnails.
+	ThumbnailSize = 320
+
+	// maxDecodePixels caps the images that are decoded for thumbnails, guarding against
+	// small files that expand to huge bitmaps.
+	maxDecodePixels = 40_000_000
+)
+
+// allowedTypes lists the sniffed content types accepted for upload.
+var allowedTypes = map[string]bool{
+	"image/png":                true,
+	"image/jpeg":               true,
+	"image/gif":                true,
+	"image/webp":               true,
+	"image/bmp":                true,
+	"audio/mpeg":               true,
+	"audio/wave":               true,
+	"audio/ogg":                true,
+	"application/ogg":          true,
+	"video/mp4":                true,
+	"video/webm":               true,
+	"application/pdf":          true,
+	"application/zip":          true,
+	"application/x-gzip":       true,
+	"text/plain":               true,
+	"application/octet-stream": true, // Unrecognised binary files, always served as downloads
+}
+
+// Sniff determines a file's content type from its first bytes, ignoring whatever the
+// uploader claimed. It returns false for types that are not accepted, such as HTML.
+func Sniff(data []byte) (string, bool) {
+	contentType := http.DetectContentType(data)
+	mediaType, params, err := mime.ParseMediaType(contentType)
+	if err != nil || !allowedTypes[mediaType] {
+		return contentType, false
+	}
+	if charset := params["charset"]; charset != "" {
+		return mime.FormatMediaType(mediaType, map[string]string{"charset": charset}), true
+	}
+	return mediaType, true
+}
+
+// IsImage reports whether the content type is an image.
+func IsImage(contentType string) bool {
+	return strings.HasPrefix(contentType, "image/")
+}
+
+// Inline reports whether files of the content type may be displayed by the browser rather
+// than downloaded.
+func Inline(contentType string) bool {
+	return IsImage(contentType) || strings.HasPrefix(contentType, "audio/") || strings.HasPrefix(contentType, "video/")
+}
+
+// Dimensions returns the size of an image in a format the server can decode.
+func Dimensions(data []byte) (int, int, bool) {
+	config, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return 0, 0, false
+	}
+	return config.Width, config.Height, true
+}
+
+// Thumbnail decodes an image and returns a JPEG no larger than ThumbnailSize on either
+// side. Transparent areas are drawn on white.
+func Thumbnail(data []byte) ([]byte, error) {
+	width, height, ok := Dimensions(data)
+	if !ok {
+		return nil, fmt.Errorf("unsupported image format")
+	}
+	if width <= 0 || height <= 0 || width*height > maxDecodePixels {
+		return nil, fmt.Errorf("image is too large to thumbnail (%dx%d)", width, height)
+	}
+
+	src, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, fmt.Errorf("failed to decode image: %w", err)
+	}
+
+	thumbWidth, thumbHeight := fit(width, height, ThumbnailSize)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, scale(src, thumbWidth, thumbHeight), &jpeg.Options{Quality: 80}); err != nil {
+		return nil, fmt.Errorf("failed to encode thumbnail: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// fit scales width and height down to fit within a bound, keeping the aspect ratio.
+func fit(width, height, bound int) (int, int) {
+	if width <= bound && height <= bound {
+		return width, height
+	}
+	if width >= height {
+		return bound, max(1, height*bound/width)
+	}
+	return max(1, width*bound/height), bound
+}
+
+// scale resizes src by averaging the source pixels that fall in each destination pixel.
+func scale(src image.Image, width, height int) *image.RGBA {
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	bounds := src.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	for y := 0; y < height; y++ {
+		y0 := bounds.Min.Y + y*srcHeight/height
+		y1 := max(y0+1, bounds.Min.Y+(y+1)*srcHeight/height)
+
+		for x := 0; x < width; x++ {
+			x0 := bounds.Min.X + x*srcWidth/width
+			x1 := max(x0+1, bounds.Min.X+(x+1)*srcWidth/width)
+
+			var r, g, b, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					// Colours are alpha-premultiplied, so adding the missing alpha composites on white
+					cr, cg, cb, ca := src.At(sx, sy).RGBA()
+					r += uint64(cr + 0xffff - ca)
+					g += uint64(cg + 0xffff - ca)
+					b += uint64(cb + 0xffff - ca)
+					n++
+				}
+			}
+			dst.SetRGBA(x, y, color.RGBA{
+				R: uint8(r / n >> 8),
+				G: uint8(g / n >> 8),
+				B: uint8(b / n >> 8),
+				A: 0xff,
+			})
+		}
+	}
+	return dst
+}
@@ -0,0 +1,25 @@
+package api
+
+import (
+	"time"
+
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const AttachmentResultType = "attachment_result"
+
+type AttachmentResultPayload struct {
+	Attachment   models.Attachment `json:"attachment"`
+	URL          string            `json:"url"`                     // Signed download URL
+	ThumbnailURL string            `json:"thumbnail_url,omitempty"` // Signed thumbnail URL, set for images
+	ExpiresAt    time.Time         `json:"expires_at"`              // When the signed URLs stop working
+}
+
+func NewAttachmentResultMessage(payload AttachmentResultPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    AttachmentResultType,
+		Sender:  "server",
+		Payload: payload,
+	}
+}
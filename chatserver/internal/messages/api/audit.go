@@ -0,0 +1,28 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const AuditLogResultType = "audit_log_result"
+
+type AuditLogPayload struct {
+	Entries    []models.AuditEntry `json:"entries"`
+	HasMore    bool                `json:"has_more"`
+	NextCursor string              `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string              `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewAuditLogResultMessage(entries []models.AuditEntry, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   AuditLogResultType,
+		Sender: "server",
+		Payload: AuditLogPayload{
+			Entries:    entries,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	AutomodRulesResultType = "automod_rules_result"
+	AutomodFlagsResultType = "automod_flags_result"
+	AutomodMutesResultType = "automod_mutes_result"
+)
+
+type AutomodRulesPayload struct {
+	Rules []models.AutomodRule `json:"rules"`
+}
+
+func NewAutomodRulesResultMessage(rules []models.AutomodRule) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    AutomodRulesResultType,
+		Sender:  "server",
+		Payload: AutomodRulesPayload{Rules: rules},
+	}
+}
+
+type AutomodFlagsPayload struct {
+	Flags      []models.AutomodFlag `json:"flags"`
+	HasMore    bool                 `json:"has_more"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string               `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewAutomodFlagsResultMessage(flags []models.AutomodFlag, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   AutomodFlagsResultType,
+		Sender: "server",
+		Payload: AutomodFlagsPayload{
+			Flags:      flags,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
+
+type AutomodMutesPayload struct {
+	Mutes []models.AutomodMute `json:"mutes"`
+}
+
+func NewAutomodMutesResultMessage(mutes []models.AutomodMute) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    AutomodMutesResultType,
+		Sender:  "server",
+		Payload: AutomodMutesPayload{Mutes: mutes},
+	}
+}
@@ -1,26 +1,92 @@
 package api
 
 import (
+	"time"
+
 	"onrabble.com/chatserver/internal/messages"
 	"onrabble.com/chatserver/internal/models"
 )
 
 const (
-	BanRecordsResultType = "ban_records_result"
+	BanRecordsResultType  = "ban_records_result"
+	BanEvasionsResultType = "ban_evasions_result"
+	BannedType            = "banned"
+	AppealsResultType     = "appeals_result"
 )
 
 type BanRecordsPayload struct {
-	Records []models.BanRecord `json:"records"`
-	HasMore bool               `json:"has_more"`
+	Records    []models.BanRecord `json:"records"`
+	HasMore    bool               `json:"has_more"`
+	NextCursor string             `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string             `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
 }
 
-func NewBanRecordsResultMessage(records []models.BanRecord, hasMore bool) messages.BaseMessage {
+func NewBanRecordsResultMessage(records []models.BanRecord, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
 	return messages.BaseMessage{
 		Type:   BanRecordsResultType,
 		Sender: "server",
 		Payload: BanRecordsPayload{
-			Records: records,
-			HasMore: hasMore,
+			Records:    records,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
+
+type BanEvasionsPayload struct {
+	Evasions   []models.BanEvasion `json:"evasions"`
+	HasMore    bool                `json:"has_more"`
+	NextCursor string              `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string              `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewBanEvasionsResultMessage(evasions []models.BanEvasion, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   BanEvasionsResultType,
+		Sender: "server",
+		Payload: BanEvasionsPayload{
+			Evasions:   evasions,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
+
+// BannedPayload tells a refused client why it was banned and how to appeal.
+type BannedPayload struct {
+	BanID        string     `json:"ban_id"`
+	Reason       string     `json:"reason,omitempty"`
+	EndTime      *time.Time `json:"end_time,omitempty"`      // Absent for permanent bans
+	AppealURL    string     `json:"appeal_url,omitempty"`    // Absent when the ban is on another account's address or device
+	AppealStatus string     `json:"appeal_status,omitempty"` // Set once the ban has been appealed
+}
+
+func NewBannedMessage(payload BannedPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    BannedType,
+		Sender:  "server",
+		Payload: payload,
+	}
+}
+
+type AppealsPayload struct {
+	Appeals    []models.Appeal `json:"appeals"`
+	HasMore    bool            `json:"has_more"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string          `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewAppealsResultMessage(appeals []models.Appeal, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   AppealsResultType,
+		Sender: "server",
+		Payload: AppealsPayload{
+			Appeals:    appeals,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
 		},
 	}
 }
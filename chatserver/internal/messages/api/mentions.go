@@ -0,0 +1,24 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const MentionsResultType = "mentions_result"
+
+type MentionsResultPayload struct {
+	Mentions    []models.Mention `json:"mentions"`
+	UnreadCount int              `json:"unread_count"` // Unread mentions across the whole inbox
+	HasMore     bool             `json:"has_more"`
+	NextCursor  string           `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor  string           `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewMentionsResultMessage(payload MentionsResultPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    MentionsResultType,
+		Sender:  "server",
+		Payload: payload,
+	}
+}
@@ -5,11 +5,16 @@ import (
 	"onrabble.com/chatserver/internal/models"
 )
 
-const MessageSearchResultType = "message_search_result"
+const (
+	MessageSearchResultType        = "message_search_result"
+	PrivateMessageSearchResultType = "private_message_search_result"
+)
 
 type MessageSearchResultPayload struct {
-	Messages []models.ChatMessage `json:"messages"`
-	HasMore  bool                 `json:"has_more"`
+	Messages   []models.ChatMessage `json:"messages"`
+	HasMore    bool                 `json:"has_more"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string               `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
 }
 
 func NewMessageSearchResultMessage(payload MessageSearchResultPayload) messages.BaseMessage {
@@ -19,3 +24,37 @@ func NewMessageSearchResultMessage(payload MessageSearchResultPayload) messages.
 		Payload: payload, // Should be a single struct, not a slice
 	}
 }
+
+type PrivateMessageSearchResultPayload struct {
+	Messages   []models.PrivateChatMessage `json:"messages"`
+	HasMore    bool                        `json:"has_more"`
+	NextCursor string                      `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string                      `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewPrivateMessageSearchResultMessage(payload PrivateMessageSearchResultPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    PrivateMessageSearchResultType,
+		Sender:  "server",
+		Payload: payload,
+	}
+}
+
+const ThreadResultType = "thread_result"
+
+// ThreadResultPayload carries a thread parent and a page of its replies, newest first.
+type ThreadResultPayload struct {
+	Parent     models.ChatMessage   `json:"parent"`
+	Replies    []models.ChatMessage `json:"replies"`
+	HasMore    bool                 `json:"has_more"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string               `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewThreadResultMessage(payload ThreadResultPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ThreadResultType,
+		Sender:  "server",
+		Payload: payload,
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const ReportsResultType = "reports_result"
+
+type ReportsPayload struct {
+	Reports    []models.Report `json:"reports"`
+	HasMore    bool            `json:"has_more"`
+	NextCursor string          `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string          `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewReportsResultMessage(reports []models.Report, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   ReportsResultType,
+		Sender: "server",
+		Payload: ReportsPayload{
+			Reports:    reports,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
@@ -0,0 +1,35 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	RetentionPoliciesResultType = "retention_policies_result"
+	LegalHoldsResultType        = "legal_holds_result"
+)
+
+type RetentionPoliciesPayload struct {
+	Policies []models.RetentionPolicy `json:"policies"`
+}
+
+func NewRetentionPoliciesResultMessage(policies []models.RetentionPolicy) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    RetentionPoliciesResultType,
+		Sender:  "server",
+		Payload: RetentionPoliciesPayload{Policies: policies},
+	}
+}
+
+type LegalHoldsPayload struct {
+	Holds []models.LegalHold `json:"holds"`
+}
+
+func NewLegalHoldsResultMessage(holds []models.LegalHold) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    LegalHoldsResultType,
+		Sender:  "server",
+		Payload: LegalHoldsPayload{Holds: holds},
+	}
+}
@@ -0,0 +1,28 @@
+package api
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const DataRequestsResultType = "data_requests_result"
+
+type DataRequestsPayload struct {
+	Requests   []models.DataRequest `json:"requests"`
+	HasMore    bool                 `json:"has_more"`
+	NextCursor string               `json:"next_cursor,omitempty"` // Token for the next (older) page
+	PrevCursor string               `json:"prev_cursor,omitempty"` // Token for the previous (newer) page
+}
+
+func NewDataRequestsResultMessage(requests []models.DataRequest, hasMore bool, nextCursor, prevCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   DataRequestsResultType,
+		Sender: "server",
+		Payload: DataRequestsPayload{
+			Requests:   requests,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+			PrevCursor: prevCursor,
+		},
+	}
+}
@@ -8,7 +8,10 @@ import (
 const UserSearchResultType = "user_search_result"
 
 type UserSearchResultPayload struct {
-	Users []models.User `json:"users"`
+	Users      []models.User `json:"users"`
+	HasMore    bool          `json:"has_more"`
+	NextCursor string        `json:"next_cursor,omitempty"`
+	PrevCursor string        `json:"prev_cursor,omitempty"`
 }
 
 func NewUserSearchResultMessage(payload UserSearchResultPayload) messages.BaseMessage {
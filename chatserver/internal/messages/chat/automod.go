@@ -0,0 +1,26 @@
+package chat
+
+import (
+	"time"
+
+	"onrabble.com/chatserver/internal/messages"
+)
+
+const MessageRejectedMessageType = "message_rejected"
+
+// MessageRejectedPayload tells a sender that automod refused their message.
+type MessageRejectedPayload struct {
+	Channel     string     `json:"channel,omitempty"`      // Set for channel messages
+	RecipientID string     `json:"recipient_id,omitempty"` // Set for private messages
+	Reason      string     `json:"reason"`
+	MutedUntil  *time.Time `json:"muted_until,omitempty"` // Set while the sender is muted
+}
+
+// NewMessageRejectedMessage builds the notice sent to the connections of a rejected message's sender.
+func NewMessageRejectedMessage(payload MessageRejectedPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    MessageRejectedMessageType,
+		Sender:  "Server",
+		Payload: payload,
+	}
+}
@@ -0,0 +1,33 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	BanEndedMessageType = "ban_ended"
+)
+
+// BanEndedPayload announces that a ban ran out or was pardoned.
+type BanEndedPayload struct {
+	BanID    string `json:"ban_id"`
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Pardoned bool   `json:"pardoned"` // Lifted by a moderator or an approved appeal rather than run out
+}
+
+// NewBanEndedMessage is sent to moderators, and to the banished user if connected, when
+// the ban sweep finds an ended ban.
+func NewBanEndedMessage(ban models.BanRecord) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   BanEndedMessageType,
+		Sender: "Server",
+		Payload: BanEndedPayload{
+			BanID:    ban.ID,
+			UserID:   ban.BanishedID,
+			Username: ban.BanishedUsername,
+			Pardoned: ban.Pardoned,
+		},
+	}
+}
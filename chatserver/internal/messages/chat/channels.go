@@ -7,18 +7,44 @@ import (
 
 const (
 	ActiveChannelsMessageType = "active_channels"
+	PinsUpdatedMessageType    = "pins_updated"
 )
 
 type ActiveChannelsPayload struct {
-	Channels []models.Channel `json:"channels"`
+	Channels      []models.Channel         `json:"channels"`
+	Categories    []models.ChannelCategory `json:"categories"`               // Category tree; channels without a category come first
+	UnreadPrivate map[string]int           `json:"unread_private,omitempty"` // Unread private messages keyed by peer ID
 }
 
-func NewActiveChannelsMessage(channels []models.Channel) messages.BaseMessage {
+func NewActiveChannelsMessage(channels []models.Channel, categories []models.ChannelCategory, unreadPrivate map[string]int) messages.BaseMessage {
 	return messages.BaseMessage{
 		Type:   ActiveChannelsMessageType,
 		Sender: "Server",
 		Payload: ActiveChannelsPayload{
-			Channels: channels,
+			Channels:      channels,
+			Categories:    categories,
+			UnreadPrivate: unreadPrivate,
+		},
+	}
+}
+
+// PinsUpdatedPayload carries a channel's full list of pins after one was added or removed.
+type PinsUpdatedPayload struct {
+	ChannelID int          `json:"channel_id"`
+	Pins      []models.Pin `json:"pins"`
+}
+
+// NewPinsUpdatedMessage announces a change to a channel's pins.
+func NewPinsUpdatedMessage(channelID int, pins []models.Pin) messages.BaseMessage {
+	if pins == nil {
+		pins = []models.Pin{}
+	}
+	return messages.BaseMessage{
+		Type:   PinsUpdatedMessageType,
+		Sender: "Server",
+		Payload: PinsUpdatedPayload{
+			ChannelID: channelID,
+			Pins:      pins,
 		},
 	}
 }
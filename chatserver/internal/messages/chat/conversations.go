@@ -0,0 +1,45 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	ConversationsMessageType  = "conversations"
+	PrivateHistoryMessageType = "private_history"
+)
+
+type ConversationsPayload struct {
+	Conversations []models.Conversation `json:"conversations"`
+}
+
+func NewConversationsMessage(conversations []models.Conversation) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   ConversationsMessageType,
+		Sender: "Server",
+		Payload: ConversationsPayload{
+			Conversations: conversations,
+		},
+	}
+}
+
+type PrivateHistoryPayload struct {
+	PeerID     string                      `json:"peer_id"`
+	Messages   []models.PrivateChatMessage `json:"messages"`
+	HasMore    bool                        `json:"has_more"`
+	NextCursor string                      `json:"next_cursor,omitempty"` // Token for the next (older) page
+}
+
+func NewPrivateHistoryMessage(peerID string, msgs []models.PrivateChatMessage, hasMore bool, nextCursor string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   PrivateHistoryMessageType,
+		Sender: "Server",
+		Payload: PrivateHistoryPayload{
+			PeerID:     peerID,
+			Messages:   msgs,
+			HasMore:    hasMore,
+			NextCursor: nextCursor,
+		},
+	}
+}
@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const MessageEmbedMessageType = "message_embed"
+
+// MessageEmbedPayload carries the link previews of a channel message once they are fetched.
+type MessageEmbedPayload struct {
+	CacheID int            `json:"cacheID"`
+	Channel string         `json:"channel"`
+	ReplyTo int            `json:"reply_to,omitempty"` // Set when the message is a thread reply
+	Embeds  []models.Embed `json:"embeds"`
+}
+
+// NewMessageEmbedMessage announces the link previews of a message.
+func NewMessageEmbedMessage(msg models.ChatMessage, embeds []models.Embed) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   MessageEmbedMessageType,
+		Sender: "Server",
+		Payload: MessageEmbedPayload{
+			CacheID: msg.CacheID,
+			Channel: msg.Channel,
+			ReplyTo: msg.ReplyTo,
+			Embeds:  embeds,
+		},
+	}
+}
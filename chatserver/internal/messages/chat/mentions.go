@@ -0,0 +1,26 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const MentionMessageType = "mention"
+
+// MentionPayload notifies a user that a chat message mentioned them.
+type MentionPayload struct {
+	Mention models.Mention     `json:"mention"`
+	Message models.ChatMessage `json:"message"`
+}
+
+// NewMentionMessage builds the notification sent to a mentioned user's connections.
+func NewMentionMessage(mention models.Mention, msg models.ChatMessage) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   MentionMessageType,
+		Sender: msg.Username,
+		Payload: MentionPayload{
+			Mention: mention,
+			Message: msg,
+		},
+	}
+}
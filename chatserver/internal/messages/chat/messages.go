@@ -13,6 +13,7 @@ const (
 	BulkChatMessagesType   = "bulk_chat_messages"
 	PrivateChatMessageType = "private_chat_message"
 	BulkPrivateMessageType = "bulk_private_messages"
+	HistoryMessageType     = "history"
 )
 
 func NewPrivateChatMessage(ID, username, recipientID, recipient, message string, authoredAt time.Time) messages.BaseMessage {
@@ -72,3 +73,21 @@ func NewBulkPrivateMessages(msgs []models.PrivateChatMessage) messages.BaseMessa
 		},
 	}
 }
+
+type HistoryPayload struct {
+	Channel  string               `json:"channel"`
+	Messages []models.ChatMessage `json:"messages"`
+	HasMore  bool                 `json:"has_more"`
+}
+
+func NewHistoryMessage(channel string, msgs []models.ChatMessage, hasMore bool) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   HistoryMessageType,
+		Sender: "Server",
+		Payload: HistoryPayload{
+			Channel:  channel,
+			Messages: msgs,
+			HasMore:  hasMore,
+		},
+	}
+}
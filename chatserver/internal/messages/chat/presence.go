@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const SetPresenceMessageType = "set_presence"
+
+// SetPresencePayload carries the presence a user has chosen for all of their connections.
+type SetPresencePayload struct {
+	UserID   string          `json:"user_id"`
+	Username string          `json:"username"`
+	Presence models.Presence `json:"presence"`
+}
+
+// NewSetPresenceMessage builds a request to change a user's presence.
+func NewSetPresenceMessage(userID, username string, presence models.Presence) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   SetPresenceMessageType,
+		Sender: username,
+		Payload: SetPresencePayload{
+			UserID:   userID,
+			Username: username,
+			Presence: presence,
+		},
+	}
+}
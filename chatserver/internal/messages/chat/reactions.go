@@ -0,0 +1,42 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	AddReactionMessageType     = "add_reaction"
+	RemoveReactionMessageType  = "remove_reaction"
+	ReactionUpdatedMessageType = "reaction_updated"
+)
+
+// ReactionUpdatedPayload describes a change to a message's reactions along with the
+// message's new reaction counts.
+type ReactionUpdatedPayload struct {
+	Target    string                 `json:"target"`
+	CacheID   int                    `json:"cacheID"`
+	Channel   string                 `json:"channel,omitempty"` // Set for public messages
+	UserID    string                 `json:"user_id"`           // User whose reaction changed
+	Emoji     string                 `json:"emoji"`
+	Added     bool                   `json:"added"`
+	Reactions []models.ReactionCount `json:"reactions"`
+}
+
+// NewReactionMessage builds an add_reaction or remove_reaction request.
+func NewReactionMessage(messageType, username string, reaction models.Reaction) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    messageType,
+		Sender:  username,
+		Payload: reaction,
+	}
+}
+
+// NewReactionUpdatedMessage announces a message's updated reactions.
+func NewReactionUpdatedMessage(payload ReactionUpdatedPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ReactionUpdatedMessageType,
+		Sender:  "Server",
+		Payload: payload,
+	}
+}
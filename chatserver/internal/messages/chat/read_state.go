@@ -0,0 +1,30 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	MarkReadMessageType    = "mark_read"
+	ReadReceiptMessageType = "read_receipt"
+)
+
+// NewMarkReadMessage wraps a client's request to move its read marker for the hub.
+func NewMarkReadMessage(username string, marker models.ReadMarker) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    MarkReadMessageType,
+		Sender:  username,
+		Payload: marker,
+	}
+}
+
+// NewReadReceiptMessage announces a saved read marker to the reader's other connections
+// and, for private conversations, to the peer.
+func NewReadReceiptMessage(username string, marker models.ReadMarker) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ReadReceiptMessageType,
+		Sender:  username,
+		Payload: marker,
+	}
+}
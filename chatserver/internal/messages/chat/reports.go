@@ -0,0 +1,28 @@
+package chat
+
+import (
+	"onrabble.com/chatserver/internal/messages"
+)
+
+const (
+	ReportMessageMessageType = "report_message"
+	ReportUserMessageType    = "report_user"
+	ReportResultMessageType  = "report_result"
+)
+
+// ReportResultPayload tells a reporter whether their report was filed.
+type ReportResultPayload struct {
+	ReportID  int    `json:"report_id,omitempty"`
+	Status    string `json:"status,omitempty"`
+	Duplicate bool   `json:"duplicate,omitempty"` // The reporter had already reported this and the report is still open
+	Error     string `json:"error,omitempty"`     // Why the report was refused
+}
+
+// NewReportResultMessage answers a report_message or report_user request.
+func NewReportResultMessage(payload ReportResultPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ReportResultMessageType,
+		Sender:  "Server",
+		Payload: payload,
+	}
+}
@@ -0,0 +1,62 @@
+package chat
+
+import (
+	"time"
+
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	OpenThreadMessageType    = "open_thread"
+	CloseThreadMessageType   = "close_thread"
+	ThreadMessageType        = "thread"
+	ThreadReplyMessageType   = "thread_reply"
+	ThreadUpdatedMessageType = "thread_updated"
+)
+
+// ThreadPayload carries a thread parent and a page of its replies, oldest first.
+type ThreadPayload struct {
+	Parent  models.ChatMessage   `json:"parent"`
+	Replies []models.ChatMessage `json:"replies"`
+	HasMore bool                 `json:"has_more"` // Older replies exist beyond this page
+}
+
+// NewThreadMessage answers an open_thread request.
+func NewThreadMessage(parent models.ChatMessage, replies []models.ChatMessage, hasMore bool) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   ThreadMessageType,
+		Sender: "Server",
+		Payload: ThreadPayload{
+			Parent:  parent,
+			Replies: replies,
+			HasMore: hasMore,
+		},
+	}
+}
+
+// NewThreadReplyMessage delivers a new reply to the clients following its thread.
+func NewThreadReplyMessage(reply models.ChatMessage) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ThreadReplyMessageType,
+		Sender:  reply.Username,
+		Payload: reply,
+	}
+}
+
+// ThreadUpdatedPayload carries a thread parent's new reply metadata.
+type ThreadUpdatedPayload struct {
+	Channel     string    `json:"channel"`
+	CacheID     int       `json:"cacheID"` // The thread parent
+	ReplyCount  int       `json:"reply_count"`
+	LastReplyAt time.Time `json:"last_reply_at"`
+}
+
+// NewThreadUpdatedMessage announces that a thread received a reply.
+func NewThreadUpdatedMessage(payload ThreadUpdatedPayload) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:    ThreadUpdatedMessageType,
+		Sender:  "Server",
+		Payload: payload,
+	}
+}
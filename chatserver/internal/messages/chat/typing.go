@@ -0,0 +1,30 @@
+package chat
+
+import "onrabble.com/chatserver/internal/messages"
+
+const (
+	TypingStartMessageType = "typing_start"
+	TypingStopMessageType  = "typing_stop"
+)
+
+// TypingPayload identifies who is typing and where. Exactly one of Channel or PeerID is set.
+type TypingPayload struct {
+	UserID   string `json:"user_id"`
+	Username string `json:"username"`
+	Channel  string `json:"channel,omitempty"`
+	PeerID   string `json:"recipient_id,omitempty"`
+}
+
+// NewTypingMessage builds a typing_start or typing_stop message.
+func NewTypingMessage(messageType, userID, username, channel, peerID string) messages.BaseMessage {
+	return messages.BaseMessage{
+		Type:   messageType,
+		Sender: username,
+		Payload: TypingPayload{
+			UserID:   userID,
+			Username: username,
+			Channel:  channel,
+			PeerID:   peerID,
+		},
+	}
+}
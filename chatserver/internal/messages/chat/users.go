@@ -1,27 +1,45 @@
 package chat
 
-import "onrabble.com/chatserver/internal/messages"
+import (
+	"time"
+
+	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/models"
+)
 
 const (
 	UserStatusMessageType     = "user_status"
 	ConnectedUsersMessageType = "connected_users"
 )
 
+// UserStatusPayload reports a user's presence. IsConnected stays for clients that only
+// distinguish online from offline; invisible users are reported as offline to others.
 type UserStatusPayload struct {
-	Username    string `json:"username"`
-	ID          string `json:"id"`
-	IsConnected bool   `json:"status"`
+	Username        string     `json:"username"`
+	ID              string     `json:"id"`
+	IsConnected     bool       `json:"status"`
+	Presence        string     `json:"presence"`
+	StatusText      string     `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
 }
 
-func NewUserStatusMessage(username, ID string, isConnected bool) messages.BaseMessage {
+// NewUserStatusPayload builds the status entry for a user with the given presence.
+func NewUserStatusPayload(username, ID string, presence models.Presence) UserStatusPayload {
+	return UserStatusPayload{
+		Username:        username,
+		ID:              ID,
+		IsConnected:     presence.State != models.PresenceOffline,
+		Presence:        presence.State,
+		StatusText:      presence.StatusText,
+		StatusExpiresAt: presence.StatusExpiresAt,
+	}
+}
+
+func NewUserStatusMessage(username, ID string, presence models.Presence) messages.BaseMessage {
 	return messages.BaseMessage{
-		Type:   UserStatusMessageType,
-		Sender: "Server",
-		Payload: UserStatusPayload{
-			Username:    username,
-			ID:          ID,
-			IsConnected: isConnected,
-		},
+		Type:    UserStatusMessageType,
+		Sender:  "Server",
+		Payload: NewUserStatusPayload(username, ID, presence),
 	}
 }
 
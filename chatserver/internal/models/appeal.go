@@ -0,0 +1,25 @@
+package models
+
+import "time"
+
+// Where a ban appeal stands.
+const (
+	AppealPending  = "pending"
+	AppealApproved = "approved" // The ban was pardoned
+	AppealDenied   = "denied"
+	AppealExpired  = "expired" // The ban ran out before a decision
+)
+
+// Appeal is a banned user's request to lift their ban.
+type Appeal struct {
+	ID           int        `json:"id"`
+	BanID        int        `json:"ban_id"`
+	UserID       string     `json:"user_id"`
+	Username     string     `json:"username"`
+	Message      string     `json:"message"`
+	Status       string     `json:"status"`
+	DecidedBy    *string    `json:"decided_by,omitempty"`
+	DecisionNote string     `json:"decision_note,omitempty"`
+	DecidedAt    *time.Time `json:"decided_at,omitempty"`
+	CreatedAt    time.Time  `json:"created_at"`
+}
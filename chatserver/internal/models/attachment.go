@@ -0,0 +1,40 @@
+package models
+
+import "time"
+
+// Attachment is an uploaded file. It belongs to its uploader until it is sent with a
+// message, after which it is visible to whoever can see that message.
+type Attachment struct {
+	ID           string    `json:"id"`
+	OwnerID      string    `json:"owner_id"`
+	Filename     string    `json:"filename"`
+	ContentType  string    `json:"content_type"` // Sniffed from the file's contents
+	Size         int64     `json:"size"`
+	Width        int       `json:"width,omitempty"`  // Set for images
+	Height       int       `json:"height,omitempty"` // Set for images
+	HasThumbnail bool      `json:"has_thumbnail,omitempty"`
+	CreatedAt    time.Time `json:"created_at"`
+
+	StorageKey   string `json:"-"`
+	ThumbnailKey string `json:"-"`
+	Target       string `json:"-"` // ReactionTargetChat or ReactionTargetPrivate once sent, empty before
+	CacheID      int    `json:"-"` // Message the attachment was sent with
+	Channel      string `json:"-"` // Set for attachments sent to a channel
+	RecipientID  string `json:"-"` // Set for attachments sent in a private message
+}
+
+// VisibleTo reports whether a user may download the attachment: its uploader always can,
+// anyone signed in can once it is posted to a channel, and only the two participants can
+// once it is sent privately.
+func (a Attachment) VisibleTo(userID string) bool {
+	switch {
+	case a.OwnerID == userID:
+		return true
+	case a.Target == ReactionTargetChat:
+		return true
+	case a.Target == ReactionTargetPrivate:
+		return a.RecipientID == userID
+	default:
+		return false
+	}
+}
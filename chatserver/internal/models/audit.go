@@ -0,0 +1,51 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Actions recorded in the audit log.
+const (
+	AuditChannelCreate     = "channel.create"
+	AuditChannelUpdate     = "channel.update"
+	AuditChannelReorder    = "channel.reorder"
+	AuditChannelDelete     = "channel.delete"
+	AuditChannelImport     = "channel.import"
+	AuditChannelExport     = "channel.export"
+	AuditCategoryCreate    = "category.create"
+	AuditCategoryUpdate    = "category.update"
+	AuditCategoryMove      = "category.move"
+	AuditCategoryDelete    = "category.delete"
+	AuditUserBan           = "user.ban"
+	AuditUserPardon        = "user.pardon"
+	AuditUserErase         = "user.erase"
+	AuditUserUnmute        = "user.unmute"
+	AuditAppealDecide      = "appeal.decide"
+	AuditBanEvasionDismiss = "ban_evasion.dismiss"
+	AuditMessagesDelete    = "messages.delete"
+	AuditRateLimitUpdate   = "ratelimit.update"
+	AuditAutomodRuleCreate = "automod_rule.create"
+	AuditAutomodRuleUpdate = "automod_rule.update"
+	AuditAutomodRuleDelete = "automod_rule.delete"
+	AuditAutomodFlagReview = "automod_flag.review"
+	AuditRetentionUpdate   = "retention.update"
+	AuditRetentionDelete   = "retention.delete"
+	AuditLegalHoldCreate   = "legal_hold.create"
+	AuditLegalHoldDelete   = "legal_hold.delete"
+	AuditReportClaim       = "report.claim"
+	AuditReportEscalate    = "report.escalate"
+	AuditReportResolve     = "report.resolve"
+)
+
+// AuditEntry records an administrative change and who made it.
+type AuditEntry struct {
+	ID            int             `json:"id"`
+	ActorID       string          `json:"actor_id,omitempty"` // Empty when the request carried no bearer token
+	ActorUsername string          `json:"actor_username,omitempty"`
+	ClientID      string          `json:"client_id,omitempty"` // Keycloak client the actor's token was issued to
+	Action        string          `json:"action"`
+	Target        string          `json:"target,omitempty"` // ID or name of what was changed
+	Details       json.RawMessage `json:"details,omitempty"`
+	CreatedAt     time.Time       `json:"created_at"`
+}
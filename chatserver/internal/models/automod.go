@@ -0,0 +1,75 @@
+package models
+
+import "time"
+
+// Kinds of automod rules.
+const (
+	AutomodWords    = "words"    // Any of Words appears as a whole word, ignoring case
+	AutomodRegex    = "regex"    // Pattern matches the message text
+	AutomodLinks    = "links"    // More than Limit links
+	AutomodCaps     = "caps"     // More than Ratio of the letters are capitals, once there are at least Limit letters
+	AutomodRepeat   = "repeat"   // The same text sent more than Limit times within WindowSeconds
+	AutomodMentions = "mentions" // More than Limit distinct mentions
+)
+
+// What automod does with a message that breaks a rule, from mildest to strictest.
+const (
+	AutomodActionFlag  = "flag"  // Deliver it, but queue it for moderator review
+	AutomodActionMask  = "mask"  // Deliver it with the matching text replaced by bullets
+	AutomodActionBlock = "block" // Refuse it
+	AutomodActionMute  = "mute"  // Refuse it and stop the sender from posting for MuteSeconds
+)
+
+// Review states of a flagged message.
+const (
+	FlagPending  = "pending"
+	FlagApproved = "approved" // Reviewed and left in place
+	FlagRemoved  = "removed"  // Reviewed and deleted
+)
+
+// AutomodRule is a moderation rule checked against every message before it is stored.
+type AutomodRule struct {
+	ID            int       `json:"id"`
+	Name          string    `json:"name"`
+	Type          string    `json:"type"`
+	Words         []string  `json:"words,omitempty"`
+	Pattern       string    `json:"pattern,omitempty"`
+	Limit         int       `json:"limit,omitempty"`
+	Ratio         float64   `json:"ratio,omitempty"`
+	WindowSeconds int       `json:"window_seconds,omitempty"`
+	Channels      []string  `json:"channels,omitempty"` // Channels the rule applies to; empty means all, including private messages
+	Action        string    `json:"action"`
+	MuteSeconds   int       `json:"mute_seconds,omitempty"`
+	Enabled       bool      `json:"enabled"`
+	CreatedBy     string    `json:"created_by"` // Moderator's ID
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// AutomodFlag is a delivered message that a rule queued for moderator review.
+type AutomodFlag struct {
+	ID          int        `json:"id"`
+	RuleID      *int       `json:"rule_id,omitempty"` // Unset once the rule is deleted
+	RuleName    string     `json:"rule_name"`
+	Reason      string     `json:"reason"`
+	Target      string     `json:"target"` // "chat" or "private"
+	CacheID     int        `json:"cacheID"`
+	Channel     string     `json:"channel,omitempty"`
+	RecipientID string     `json:"recipient_id,omitempty"`
+	OwnerID     string     `json:"owner_id"`
+	Username    string     `json:"username"`
+	Message     string     `json:"message"`
+	Status      string     `json:"status"`
+	CreatedAt   time.Time  `json:"created_at"`
+	ReviewedBy  *string    `json:"reviewed_by,omitempty"`
+	ReviewedAt  *time.Time `json:"reviewed_at,omitempty"`
+}
+
+// AutomodMute stops a user from sending messages until it expires.
+type AutomodMute struct {
+	UserID    string    `json:"user_id"`
+	Until     time.Time `json:"until"`
+	Reason    string    `json:"reason"`
+	RuleID    *int      `json:"rule_id,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -5,5 +5,19 @@ type Channel struct {
 	ID          int     `json:"id"`
 	Name        string  `json:"name"`
 	Description *string `json:"description,omitempty"`
-	SortOrder   int     `json:"sort_order,omitempty"`
+	SortOrder   int     `json:"sort_order,omitempty"`      // Position within the category; gaps are left between channels
+	CategoryID  *int    `json:"category_id,omitempty"`     // Absent for uncategorized channels, listed first
+	Language    string  `json:"search_language,omitempty"` // Text search configuration, e.g. "english"
+	UnreadCount int     `json:"unread_count,omitempty"`    // Set per user when sent over the websocket
+	Pins        []Pin   `json:"pins,omitempty"`            // Set when sent over the websocket, newest first
+}
+
+// ChannelCategory groups channels in the channel list. Categories are ordered among
+// themselves and their channels within them.
+type ChannelCategory struct {
+	ID         int    `json:"id"`
+	Name       string `json:"name"`
+	SortOrder  int    `json:"sort_order"`
+	Collapsed  bool   `json:"collapsed"`   // Shown collapsed until the user expands it
+	ChannelIDs []int  `json:"channel_ids"` // The category's channels in display order
 }
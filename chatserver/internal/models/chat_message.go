@@ -14,6 +14,20 @@ type ChatMessage struct {
 	Channel  string    `json:"channel"`
 	Message  string    `json:"message"`
 	Sent     time.Time `json:"authored_at"`
+	Rank     float32   `json:"rank,omitempty"`    // Search relevance, set on keyword search results
+	Snippet  string    `json:"snippet,omitempty"` // HTML-escaped excerpt with <mark> highlights
+
+	Content []MessageNode `json:"content,omitempty"` // Message parsed as restricted Markdown
+	HTML    string        `json:"html,omitempty"`    // Sanitized rendering of Content
+
+	ReplyTo     int        `json:"reply_to,omitempty"`      // cacheID of the thread's parent, set on replies
+	ReplyToID   int        `json:"reply_to_id,omitempty"`   // Parent's database ID, accepted in place of ReplyTo
+	ReplyCount  int        `json:"reply_count,omitempty"`   // Number of replies, set on thread parents
+	LastReplyAt *time.Time `json:"last_reply_at,omitempty"` // Time of the newest reply, set on thread parents
+
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Embeds      []Embed         `json:"embeds,omitempty"` // Link previews, added once fetched
+	Reactions   []ReactionCount `json:"reactions,omitempty"`
 }
 
 // PrivateChatMessage represents a private message sent between two users.
@@ -26,4 +40,21 @@ type PrivateChatMessage struct {
 	Recipient   string    `json:"recipient"`    // Receiver's username
 	Message     string    `json:"message"`
 	Sent        time.Time `json:"authored_at"`
+	Unread      bool      `json:"unread,omitempty"`  // Set for received messages the recipient has not read
+	Rank        float32   `json:"rank,omitempty"`    // Search relevance, set on keyword search results
+	Snippet     string    `json:"snippet,omitempty"` // HTML-escaped excerpt with <mark> highlights
+
+	Content []MessageNode `json:"content,omitempty"` // Message parsed as restricted Markdown
+	HTML    string        `json:"html,omitempty"`    // Sanitized rendering of Content
+
+	Attachments []Attachment    `json:"attachments,omitempty"`
+	Reactions   []ReactionCount `json:"reactions,omitempty"`
+}
+
+// Conversation summarizes a user's private message thread with a single peer.
+type Conversation struct {
+	PeerID       string             `json:"peer_id"`
+	PeerUsername string             `json:"peer_username"`
+	LastMessage  PrivateChatMessage `json:"last_message"`
+	UnreadCount  int                `json:"unread_count"` // Messages from the peer not yet read
 }
@@ -0,0 +1,16 @@
+package models
+
+// Embed is a preview of a link in a message, built from the linked page's OpenGraph and
+// oEmbed metadata.
+type Embed struct {
+	URL          string `json:"url"`
+	Title        string `json:"title,omitempty"`
+	Description  string `json:"description,omitempty"`
+	ThumbnailURL string `json:"thumbnail_url,omitempty"`
+	SiteName     string `json:"site_name,omitempty"`
+}
+
+// Empty reports whether the embed has nothing to show, as when the page had no metadata.
+func (e Embed) Empty() bool {
+	return e.Title == "" && e.Description == "" && e.ThumbnailURL == ""
+}
@@ -0,0 +1,23 @@
+package models
+
+// Types of MessageNode produced by the formatting pipeline.
+const (
+	NodeText      = "text"
+	NodeBold      = "bold"
+	NodeItalic    = "italic"
+	NodeCode      = "code"
+	NodeCodeBlock = "code_block"
+	NodeSpoiler   = "spoiler"
+	NodeLink      = "link"
+	NodeMention   = "mention"
+)
+
+// MessageNode is one element of a message's parsed Markdown. Bold, italic, spoiler and
+// link nodes hold their content in Children; the others carry Text.
+type MessageNode struct {
+	Type     string        `json:"type"`
+	Text     string        `json:"text,omitempty"`     // Content of text and code nodes, the name in mention nodes
+	URL      string        `json:"url,omitempty"`      // Target of link nodes
+	Language string        `json:"language,omitempty"` // Hint given after the opening fence of a code block
+	Children []MessageNode `json:"children,omitempty"`
+}
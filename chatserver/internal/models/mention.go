@@ -0,0 +1,24 @@
+package models
+
+import "time"
+
+// Ways a user can be mentioned.
+const (
+	MentionUser    = "user"    // @username
+	MentionHere    = "here"    // @here, everyone online
+	MentionChannel = "channel" // @channel, everyone following the channel
+)
+
+// Mention records that a chat message mentioned a user.
+type Mention struct {
+	ID             int        `json:"id,omitempty"`
+	UserID         string     `json:"user_id"` // Mentioned user
+	CacheID        int        `json:"cacheID"` // Message containing the mention
+	Channel        string     `json:"channel"`
+	AuthorID       string     `json:"author_id"`
+	AuthorUsername string     `json:"author_username"`
+	Kind           string     `json:"kind"`
+	Message        string     `json:"message,omitempty"` // Text of the message, if it still exists
+	CreatedAt      time.Time  `json:"created_at"`
+	ReadAt         *time.Time `json:"read_at,omitempty"`
+}
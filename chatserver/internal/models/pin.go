@@ -0,0 +1,12 @@
+package models
+
+import "time"
+
+// Pin is a message pinned to the top of a channel.
+type Pin struct {
+	ChannelID int         `json:"channel_id"`
+	CacheID   int         `json:"cacheID"`
+	PinnedBy  string      `json:"pinned_by"` // Moderator's user ID
+	PinnedAt  time.Time   `json:"pinned_at"`
+	Message   ChatMessage `json:"message"`
+}
@@ -0,0 +1,34 @@
+package models
+
+import "time"
+
+// Presence states. Users choose between online, idle, dnd and invisible; offline is
+// reported for users without connections and to others for invisible users.
+const (
+	PresenceOnline    = "online"
+	PresenceIdle      = "idle"
+	PresenceDND       = "dnd"
+	PresenceInvisible = "invisible"
+	PresenceOffline   = "offline"
+)
+
+// Presence is a user's availability along with an optional custom status.
+type Presence struct {
+	State           string     `json:"state"`
+	StatusText      string     `json:"status_text,omitempty"`
+	StatusExpiresAt *time.Time `json:"status_expires_at,omitempty"`
+}
+
+// ValidPresenceState reports whether state can be chosen by a user.
+func ValidPresenceState(state string) bool {
+	switch state {
+	case PresenceOnline, PresenceIdle, PresenceDND, PresenceInvisible:
+		return true
+	}
+	return false
+}
+
+// StatusExpired reports whether the custom status has passed its expiry.
+func (p Presence) StatusExpired(now time.Time) bool {
+	return p.StatusExpiresAt != nil && !now.Before(*p.StatusExpiresAt)
+}
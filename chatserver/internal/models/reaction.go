@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// Kinds of message a reaction can target. Public and private messages use separate
+// cacheID counters, so a reaction is identified by both its kind and cacheID.
+const (
+	ReactionTargetChat    = "chat"
+	ReactionTargetPrivate = "private"
+)
+
+// Reaction is a single user's emoji reaction to a message.
+type Reaction struct {
+	Target    string     `json:"target"`               // ReactionTargetChat or ReactionTargetPrivate
+	CacheID   int        `json:"cacheID"`              // Message the reaction belongs to
+	MessageID int        `json:"message_id,omitempty"` // Database ID, accepted in place of cacheID for stored messages
+	UserID    string     `json:"user_id"`
+	Emoji     string     `json:"emoji"`
+	CreatedAt *time.Time `json:"created_at,omitempty"` // Set on stored reactions in data exports
+}
+
+// ReactionCount aggregates every reaction to a message with the same emoji.
+type ReactionCount struct {
+	Emoji   string   `json:"emoji"`
+	Count   int      `json:"count"`
+	UserIDs []string `json:"user_ids"` // Reacting users, earliest first
+}
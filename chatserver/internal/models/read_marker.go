@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// ReadMarker records how far a user has read a channel or a private conversation.
+// Exactly one of Channel or PeerID is set.
+type ReadMarker struct {
+	UserID  string    `json:"user_id"`
+	Channel string    `json:"channel,omitempty"`
+	PeerID  string    `json:"peer_id,omitempty"`
+	CacheID int       `json:"cacheID"` // Newest message read, from the matching cacheID counter
+	ReadAt  time.Time `json:"read_at"`
+}
@@ -0,0 +1,65 @@
+package models
+
+import (
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// What a report is about.
+const (
+	ReportMessage = "message"
+	ReportUser    = "user"
+)
+
+// Why a user filed a report.
+var ReportReasons = []string{"spam", "harassment", "hate", "sexual", "violence", "impersonation", "other"}
+
+// Where a report is in the moderation queue.
+const (
+	ReportOpen      = "open"      // Waiting for a moderator
+	ReportClaimed   = "claimed"   // A moderator is handling it
+	ReportEscalated = "escalated" // Handed on for a second opinion; any moderator may claim it
+	ReportResolved  = "resolved"
+)
+
+// How a moderator resolved a report.
+const (
+	ResolutionDismissed      = "dismissed"       // No action needed
+	ResolutionMessageRemoved = "message_removed" // The reported message was deleted
+	ResolutionUserBanned     = "user_banned"     // The reported user was banned; BanID links the ban
+)
+
+// Reasons a report is refused.
+var (
+	ErrInvalidReport        = errors.New("invalid report")
+	ErrReportTargetNotFound = errors.New("reported message or user not found")
+)
+
+// Report is a user's complaint about a message or another user.
+type Report struct {
+	ID               int             `json:"id"`
+	ReporterID       string          `json:"reporter_id"`
+	ReporterUsername string          `json:"reporter_username"`
+	Kind             string          `json:"kind"`             // "message" or "user"
+	Target           string          `json:"target,omitempty"` // "chat" or "private", for message reports
+	CacheID          int             `json:"cacheID,omitempty"`
+	MessageID        int             `json:"message_id,omitempty"` // Accepted in place of CacheID when filing
+	Channel          string          `json:"channel,omitempty"`
+	ReportedUserID   string          `json:"reported_user_id"`
+	ReportedUsername string          `json:"reported_username"`
+	Snapshot         json.RawMessage `json:"snapshot,omitempty"` // The message as it was when reported
+	Reason           string          `json:"reason"`
+	Details          string          `json:"details,omitempty"`
+	Status           string          `json:"status"`
+	ClaimedBy        *string         `json:"claimed_by,omitempty"`
+	ClaimedAt        *time.Time      `json:"claimed_at,omitempty"`
+	EscalatedBy      *string         `json:"escalated_by,omitempty"`
+	EscalationNote   string          `json:"escalation_note,omitempty"`
+	Resolution       string          `json:"resolution,omitempty"`
+	ResolutionNote   string          `json:"resolution_note,omitempty"`
+	BanID            *int            `json:"ban_id,omitempty"`
+	ResolvedBy       *string         `json:"resolved_by,omitempty"`
+	ResolvedAt       *time.Time      `json:"resolved_at,omitempty"`
+	CreatedAt        time.Time       `json:"created_at"`
+}
@@ -0,0 +1,33 @@
+package models
+
+import "time"
+
+// What a retention policy covers.
+const (
+	RetentionChannels = "channels" // Every channel without a policy of its own
+	RetentionChannel  = "channel"  // One channel, named by Channel
+	RetentionPrivate  = "private"  // Private messages
+	RetentionSessions = "sessions" // Session records
+)
+
+// RetentionPolicy limits how long rows are kept. Zero limits keep rows forever.
+type RetentionPolicy struct {
+	Scope       string    `json:"scope"`
+	Channel     string    `json:"channel,omitempty"`
+	MaxAgeDays  int       `json:"max_age_days,omitempty"`
+	MaxMessages int       `json:"max_messages,omitempty"` // Newest messages kept per channel; channel scopes only
+	Archive     bool      `json:"archive"`                // Move expired messages to the archive tables instead of deleting them
+	UpdatedBy   string    `json:"updated_by"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// LegalHold exempts a channel's messages, or a user's messages and sessions, from
+// retention purges.
+type LegalHold struct {
+	ID        int       `json:"id"`
+	Channel   string    `json:"channel,omitempty"`
+	UserID    string    `json:"user_id,omitempty"`
+	Reason    string    `json:"reason"`
+	CreatedBy string    `json:"created_by"`
+	CreatedAt time.Time `json:"created_at"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import "time"
+
+// Kinds of data subject request.
+const (
+	DataRequestExport = "export"
+	DataRequestErase  = "erase"
+)
+
+// How an erasure treats the user's messages.
+const (
+	ErasureDelete       = "delete"       // Messages are deleted
+	ErasurePseudonymize = "pseudonymize" // Messages are kept under a pseudonym
+)
+
+// Where a data subject request stands.
+const (
+	DataRequestPending   = "pending"
+	DataRequestRunning   = "running"
+	DataRequestCompleted = "completed"
+	DataRequestFailed    = "failed"
+)
+
+// DataRequest records an export or erasure of a user's data, kept as an audit trail.
+type DataRequest struct {
+	ID          int              `json:"id"`
+	Kind        string           `json:"kind"`
+	UserID      string           `json:"user_id"`
+	Mode        string           `json:"mode"`                // Export format, zip or json, or erasure mode
+	Pseudonym   string           `json:"pseudonym,omitempty"` // Replaces the user's ID and name in records an erasure keeps
+	Status      string           `json:"status"`
+	Counts      map[string]int64 `json:"counts"` // Rows exported or erased, by kind
+	Error       string           `json:"error,omitempty"`
+	RequestedBy string           `json:"requested_by"`
+	CreatedAt   time.Time        `json:"created_at"`
+	StartedAt   *time.Time       `json:"started_at,omitempty"`
+	FinishedAt  *time.Time       `json:"finished_at,omitempty"`
+}
+
+// UserSession is a single recorded connection.
+type UserSession struct {
+	ID       int       `json:"id"`
+	Start    time.Time `json:"start_time"`
+	End      time.Time `json:"end_time"`
+	Duration string    `json:"duration"`
+}
+
+// UserDataExport bundles the data stored about a user. Archived messages are included.
+type UserDataExport struct {
+	UserID          string               `json:"user_id"`
+	Username        string               `json:"username,omitempty"`
+	ExportedAt      time.Time            `json:"exported_at"`
+	ChatMessages    []ChatMessage        `json:"chat_messages"`
+	PrivateMessages []PrivateChatMessage `json:"private_messages"` // Sent and received
+	Sessions        []UserSession        `json:"sessions"`
+	Bans            []BanRecord          `json:"bans"`
+	Reactions       []Reaction           `json:"reactions"`
+}
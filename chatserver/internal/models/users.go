@@ -3,9 +3,10 @@ package models
 import "time"
 
 type User struct {
-	ID       string `json:"id"`
-	Username string `json:"username"`
-	Banned   bool   `json:"is_banned"`
+	ID        string    `json:"id"`
+	Username  string    `json:"username"`
+	Banned    bool      `json:"is_banned"`
+	CreatedAt time.Time `json:"created_at"`
 }
 
 type BanRecord struct {
@@ -18,4 +19,29 @@ type BanRecord struct {
 	End              *time.Time `json:"end,omitempty"`
 	Duration         *string    `json:"duration,omitempty"`
 	Pardoned         bool       `json:"pardoned"`
+	IPRange          string     `json:"ip_range,omitempty"`  // Also refuses any account connecting from this CIDR
+	DeviceID         string     `json:"device_id,omitempty"` // Also refuses any account connecting from this device
+	PardonedAt       *time.Time `json:"pardoned_at,omitempty"`
+	PardonedBy       *string    `json:"pardoned_by,omitempty"`
+	AppealID         *int       `json:"appeal_id,omitempty"` // The approved appeal that lifted the ban
+}
+
+// BanScope widens a ban beyond the banished account. Empty fields are not applied.
+type BanScope struct {
+	IPRange  string // An address or CIDR range
+	DeviceID string // A client-provided device fingerprint
+}
+
+// BanEvasion records an account first seen after a ban connecting from an address or device
+// the banned user had used.
+type BanEvasion struct {
+	ID         int       `json:"id"`
+	UserID     string    `json:"user_id"`
+	Username   string    `json:"username"`
+	BanID      int       `json:"ban_id"`
+	BanishedID string    `json:"banished_id"`
+	IP         string    `json:"ip,omitempty"`
+	DeviceID   string    `json:"device_id,omitempty"`
+	Dismissed  bool      `json:"dismissed"`
+	CreatedAt  time.Time `json:"created_at"`
 }
@@ -0,0 +1,218 @@
+package retention
+
+import (
+	"log"
+	"time"
+
+	"onrabble.com/chatserver/internal/cache"
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	sweepInterval = time.Hour
+
+	// batchSize bounds the rows each purge statement deletes, and batchPause spaces the
+	// statements out so other queries are not starved while a large backlog is cleared.
+	batchSize  = 1000
+	batchPause = 100 * time.Millisecond
+)
+
+// Janitor purges messages and sessions that have outlived their retention policies.
+type Janitor struct {
+	db    *pgxpool.Pool
+	cache *cache.MessageCache
+}
+
+// Result counts the rows one pass purged.
+type Result struct {
+	ChatMessages    int
+	PrivateMessages int
+	Sessions        int64
+}
+
+// NewJanitor returns a janitor purging rows from db and their copies from the cache.
+func NewJanitor(db *pgxpool.Pool, cache *cache.MessageCache) *Janitor {
+	return &Janitor{db: db, cache: cache}
+}
+
+// Start runs a pass every sweepInterval in the background.
+func (j *Janitor) Start() {
+	go func() {
+		ticker := time.NewTicker(sweepInterval)
+		defer ticker.Stop()
+
+		for range ticker.C {
+			result, err := j.Run()
+			if err != nil {
+				log.Printf("Retention sweep failed: %v", err)
+			}
+			if result.ChatMessages > 0 || result.PrivateMessages > 0 || result.Sessions > 0 {
+				log.Printf("Retention sweep purged %d chat messages, %d private messages and %d sessions",
+					result.ChatMessages, result.PrivateMessages, result.Sessions)
+			}
+		}
+	}()
+}
+
+// Run applies every retention policy once. A failure stops the pass; what was purged
+// before it is still counted.
+func (j *Janitor) Run() (Result, error) {
+	var result Result
+
+	policies, err := db.FetchRetentionPolicies(j.db)
+	if err != nil {
+		return result, err
+	}
+
+	var defaults, private, sessions *models.RetentionPolicy
+	channelPolicies := make(map[string]models.RetentionPolicy)
+	for i, policy := range policies {
+		switch policy.Scope {
+		case models.RetentionChannels:
+			defaults = &policies[i]
+		case models.RetentionChannel:
+			channelPolicies[policy.Channel] = policy
+		case models.RetentionPrivate:
+			private = &policies[i]
+		case models.RetentionSessions:
+			sessions = &policies[i]
+		}
+	}
+
+	// Channel policies may name channels that have since been removed from the channel list
+	channels, err := db.FetchChannels(j.db)
+	if err != nil {
+		return result, err
+	}
+	names := make(map[string]bool)
+	for _, channel := range channels {
+		names[channel.Name] = true
+	}
+	for name := range channelPolicies {
+		names[name] = true
+	}
+
+	for name := range names {
+		policy, ok := channelPolicies[name]
+		if !ok {
+			if defaults == nil {
+				continue
+			}
+			policy = *defaults
+		}
+		purged, err := j.purgeChannel(name, policy)
+		result.ChatMessages += purged
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if private != nil && private.MaxAgeDays > 0 {
+		purged, err := j.purgePrivateMessages(*private)
+		result.PrivateMessages += purged
+		if err != nil {
+			return result, err
+		}
+	}
+
+	if sessions != nil && sessions.MaxAgeDays > 0 {
+		olderThan := cutoff(sessions.MaxAgeDays)
+		for {
+			deleted, err := db.PurgeSessions(j.db, olderThan, batchSize)
+			result.Sessions += deleted
+			if err != nil {
+				return result, err
+			}
+			if deleted < batchSize {
+				break
+			}
+			time.Sleep(batchPause)
+		}
+	}
+
+	return result, nil
+}
+
+// purgeChannel deletes a channel's expired messages batch by batch, along with any copies
+// still in its history ring. Channels under legal hold are skipped.
+func (j *Janitor) purgeChannel(channel string, policy models.RetentionPolicy) (int, error) {
+	if policy.MaxAgeDays <= 0 && policy.MaxMessages <= 0 {
+		return 0, nil
+	}
+	held, err := db.ChannelHeld(j.db, channel)
+	if err != nil || held {
+		return 0, err
+	}
+
+	var olderThan time.Time
+	if policy.MaxAgeDays > 0 {
+		olderThan = cutoff(policy.MaxAgeDays)
+	}
+
+	cached := make(map[int]bool)
+	for _, msg := range j.cache.GetChannelHistory(channel) {
+		cached[msg.CacheID] = true
+	}
+
+	purged := 0
+	for {
+		cacheIDs, err := db.PurgeChatMessages(j.db, channel, olderThan, policy.MaxMessages, policy.Archive, batchSize)
+		purged += len(cacheIDs)
+		for _, cacheID := range cacheIDs {
+			if cached[cacheID] {
+				j.cache.DeleteCachedMessage(cacheID)
+			}
+		}
+		if err != nil {
+			return purged, err
+		}
+		if len(cacheIDs) < batchSize {
+			return purged, nil
+		}
+		time.Sleep(batchPause)
+	}
+}
+
+// purgePrivateMessages deletes expired private messages batch by batch, along with any
+// copies still in their participants' recent messages.
+func (j *Janitor) purgePrivateMessages(policy models.RetentionPolicy) (int, error) {
+	olderThan := cutoff(policy.MaxAgeDays)
+
+	purged := 0
+	for {
+		messages, err := db.PurgePrivateMessages(j.db, olderThan, policy.Archive, batchSize)
+		purged += len(messages)
+
+		// Only read each participant's recent messages once per batch
+		cached := make(map[string]map[int]bool)
+		for _, msg := range messages {
+			for _, userID := range []string{msg.OwnerID, msg.RecipientID} {
+				if _, ok := cached[userID]; !ok {
+					cached[userID] = make(map[int]bool)
+					for _, recent := range j.cache.GetCachedPrivateMessages(userID) {
+						cached[userID][recent.CacheID] = true
+					}
+				}
+			}
+			if cached[msg.OwnerID][msg.CacheID] || cached[msg.RecipientID][msg.CacheID] {
+				j.cache.DeleteCachedPrivateMessage(msg.CacheID, msg.OwnerID, msg.RecipientID)
+			}
+		}
+
+		if err != nil {
+			return purged, err
+		}
+		if len(messages) < batchSize {
+			return purged, nil
+		}
+		time.Sleep(batchPause)
+	}
+}
+
+// cutoff returns the time before which rows kept for days have expired.
+func cutoff(days int) time.Time {
+	return time.Now().AddDate(0, 0, -days)
+}
@@ -0,0 +1,59 @@
+package server
+
+import (
+	"context"
+	"log"
+	"time"
+
+	database "onrabble.com/chatserver/internal/db"
+)
+
+const (
+	// unsentAttachmentTTL is how long an upload may wait to be sent before it is deleted.
+	unsentAttachmentTTL = 24 * time.Hour
+
+	attachmentSweepInterval  = time.Hour
+	attachmentSweepBatchSize = 500
+)
+
+// sweepAttachments periodically deletes attachments that were never sent, or whose message
+// was deleted, together with their stored files.
+func (s *Server) sweepAttachments() {
+	ticker := time.NewTicker(attachmentSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		stale, err := database.FetchStaleAttachments(s.db, time.Now().Add(-unsentAttachmentTTL), attachmentSweepBatchSize)
+		if err != nil {
+			log.Printf("Attachment sweep failed: %v", err)
+			continue
+		}
+
+		removed := 0
+		for _, attachment := range stale {
+			if err := s.deleteAttachment(attachment.ID, attachment.StorageKey, attachment.ThumbnailKey); err != nil {
+				log.Printf("Failed to delete attachment %s: %v", attachment.ID, err)
+				continue
+			}
+			removed++
+		}
+		if removed > 0 {
+			log.Printf("Removed %d unsent attachments", removed)
+		}
+	}
+}
+
+// deleteAttachment removes an attachment's files and then its record, so a failure leaves
+// the record behind to be retried by the next sweep.
+func (s *Server) deleteAttachment(id string, keys ...string) error {
+	ctx := context.Background()
+	for _, key := range keys {
+		if key == "" {
+			continue
+		}
+		if err := s.attachments.Store.Delete(ctx, key); err != nil {
+			return err
+		}
+	}
+	return database.DeleteAttachment(s.db, id)
+}
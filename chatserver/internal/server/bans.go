@@ -0,0 +1,34 @@
+package server
+
+import (
+	"log"
+	"time"
+
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/chat"
+)
+
+// banSweepInterval is how often bans that ran out are processed.
+const banSweepInterval = 5 * time.Minute
+
+// sweepEndedBans periodically announces the bans that have run out or been pardoned to the
+// connected moderators and closes their pending appeals, which no longer need a decision.
+func (s *Server) sweepEndedBans() {
+	ticker := time.NewTicker(banSweepInterval)
+	defer ticker.Stop()
+
+	for range ticker.C {
+		ended, closed, err := database.ProcessEndedBans(s.db)
+		if err != nil {
+			log.Printf("Ban sweep failed: %v", err)
+			continue
+		}
+		for _, ban := range ended {
+			log.Printf("Ban %s on %s has ended", ban.ID, ban.BanishedID)
+			s.hub.SendMessage(chat.NewBanEndedMessage(ban))
+		}
+		if closed > 0 {
+			log.Printf("Closed %d appeals of ended bans", closed)
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package server
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"net/netip"
+	"os"
+	"strings"
+)
+
+// defaultTrustedProxies covers loopback and the private ranges Docker networks use, where
+// Caddy runs alongside the chat server.
+var defaultTrustedProxies = []string{"127.0.0.0/8", "::1/128", "10.0.0.0/8", "172.16.0.0/12", "192.168.0.0/16", "fc00::/7"}
+
+// trustedProxiesFromEnv reads the comma-separated addresses or CIDR ranges in
+// TRUSTED_PROXIES, falling back to defaultTrustedProxies when unset. Invalid entries are
+// logged and skipped.
+func trustedProxiesFromEnv() []netip.Prefix {
+	entries := defaultTrustedProxies
+	if value := strings.TrimSpace(os.Getenv("TRUSTED_PROXIES")); value != "" {
+		entries = strings.Split(value, ",")
+	}
+
+	var prefixes []netip.Prefix
+	for _, entry := range entries {
+		prefix, err := parsePrefix(strings.TrimSpace(entry))
+		if err != nil {
+			log.Printf("Ignoring invalid trusted proxy %q: %v", entry, err)
+			continue
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	return prefixes
+}
+
+// parsePrefix parses a CIDR range, or a single address as a range holding only itself.
+func parsePrefix(value string) (netip.Prefix, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		return prefix.Masked(), err
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return netip.Prefix{}, err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()), nil
+}
+
+// clientIP returns the address a request came from. X-Forwarded-For is read from the right,
+// skipping hops while they are trusted proxies, so a client can't spoof its address by
+// sending the header itself. It returns "" if no address can be determined.
+func (s *Server) clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return ""
+	}
+	addr = addr.Unmap()
+
+	var hops []string
+	for _, header := range r.Header.Values("X-Forwarded-For") {
+		hops = append(hops, strings.Split(header, ",")...)
+	}
+	for i := len(hops) - 1; i >= 0 && s.isTrustedProxy(addr); i-- {
+		hop, err := netip.ParseAddr(strings.TrimSpace(hops[i]))
+		if err != nil {
+			break
+		}
+		addr = hop.Unmap()
+	}
+	return addr.String()
+}
+
+func (s *Server) isTrustedProxy(addr netip.Addr) bool {
+	for _, prefix := range s.trustedProxies {
+		if prefix.Contains(addr) {
+			return true
+		}
+	}
+	return false
+}
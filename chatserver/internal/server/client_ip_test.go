@@ -0,0 +1,71 @@
+package server
+
+import (
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	srv := &Server{trustedProxies: []netip.Prefix{
+		netip.MustParsePrefix("10.0.0.0/8"),
+		netip.MustParsePrefix("::1/128"),
+	}}
+
+	tests := []struct {
+		name       string
+		remoteAddr string
+		forwarded  []string
+		want       string
+	}{
+		{"direct client", "203.0.113.7:5000", nil, "203.0.113.7"},
+		{"untrusted peer's header is ignored", "203.0.113.7:5000", []string{"198.51.100.1"}, "203.0.113.7"},
+		{"trusted proxy", "10.0.0.2:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"spoofed leftmost hop", "10.0.0.2:5000", []string{"1.2.3.4, 198.51.100.1"}, "198.51.100.1"},
+		{"chain of trusted proxies", "10.0.0.2:5000", []string{"198.51.100.1, 10.0.0.3, 10.0.0.4"}, "198.51.100.1"},
+		{"repeated headers", "10.0.0.2:5000", []string{"1.2.3.4", "198.51.100.1, 10.0.0.3"}, "198.51.100.1"},
+		{"all hops trusted", "10.0.0.2:5000", []string{"10.0.0.3"}, "10.0.0.3"},
+		{"garbage hop stops the walk", "10.0.0.2:5000", []string{"198.51.100.1, garbage"}, "10.0.0.2"},
+		{"trusted IPv6 proxy", "[::1]:5000", []string{"2001:db8::1"}, "2001:db8::1"},
+		{"IPv4-mapped hop", "10.0.0.2:5000", []string{"::ffff:198.51.100.1"}, "198.51.100.1"},
+		{"IPv4-mapped proxy", "[::ffff:10.0.0.2]:5000", []string{"198.51.100.1"}, "198.51.100.1"},
+		{"remote address without port", "203.0.113.7", nil, "203.0.113.7"},
+		{"unparseable remote address", "pipe", nil, ""},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/", nil)
+		r.RemoteAddr = test.remoteAddr
+		for _, header := range test.forwarded {
+			r.Header.Add("X-Forwarded-For", header)
+		}
+		if got := srv.clientIP(r); got != test.want {
+			t.Errorf("%s: clientIP = %q, want %q", test.name, got, test.want)
+		}
+	}
+}
+
+func TestParsePrefix(t *testing.T) {
+	tests := []struct {
+		value   string
+		want    string
+		wantErr bool
+	}{
+		{"10.1.2.3/8", "10.0.0.0/8", false},
+		{"192.168.1.1", "192.168.1.1/32", false},
+		{"::ffff:192.168.1.1", "192.168.1.1/32", false},
+		{"fc00::/7", "fc00::/7", false},
+		{"::1", "::1/128", false},
+		{"not-an-ip", "", true},
+		{"10.0.0.0/33", "", true},
+	}
+	for _, test := range tests {
+		prefix, err := parsePrefix(test.value)
+		if (err != nil) != test.wantErr {
+			t.Errorf("parsePrefix(%q) error = %v, want error %v", test.value, err, test.wantErr)
+			continue
+		}
+		if err == nil && prefix.String() != test.want {
+			t.Errorf("parsePrefix(%q) = %s, want %s", test.value, prefix, test.want)
+		}
+	}
+}
@@ -1,19 +1,29 @@
 package server
 
 import (
+	"encoding/json"
 	"errors"
 	"log"
 	"net/http"
+	"os"
+	"strconv"
+	"strings"
 
+	"onrabble.com/chatserver/internal/auth"
 	"onrabble.com/chatserver/internal/client"
 	"onrabble.com/chatserver/internal/db"
 	"onrabble.com/chatserver/internal/messages"
+	"onrabble.com/chatserver/internal/messages/api"
 	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
 
 	"github.com/golang-jwt/jwt/v5"
 	"github.com/gorilla/websocket"
 )
 
+// maxDeviceIDLength bounds the device fingerprint a client may send; longer ones are ignored.
+const maxDeviceIDLength = 128
+
 // upgrader defines the WebSocket upgrader that allows connections from any origin.
 var upgrader = websocket.Upgrader{
 	CheckOrigin: func(r *http.Request) bool {
@@ -33,26 +43,42 @@ func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	username, userSub, clientID, err := s.parseAndValidateJWT(token)
+	identity, err := s.parseAndValidateJWT(token)
 	if err != nil {
 		log.Printf("Token validation failed: %v", err)
 		http.Error(w, "Unauthorized", http.StatusUnauthorized)
 		return
 	}
+	username, userSub, clientID := identity.Username, identity.UserID, identity.ClientID
 
 	log.Printf("%s connecting through %s", username, clientID)
 
-	banned, err := db.IsUserBanned(s.db, userSub)
+	// The device fingerprint is optional and only as trustworthy as the client sending it
+	ip := s.clientIP(r)
+	deviceID := strings.TrimSpace(r.URL.Query().Get("device_id"))
+	if len(deviceID) > maxDeviceIDLength {
+		deviceID = ""
+	}
+
+	ban, banned, err := db.FindActiveBan(s.db, userSub, ip, deviceID)
 	if err != nil {
 		http.Error(w, "Could not determine ban status for user.", http.StatusInternalServerError)
 		return
 	}
 	if banned {
-		log.Printf("User %s is banned", userSub)
-		http.Error(w, "User is banned.", http.StatusUnauthorized)
+		if ban.BanishedID != userSub {
+			log.Printf("User %s refused by ban %s on %s from %s", userSub, ban.ID, ban.BanishedID, ip)
+		} else {
+			log.Printf("User %s is banned", userSub)
+		}
+		s.rejectBanned(w, ban, ban.BanishedID == userSub)
 		return
 	}
 
+	if ip != "" {
+		s.trackAddress(userSub, username, ip, deviceID)
+	}
+
 	log.Println("User connected:", username)
 
 	// Upgrade to WebSocket Connection
@@ -64,25 +90,21 @@ func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 
 	// Create Client and Register with Hub
 	client := &client.Client{
-		Username: username,
-		Conn:     conn,
-		Send:     make(chan messages.BaseMessage, 256),
-		Hub:      s.hub,
-		Sub:      userSub,
-		ClientID: clientID,
-	}
-
-	// Notify the other clients that a new client has connected (if they did not connect through dashboard)
-	if clientID != "WebClient" {
-		newConnectionMessage := chat.NewUserStatusMessage(client.Username, client.Sub, true)
-		s.hub.SendMessage(newConnectionMessage)
+		Username:  username,
+		Conn:      conn,
+		Send:      make(chan messages.BaseMessage, 256),
+		Hub:       s.hub,
+		Sub:       userSub,
+		ClientID:  clientID,
+		ConnID:    client.NewConnectionID(),
+		Moderator: identity.HasRole(auth.RoleModerator),
 	}
 
-	// Register Client with the Hub
-	s.hub.RegisterClient(client, client.ClientID)
+	// Register Client with the Hub, which announces their presence to the other clients
+	s.hub.RegisterClient(client)
 
 	// Send the active channels and cached server messages to the client
-	if err := s.sendChannelsAndCachedMessages(conn); err != nil {
+	if err := s.sendChannelsAndCachedMessages(conn, client.Sub); err != nil {
 		http.Error(w, "Failed to initialize chat data.", http.StatusInternalServerError)
 		return
 	}
@@ -97,57 +119,141 @@ func (s *Server) handleConnection(w http.ResponseWriter, r *http.Request) {
 	go client.WritePump()
 }
 
-// parseAndValidateJWT parses and validates the JWT token and extracts the username, useerID (sub), and clientID.
-func (s *Server) parseAndValidateJWT(token string) (string, string, string, error) {
+// rejectBanned refuses a connection with a JSON description of the ban. Only the banned
+// account itself is pointed at the appeal endpoint and told how its appeal stands.
+func (s *Server) rejectBanned(w http.ResponseWriter, ban models.BanRecord, ownBan bool) {
+	payload := api.BannedPayload{BanID: ban.ID, EndTime: ban.End}
+	if ban.Reason != nil {
+		payload.Reason = *ban.Reason
+	}
+	if ownBan {
+		payload.AppealURL = banAppealURL()
+		if id, err := strconv.Atoi(ban.ID); err == nil {
+			appeal, found, err := db.FindAppealByBan(s.db, id)
+			if err != nil {
+				log.Printf("Failed to look up appeal of ban %d: %v", id, err)
+			} else if found {
+				payload.AppealStatus = appeal.Status
+			}
+		}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusUnauthorized)
+	json.NewEncoder(w).Encode(api.NewBannedMessage(payload))
+}
+
+// banAppealURL is where banned users are sent to appeal: BAN_APPEAL_URL, or the appeals
+// endpoint when unset.
+func banAppealURL() string {
+	if url := os.Getenv("BAN_APPEAL_URL"); url != "" {
+		return url
+	}
+	return "/appeals"
+}
+
+// trackAddress records where a user connected from and flags them for moderator review if
+// they look like a banned user on a new account. Failures are logged and don't block the
+// connection.
+func (s *Server) trackAddress(userID, username, ip, deviceID string) {
+	evasions, err := db.DetectBanEvasion(s.db, userID, username, ip, deviceID)
+	if err != nil {
+		log.Printf("Failed to check %s for ban evasion: %v", username, err)
+	}
+	for _, evasion := range evasions {
+		log.Printf("Possible ban evasion: %s connected from an address or device of %s (ban %d)",
+			username, evasion.BanishedID, evasion.BanID)
+	}
+
+	if err := db.RecordUserAddress(s.db, userID, ip, deviceID); err != nil {
+		log.Printf("Failed to record address of %s: %v", username, err)
+	}
+}
+
+// parseAndValidateJWT parses and validates the JWT token and extracts the username, useerID (sub),
+// clientID and realm roles.
+func (s *Server) parseAndValidateJWT(token string) (auth.Identity, error) {
 	parsedToken, err := jwt.Parse(token, s.jwkKeyFunc)
 	if err != nil || parsedToken == nil || !parsedToken.Valid {
-		return "", "", "", errors.New("invalid token")
+		return auth.Identity{}, errors.New("invalid token")
 	}
 
 	claims, ok := parsedToken.Claims.(jwt.MapClaims)
 	if !ok {
-		return "", "", "", errors.New("invalid token claims")
+		return auth.Identity{}, errors.New("invalid token claims")
 	}
 
 	username, ok := claims["preferred_username"].(string)
 	if !ok {
-		return "", "", "", errors.New("username missing from token")
+		return auth.Identity{}, errors.New("username missing from token")
 	}
 
 	sub, ok := claims["sub"].(string)
 	if !ok {
-		return "", "", "", errors.New("sub missing from token")
+		return auth.Identity{}, errors.New("sub missing from token")
 	}
 
 	clientID, ok := claims["azp"].(string)
 	if !ok {
-		return "", "", "", errors.New("client ID missing from token")
+		return auth.Identity{}, errors.New("client ID missing from token")
+	}
+
+	// Realm roles are optional; tokens without them simply carry no roles
+	var roles []string
+	if realmAccess, ok := claims["realm_access"].(map[string]interface{}); ok {
+		if rawRoles, ok := realmAccess["roles"].([]interface{}); ok {
+			for _, role := range rawRoles {
+				if name, ok := role.(string); ok {
+					roles = append(roles, name)
+				}
+			}
+		}
 	}
 
-	return username, sub, clientID, nil
+	return auth.Identity{Username: username, UserID: sub, ClientID: clientID, Roles: roles}, nil
 }
 
-// sendChannelsAndCachedMessages sends cached chat messages and active channel list to the connected client.
-func (s *Server) sendChannelsAndCachedMessages(conn *websocket.Conn) error {
-	// Send cached chat messages
-	cachedMessages := s.hub.GetCachedChatMessages()
+// sendChannelsAndCachedMessages sends the most recent cached messages of each active channel
+// and the active channel list, with the user's unread counts, to the connected client.
+func (s *Server) sendChannelsAndCachedMessages(conn *websocket.Conn, userID string) error {
+	// Fetch channels
+	channels, err := db.FetchChannels(s.db)
+	if err != nil {
+		log.Println("Failed to load channels from database:", err)
+		return err
+	}
+
+	// Send the last messages of every channel the client will see
+	var cachedMessages []models.ChatMessage
+	for _, channel := range channels {
+		cachedMessages = append(cachedMessages, s.hub.GetCachedChatMessages(channel.Name, 0)...)
+	}
 	if len(cachedMessages) > 0 {
 		bulkMessage := chat.NewBulkChatMessages(cachedMessages)
 		if err := conn.WriteJSON(bulkMessage); err != nil {
 			log.Printf("Failed to send bulk chat messages: %v", err)
 		} else {
-			log.Printf("Sent %d cached messages to client", len(cachedMessages))
+			log.Printf("Sent %d cached messages across %d channels to client", len(cachedMessages), len(channels))
 		}
 	}
 
-	// Fetch and send channels
-	channels, err := db.FetchChannels(s.db)
+	categories, err := db.FetchChannelCategories(s.db)
 	if err != nil {
-		log.Println("Failed to load channels from database:", err)
-		return err
+		log.Printf("Failed to load channel categories: %v", err)
+	}
+
+	pins, err := s.MessageCache.FetchChannelPins(0)
+	if err != nil {
+		log.Printf("Failed to load pinned messages: %v", err)
+	}
+
+	unreadChannels, unreadPrivate := s.hub.GetUnreadCounts(userID)
+	for i := range channels {
+		channels[i].UnreadCount = unreadChannels[channels[i].Name]
+		channels[i].Pins = pins[channels[i].ID]
 	}
 
-	newActiveChannnelsMessage := chat.NewActiveChannelsMessage(channels)
+	newActiveChannnelsMessage := chat.NewActiveChannelsMessage(channels, categories, unreadPrivate)
 	if err := conn.WriteJSON(newActiveChannnelsMessage); err != nil {
 		log.Printf("Failed to send channels to client: %v", err)
 		return err
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/auth"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxAppealLength caps the text of an appeal, in characters.
+const maxAppealLength = 2000
+
+// HandleAppeals files an appeal against the caller's ban on POST and lists appeals newest
+// first on GET. The JSON body's 'ban_id' picks the ban, defaulting to the caller's active
+// one, and 'message' explains the appeal. Moderators list every appeal, filtered by
+// 'status' (pending by default, or all); other users list their own.
+func HandleAppeals(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				BanID   int    `json:"ban_id"`
+				Message string `json:"message"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			body.Message = strings.TrimSpace(body.Message)
+			if body.Message == "" || utf8.RuneCountInString(body.Message) > maxAppealLength {
+				http.Error(w, "'message' must be between 1 and 2000 characters", http.StatusBadRequest)
+				return
+			}
+
+			var ban models.BanRecord
+			var found bool
+			var err error
+			if body.BanID > 0 {
+				ban, found, err = database.FindBan(db, body.BanID)
+			} else {
+				ban, found, err = database.FindActiveBan(db, identity.UserID, "", "")
+			}
+			if err != nil {
+				log.Printf("Failed to look up ban for appeal by %s: %v", identity.Username, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			// Other users' bans are reported as missing rather than forbidden
+			if !found || ban.BanishedID != identity.UserID {
+				http.Error(w, "Ban not found", http.StatusNotFound)
+				return
+			}
+			if ban.Pardoned || (ban.End != nil && ban.End.Before(time.Now())) {
+				http.Error(w, "Ban is no longer in effect", http.StatusConflict)
+				return
+			}
+
+			banID, _ := strconv.Atoi(ban.ID)
+			appeal, created, err := database.SaveAppeal(db, models.Appeal{
+				BanID:    banID,
+				UserID:   identity.UserID,
+				Username: identity.Username,
+				Message:  body.Message,
+			})
+			if err != nil {
+				log.Printf("Failed to save appeal by %s: %v", identity.Username, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !created {
+				http.Error(w, "Ban was already appealed", http.StatusConflict)
+				return
+			}
+			log.Printf("%s appealed ban %d", identity.Username, banID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(appeal)
+
+		case http.MethodGet:
+			userID, status := identity.UserID, ""
+			if identity.HasRole(auth.RoleModerator) {
+				userID = ""
+				switch status = r.URL.Query().Get("status"); status {
+				case "":
+					status = models.AppealPending
+				case "all":
+					status = ""
+				case models.AppealPending, models.AppealApproved, models.AppealDenied, models.AppealExpired:
+				default:
+					http.Error(w, "Invalid 'status' query parameter", http.StatusBadRequest)
+					return
+				}
+			}
+
+			page, err := parsePageRequest(r, 50)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			appeals, info, err := database.FetchAppeals(db, userID, status, page)
+			if err != nil {
+				log.Printf("Failed to fetch appeals: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(api.NewAppealsResultMessage(appeals, info.HasMore, info.NextCursor, info.PrevCursor))
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleAppeal decides the pending appeal whose ID is given in the path. The JSON body's
+// 'status' is "approved", which pardons the ban, or "denied", with an optional 'note' for
+// the appellant. Moderators only.
+func HandleAppeal(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid appeal ID", http.StatusBadRequest)
+			return
+		}
+
+		var body struct {
+			Status string `json:"status"`
+			Note   string `json:"note"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.Status != models.AppealApproved && body.Status != models.AppealDenied {
+			http.Error(w, "'status' must be approved or denied", http.StatusBadRequest)
+			return
+		}
+
+		appeal, decided, err := database.DecideAppeal(db, id, identity.UserID, body.Status, strings.TrimSpace(body.Note))
+		if err != nil {
+			log.Printf("Failed to decide appeal %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !decided {
+			http.Error(w, "Appeal not found or already decided", http.StatusConflict)
+			return
+		}
+		log.Printf("%s %s appeal %d against ban %d", identity.Username, body.Status, id, appeal.BanID)
+		recordAudit(db, r, models.AuditAppealDecide, strconv.Itoa(id), map[string]interface{}{
+			"ban_id": appeal.BanID, "status": body.Status,
+		})
+		if body.Status == models.AppealApproved {
+			recordAudit(db, r, models.AuditUserPardon, strconv.Itoa(appeal.BanID), map[string]int{"appeal_id": id})
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(appeal)
+	}
+}
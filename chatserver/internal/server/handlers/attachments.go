@@ -0,0 +1,328 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+
+	"onrabble.com/chatserver/internal/auth"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/media"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+	"onrabble.com/chatserver/internal/storage"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+const (
+	// defaultMaxAttachmentSize is the largest upload accepted when no limit is configured.
+	defaultMaxAttachmentSize = 10 << 20
+
+	// downloadURLLifetime is how long signed download URLs stay valid.
+	downloadURLLifetime = 15 * time.Minute
+
+	variantOriginal  = "original"
+	variantThumbnail = "thumbnail"
+)
+
+// HandleUploadAttachment stores the file sent in the 'file' field of a multipart POST and
+// returns its attachment record. The file's type is sniffed from its contents and images
+// get a thumbnail. The attachment stays private to the uploader until it is sent with a
+// message by listing its ID in the message's 'attachments'.
+func HandleUploadAttachment(db *pgxpool.Pool, store storage.Store, maxSize int64) http.HandlerFunc {
+	if maxSize <= 0 {
+		maxSize = defaultMaxAttachmentSize
+	}
+
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		// Leave room for the multipart framing around the file
+		r.Body = http.MaxBytesReader(w, r.Body, maxSize+64<<10)
+		reader, err := r.MultipartReader()
+		if err != nil {
+			http.Error(w, "Expected a multipart/form-data body", http.StatusBadRequest)
+			return
+		}
+
+		var filename string
+		var data []byte
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			if part.FormName() != "file" {
+				part.Close()
+				continue
+			}
+
+			filename = part.FileName()
+			data, err = io.ReadAll(io.LimitReader(part, maxSize+1))
+			part.Close()
+			if err != nil {
+				uploadError(w, err)
+				return
+			}
+			break
+		}
+
+		if len(data) == 0 {
+			http.Error(w, "A non-empty 'file' field is required", http.StatusBadRequest)
+			return
+		}
+		if int64(len(data)) > maxSize {
+			http.Error(w, "File exceeds the maximum size of "+strconv.FormatInt(maxSize, 10)+" bytes", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		contentType, ok := media.Sniff(data)
+		if !ok {
+			http.Error(w, "Files of type "+contentType+" are not accepted", http.StatusUnsupportedMediaType)
+			return
+		}
+
+		id := uuid.NewString()
+		attachment := models.Attachment{
+			ID:          id,
+			OwnerID:     identity.UserID,
+			Filename:    cleanFilename(filename),
+			ContentType: contentType,
+			Size:        int64(len(data)),
+			CreatedAt:   time.Now(),
+			StorageKey:  "attachments/" + id,
+		}
+
+		if err := store.Put(r.Context(), attachment.StorageKey, data, contentType); err != nil {
+			log.Printf("Failed to store attachment %s: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		if media.IsImage(contentType) {
+			attachment.Width, attachment.Height, _ = media.Dimensions(data)
+			if thumbnail, err := media.Thumbnail(data); err != nil {
+				log.Printf("No thumbnail for attachment %s: %v", id, err)
+			} else if err := store.Put(r.Context(), "thumbnails/"+id+".jpg", thumbnail, "image/jpeg"); err != nil {
+				log.Printf("Failed to store thumbnail for attachment %s: %v", id, err)
+			} else {
+				attachment.ThumbnailKey = "thumbnails/" + id + ".jpg"
+				attachment.HasThumbnail = true
+			}
+		}
+
+		if err := database.SaveAttachment(db, attachment); err != nil {
+			log.Printf("Failed to save attachment %s: %v", id, err)
+			deleteBlobs(r, store, attachment)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		log.Printf("%s uploaded attachment %s (%s, %d bytes)", identity.Username, id, contentType, attachment.Size)
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(attachment)
+	}
+}
+
+// uploadError reports a failure to read an upload, distinguishing bodies over the limit.
+func uploadError(w http.ResponseWriter, err error) {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "Request body too large", http.StatusRequestEntityTooLarge)
+		return
+	}
+	http.Error(w, "Invalid multipart body", http.StatusBadRequest)
+}
+
+// deleteBlobs removes an attachment's stored files after a failed upload.
+func deleteBlobs(r *http.Request, store storage.Store, attachment models.Attachment) {
+	for _, key := range []string{attachment.StorageKey, attachment.ThumbnailKey} {
+		if key == "" {
+			continue
+		}
+		if err := store.Delete(r.Context(), key); err != nil {
+			log.Printf("Failed to delete %s: %v", key, err)
+		}
+	}
+}
+
+// cleanFilename keeps the base name of an uploaded file, without control characters and
+// at most 255 bytes long.
+func cleanFilename(name string) string {
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name)
+	name = strings.TrimSpace(name)
+	for len(name) > 255 {
+		_, size := utf8.DecodeLastRuneInString(name)
+		name = name[:len(name)-size]
+	}
+	if name == "" || name == "." || name == "/" {
+		return "file"
+	}
+	return name
+}
+
+// HandleAttachment returns the attachment whose ID is given in the path together with
+// short-lived signed URLs for downloading it. Attachments the caller may not see are
+// reported as not found.
+func HandleAttachment(db *pgxpool.Pool, signer *storage.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		id := r.PathValue("id")
+		if uuid.Validate(id) != nil {
+			http.Error(w, "Invalid attachment ID", http.StatusBadRequest)
+			return
+		}
+
+		attachment, found, err := database.FindAttachment(db, id)
+		if err != nil {
+			log.Printf("Failed to look up attachment %s: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found || !attachment.VisibleTo(identity.UserID) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+
+		expires := time.Now().Add(downloadURLLifetime).Truncate(time.Second)
+		result := api.AttachmentResultPayload{
+			Attachment: attachment,
+			URL:        signedURL(signer, id, variantOriginal, expires),
+			ExpiresAt:  expires,
+		}
+		if attachment.HasThumbnail {
+			result.ThumbnailURL = signedURL(signer, id, variantThumbnail, expires)
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewAttachmentResultMessage(result).Payload)
+	}
+}
+
+// signedURL builds the path of a download URL valid until expires.
+func signedURL(signer *storage.URLSigner, id, variant string, expires time.Time) string {
+	query := url.Values{}
+	query.Set("variant", variant)
+	query.Set("expires", strconv.FormatInt(expires.Unix(), 10))
+	query.Set("signature", signer.Sign(id, variant, expires))
+	return "/attachments/" + id + "/content?" + query.Encode()
+}
+
+// HandleAttachmentContent serves an attachment's file, or its thumbnail when 'variant' is
+// "thumbnail". Access is granted by the signature from HandleAttachment rather than a
+// bearer token, so the URL can be used directly by the browser.
+func HandleAttachmentContent(db *pgxpool.Pool, store storage.Store, signer *storage.URLSigner) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet && r.Method != http.MethodHead {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		id := r.PathValue("id")
+		query := r.URL.Query()
+		variant := query.Get("variant")
+		if variant == "" {
+			variant = variantOriginal
+		}
+		unix, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+		if err != nil || !signer.Verify(id, variant, time.Unix(unix, 0), query.Get("signature")) {
+			http.Error(w, "Invalid or expired link", http.StatusForbidden)
+			return
+		}
+
+		attachment, found, err := database.FindAttachment(db, id)
+		if err != nil {
+			log.Printf("Failed to look up attachment %s: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+
+		key, contentType := attachment.StorageKey, attachment.ContentType
+		if variant == variantThumbnail {
+			if !attachment.HasThumbnail {
+				http.Error(w, "Attachment has no thumbnail", http.StatusNotFound)
+				return
+			}
+			key, contentType = attachment.ThumbnailKey, "image/jpeg"
+		} else if variant != variantOriginal {
+			http.Error(w, "Unknown variant", http.StatusBadRequest)
+			return
+		}
+
+		body, err := store.Get(r.Context(), key)
+		if errors.Is(err, storage.ErrNotFound) {
+			http.Error(w, "Attachment not found", http.StatusNotFound)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to read attachment %s: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		defer body.Close()
+
+		disposition := "attachment"
+		if media.Inline(contentType) {
+			disposition = "inline"
+		}
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Disposition", disposition+"; filename*=UTF-8''"+url.PathEscape(attachment.Filename))
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; sandbox")
+		w.Header().Set("Cache-Control", "private, max-age="+strconv.Itoa(int(downloadURLLifetime.Seconds())))
+		if variant == variantOriginal {
+			w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+		}
+		if r.Method == http.MethodHead {
+			return
+		}
+		if _, err := io.Copy(w, body); err != nil {
+			log.Printf("Failed to send attachment %s: %v", id, err)
+		}
+	}
+}
@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"onrabble.com/chatserver/internal/auth"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// recordAudit logs an administrative change made by the request's caller, who is unknown
+// when the request carried no bearer token. The change is already made, so a failure to
+// record it is only logged.
+func recordAudit(db *pgxpool.Pool, r *http.Request, action, target string, details any) {
+	entry := models.AuditEntry{Action: action, Target: target}
+	if identity, ok := auth.FromContext(r.Context()); ok {
+		entry.ActorID, entry.ActorUsername, entry.ClientID = identity.UserID, identity.Username, identity.ClientID
+	}
+	if err := database.RecordAudit(db, entry, details); err != nil {
+		log.Printf("Failed to record audit entry: %v", err)
+	}
+}
+
+// HandleAuditLog lists administrative changes newest first, optionally filtered by
+// 'actor_id', 'action' and 'target'. Moderators only.
+func HandleAuditLog(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		query := r.URL.Query()
+		entries, info, err := database.FetchAuditLog(db, query.Get("actor_id"), query.Get("action"), query.Get("target"), page)
+		if err != nil {
+			log.Printf("Failed to fetch audit log: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewAuditLogResultMessage(entries, info.HasMore, info.NextCursor, info.PrevCursor))
+	}
+}
@@ -0,0 +1,345 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/automod"
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/interfaces"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// moderatorIdentity returns the caller's identity, answering 401 or 403 and returning
+// false unless the caller is a moderator.
+func moderatorIdentity(w http.ResponseWriter, r *http.Request) (auth.Identity, bool) {
+	identity, ok := auth.FromContext(r.Context())
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return identity, false
+	}
+	if !identity.HasRole(auth.RoleModerator) {
+		http.Error(w, "Forbidden", http.StatusForbidden)
+		return identity, false
+	}
+	return identity, true
+}
+
+// reloadAutomod applies a rule or mute change to the hub. The change is already stored,
+// so a failure only delays it until the next successful reload.
+func reloadAutomod(hub interfaces.HubInterface) {
+	if err := hub.ReloadAutomod(); err != nil {
+		log.Printf("Failed to reload automod: %v", err)
+	}
+}
+
+// HandleAutomodRules lists the automod rules on GET and creates one from the JSON body on
+// POST. Moderators only.
+func HandleAutomodRules(db *pgxpool.Pool, hub interfaces.HubInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			rules, err := database.FetchAutomodRules(db)
+			if err != nil {
+				log.Printf("Failed to fetch automod rules: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(api.NewAutomodRulesResultMessage(rules))
+
+		case http.MethodPost:
+			rule := models.AutomodRule{Enabled: true}
+			if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			if err := automod.Validate(&rule); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+			rule.CreatedBy = identity.UserID
+
+			created, err := database.CreateAutomodRule(db, rule)
+			if err != nil {
+				log.Printf("Failed to create automod rule: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			reloadAutomod(hub)
+			log.Printf("%s created automod rule %d (%s)", identity.Username, created.ID, created.Name)
+			recordAudit(db, r, models.AuditAutomodRuleCreate, strconv.Itoa(created.ID), created)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(created)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleAutomodRule reads, updates or deletes the automod rule whose ID is given in the
+// path. PATCH only changes the fields present in the JSON body. Moderators only.
+func HandleAutomodRule(db *pgxpool.Pool, hub interfaces.HubInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid rule ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet, http.MethodPatch:
+			rule, found, err := database.FindAutomodRule(db, id)
+			if err != nil {
+				log.Printf("Failed to look up automod rule %d: %v", id, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !found {
+				http.Error(w, "Rule not found", http.StatusNotFound)
+				return
+			}
+
+			if r.Method == http.MethodPatch {
+				// Decoding over the stored rule leaves absent fields unchanged
+				if err := json.NewDecoder(r.Body).Decode(&rule); err != nil {
+					http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+					return
+				}
+				rule.ID = id
+				if err := automod.Validate(&rule); err != nil {
+					http.Error(w, err.Error(), http.StatusBadRequest)
+					return
+				}
+
+				rule, found, err = database.UpdateAutomodRule(db, rule)
+				if err != nil {
+					log.Printf("Failed to update automod rule %d: %v", id, err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				if !found {
+					http.Error(w, "Rule not found", http.StatusNotFound)
+					return
+				}
+				reloadAutomod(hub)
+				log.Printf("%s updated automod rule %d", identity.Username, id)
+				recordAudit(db, r, models.AuditAutomodRuleUpdate, strconv.Itoa(id), rule)
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(rule)
+
+		case http.MethodDelete:
+			deleted, err := database.DeleteAutomodRule(db, id)
+			if err != nil {
+				log.Printf("Failed to delete automod rule %d: %v", id, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !deleted {
+				http.Error(w, "Rule not found", http.StatusNotFound)
+				return
+			}
+			reloadAutomod(hub)
+			log.Printf("%s deleted automod rule %d", identity.Username, id)
+			recordAudit(db, r, models.AuditAutomodRuleDelete, strconv.Itoa(id), nil)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleAutomodFlags lists flagged messages, newest first. 'status' selects pending
+// (default), approved, removed or all flags. Moderators only.
+func HandleAutomodFlags(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "":
+			status = models.FlagPending
+		case "all":
+			status = ""
+		case models.FlagPending, models.FlagApproved, models.FlagRemoved:
+		default:
+			http.Error(w, "Invalid 'status' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		flags, info, err := database.FetchAutomodFlags(db, status, page)
+		if err != nil {
+			log.Printf("Failed to fetch automod flags: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewAutomodFlagsResultMessage(flags, info.HasMore, info.NextCursor, info.PrevCursor))
+	}
+}
+
+// HandleAutomodFlag reviews the pending flag whose ID is given in the path. The JSON body's
+// 'status' is "approved" to leave the message in place or "removed" to delete it.
+// Moderators only.
+func HandleAutomodFlag(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid flag ID", http.StatusBadRequest)
+			return
+		}
+
+		var body struct {
+			Status string `json:"status"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+		if body.Status != models.FlagApproved && body.Status != models.FlagRemoved {
+			http.Error(w, "'status' must be approved or removed", http.StatusBadRequest)
+			return
+		}
+
+		flag, found, err := database.FindAutomodFlag(db, id)
+		if err != nil {
+			log.Printf("Failed to look up automod flag %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Flag not found", http.StatusNotFound)
+			return
+		}
+		if flag.Status != models.FlagPending {
+			http.Error(w, "Flag was already reviewed", http.StatusConflict)
+			return
+		}
+
+		if body.Status == models.FlagRemoved {
+			if err := removeMessage(db, cache, flag.Target, flag.CacheID, flag.OwnerID, flag.RecipientID); err != nil {
+				log.Printf("Failed to remove flagged message %d: %v", flag.CacheID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+		}
+
+		flag, found, err = database.ReviewAutomodFlag(db, id, body.Status, identity.UserID)
+		if err != nil {
+			log.Printf("Failed to review automod flag %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Flag was already reviewed", http.StatusConflict)
+			return
+		}
+		log.Printf("%s marked automod flag %d as %s", identity.Username, id, body.Status)
+		recordAudit(db, r, models.AuditAutomodFlagReview, strconv.Itoa(id), map[string]interface{}{
+			"status": body.Status, "owner_id": flag.OwnerID, "cache_id": flag.CacheID,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(flag)
+	}
+}
+
+// HandleAutomodMutes lists the users automod has muted. Moderators only.
+func HandleAutomodMutes(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		mutes, err := database.FetchActiveMutes(db)
+		if err != nil {
+			log.Printf("Failed to fetch mutes: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewAutomodMutesResultMessage(mutes))
+	}
+}
+
+// HandleAutomodMute lifts the mute of the user whose ID is given in the path on DELETE.
+// Moderators only.
+func HandleAutomodMute(db *pgxpool.Pool, hub interfaces.HubInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		userID := r.PathValue("userID")
+		unmuted, err := database.UnmuteUser(db, userID)
+		if err != nil {
+			log.Printf("Failed to unmute %s: %v", userID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !unmuted {
+			http.Error(w, "User is not muted", http.StatusNotFound)
+			return
+		}
+		reloadAutomod(hub)
+		log.Printf("%s unmuted %s", identity.Username, userID)
+		recordAudit(db, r, models.AuditUserUnmute, userID, nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// maxCategoryName matches the length of channel_categories.name.
+const maxCategoryName = 32
+
+// validCategoryName trims a category name and reports whether it fits.
+func validCategoryName(name string) (string, bool) {
+	name = strings.TrimSpace(name)
+	return name, name != "" && utf8.RuneCountInString(name) <= maxCategoryName
+}
+
+// HandleChannelCategories lists channel categories in display order, each with its
+// channels' IDs, and creates one after the others with POST.
+func HandleChannelCategories(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet:
+			categories, err := database.FetchChannelCategories(db)
+			if err != nil {
+				log.Printf("Failed to fetch channel categories: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string][]models.ChannelCategory{"categories": categories})
+
+		case http.MethodPost:
+			var request struct {
+				Name      string `json:"name"`
+				Collapsed bool   `json:"collapsed"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
+				return
+			}
+			name, ok := validCategoryName(request.Name)
+			if !ok {
+				http.Error(w, "Category name must be between 1 and 32 characters", http.StatusBadRequest)
+				return
+			}
+
+			category, err := database.CreateChannelCategory(db, name, request.Collapsed)
+			if errors.Is(err, database.ErrCategoryExists) {
+				http.Error(w, "Category already exists", http.StatusConflict)
+				return
+			}
+			if err != nil {
+				log.Printf("Failed to create channel category: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			log.Printf("Channel category '%s' created", category.Name)
+			recordAudit(db, r, models.AuditCategoryCreate, strconv.Itoa(category.ID), map[string]interface{}{
+				"name":      category.Name,
+				"collapsed": category.Collapsed,
+			})
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(category)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleChannelCategory renames, collapses or moves the category whose ID is given in the
+// path with PATCH, and deletes it with DELETE. Its channels then join the uncategorized ones.
+func HandleChannelCategory(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid category ID", http.StatusBadRequest)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPatch:
+			var request struct {
+				Name      *string `json:"name,omitempty"`
+				Collapsed *bool   `json:"collapsed,omitempty"`
+				BeforeID  *int    `json:"before_id,omitempty"` // Category to move in front of; 0 for the end
+			}
+			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+				http.Error(w, "Invalid JSON request body", http.StatusBadRequest)
+				return
+			}
+			if request.Name == nil && request.Collapsed == nil && request.BeforeID == nil {
+				http.Error(w, "Nothing to update", http.StatusBadRequest)
+				return
+			}
+			if request.Name != nil {
+				name, ok := validCategoryName(*request.Name)
+				if !ok {
+					http.Error(w, "Category name must be between 1 and 32 characters", http.StatusBadRequest)
+					return
+				}
+				request.Name = &name
+			}
+
+			if request.Name != nil || request.Collapsed != nil {
+				err = database.UpdateChannelCategory(db, id, request.Name, request.Collapsed)
+				if !categoryChanged(w, err) {
+					return
+				}
+				recordAudit(db, r, models.AuditCategoryUpdate, strconv.Itoa(id), map[string]interface{}{
+					"name":      request.Name,
+					"collapsed": request.Collapsed,
+				})
+			}
+			if request.BeforeID != nil {
+				err = database.MoveChannelCategory(db, id, *request.BeforeID)
+				if !categoryChanged(w, err) {
+					return
+				}
+				recordAudit(db, r, models.AuditCategoryMove, strconv.Itoa(id), map[string]int{"before_id": *request.BeforeID})
+			}
+
+			log.Printf("Channel category %d updated", id)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Category updated"})
+
+		case http.MethodDelete:
+			if !categoryChanged(w, database.RemoveChannelCategory(db, id)) {
+				return
+			}
+
+			log.Printf("Channel category %d deleted", id)
+			recordAudit(db, r, models.AuditCategoryDelete, strconv.Itoa(id), nil)
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(map[string]string{"message": "Category deleted"})
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// categoryChanged reports whether a category change succeeded, and otherwise writes the
+// error response.
+func categoryChanged(w http.ResponseWriter, err error) bool {
+	switch {
+	case err == nil:
+		return true
+	case errors.Is(err, database.ErrCategoryNotFound):
+		http.Error(w, "Category not found", http.StatusNotFound)
+	case errors.Is(err, database.ErrCategoryExists):
+		http.Error(w, "Category already exists", http.StatusConflict)
+	default:
+		log.Printf("Failed to change channel category: %v", err)
+		http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+	}
+	return false
+}
@@ -2,19 +2,24 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"log"
 	"net/http"
 	"strconv"
 	"strings"
 
+	"onrabble.com/chatserver/internal/cache"
+	"onrabble.com/chatserver/internal/channelarchive"
 	database "onrabble.com/chatserver/internal/db"
 	"onrabble.com/chatserver/internal/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
-// HandleChannels handles creating and fetching channels.
-func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
+// HandleChannels handles creating, fetching, updating and moving channels. Channels are
+// listed with the category tree they are shown in.
+func HandleChannels(db *pgxpool.Pool, messageCache *cache.MessageCache) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodGet:
@@ -25,14 +30,22 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 				return
 			}
 
+			categories, err := database.FetchChannelCategories(db)
+			if err != nil {
+				log.Println("Failed to load channel categories from database:", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
 			w.Header().Set("Content-Type", "application/json")
-			response := map[string][]models.Channel{"channels": channels}
+			response := map[string]interface{}{"channels": channels, "categories": categories}
 			json.NewEncoder(w).Encode(response)
 
 		case http.MethodPost:
 			var request struct {
 				Name        string `json:"name"`
 				Description string `json:"description"`
+				CategoryID  int    `json:"category_id"` // Category to add the channel to; 0 for none
 			}
 
 			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -45,7 +58,11 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 				return
 			}
 
-			err := database.CreateChannel(db, request.Name, request.Description)
+			err := database.CreateChannel(db, request.Name, request.Description, request.CategoryID)
+			if errors.Is(err, database.ErrCategoryNotFound) {
+				http.Error(w, "Category not found", http.StatusBadRequest)
+				return
+			}
 			if err != nil {
 				log.Println("Failed to create channel:", err)
 				http.Error(w, "Failed to create channel", http.StatusInternalServerError)
@@ -53,6 +70,7 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 			}
 
 			log.Printf("Channel '%s' created successfully", request.Name)
+			recordAudit(db, r, models.AuditChannelCreate, request.Name, map[string]string{"description": request.Description})
 			w.WriteHeader(http.StatusCreated)
 			json.NewEncoder(w).Encode(map[string]string{"message": "Channel created", "name": request.Name})
 
@@ -61,7 +79,9 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 				ID          *int    `json:"id"`
 				Name        *string `json:"name,omitempty"`
 				Description *string `json:"description,omitempty"`
-				BeforeID    *int    `json:"before_id,omitempty"` // New field for sorting
+				Language    *string `json:"search_language,omitempty"` // Text search configuration, e.g. "english"
+				BeforeID    *int    `json:"before_id,omitempty"`       // Channel to move in front of; 0 for the end of the category
+				CategoryID  *int    `json:"category_id,omitempty"`     // Category to move the channel into; 0 for none
 			}
 
 			if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
@@ -74,33 +94,83 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 				return
 			}
 
-			// If BeforeID is provided, perform a reorder operation
-			if request.BeforeID != nil {
-				if err := database.MoveChannelBefore(db, *request.ID, request.BeforeID); err != nil {
+			// If BeforeID or CategoryID is provided, move the channel
+			if request.BeforeID != nil || request.CategoryID != nil {
+				beforeID := 0
+				if request.BeforeID != nil {
+					beforeID = *request.BeforeID
+				}
+
+				err := database.MoveChannel(db, *request.ID, request.CategoryID, beforeID)
+				switch {
+				case errors.Is(err, database.ErrChannelNotFound):
+					http.Error(w, "Channel not found", http.StatusNotFound)
+					return
+				case errors.Is(err, database.ErrCategoryNotFound):
+					http.Error(w, "Category not found", http.StatusNotFound)
+					return
+				case errors.Is(err, database.ErrCategoryMismatch):
+					http.Error(w, "'before_id' is in another category than 'category_id'", http.StatusBadRequest)
+					return
+				case err != nil:
 					log.Println("Failed to reorder channel:", err)
 					http.Error(w, "Failed to reorder channel", http.StatusInternalServerError)
 					return
 				}
 
-				log.Printf("Channel ID '%d' moved before ID '%d'", *request.ID, *request.BeforeID)
+				log.Printf("Channel ID '%d' moved before ID '%d'", *request.ID, beforeID)
+				recordAudit(db, r, models.AuditChannelReorder, strconv.Itoa(*request.ID), map[string]*int{
+					"before_id":   request.BeforeID,
+					"category_id": request.CategoryID,
+				})
 				w.WriteHeader(http.StatusOK)
 				json.NewEncoder(w).Encode(map[string]string{"message": "Channel reordered"})
 				return
 			}
 
 			// Otherwise, perform a regular update
-			if request.Name == nil && request.Description == nil {
+			if request.Name == nil && request.Description == nil && request.Language == nil {
 				http.Error(w, "Nothing to update", http.StatusBadRequest)
 				return
 			}
 
-			if err := database.UpdateChannel(db, *request.ID, request.Name, request.Description); err != nil {
+			var previous models.Channel
+			if request.Name != nil {
+				channel, found, err := database.FindChannel(db, *request.ID)
+				if err != nil {
+					log.Println("Failed to look up channel:", err)
+					http.Error(w, "Failed to update channel", http.StatusInternalServerError)
+					return
+				}
+				if !found {
+					http.Error(w, "Channel not found", http.StatusNotFound)
+					return
+				}
+				previous = channel
+			}
+
+			err := database.UpdateChannel(db, *request.ID, request.Name, request.Description, request.Language)
+			if errors.Is(err, database.ErrUnknownLanguage) {
+				http.Error(w, "Unknown search language", http.StatusBadRequest)
+				return
+			}
+			if err != nil {
 				log.Println("Failed to update channel:", err)
 				http.Error(w, "Failed to update channel", http.StatusInternalServerError)
 				return
 			}
 
+			// Stored messages keep the old name, so its history ring would never be read again
+			if request.Name != nil && *request.Name != previous.Name {
+				messageCache.DropChannelHistory(previous.Name)
+			}
+
 			log.Printf("Channel ID '%d' updated successfully", *request.ID)
+			recordAudit(db, r, models.AuditChannelUpdate, strconv.Itoa(*request.ID), map[string]*string{
+				"name":            request.Name,
+				"description":     request.Description,
+				"search_language": request.Language,
+			})
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"message": "Channel updated"})
 
@@ -131,6 +201,7 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 			}
 
 			log.Printf("Channel ID '%d' deleted successfully (purge: %v)", id, purge)
+			recordAudit(db, r, models.AuditChannelDelete, idParam, map[string]bool{"purge": purge})
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"message": "Channel deleted"})
 
@@ -139,3 +210,133 @@ func HandleChannels(db *pgxpool.Pool) http.HandlerFunc {
 		}
 	}
 }
+
+// maxArchiveSize caps an uploaded channel archive, in bytes.
+const maxArchiveSize = 1 << 30
+
+// HandleChannelArchive streams the channel whose ID is given in the path, with all its
+// messages, as a JSON Lines archive. Moderators only.
+func HandleChannelArchive(db *pgxpool.Pool, messageCache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+			return
+		}
+
+		channel, found, err := database.FindChannel(db, id)
+		if err != nil {
+			log.Printf("Failed to look up channel %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Channel not found", http.StatusNotFound)
+			return
+		}
+
+		// Include messages that are still only cached
+		messageCache.FlushCacheToDB()
+
+		w.Header().Set("Content-Type", "application/x-ndjson")
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", channel.Name+".jsonl"))
+		count, err := channelarchive.Export(db, channel, w)
+		recordAudit(db, r, models.AuditChannelExport, strconv.Itoa(channel.ID), map[string]interface{}{
+			"name": channel.Name, "messages": count, "complete": err == nil,
+		})
+		if err != nil {
+			// The response has started, so the client only sees an archive without an end record
+			log.Printf("Failed to export channel %s after %d messages: %v", channel.Name, count, err)
+			return
+		}
+		log.Printf("%s exported channel %s with %d messages", identity.Username, channel.Name, count)
+	}
+}
+
+// HandleChannelImport recreates a channel from a JSON Lines archive uploaded as the
+// 'archive' part of a multipart form. The optional 'users' part maps the archive's user IDs
+// to this server's as a JSON object; 'name' renames the channel and 'strict' fails the
+// import when an author is not mapped. Moderators only.
+func HandleChannelImport(db *pgxpool.Pool, messageCache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		r.Body = http.MaxBytesReader(w, r.Body, maxArchiveSize)
+		if err := r.ParseMultipartForm(32 << 20); err != nil {
+			http.Error(w, "Expected a multipart form of at most 1 GiB", http.StatusBadRequest)
+			return
+		}
+		defer r.MultipartForm.RemoveAll()
+
+		archive, _, err := r.FormFile("archive")
+		if err != nil {
+			http.Error(w, "'archive' is required", http.StatusBadRequest)
+			return
+		}
+		defer archive.Close()
+
+		opts := channelarchive.ImportOptions{
+			Name:       strings.TrimSpace(r.FormValue("name")),
+			Strict:     r.FormValue("strict") == "1" || strings.ToLower(r.FormValue("strict")) == "true",
+			ImportedBy: identity.UserID,
+		}
+		if users, _, err := r.FormFile("users"); err == nil {
+			err = json.NewDecoder(users).Decode(&opts.Users)
+			users.Close()
+			if err != nil {
+				http.Error(w, "'users' must be a JSON object of user IDs", http.StatusBadRequest)
+				return
+			}
+		} else if value := r.FormValue("users"); value != "" {
+			if err := json.Unmarshal([]byte(value), &opts.Users); err != nil {
+				http.Error(w, "'users' must be a JSON object of user IDs", http.StatusBadRequest)
+				return
+			}
+		}
+
+		result, err := channelarchive.Import(db, messageCache, archive, opts)
+		var formatErr *channelarchive.FormatError
+		switch {
+		case errors.As(err, &formatErr):
+			http.Error(w, formatErr.Error(), http.StatusBadRequest)
+			return
+		case errors.Is(err, database.ErrUnknownLanguage):
+			http.Error(w, "The archive's search language is not available", http.StatusBadRequest)
+			return
+		case errors.Is(err, database.ErrChannelExists):
+			http.Error(w, "Channel already exists", http.StatusConflict)
+			return
+		case err != nil:
+			log.Printf("Failed to import channel: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		log.Printf("%s imported channel %s with %d messages (%d unmapped users)", identity.Username,
+			result.Channel.Name, result.Messages, len(result.UnmappedUsers))
+		recordAudit(db, r, models.AuditChannelImport, strconv.Itoa(result.Channel.ID), map[string]interface{}{
+			"name":           result.Channel.Name,
+			"messages":       result.Messages,
+			"unmapped_users": len(result.UnmappedUsers),
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		json.NewEncoder(w).Encode(result)
+	}
+}
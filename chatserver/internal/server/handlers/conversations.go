@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/cache"
+	"onrabble.com/chatserver/internal/messages/chat"
+)
+
+// HandleConversations lists the authenticated caller's private conversations, including
+// messages not yet flushed to the database.
+func HandleConversations(cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		conversations, err := cache.FetchConversations(identity.UserID)
+		if err != nil {
+			log.Printf("Failed to fetch conversations for %s: %v", identity.UserID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(chat.NewConversationsMessage(conversations))
+	}
+}
+
+// HandleConversationHistory pages through the private messages exchanged between the
+// authenticated caller and the user given by 'peer_id', including messages not yet
+// flushed to the database.
+func HandleConversationHistory(cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		peerID := r.URL.Query().Get("peer_id")
+		if peerID == "" {
+			http.Error(w, "Missing peer_id parameter", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		history, info, err := cache.FetchPrivateHistory(identity.UserID, peerID, page)
+		if err != nil {
+			log.Printf("Failed to fetch private history between %s and %s: %v", identity.UserID, peerID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(chat.NewPrivateHistoryMessage(peerID, history, info.HasMore, info.NextCursor))
+	}
+}
@@ -0,0 +1,84 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HandleMentions serves the authenticated caller's mention inbox. GET lists mentions,
+// only unread ones with 'unread=true', and POST marks the mentions given by 'ids' as read,
+// or all of them when no IDs are given.
+func HandleMentions(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			page, err := parsePageRequest(r, 50)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			unreadOnly := r.URL.Query().Get("unread") == "true"
+			mentions, info, err := cache.FetchMentions(identity.UserID, unreadOnly, page)
+			if err != nil {
+				log.Printf("Failed to fetch mentions for %s: %v", identity.UserID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			unread, err := database.CountUnreadMentions(db, identity.UserID)
+			if err != nil {
+				log.Printf("Failed to count unread mentions for %s: %v", identity.UserID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			response := api.NewMentionsResultMessage(api.MentionsResultPayload{
+				Mentions:    mentions,
+				UnreadCount: unread,
+				HasMore:     info.HasMore,
+				NextCursor:  info.NextCursor,
+				PrevCursor:  info.PrevCursor,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(response)
+
+		case http.MethodPost:
+			var body struct {
+				IDs []int `json:"ids"`
+			}
+			if r.ContentLength != 0 {
+				if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+					http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+					return
+				}
+			}
+
+			if _, err := database.MarkMentionsRead(db, identity.UserID, body.IDs); err != nil {
+				log.Printf("Failed to mark mentions read for %s: %v", identity.UserID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
@@ -2,13 +2,16 @@ package handlers
 
 import (
 	"encoding/json"
+	"errors"
 	"log"
 	"net/http"
-	"strconv"
+	"time"
 
+	"onrabble.com/chatserver/internal/auth"
 	"onrabble.com/chatserver/internal/cache"
 	database "onrabble.com/chatserver/internal/db"
 	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -18,46 +21,45 @@ func HandleMessages(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFun
 		switch r.Method {
 		case http.MethodGet:
 			// Extract query parameters
-			channels := r.URL.Query()["channel"]
-			keyword := r.URL.Query().Get("keyword")
-			limitStr := r.URL.Query().Get("limit")
-			offsetStr := r.URL.Query().Get("offset")
-
-			limit := 50 // Default
-			offset := 0 // Default
-
-			if limitStr != "" {
-				parsedLimit, err := strconv.Atoi(limitStr)
-				if err != nil || parsedLimit <= 0 {
-					http.Error(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
-					return
-				}
-				limit = parsedLimit
+			filter := database.MessageFilter{
+				UserID:    r.URL.Query().Get("user_id"),
+				Channels:  r.URL.Query()["channel"],
+				Keyword:   r.URL.Query().Get("keyword"),
+				Relevance: r.URL.Query().Get("sort") == "relevance",
 			}
 
-			if offsetStr != "" {
-				parsedOffset, err := strconv.Atoi(offsetStr)
-				if err != nil || parsedOffset < 0 {
-					http.Error(w, "Invalid 'offset' query parameter", http.StatusBadRequest)
-					return
-				}
-				offset = parsedOffset
+			var err error
+			if filter.From, filter.To, err = parseDateRange(r); err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
 			}
 
-			userID := r.URL.Query().Get("user_id")
+			page, err := parsePageRequest(r, 50)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			// Relevance ordering pages by offset since rank is not part of the cursor
+			if filter.Relevance && (page.Before != nil || page.After != nil) {
+				http.Error(w, "Cursors cannot be combined with 'sort=relevance'", http.StatusBadRequest)
+				return
+			}
 
 			// Fetch messages
-			search_messages, hasMore, err := database.FetchMessages(db, userID, channels, keyword, limit, offset)
+			search_messages, info, err := database.FetchMessages(db, filter, page)
 			if err != nil {
-				log.Printf("Failed to fetch messages for channels '%v': %v", channels, err)
+				log.Printf("Failed to fetch messages for channels '%v': %v", filter.Channels, err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
 			// Wrap messages in the correct struct
 			payload := api.MessageSearchResultPayload{
-				Messages: search_messages, // Fixing struct usage
-				HasMore:  hasMore,
+				Messages:   search_messages, // Fixing struct usage
+				HasMore:    info.HasMore,
+				NextCursor: info.NextCursor,
+				PrevCursor: info.PrevCursor,
 			}
 
 			// Use NewMessageSearchResultMessage with correct payload
@@ -95,6 +97,11 @@ func HandleMessages(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFun
 				return
 			}
 
+			recordAudit(db, r, models.AuditMessagesDelete, "", map[string]interface{}{
+				"ids":     body.IDs,
+				"deleted": rowsDeleted,
+			})
+
 			// Purge messages from the cache
 			for _, cacheID := range cacheIDs {
 				success := cache.DeleteCachedMessage(cacheID)
@@ -113,3 +120,121 @@ func HandleMessages(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFun
 		}
 	}
 }
+
+// HandlePrivateMessages searches the authenticated caller's own private conversations.
+func HandlePrivateMessages(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		filter := database.PrivateMessageFilter{
+			PeerID:  r.URL.Query().Get("peer_id"),
+			Keyword: r.URL.Query().Get("keyword"),
+		}
+
+		var err error
+		if filter.From, filter.To, err = parseDateRange(r); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		privateMessages, info, err := database.FetchPrivateMessages(db, identity.UserID, filter, page)
+		if err != nil {
+			log.Printf("Failed to fetch private messages for %s: %v", identity.UserID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := api.NewPrivateMessageSearchResultMessage(api.PrivateMessageSearchResultPayload{
+			Messages:   privateMessages,
+			HasMore:    info.HasMore,
+			NextCursor: info.NextCursor,
+			PrevCursor: info.PrevCursor,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// parseDateRange reads the optional 'from' and 'to' query parameters. Both accept RFC 3339
+// timestamps or plain dates; a plain 'to' date includes the whole of that day.
+// The returned error is safe to show to the caller.
+func parseDateRange(r *http.Request) (*time.Time, *time.Time, error) {
+	from, err := parseDateBound(r.URL.Query().Get("from"), false)
+	if err != nil {
+		return nil, nil, errors.New("Invalid 'from' query parameter")
+	}
+
+	to, err := parseDateBound(r.URL.Query().Get("to"), true)
+	if err != nil {
+		return nil, nil, errors.New("Invalid 'to' query parameter")
+	}
+
+	if from != nil && to != nil && !from.Before(*to) {
+		return nil, nil, errors.New("'from' must be earlier than 'to'")
+	}
+
+	return from, to, nil
+}
+
+// parseDateBound parses a single date bound, returning nil for an empty value.
+func parseDateBound(value string, endOfDay bool) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		// Stored timestamps have no zone and are written in UTC
+		t = t.UTC()
+		return &t, nil
+	}
+
+	t, err := time.Parse(time.DateOnly, value)
+	if err != nil {
+		return nil, err
+	}
+	if endOfDay {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+// removeMessage deletes a channel or private message by cacheID from the database and the
+// cache, flushing the cache first so unflushed messages are found. Messages that were
+// already deleted are skipped.
+func removeMessage(db *pgxpool.Pool, cache *cache.MessageCache, target string, cacheID int, ownerID, recipientID string) error {
+	if target == models.ReactionTargetPrivate {
+		cache.FlushPrivateMessagesToDB()
+		if _, err := database.RemovePrivateMessage(db, cacheID); err != nil {
+			return err
+		}
+		cache.DeleteCachedPrivateMessage(cacheID, ownerID, recipientID)
+		return nil
+	}
+
+	cache.FlushCacheToDB()
+	msg, found, err := database.FindChatMessageByCacheID(db, cacheID)
+	if err != nil || !found {
+		return err
+	}
+	if _, _, err := database.RemoveMessages(db, []int{msg.ID}); err != nil {
+		return err
+	}
+	cache.DeleteCachedMessage(cacheID)
+	return nil
+}
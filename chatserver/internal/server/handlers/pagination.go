@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	database "onrabble.com/chatserver/internal/db"
+)
+
+// maxPageSize caps the 'limit' of any paged listing.
+const maxPageSize = 200
+
+// parsePageRequest reads the 'limit', 'before', 'after' and legacy 'offset' query parameters.
+// Limits above maxPageSize are lowered to it. The returned error is safe to show to the caller.
+func parsePageRequest(r *http.Request, defaultLimit int) (database.PageRequest, error) {
+	query := r.URL.Query()
+	page := database.PageRequest{Limit: defaultLimit}
+
+	if limitStr := query.Get("limit"); limitStr != "" {
+		parsedLimit, err := strconv.Atoi(limitStr)
+		if err != nil || parsedLimit <= 0 {
+			return page, errors.New("Invalid 'limit' query parameter")
+		}
+		page.Limit = min(parsedLimit, maxPageSize)
+	}
+
+	before := query.Get("before")
+	after := query.Get("after")
+	if before != "" && after != "" {
+		return page, errors.New("Only one of 'before' or 'after' may be provided")
+	}
+
+	if before != "" {
+		cursor, err := database.DecodeCursor(before)
+		if err != nil {
+			return page, errors.New("Invalid 'before' cursor")
+		}
+		page.Before = &cursor
+	}
+
+	if after != "" {
+		cursor, err := database.DecodeCursor(after)
+		if err != nil {
+			return page, errors.New("Invalid 'after' cursor")
+		}
+		page.After = &cursor
+	}
+
+	// Offset paging is kept for dashboards that predate cursors
+	if offsetStr := query.Get("offset"); offsetStr != "" {
+		parsedOffset, err := strconv.Atoi(offsetStr)
+		if err != nil || parsedOffset < 0 {
+			return page, errors.New("Invalid 'offset' query parameter")
+		}
+		page.Offset = parsedOffset
+	}
+
+	return page, nil
+}
@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/interfaces"
+	"onrabble.com/chatserver/internal/messages/chat"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HandleChannelPins lists the pins of the channel whose ID is given in the path. Moderators
+// can POST a message to pin it and DELETE one to unpin it, identifying the message by
+// 'cacheID' or 'message_id' in the JSON body. Changes are broadcast as pins_updated.
+func HandleChannelPins(db *pgxpool.Pool, cache *cache.MessageCache, hub interfaces.HubInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		channelID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || channelID <= 0 {
+			http.Error(w, "Invalid channel ID", http.StatusBadRequest)
+			return
+		}
+
+		if r.Method == http.MethodGet {
+			pins, err := cache.FetchChannelPins(channelID)
+			if err != nil {
+				log.Printf("Failed to fetch pins for channel %d: %v", channelID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(chat.NewPinsUpdatedMessage(channelID, pins[channelID]).Payload)
+			return
+		}
+
+		if r.Method != http.MethodPost && r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !identity.HasRole(auth.RoleModerator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		var body struct {
+			CacheID   int `json:"cacheID"`
+			MessageID int `json:"message_id"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+			http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+			return
+		}
+
+		if body.CacheID <= 0 && body.MessageID > 0 {
+			cacheID, found, err := database.FindCacheIDByMessageID(db, models.ReactionTargetChat, body.MessageID)
+			if err != nil {
+				log.Printf("Failed to look up message %d: %v", body.MessageID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if found {
+				body.CacheID = cacheID
+			}
+		}
+		if body.CacheID <= 0 {
+			http.Error(w, "A cacheID or message_id is required", http.StatusBadRequest)
+			return
+		}
+
+		var changed bool
+		if r.Method == http.MethodPost {
+			// Messages not flushed yet are only in the cache
+			var cachedChannel string
+			if msg, ok := cache.FindUnflushedChatMessage(body.CacheID); ok {
+				cachedChannel = msg.Channel
+			}
+			changed, err = database.PinMessage(db, channelID, body.CacheID, identity.UserID, cachedChannel)
+		} else {
+			changed, err = database.UnpinMessage(db, channelID, body.CacheID)
+		}
+		if errors.Is(err, database.ErrPinLimitReached) {
+			http.Error(w, "This channel has too many pinned messages", http.StatusConflict)
+			return
+		}
+		if err != nil {
+			log.Printf("Failed to update pins for channel %d: %v", channelID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !changed {
+			http.Error(w, "Message not found in this channel", http.StatusNotFound)
+			return
+		}
+
+		pins, err := cache.FetchChannelPins(channelID)
+		if err != nil {
+			log.Printf("Failed to fetch pins for channel %d: %v", channelID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		update := chat.NewPinsUpdatedMessage(channelID, pins[channelID])
+		hub.SendMessage(update)
+		log.Printf("%s updated the pins of channel %d", identity.Username, channelID)
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(update.Payload)
+	}
+}
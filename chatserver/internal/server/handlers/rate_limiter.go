@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 
 	"onrabble.com/chatserver/internal/cache"
 	database "onrabble.com/chatserver/internal/db"
@@ -49,6 +50,10 @@ func HandleRateLimiter(db *pgxpool.Pool, cache *cache.MessageCache) http.Handler
 			}
 
 			cache.UpdateRateLimitSettings(payload.MessageLimit, payload.WindowSeconds)
+			recordAudit(db, r, models.AuditRateLimitUpdate, strconv.Itoa(payload.ID), map[string]int{
+				"message_limit":  payload.MessageLimit,
+				"window_seconds": payload.WindowSeconds,
+			})
 
 			w.WriteHeader(http.StatusOK)
 			json.NewEncoder(w).Encode(map[string]string{"message": "Rate limit updated"})
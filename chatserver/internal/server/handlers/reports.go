@@ -0,0 +1,270 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/interfaces"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// reportAuditActions maps the report actions to their audit log actions.
+var reportAuditActions = map[string]string{
+	"claim":    models.AuditReportClaim,
+	"escalate": models.AuditReportEscalate,
+	"resolve":  models.AuditReportResolve,
+}
+
+// HandleReports files a report from the JSON body on POST, for any signed-in user, and
+// lists reports newest first on GET, for moderators. 'status' selects open (default),
+// claimed, escalated, resolved or all reports.
+func HandleReports(db *pgxpool.Pool, hub interfaces.HubInterface) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost:
+			identity, ok := auth.FromContext(r.Context())
+			if !ok {
+				http.Error(w, "Unauthorized", http.StatusUnauthorized)
+				return
+			}
+
+			var report models.Report
+			if err := json.NewDecoder(r.Body).Decode(&report); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			report.ReporterID, report.ReporterUsername = identity.UserID, identity.Username
+
+			saved, created, err := hub.FileReport(report)
+			switch {
+			case errors.Is(err, models.ErrInvalidReport):
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			case errors.Is(err, models.ErrReportTargetNotFound):
+				http.Error(w, err.Error(), http.StatusNotFound)
+				return
+			case err != nil:
+				log.Printf("Failed to file report from %s: %v", identity.Username, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			if created {
+				w.WriteHeader(http.StatusCreated)
+			}
+			json.NewEncoder(w).Encode(saved)
+
+		case http.MethodGet:
+			if _, ok := moderatorIdentity(w, r); !ok {
+				return
+			}
+
+			status := r.URL.Query().Get("status")
+			switch status {
+			case "":
+				status = models.ReportOpen
+			case "all":
+				status = ""
+			case models.ReportOpen, models.ReportClaimed, models.ReportEscalated, models.ReportResolved:
+			default:
+				http.Error(w, "Invalid 'status' query parameter", http.StatusBadRequest)
+				return
+			}
+
+			page, err := parsePageRequest(r, 50)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			reports, info, err := database.FetchReports(db, status, page)
+			if err != nil {
+				log.Printf("Failed to fetch reports: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(api.NewReportsResultMessage(reports, info.HasMore, info.NextCursor, info.PrevCursor))
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleReport returns the report whose ID is given in the path. Moderators only.
+func HandleReport(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		report, found, err := database.FindReport(db, id)
+		if err != nil {
+			log.Printf("Failed to look up report %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
+
+// HandleReportAction moves the report whose ID is given in the path through the queue.
+// The action in the path is one of:
+//   - claim: assigns the report to the caller
+//   - escalate: hands it on with the JSON body's 'note'
+//   - resolve: closes it with the JSON body's 'resolution' and 'note'. "message_removed"
+//     deletes the reported message and "user_banned" bans the reported user for
+//     'ban_duration' hours (0 or absent is permanent), linking the ban to the report.
+//
+// A report claimed by another moderator can't be escalated or resolved. Moderators only.
+func HandleReportAction(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid report ID", http.StatusBadRequest)
+			return
+		}
+
+		action := r.PathValue("action")
+		if action != "claim" && action != "escalate" && action != "resolve" {
+			http.Error(w, "Action must be claim, escalate or resolve", http.StatusNotFound)
+			return
+		}
+
+		var body struct {
+			Resolution  string `json:"resolution"`
+			Note        string `json:"note"`
+			BanDuration int    `json:"ban_duration"` // Hours; 0 is permanent
+		}
+		if action != "claim" {
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+		}
+
+		report, found, err := database.FindReport(db, id)
+		if err != nil {
+			log.Printf("Failed to look up report %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Report not found", http.StatusNotFound)
+			return
+		}
+		if report.Status == models.ReportResolved {
+			http.Error(w, "Report was already resolved", http.StatusConflict)
+			return
+		}
+		if report.Status == models.ReportClaimed && *report.ClaimedBy != identity.UserID {
+			http.Error(w, "Report is claimed by another moderator", http.StatusConflict)
+			return
+		}
+
+		switch action {
+		case "claim":
+			report, found, err = database.ClaimReport(db, id, identity.UserID)
+
+		case "escalate":
+			report, found, err = database.EscalateReport(db, id, identity.UserID, body.Note)
+
+		case "resolve":
+			var banID *int
+			switch body.Resolution {
+			case models.ResolutionDismissed:
+			case models.ResolutionMessageRemoved:
+				if report.Kind != models.ReportMessage {
+					http.Error(w, "Only message reports can be resolved by removing the message", http.StatusBadRequest)
+					return
+				}
+				var snapshot struct {
+					RecipientID string `json:"recipient_id"`
+				}
+				json.Unmarshal(report.Snapshot, &snapshot)
+				if err := removeMessage(db, cache, report.Target, report.CacheID, report.ReportedUserID, snapshot.RecipientID); err != nil {
+					log.Printf("Failed to remove reported message %d: %v", report.CacheID, err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+			case models.ResolutionUserBanned:
+				if body.BanDuration < 0 {
+					http.Error(w, "'ban_duration' must not be negative", http.StatusBadRequest)
+					return
+				}
+				reason := fmt.Sprintf("Report %d: %s", report.ID, report.Reason)
+				ban, err := database.BanUser(db, identity.UserID, report.ReportedUserID, reason, body.BanDuration, models.BanScope{})
+				if err != nil {
+					log.Printf("Failed to ban %s for report %d: %v", report.ReportedUserID, id, err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				banID = &ban
+				recordAudit(db, r, models.AuditUserBan, report.ReportedUserID, map[string]interface{}{
+					"ban_id":    ban,
+					"reason":    reason,
+					"duration":  body.BanDuration,
+					"report_id": report.ID,
+				})
+			default:
+				http.Error(w, "'resolution' must be dismissed, message_removed or user_banned", http.StatusBadRequest)
+				return
+			}
+			report, found, err = database.ResolveReport(db, id, identity.UserID, body.Resolution, body.Note, banID)
+		}
+		if err != nil {
+			log.Printf("Failed to %s report %d: %v", action, id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Report was changed by another moderator", http.StatusConflict)
+			return
+		}
+		log.Printf("%s %s report %d", identity.Username, report.Status, id)
+		recordAudit(db, r, reportAuditActions[action], strconv.Itoa(id), map[string]string{
+			"status": report.Status, "resolution": body.Resolution, "note": body.Note,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(report)
+	}
+}
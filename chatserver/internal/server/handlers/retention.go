@@ -0,0 +1,220 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HandleRetentionPolicies lists the retention policies. Moderators only.
+func HandleRetentionPolicies(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		policies, err := database.FetchRetentionPolicies(db)
+		if err != nil {
+			log.Printf("Failed to fetch retention policies: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewRetentionPoliciesResultMessage(policies))
+	}
+}
+
+// HandleRetentionPolicy sets the policy for the scope in the path from the JSON body on PUT
+// and removes it on DELETE. The scope is channels, private or sessions, or the channel named
+// in the path. Moderators only.
+func HandleRetentionPolicy(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		scope, channel := r.PathValue("scope"), r.PathValue("channel")
+		if channel != "" {
+			scope = models.RetentionChannel
+		}
+		switch scope {
+		case models.RetentionChannels, models.RetentionPrivate, models.RetentionSessions, models.RetentionChannel:
+		default:
+			http.Error(w, "Scope must be channels, private, sessions or channel/{name}", http.StatusNotFound)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodPut:
+			var policy models.RetentionPolicy
+			if err := json.NewDecoder(r.Body).Decode(&policy); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			policy.Scope, policy.Channel, policy.UpdatedBy = scope, channel, identity.UserID
+
+			if policy.MaxAgeDays < 0 || policy.MaxMessages < 0 {
+				http.Error(w, "Limits must not be negative", http.StatusBadRequest)
+				return
+			}
+			if policy.MaxMessages > 0 && scope != models.RetentionChannels && scope != models.RetentionChannel {
+				http.Error(w, "'max_messages' only applies to channels", http.StatusBadRequest)
+				return
+			}
+			if policy.Archive && scope == models.RetentionSessions {
+				http.Error(w, "Sessions can't be archived", http.StatusBadRequest)
+				return
+			}
+
+			policy, err := database.SaveRetentionPolicy(db, policy)
+			if err != nil {
+				log.Printf("Failed to save retention policy: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s set the %s %s retention policy to %d days, %d messages", identity.Username, scope, channel,
+				policy.MaxAgeDays, policy.MaxMessages)
+			recordAudit(db, r, models.AuditRetentionUpdate, retentionTarget(scope, channel), map[string]interface{}{
+				"max_age_days": policy.MaxAgeDays, "max_messages": policy.MaxMessages, "archive": policy.Archive,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(policy)
+
+		case http.MethodDelete:
+			deleted, err := database.DeleteRetentionPolicy(db, scope, channel)
+			if err != nil {
+				log.Printf("Failed to delete retention policy: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !deleted {
+				http.Error(w, "Policy not found", http.StatusNotFound)
+				return
+			}
+			log.Printf("%s removed the %s %s retention policy", identity.Username, scope, channel)
+			recordAudit(db, r, models.AuditRetentionDelete, retentionTarget(scope, channel), nil)
+			w.WriteHeader(http.StatusNoContent)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// retentionTarget names a retention policy in the audit log, e.g. "channels" or
+// "channel/general".
+func retentionTarget(scope, channel string) string {
+	if channel == "" {
+		return scope
+	}
+	return scope + "/" + channel
+}
+
+// HandleLegalHolds lists legal holds on GET and places one from the JSON body on POST. A
+// hold names either a 'channel' or a 'user_id', with a 'reason'. Moderators only.
+func HandleLegalHolds(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		switch r.Method {
+		case http.MethodGet:
+			holds, err := database.FetchLegalHolds(db)
+			if err != nil {
+				log.Printf("Failed to fetch legal holds: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(api.NewLegalHoldsResultMessage(holds))
+
+		case http.MethodPost:
+			var hold models.LegalHold
+			if err := json.NewDecoder(r.Body).Decode(&hold); err != nil {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			hold.Reason = strings.TrimSpace(hold.Reason)
+			if (hold.Channel == "") == (hold.UserID == "") {
+				http.Error(w, "Exactly one of 'channel' and 'user_id' is required", http.StatusBadRequest)
+				return
+			}
+			if hold.Reason == "" {
+				http.Error(w, "'reason' is required", http.StatusBadRequest)
+				return
+			}
+			hold.CreatedBy = identity.UserID
+
+			hold, err := database.CreateLegalHold(db, hold)
+			if err != nil {
+				log.Printf("Failed to create legal hold: %v", err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			log.Printf("%s placed legal hold %d", identity.Username, hold.ID)
+			recordAudit(db, r, models.AuditLegalHoldCreate, strconv.Itoa(hold.ID), map[string]string{
+				"channel": hold.Channel, "user_id": hold.UserID, "reason": hold.Reason,
+			})
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusCreated)
+			json.NewEncoder(w).Encode(hold)
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleLegalHold lifts the legal hold whose ID is given in the path on DELETE. Moderators
+// only.
+func HandleLegalHold(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid hold ID", http.StatusBadRequest)
+			return
+		}
+
+		deleted, err := database.DeleteLegalHold(db, id)
+		if err != nil {
+			log.Printf("Failed to delete legal hold %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !deleted {
+			http.Error(w, "Hold not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("%s lifted legal hold %d", identity.Username, id)
+		recordAudit(db, r, models.AuditLegalHoldDelete, strconv.Itoa(id), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
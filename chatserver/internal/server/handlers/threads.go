@@ -0,0 +1,96 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HandleThread pages through the replies to the message whose database ID is given in
+// the path, including replies still waiting to be flushed. Asking for a reply returns the
+// whole thread it belongs to.
+func HandleThread(db *pgxpool.Pool, cache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		messageID, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || messageID <= 0 {
+			http.Error(w, "Invalid message ID", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		parent, ok, err := findThreadParent(db, messageID)
+		if err != nil {
+			log.Printf("Failed to find thread for message %d: %v", messageID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !ok {
+			http.Error(w, "Message not found", http.StatusNotFound)
+			return
+		}
+
+		replies, info, err := cache.FetchThreadReplies(parent.CacheID, page)
+		if err != nil {
+			log.Printf("Failed to fetch replies to message %d: %v", parent.ID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		response := api.NewThreadResultMessage(api.ThreadResultPayload{
+			Parent:     parent,
+			Replies:    replies,
+			HasMore:    info.HasMore,
+			NextCursor: info.NextCursor,
+			PrevCursor: info.PrevCursor,
+		})
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(response)
+	}
+}
+
+// findThreadParent returns the thread parent for a stored message, which is the message
+// itself unless it is a reply. Reactions and reply metadata are included.
+func findThreadParent(db *pgxpool.Pool, messageID int) (models.ChatMessage, bool, error) {
+	cacheID, ok, err := database.FindCacheIDByMessageID(db, models.ReactionTargetChat, messageID)
+	if err != nil || !ok {
+		return models.ChatMessage{}, false, err
+	}
+
+	parent, ok, err := database.FindChatMessageByCacheID(db, cacheID)
+	if err != nil || !ok {
+		return parent, false, err
+	}
+	if parent.ReplyTo > 0 {
+		if parent, ok, err = database.FindChatMessageByCacheID(db, parent.ReplyTo); err != nil || !ok {
+			return parent, false, err
+		}
+	}
+
+	parents := []models.ChatMessage{parent}
+	if err := database.AttachChatReactions(db, parents); err != nil {
+		return parent, false, err
+	}
+	if err := database.AttachThreadSummaries(db, parents); err != nil {
+		return parent, false, err
+	}
+	return parents[0], true, nil
+}
@@ -0,0 +1,263 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"onrabble.com/chatserver/internal/auth"
+	"onrabble.com/chatserver/internal/cache"
+	database "onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
+	"onrabble.com/chatserver/internal/userdata"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// HandleUserExport returns the data stored about the user whose ID is given in the path as
+// a ZIP archive, or as a single JSON document with 'format=json'. Users can export their
+// own data and moderators anyone's. Every export is recorded as a data request.
+func HandleUserExport(db *pgxpool.Pool, messageCache *cache.MessageCache) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := auth.FromContext(r.Context())
+		if !ok {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		userID := r.PathValue("id")
+		if userID != identity.UserID && !identity.HasRole(auth.RoleModerator) {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+
+		format := r.URL.Query().Get("format")
+		switch format {
+		case "":
+			format = "zip"
+		case "zip", "json":
+		default:
+			http.Error(w, "'format' must be zip or json", http.StatusBadRequest)
+			return
+		}
+
+		request, _, err := database.CreateDataRequest(db, models.DataRequest{
+			Kind:        models.DataRequestExport,
+			UserID:      userID,
+			Mode:        format,
+			Status:      models.DataRequestRunning,
+			RequestedBy: identity.UserID,
+		})
+		if err != nil {
+			log.Printf("Failed to record export of %s: %v", userID, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		export, err := userdata.Export(db, messageCache, userID)
+		if err != nil {
+			log.Printf("Failed to export %s: %v", userID, err)
+			database.FinishDataRequest(db, request.ID, nil, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		filename := fmt.Sprintf("user-%s-export.%s", userID, format)
+		w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+		if format == "json" {
+			w.Header().Set("Content-Type", "application/json")
+			err = json.NewEncoder(w).Encode(export)
+		} else {
+			w.Header().Set("Content-Type", "application/zip")
+			err = userdata.WriteArchive(w, export)
+		}
+		if err != nil {
+			log.Printf("Failed to write export of %s: %v", userID, err)
+		}
+		if err := database.FinishDataRequest(db, request.ID, userdata.Counts(export), err); err != nil {
+			log.Printf("Failed to record export of %s: %v", userID, err)
+		}
+		log.Printf("%s exported the data of %s (request %d)", identity.Username, userID, request.ID)
+	}
+}
+
+// HandleUserErasure starts erasing the user whose ID is given in the path on POST and lists
+// that user's data requests on GET. The optional JSON body's 'mode' is "delete", the
+// default, which deletes their messages, or "pseudonymize", which keeps them under a
+// pseudonym. The erasure runs in the background; its request reports progress. Moderators
+// only.
+func HandleUserErasure(db *pgxpool.Pool, eraser *userdata.Eraser) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+		userID := r.PathValue("id")
+
+		switch r.Method {
+		case http.MethodPost:
+			var body struct {
+				Mode string `json:"mode"`
+			}
+			if err := json.NewDecoder(r.Body).Decode(&body); err != nil && !errors.Is(err, io.EOF) {
+				http.Error(w, "Invalid JSON body", http.StatusBadRequest)
+				return
+			}
+			switch body.Mode {
+			case "":
+				body.Mode = models.ErasureDelete
+			case models.ErasureDelete, models.ErasurePseudonymize:
+			default:
+				http.Error(w, "'mode' must be delete or pseudonymize", http.StatusBadRequest)
+				return
+			}
+
+			held, err := database.UserHeld(db, userID)
+			if err != nil {
+				log.Printf("Failed to check legal hold on %s: %v", userID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if held {
+				http.Error(w, "User is under legal hold", http.StatusConflict)
+				return
+			}
+
+			request, created, err := database.CreateDataRequest(db, models.DataRequest{
+				Kind:        models.DataRequestErase,
+				UserID:      userID,
+				Mode:        body.Mode,
+				Pseudonym:   userdata.NewPseudonym(),
+				Status:      models.DataRequestPending,
+				RequestedBy: identity.UserID,
+			})
+			if err != nil {
+				log.Printf("Failed to record erasure of %s: %v", userID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+			if !created {
+				http.Error(w, "User is already being erased", http.StatusConflict)
+				return
+			}
+			log.Printf("%s requested erasure %d of %s (%s)", identity.Username, request.ID, userID, body.Mode)
+			recordAudit(db, r, models.AuditUserErase, userID, map[string]interface{}{
+				"request_id": request.ID,
+				"mode":       body.Mode,
+			})
+			eraser.Start(request.ID)
+
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusAccepted)
+			json.NewEncoder(w).Encode(request)
+
+		case http.MethodGet:
+			page, err := parsePageRequest(r, 50)
+			if err != nil {
+				http.Error(w, err.Error(), http.StatusBadRequest)
+				return
+			}
+
+			requests, info, err := database.FetchDataRequests(db, userID, "", "", page)
+			if err != nil {
+				log.Printf("Failed to fetch data requests of %s: %v", userID, err)
+				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+				return
+			}
+
+			w.Header().Set("Content-Type", "application/json")
+			json.NewEncoder(w).Encode(api.NewDataRequestsResultMessage(requests, info.HasMore, info.NextCursor, info.PrevCursor))
+
+		default:
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+		}
+	}
+}
+
+// HandleDataRequests lists exports and erasures newest first, optionally filtered by 'kind'
+// and 'status'. Moderators only.
+func HandleDataRequests(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		query := r.URL.Query()
+		kind, status := query.Get("kind"), query.Get("status")
+		switch kind {
+		case "", models.DataRequestExport, models.DataRequestErase:
+		default:
+			http.Error(w, "Invalid 'kind' query parameter", http.StatusBadRequest)
+			return
+		}
+		switch status {
+		case "", models.DataRequestPending, models.DataRequestRunning, models.DataRequestCompleted, models.DataRequestFailed:
+		default:
+			http.Error(w, "Invalid 'status' query parameter", http.StatusBadRequest)
+			return
+		}
+
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		requests, info, err := database.FetchDataRequests(db, "", kind, status, page)
+		if err != nil {
+			log.Printf("Failed to fetch data requests: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewDataRequestsResultMessage(requests, info.HasMore, info.NextCursor, info.PrevCursor))
+	}
+}
+
+// HandleDataRequest returns the export or erasure whose ID is given in the path, including
+// its status and counts. Moderators only.
+func HandleDataRequest(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid request ID", http.StatusBadRequest)
+			return
+		}
+
+		request, found, err := database.FindDataRequest(db, id)
+		if err != nil {
+			log.Printf("Failed to look up data request %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !found {
+			http.Error(w, "Request not found", http.StatusNotFound)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(request)
+	}
+}
@@ -5,10 +5,14 @@ import (
 	"fmt"
 	"log"
 	"net/http"
+	"net/netip"
 	"strconv"
+	"strings"
 
+	"onrabble.com/chatserver/internal/auth"
 	database "onrabble.com/chatserver/internal/db"
 	"onrabble.com/chatserver/internal/messages/api"
+	"onrabble.com/chatserver/internal/models"
 
 	"github.com/jackc/pgx/v5/pgxpool"
 )
@@ -16,14 +20,24 @@ import (
 func HandleUsers(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		username := r.URL.Query().Get("username")
-		users, err := database.FetchUsers(db, username)
+
+		page, err := parsePageRequest(r, 100)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		users, info, err := database.FetchUsers(db, username, page)
 		if err != nil {
 			log.Printf("Failed to fetch users: %v", err)
 			http.Error(w, "Internal server error", http.StatusInternalServerError)
 			return
 		}
 		payload := api.UserSearchResultPayload{
-			Users: users,
+			Users:      users,
+			HasMore:    info.HasMore,
+			NextCursor: info.NextCursor,
+			PrevCursor: info.PrevCursor,
 		}
 
 		response := api.NewUserSearchResultMessage(payload)
@@ -36,13 +50,18 @@ func HandleBanUser(db *pgxpool.Pool) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		switch r.Method {
 		case http.MethodPost:
-			// temp owner_id
+			// temp owner_id, used until the dashboard authenticates its requests
 			ownerID := "ace4e8be-d2a2-46d7-9c9e-57f04f915835"
+			if identity, ok := auth.FromContext(r.Context()); ok {
+				ownerID = identity.UserID
+			}
 
 			var request struct {
 				BanishedID string  `json:"banished_id"` // The user being banned
 				Reason     *string `json:"reason"`      // Reason for the ban (optional)
 				Duration   *int    `json:"duration"`    // Duration in hours (optional, nil = permanent)
+				IP         string  `json:"ip"`          // Address or CIDR range to ban too, or "last" (optional)
+				DeviceID   string  `json:"device_id"`   // Device fingerprint to ban too, or "last" (optional)
 			}
 
 			// Parse request body
@@ -71,14 +90,55 @@ func HandleBanUser(db *pgxpool.Pool) http.HandlerFunc {
 				reason = *request.Reason
 			}
 
+			// "last" bans the address or device the user most recently connected from
+			scope := models.BanScope{IPRange: request.IP, DeviceID: request.DeviceID}
+			if scope.IPRange == "last" || scope.DeviceID == "last" {
+				ip, deviceID, found, err := database.LastUserAddress(db, request.BanishedID)
+				if err != nil {
+					log.Printf("Failed to look up last address: %v", err)
+					http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+				if !found || (scope.DeviceID == "last" && deviceID == "") {
+					http.Error(w, "No known address or device for banished_id", http.StatusBadRequest)
+					return
+				}
+				if scope.IPRange == "last" {
+					scope.IPRange = ip
+				}
+				if scope.DeviceID == "last" {
+					scope.DeviceID = deviceID
+				}
+			}
+			if scope.IPRange != "" {
+				ipRange, err := parseIPRange(scope.IPRange)
+				if err != nil {
+					http.Error(w, "Invalid ip: must be an address or CIDR range", http.StatusBadRequest)
+					return
+				}
+				scope.IPRange = ipRange
+			}
+			if len(scope.DeviceID) > 128 {
+				http.Error(w, "Invalid device_id", http.StatusBadRequest)
+				return
+			}
+
 			// Ban the user
-			err := database.BanUser(db, ownerID, request.BanishedID, reason, duration)
+			banID, err := database.BanUser(db, ownerID, request.BanishedID, reason, duration, scope)
 			if err != nil {
 				log.Printf("Failed to ban user: %v", err)
 				http.Error(w, "Internal Server Error", http.StatusInternalServerError)
 				return
 			}
 
+			recordAudit(db, r, models.AuditUserBan, request.BanishedID, map[string]interface{}{
+				"ban_id":    banID,
+				"reason":    reason,
+				"duration":  duration,
+				"ip_range":  scope.IPRange,
+				"device_id": scope.DeviceID,
+			})
+
 			log.Printf("User %s banned by %s. Reason: %v, Duration: %s",
 				request.BanishedID, ownerID, reason,
 				func() string {
@@ -123,6 +183,7 @@ func HandleBanUser(db *pgxpool.Pool) http.HandlerFunc {
 			}
 
 			log.Printf("Ban ID %d pardoned", banID)
+			recordAudit(db, r, models.AuditUserPardon, banIDStr, nil)
 
 			w.Header().Set("Content-Type", "application/json")
 			json.NewEncoder(w).Encode(map[string]string{
@@ -144,31 +205,13 @@ func HandleBanRecords(db *pgxpool.Pool) http.HandlerFunc {
 			return
 		}
 
-		limitStr := r.URL.Query().Get("limit")
-		offsetStr := r.URL.Query().Get("offset")
-
-		limit := 50 // Default
-		offset := 0 // Default
-
-		if limitStr != "" {
-			parsedLimit, err := strconv.Atoi(limitStr)
-			if err != nil || parsedLimit <= 0 {
-				http.Error(w, "Invalid 'limit' query parameter", http.StatusBadRequest)
-				return
-			}
-			limit = parsedLimit
-		}
-
-		if offsetStr != "" {
-			parsedOffset, err := strconv.Atoi(offsetStr)
-			if err != nil || parsedOffset < 0 {
-				http.Error(w, "Invalid 'offset' query parameter", http.StatusBadRequest)
-				return
-			}
-			offset = parsedOffset
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
 		}
 
-		banRecords, hasMore, err := database.FetchBanRecords(db, limit, offset)
+		banRecords, info, err := database.FetchBanRecords(db, page)
 		if err != nil {
 			log.Printf("Failed to fetch ban records: %v", err)
 			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
@@ -176,10 +219,93 @@ func HandleBanRecords(db *pgxpool.Pool) http.HandlerFunc {
 		}
 
 		// Create message payload
-		response := api.NewBanRecordsResultMessage(banRecords, hasMore)
+		response := api.NewBanRecordsResultMessage(banRecords, info.HasMore, info.NextCursor, info.PrevCursor)
 
 		// Send response
 		w.Header().Set("Content-Type", "application/json")
 		json.NewEncoder(w).Encode(response)
 	}
 }
+
+// parseIPRange normalizes an address or CIDR range to a CIDR with its host bits cleared.
+func parseIPRange(value string) (string, error) {
+	if strings.Contains(value, "/") {
+		prefix, err := netip.ParsePrefix(value)
+		if err != nil {
+			return "", err
+		}
+		return prefix.Masked().String(), nil
+	}
+	addr, err := netip.ParseAddr(value)
+	if err != nil {
+		return "", err
+	}
+	addr = addr.Unmap()
+	return netip.PrefixFrom(addr, addr.BitLen()).String(), nil
+}
+
+// HandleBanEvasions lists accounts suspected of evading a ban, newest first. Dismissed
+// suspicions are left out unless 'all' is true. Moderators only.
+func HandleBanEvasions(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodGet {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		if _, ok := moderatorIdentity(w, r); !ok {
+			return
+		}
+
+		all, _ := strconv.ParseBool(r.URL.Query().Get("all"))
+		page, err := parsePageRequest(r, 50)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+
+		evasions, info, err := database.FetchBanEvasions(db, all, page)
+		if err != nil {
+			log.Printf("Failed to fetch ban evasions: %v", err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(api.NewBanEvasionsResultMessage(evasions, info.HasMore, info.NextCursor, info.PrevCursor))
+	}
+}
+
+// HandleBanEvasion dismisses the suspected ban evasion whose ID is given in the path on
+// DELETE. Moderators only.
+func HandleBanEvasion(db *pgxpool.Pool) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodDelete {
+			http.Error(w, "Method Not Allowed", http.StatusMethodNotAllowed)
+			return
+		}
+		identity, ok := moderatorIdentity(w, r)
+		if !ok {
+			return
+		}
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid evasion ID", http.StatusBadRequest)
+			return
+		}
+
+		dismissed, err := database.DismissBanEvasion(db, id)
+		if err != nil {
+			log.Printf("Failed to dismiss ban evasion %d: %v", id, err)
+			http.Error(w, "Internal Server Error", http.StatusInternalServerError)
+			return
+		}
+		if !dismissed {
+			http.Error(w, "Evasion not found", http.StatusNotFound)
+			return
+		}
+		log.Printf("%s dismissed ban evasion %d", identity.Username, id)
+		recordAudit(db, r, models.AuditBanEvasionDismiss, strconv.Itoa(id), nil)
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
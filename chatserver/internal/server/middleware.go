@@ -1,6 +1,12 @@
 package server
 
-import "net/http"
+import (
+	"log"
+	"net/http"
+	"strings"
+
+	"onrabble.com/chatserver/internal/auth"
+)
 
 // enableCORS is a middleware that sets headers to allow CORS requests.
 func enableCORS(next http.Handler) http.Handler {
@@ -17,3 +23,37 @@ func enableCORS(next http.Handler) http.Handler {
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requireAuth is a middleware that validates the bearer token in the Authorization header
+// and makes the caller's identity available to the handler through its request context.
+func (s *Server) requireAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if !ok || token == "" {
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		identity, err := s.parseAndValidateJWT(token)
+		if err != nil {
+			log.Printf("Token validation failed: %v", err)
+			http.Error(w, "Unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		next(w, r.WithContext(auth.NewContext(r.Context(), identity)))
+	}
+}
+
+// optionalAuth is like requireAuth for routes the admin dashboard calls without a token:
+// requests without an Authorization header pass through anonymously, while a bearer token,
+// when sent, must be valid and makes the caller's identity available to the handler.
+func (s *Server) optionalAuth(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") == "" {
+			next(w, r)
+			return
+		}
+		s.requireAuth(next)(w, r)
+	}
+}
@@ -14,12 +14,48 @@ import (
 func RegisterRoutes(srv *Server, mux *http.ServeMux, db *pgxpool.Pool, cache *cache.MessageCache, identity db.ServerIdentity) {
 	mux.HandleFunc("/ws", srv.handleConnection)
 	mux.HandleFunc("/discovery", handlers.HandleDiscovery(identity))
-	mux.HandleFunc("/channels", handlers.HandleChannels(db))
-	mux.HandleFunc("/messages", handlers.HandleMessages(db, cache))
+	mux.HandleFunc("/channels", srv.optionalAuth(handlers.HandleChannels(db, cache)))
+	mux.HandleFunc("/channels/import", srv.requireAuth(handlers.HandleChannelImport(db, cache)))
+	mux.HandleFunc("/channels/{id}/archive", srv.requireAuth(handlers.HandleChannelArchive(db, cache)))
+	mux.HandleFunc("/categories", srv.optionalAuth(handlers.HandleChannelCategories(db)))
+	mux.HandleFunc("/categories/{id}", srv.optionalAuth(handlers.HandleChannelCategory(db)))
+	mux.HandleFunc("/channels/{id}/pins", srv.requireAuth(handlers.HandleChannelPins(db, cache, srv.hub)))
+	mux.HandleFunc("/messages", srv.optionalAuth(handlers.HandleMessages(db, cache)))
+	mux.HandleFunc("/messages/{id}/thread", srv.requireAuth(handlers.HandleThread(db, cache)))
+	mux.HandleFunc("/messages/private", srv.requireAuth(handlers.HandlePrivateMessages(db)))
+	mux.HandleFunc("/conversations", srv.requireAuth(handlers.HandleConversations(cache)))
+	mux.HandleFunc("/conversations/history", srv.requireAuth(handlers.HandleConversationHistory(cache)))
+	mux.HandleFunc("/mentions", srv.requireAuth(handlers.HandleMentions(db, cache)))
+	mux.HandleFunc("/attachments", srv.requireAuth(handlers.HandleUploadAttachment(db, srv.attachments.Store, srv.attachments.MaxSize)))
+	mux.HandleFunc("/attachments/{id}", srv.requireAuth(handlers.HandleAttachment(db, srv.attachments.Signer)))
+	mux.HandleFunc("/attachments/{id}/content", handlers.HandleAttachmentContent(db, srv.attachments.Store, srv.attachments.Signer))
+	mux.HandleFunc("/automod/rules", srv.requireAuth(handlers.HandleAutomodRules(db, srv.hub)))
+	mux.HandleFunc("/automod/rules/{id}", srv.requireAuth(handlers.HandleAutomodRule(db, srv.hub)))
+	mux.HandleFunc("/automod/flags", srv.requireAuth(handlers.HandleAutomodFlags(db)))
+	mux.HandleFunc("/automod/flags/{id}", srv.requireAuth(handlers.HandleAutomodFlag(db, cache)))
+	mux.HandleFunc("/automod/mutes", srv.requireAuth(handlers.HandleAutomodMutes(db)))
+	mux.HandleFunc("/automod/mutes/{userID}", srv.requireAuth(handlers.HandleAutomodMute(db, srv.hub)))
+	mux.HandleFunc("/reports", srv.requireAuth(handlers.HandleReports(db, srv.hub)))
+	mux.HandleFunc("/reports/{id}", srv.requireAuth(handlers.HandleReport(db)))
+	mux.HandleFunc("/reports/{id}/{action}", srv.requireAuth(handlers.HandleReportAction(db, cache)))
 	mux.HandleFunc("/users", handlers.HandleUsers(db))
-	mux.HandleFunc("/users/ban", handlers.HandleBanUser(db))
+	mux.HandleFunc("/users/ban", srv.optionalAuth(handlers.HandleBanUser(db)))
 	mux.HandleFunc("/users/bans", handlers.HandleBanRecords(db))
+	mux.HandleFunc("/users/bans/evasions", srv.requireAuth(handlers.HandleBanEvasions(db)))
+	mux.HandleFunc("/users/bans/evasions/{id}", srv.requireAuth(handlers.HandleBanEvasion(db)))
+	mux.HandleFunc("/users/{id}/export", srv.requireAuth(handlers.HandleUserExport(db, cache)))
+	mux.HandleFunc("/users/{id}/erase", srv.requireAuth(handlers.HandleUserErasure(db, srv.eraser)))
+	mux.HandleFunc("/data-requests", srv.requireAuth(handlers.HandleDataRequests(db)))
+	mux.HandleFunc("/data-requests/{id}", srv.requireAuth(handlers.HandleDataRequest(db)))
+	mux.HandleFunc("/appeals", srv.requireAuth(handlers.HandleAppeals(db)))
+	mux.HandleFunc("/appeals/{id}", srv.requireAuth(handlers.HandleAppeal(db)))
+	mux.HandleFunc("/retention/policies", srv.requireAuth(handlers.HandleRetentionPolicies(db)))
+	mux.HandleFunc("/retention/policies/{scope}", srv.requireAuth(handlers.HandleRetentionPolicy(db)))
+	mux.HandleFunc("/retention/policies/channel/{channel}", srv.requireAuth(handlers.HandleRetentionPolicy(db)))
+	mux.HandleFunc("/retention/holds", srv.requireAuth(handlers.HandleLegalHolds(db)))
+	mux.HandleFunc("/retention/holds/{id}", srv.requireAuth(handlers.HandleLegalHold(db)))
 	mux.HandleFunc("/activity/sessions", handlers.HandleRecentActivity(db))
 	mux.HandleFunc("/activity/channels", handlers.HandleChannelActivity(db))
-	mux.HandleFunc("/ratelimits", handlers.HandleRateLimiter(db, cache))
+	mux.HandleFunc("/ratelimits", srv.optionalAuth(handlers.HandleRateLimiter(db, cache)))
+	mux.HandleFunc("/audit", srv.requireAuth(handlers.HandleAuditLog(db)))
 }
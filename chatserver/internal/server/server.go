@@ -3,11 +3,14 @@ package server
 import (
 	"log"
 	"net/http"
+	"net/netip"
 
 	database "onrabble.com/chatserver/internal/db"
 
 	"onrabble.com/chatserver/internal/cache"
 	"onrabble.com/chatserver/internal/interfaces"
+	"onrabble.com/chatserver/internal/storage"
+	"onrabble.com/chatserver/internal/userdata"
 
 	"github.com/MicahParks/keyfunc/v3"
 	"github.com/golang-jwt/jwt/v5"
@@ -16,16 +19,26 @@ import (
 
 // Server handles WebSocket connections, authentication, and client coordination.
 type Server struct {
-	HttpServer   *http.Server            // The underlying HTTP server.
-	jwkKeyFunc   jwt.Keyfunc             // Key function for JWT validation.
-	hub          interfaces.HubInterface // Central hub for managing client communication.
-	db           *pgxpool.Pool           // PostgreSQL database pool.
-	MessageCache *cache.MessageCache     // Shared message cache for recent chat messages.
+	HttpServer     *http.Server            // The underlying HTTP server.
+	jwkKeyFunc     jwt.Keyfunc             // Key function for JWT validation.
+	hub            interfaces.HubInterface // Central hub for managing client communication.
+	db             *pgxpool.Pool           // PostgreSQL database pool.
+	MessageCache   *cache.MessageCache     // Shared message cache for recent chat messages.
+	attachments    AttachmentConfig        // Where uploads are stored and how downloads are signed.
+	trustedProxies []netip.Prefix          // Proxies whose X-Forwarded-For entries are believed.
+	eraser         *userdata.Eraser        // Runs user data erasures in the background.
+}
+
+// AttachmentConfig configures file uploads and downloads.
+type AttachmentConfig struct {
+	Store   storage.Store
+	Signer  *storage.URLSigner
+	MaxSize int64 // Largest accepted upload in bytes; 0 uses the default
 }
 
 // New initializes and returns a new Server instance.
 // It configures JWT authentication, rate limiting, and registers all HTTP routes.
-func New(addr string, h interfaces.HubInterface, db *pgxpool.Pool, cache *cache.MessageCache) (*Server, error) {
+func New(addr string, h interfaces.HubInterface, db *pgxpool.Pool, cache *cache.MessageCache, attachments AttachmentConfig) (*Server, error) {
 	mux := http.NewServeMux()
 	handler := enableCORS(mux)
 
@@ -38,10 +51,14 @@ func New(addr string, h interfaces.HubInterface, db *pgxpool.Pool, cache *cache.
 
 	// Create server instance
 	srv := &Server{
-		HttpServer: &http.Server{Addr: addr, Handler: handler},
-		jwkKeyFunc: k.Keyfunc,
-		hub:        h,
-		db:         db,
+		HttpServer:     &http.Server{Addr: addr, Handler: handler},
+		jwkKeyFunc:     k.Keyfunc,
+		hub:            h,
+		db:             db,
+		MessageCache:   cache,
+		attachments:    attachments,
+		trustedProxies: trustedProxiesFromEnv(),
+		eraser:         userdata.NewEraser(db, cache),
 	}
 
 	// Load rate limiting settings from DB
@@ -54,6 +71,9 @@ func New(addr string, h interfaces.HubInterface, db *pgxpool.Pool, cache *cache.
 	// Register this server instance and HTTP routes
 	serverIdentity := database.RegisterOrLoadServer(db)
 	RegisterRoutes(srv, mux, db, cache, serverIdentity)
+	go srv.sweepAttachments()
+	go srv.sweepEndedBans()
+	srv.eraser.Resume()
 
 	return srv, nil
 }
@@ -0,0 +1,45 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"strconv"
+	"time"
+)
+
+// URLSigner creates and checks expiring download signatures, so files can be fetched by
+// URL (for example from an <img> tag) without sending a bearer token.
+type URLSigner struct {
+	key []byte
+}
+
+// NewURLSigner creates a signer using secret. With an empty secret a random key is used,
+// which means signed URLs stop working on restart and are not shared between servers.
+func NewURLSigner(secret string) *URLSigner {
+	if secret != "" {
+		return &URLSigner{key: []byte(secret)}
+	}
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		// crypto/rand does not fail on supported platforms
+		panic(err)
+	}
+	return &URLSigner{key: key}
+}
+
+// Sign returns the signature granting access to one variant of a file until expires.
+func (s *URLSigner) Sign(id, variant string, expires time.Time) string {
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write([]byte(id + "\n" + variant + "\n" + strconv.FormatInt(expires.Unix(), 10)))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature grants access to the variant and has not expired.
+func (s *URLSigner) Verify(id, variant string, expires time.Time, signature string) bool {
+	if time.Now().After(expires) {
+		return false
+	}
+	return hmac.Equal([]byte(s.Sign(id, variant, expires)), []byte(signature))
+}
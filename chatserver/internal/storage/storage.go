@@ -0,0 +1,43 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// ErrNotFound is returned when a requested object does not exist.
+var ErrNotFound = errors.New("object not found")
+
+// Store saves and retrieves blobs by key. Keys are slash-separated paths such as
+// "attachments/<id>".
+type Store interface {
+	Put(ctx context.Context, key string, data []byte, contentType string) error
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// NewFromEnv creates the store selected by STORAGE_BACKEND: "local" (the default) keeps files
+// under STORAGE_PATH, "s3" uses the bucket described by the S3_* variables.
+func NewFromEnv() (Store, error) {
+	switch backend := os.Getenv("STORAGE_BACKEND"); backend {
+	case "", "local":
+		root := os.Getenv("STORAGE_PATH")
+		if root == "" {
+			root = "data/attachments"
+		}
+		return NewLocalStore(root)
+	case "s3":
+		return NewS3Store(S3Config{
+			Endpoint:  os.Getenv("S3_ENDPOINT"),
+			Region:    os.Getenv("S3_REGION"),
+			Bucket:    os.Getenv("S3_BUCKET"),
+			AccessKey: os.Getenv("S3_ACCESS_KEY"),
+			SecretKey: os.Getenv("S3_SECRET_KEY"),
+		})
+	default:
+		return nil, fmt.Errorf("unknown storage backend %q", backend)
+	}
+}
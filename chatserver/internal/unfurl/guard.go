@@ -0,0 +1,105 @@
+package unfurl
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"syscall"
+)
+
+// ErrBlocked is returned for links the unfurler refuses to fetch.
+var ErrBlocked = errors.New("link blocked")
+
+// blockedPrefixes are address ranges that are never fetched, on top of the private,
+// loopback, link-local and multicast ranges recognised by net/netip.
+var blockedPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),     // "This" network
+	netip.MustParsePrefix("100.64.0.0/10"), // Carrier-grade NAT
+	netip.MustParsePrefix("192.0.0.0/24"),  // IETF protocol assignments
+	netip.MustParsePrefix("198.18.0.0/15"), // Benchmarking
+	netip.MustParsePrefix("240.0.0.0/4"),   // Reserved
+	netip.MustParsePrefix("64:ff9b::/96"),  // NAT64, which can reach IPv4 internals
+}
+
+// publicAddress reports whether addr is routable on the public internet.
+func publicAddress(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	if !addr.IsValid() || addr.IsUnspecified() || addr.IsLoopback() || addr.IsPrivate() ||
+		addr.IsLinkLocalUnicast() || addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() {
+		return false
+	}
+	for _, prefix := range blockedPrefixes {
+		if prefix.Contains(addr) {
+			return false
+		}
+	}
+	return true
+}
+
+// checkDial runs as the dialer's Control hook, after DNS resolution and right before each
+// connection, so hostnames that resolve (or re-resolve) to internal addresses are refused.
+func (u *Unfurler) checkDial(network, address string, _ syscall.RawConn) error {
+	if u.config.AllowPrivate {
+		return nil
+	}
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: unparseable address %s", ErrBlocked, address)
+	}
+	if !publicAddress(addrPort.Addr()) {
+		return fmt.Errorf("%w: %s is not a public address", ErrBlocked, addrPort.Addr())
+	}
+	if port := addrPort.Port(); port != 80 && port != 443 {
+		return fmt.Errorf("%w: port %d is not allowed", ErrBlocked, port)
+	}
+	return nil
+}
+
+// domainAllowed applies the allow and deny lists to a hostname. Entries match the domain
+// itself and its subdomains; the deny list wins, and an empty allow list allows everything.
+func (u *Unfurler) domainAllowed(host string) bool {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "" {
+		return false
+	}
+	if !u.config.AllowPrivate {
+		// Literal addresses skip DNS, so refuse internal ones before dialing
+		if addr, err := netip.ParseAddr(host); err == nil && !publicAddress(addr) {
+			return false
+		}
+		if host == "localhost" || strings.HasSuffix(host, ".localhost") || strings.HasSuffix(host, ".internal") {
+			return false
+		}
+	}
+	for _, domain := range u.config.DenyDomains {
+		if matchDomain(host, domain) {
+			return false
+		}
+	}
+	if len(u.config.AllowDomains) == 0 {
+		return true
+	}
+	for _, domain := range u.config.AllowDomains {
+		if matchDomain(host, domain) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchDomain reports whether host is domain or one of its subdomains.
+func matchDomain(host, domain string) bool {
+	domain = strings.TrimPrefix(strings.TrimSuffix(strings.ToLower(domain), "."), ".")
+	return domain != "" && (host == domain || strings.HasSuffix(host, "."+domain))
+}
+
+// newDialer returns a dialer that enforces checkDial.
+func (u *Unfurler) newDialer() *net.Dialer {
+	return &net.Dialer{
+		Timeout: u.config.Timeout,
+		Control: u.checkDial,
+	}
+}
@@ -0,0 +1,120 @@
+package unfurl
+
+import (
+	"errors"
+	"net/netip"
+	"testing"
+)
+
+func TestPublicAddress(t *testing.T) {
+	tests := []struct {
+		addr string
+		want bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"127.0.0.1", false},
+		{"127.255.0.1", false},
+		{"::1", false},
+		{"10.0.0.1", false},
+		{"172.16.5.4", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"100.64.0.1", false},
+		{"100.127.255.254", false},
+		{"100.128.0.1", true},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:10.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+		{"::ffff:93.184.216.34", true},
+		{"64:ff9b::7f00:1", false},
+		{"224.0.0.1", false},
+		{"ff02::1", false},
+		{"198.18.0.1", false},
+		{"240.0.0.1", false},
+		{"255.255.255.255", false},
+	}
+	for _, test := range tests {
+		if got := publicAddress(netip.MustParseAddr(test.addr)); got != test.want {
+			t.Errorf("publicAddress(%s) = %v, want %v", test.addr, got, test.want)
+		}
+	}
+}
+
+func TestCheckDial(t *testing.T) {
+	tests := []struct {
+		address      string
+		allowPrivate bool
+		blocked      bool
+	}{
+		{"93.184.216.34:443", false, false},
+		{"93.184.216.34:80", false, false},
+		{"[2606:2800:220:1:248:1893:25c8:1946]:443", false, false},
+		{"93.184.216.34:22", false, true},
+		{"127.0.0.1:443", false, true},
+		{"[::ffff:127.0.0.1]:443", false, true},
+		{"169.254.169.254:80", false, true},
+		{"100.64.0.1:443", false, true},
+		{"not an address", false, true},
+		{"127.0.0.1:8080", true, false},
+	}
+	for _, test := range tests {
+		u := New(Config{AllowPrivate: test.allowPrivate})
+		err := u.checkDial("tcp", test.address, nil)
+		if blocked := errors.Is(err, ErrBlocked); blocked != test.blocked {
+			t.Errorf("checkDial(%q, allowPrivate=%v) = %v, want blocked %v", test.address, test.allowPrivate, err, test.blocked)
+		}
+	}
+}
+
+func TestMatchDomain(t *testing.T) {
+	tests := []struct {
+		host, domain string
+		want         bool
+	}{
+		{"example.com", "example.com", true},
+		{"www.example.com", "example.com", true},
+		{"www.example.com", ".example.com", true},
+		{"example.com", "Example.COM.", true},
+		{"badexample.com", "example.com", false},
+		{"example.com.evil.net", "example.com", false},
+		{"example.com", "www.example.com", false},
+		{"example.com", "", false},
+		{"example.com", ".", false},
+	}
+	for _, test := range tests {
+		if got := matchDomain(test.host, test.domain); got != test.want {
+			t.Errorf("matchDomain(%q, %q) = %v, want %v", test.host, test.domain, got, test.want)
+		}
+	}
+}
+
+func TestDomainAllowed(t *testing.T) {
+	tests := []struct {
+		host   string
+		config Config
+		want   bool
+	}{
+		{"example.com", Config{}, true},
+		{"localhost", Config{}, false},
+		{"api.localhost", Config{}, false},
+		{"metadata.google.internal", Config{}, false},
+		{"127.0.0.1", Config{}, false},
+		{"::1", Config{}, false},
+		{"::ffff:10.0.0.1", Config{}, false},
+		{"localhost", Config{AllowPrivate: true}, true},
+		{"cdn.example.com", Config{AllowDomains: []string{"example.com"}}, true},
+		{"example.org", Config{AllowDomains: []string{"example.com"}}, false},
+		{"ads.example.com", Config{AllowDomains: []string{"example.com"}, DenyDomains: []string{"ads.example.com"}}, false},
+		{"", Config{}, false},
+	}
+	for _, test := range tests {
+		if got := New(test.config).domainAllowed(test.host); got != test.want {
+			t.Errorf("domainAllowed(%q, %+v) = %v, want %v", test.host, test.config, got, test.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+package unfurl
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+var (
+	tagPattern       = regexp.MustCompile(`(?is)<(meta|link)\b([^>]*)>`)
+	titlePattern     = regexp.MustCompile(`(?is)<title\b[^>]*>(.*?)</title>`)
+	attributePattern = regexp.MustCompile(`(?s)([a-zA-Z_:][-a-zA-Z0-9_:.]*)\s*=\s*(?:"([^"]*)"|'([^']*)'|([^\s"'=<>` + "`" + `]+))`)
+	spacePattern     = regexp.MustCompile(`\s+`)
+)
+
+// headMetadata is what a page's <head> says about it.
+type headMetadata struct {
+	title       string
+	description string
+	image       string
+	siteName    string
+	oembed      string // URL of the page's JSON oEmbed endpoint, if it advertises one
+}
+
+// parseHead extracts preview metadata from the <meta>, <link> and <title> tags of an
+// HTML page. OpenGraph and Twitter card tags are preferred over the plain title and
+// description. Only absolute http and https URLs are kept.
+func parseHead(page string, base *url.URL) headMetadata {
+	if end := strings.Index(strings.ToLower(page), "</head>"); end >= 0 {
+		page = page[:end]
+	}
+
+	var meta headMetadata
+	var plainTitle, plainDescription string
+	var twitterTitle, twitterDescription, twitterImage string
+
+	for _, tag := range tagPattern.FindAllStringSubmatch(page, -1) {
+		attrs := parseAttributes(tag[2])
+
+		if strings.EqualFold(tag[1], "link") {
+			if strings.EqualFold(attrs["type"], "application/json+oembed") && hasToken(attrs["rel"], "alternate") {
+				meta.oembed = safeURL(base, attrs["href"])
+			}
+			continue
+		}
+
+		key := strings.ToLower(firstNonEmpty(attrs["property"], attrs["name"]))
+		content := clean(attrs["content"])
+		if content == "" {
+			continue
+		}
+		switch key {
+		case "og:title":
+			meta.title = content
+		case "og:description":
+			meta.description = content
+		case "og:image", "og:image:url", "og:image:secure_url":
+			if meta.image == "" {
+				meta.image = safeURL(base, content)
+			}
+		case "og:site_name":
+			meta.siteName = content
+		case "twitter:title":
+			twitterTitle = content
+		case "twitter:description":
+			twitterDescription = content
+		case "twitter:image", "twitter:image:src":
+			twitterImage = safeURL(base, content)
+		case "description":
+			plainDescription = content
+		}
+	}
+
+	if match := titlePattern.FindStringSubmatch(page); match != nil {
+		plainTitle = clean(match[1])
+	}
+
+	meta.title = firstNonEmpty(meta.title, twitterTitle, plainTitle)
+	meta.description = firstNonEmpty(meta.description, twitterDescription, plainDescription)
+	meta.image = firstNonEmpty(meta.image, twitterImage)
+	return meta
+}
+
+// parseAttributes reads the attributes of a tag, lower-casing their names.
+func parseAttributes(tag string) map[string]string {
+	attrs := make(map[string]string)
+	for _, match := range attributePattern.FindAllStringSubmatch(tag, -1) {
+		name := strings.ToLower(match[1])
+		if _, seen := attrs[name]; !seen {
+			attrs[name] = match[2] + match[3] + match[4]
+		}
+	}
+	return attrs
+}
+
+// hasToken reports whether a space-separated attribute value such as rel contains token.
+func hasToken(value, token string) bool {
+	for _, field := range strings.Fields(value) {
+		if strings.EqualFold(field, token) {
+			return true
+		}
+	}
+	return false
+}
+
+// clean decodes HTML entities and collapses whitespace.
+func clean(s string) string {
+	return strings.TrimSpace(spacePattern.ReplaceAllString(html.UnescapeString(s), " "))
+}
+
+// safeURL resolves ref against base and returns it only if it is an http or https URL.
+func safeURL(base *url.URL, ref string) string {
+	ref = strings.TrimSpace(html.UnescapeString(ref))
+	if ref == "" || len(ref) > maxURLLength {
+		return ""
+	}
+	parsed, err := base.Parse(ref)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return ""
+	}
+	return parsed.String()
+}
@@ -0,0 +1,244 @@
+package unfurl
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/models"
+)
+
+const (
+	defaultTimeout = 5 * time.Second
+
+	maxRedirects   = 3
+	maxPageBytes   = 1 << 20   // Only the start of a page is read; metadata lives in <head>
+	maxOEmbedBytes = 256 << 10 // oEmbed responses are small JSON documents
+	maxURLLength   = 2048
+	userAgent      = "RabbleLinkPreview/1.0 (+https://onrabble.com)"
+)
+
+// Config controls which links are fetched.
+type Config struct {
+	AllowDomains []string      // When set, only these domains and their subdomains are fetched
+	DenyDomains  []string      // Never fetched, even if allowed
+	Timeout      time.Duration // Budget for fetching one link, including oEmbed; defaults to 5s
+	AllowPrivate bool          // Permits internal addresses and any port, for local testing only
+}
+
+// ConfigFromEnv reads UNFURL_ALLOW_DOMAINS and UNFURL_DENY_DOMAINS (comma-separated),
+// UNFURL_TIMEOUT_SECONDS and UNFURL_ALLOW_PRIVATE.
+func ConfigFromEnv() Config {
+	config := Config{
+		AllowDomains: splitList(os.Getenv("UNFURL_ALLOW_DOMAINS")),
+		DenyDomains:  splitList(os.Getenv("UNFURL_DENY_DOMAINS")),
+	}
+	if seconds, err := strconv.Atoi(os.Getenv("UNFURL_TIMEOUT_SECONDS")); err == nil && seconds > 0 {
+		config.Timeout = time.Duration(seconds) * time.Second
+	}
+	config.AllowPrivate, _ = strconv.ParseBool(os.Getenv("UNFURL_ALLOW_PRIVATE"))
+	return config
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Unfurler fetches link previews while guarding against requests to internal services.
+type Unfurler struct {
+	config Config
+	client *http.Client
+}
+
+// New creates an Unfurler with the given configuration.
+func New(config Config) *Unfurler {
+	if config.Timeout <= 0 {
+		config.Timeout = defaultTimeout
+	}
+
+	u := &Unfurler{config: config}
+	transport := &http.Transport{
+		Proxy:                 nil, // A proxy would dial on our behalf and bypass the address checks
+		DialContext:           u.newDialer().DialContext,
+		TLSHandshakeTimeout:   config.Timeout,
+		ResponseHeaderTimeout: config.Timeout,
+		MaxIdleConns:          16,
+		IdleConnTimeout:       30 * time.Second,
+	}
+	u.client = &http.Client{
+		Transport: transport,
+		Timeout:   config.Timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			return u.checkURL(req.URL)
+		},
+	}
+	return u
+}
+
+// checkURL applies the scheme and domain rules to a link or redirect target.
+func (u *Unfurler) checkURL(link *url.URL) error {
+	if link.Scheme != "http" && link.Scheme != "https" {
+		return fmt.Errorf("%w: unsupported scheme %q", ErrBlocked, link.Scheme)
+	}
+	if link.User != nil {
+		return fmt.Errorf("%w: credentials in URL", ErrBlocked)
+	}
+	if !u.domainAllowed(link.Hostname()) {
+		return fmt.Errorf("%w: domain %s is not allowed", ErrBlocked, link.Hostname())
+	}
+	return nil
+}
+
+// Fetch builds a preview of the page at link from its OpenGraph tags, falling back to
+// its oEmbed endpoint and plain HTML title and description. Direct links to images are
+// previewed as the image itself. An empty embed means the page had nothing to show.
+func (u *Unfurler) Fetch(ctx context.Context, link string) (models.Embed, error) {
+	embed := models.Embed{URL: link}
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return embed, fmt.Errorf("invalid link: %w", err)
+	}
+	if err := u.checkURL(parsed); err != nil {
+		return embed, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, u.config.Timeout)
+	defer cancel()
+
+	resp, err := u.get(ctx, parsed.String(), "text/html,application/xhtml+xml;q=0.9,image/*;q=0.8")
+	if err != nil {
+		return embed, err
+	}
+	defer resp.Body.Close()
+
+	mediaType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if strings.HasPrefix(mediaType, "image/") {
+		embed.ThumbnailURL = resp.Request.URL.String()
+		return embed, nil
+	}
+	if mediaType != "text/html" && mediaType != "application/xhtml+xml" {
+		return embed, nil
+	}
+
+	page, err := io.ReadAll(io.LimitReader(resp.Body, maxPageBytes))
+	if err != nil {
+		return embed, fmt.Errorf("failed to read %s: %w", link, err)
+	}
+
+	// Relative URLs in the page are resolved against where redirects ended up
+	meta := parseHead(string(page), resp.Request.URL)
+	embed.Title = meta.title
+	embed.Description = meta.description
+	embed.ThumbnailURL = meta.image
+	embed.SiteName = meta.siteName
+
+	if meta.oembed != "" && (embed.Title == "" || embed.ThumbnailURL == "") {
+		if oembed, err := u.fetchOEmbed(ctx, meta.oembed); err == nil {
+			embed.Title = firstNonEmpty(embed.Title, oembed.Title)
+			embed.ThumbnailURL = firstNonEmpty(embed.ThumbnailURL, safeURL(resp.Request.URL, oembed.ThumbnailURL))
+			embed.SiteName = firstNonEmpty(embed.SiteName, oembed.ProviderName)
+			if embed.Description == "" && oembed.AuthorName != "" {
+				embed.Description = "by " + oembed.AuthorName
+			}
+		}
+	}
+
+	embed.Title = truncate(embed.Title, 256)
+	embed.Description = truncate(embed.Description, 512)
+	embed.SiteName = truncate(embed.SiteName, 128)
+	return embed, nil
+}
+
+// get sends a GET request and fails on non-2xx responses.
+func (u *Unfurler) get(ctx context.Context, link, accept string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, link, nil)
+	if err != nil {
+		return nil, fmt.Errorf("invalid link: %w", err)
+	}
+	req.Header.Set("User-Agent", userAgent)
+	req.Header.Set("Accept", accept)
+
+	resp, err := u.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", link, err)
+	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, fmt.Errorf("failed to fetch %s: %s", link, resp.Status)
+	}
+	return resp, nil
+}
+
+// oEmbedResponse holds the oEmbed fields used for previews.
+type oEmbedResponse struct {
+	Title        string `json:"title"`
+	AuthorName   string `json:"author_name"`
+	ProviderName string `json:"provider_name"`
+	ThumbnailURL string `json:"thumbnail_url"`
+}
+
+// fetchOEmbed reads a JSON oEmbed document, applying the same rules as page fetches.
+func (u *Unfurler) fetchOEmbed(ctx context.Context, link string) (oEmbedResponse, error) {
+	var oembed oEmbedResponse
+
+	parsed, err := url.Parse(link)
+	if err != nil {
+		return oembed, err
+	}
+	if err := u.checkURL(parsed); err != nil {
+		return oembed, err
+	}
+
+	resp, err := u.get(ctx, link, "application/json")
+	if err != nil {
+		return oembed, err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(io.LimitReader(resp.Body, maxOEmbedBytes)).Decode(&oembed); err != nil {
+		return oembed, fmt.Errorf("invalid oEmbed response from %s: %w", link, err)
+	}
+	return oembed, nil
+}
+
+// IsBlocked reports whether err means the link was refused rather than failing to load.
+func IsBlocked(err error) bool {
+	return errors.Is(err, ErrBlocked)
+}
+
+func firstNonEmpty(values ...string) string {
+	for _, value := range values {
+		if value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+// truncate shortens s to at most limit runes, marking the cut with an ellipsis.
+func truncate(s string, limit int) string {
+	runes := []rune(s)
+	if len(runes) <= limit {
+		return s
+	}
+	return strings.TrimSpace(string(runes[:limit-1])) + "…"
+}
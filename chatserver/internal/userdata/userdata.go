@@ -0,0 +1,178 @@
+package userdata
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"io"
+	"log"
+	"strings"
+	"time"
+
+	"onrabble.com/chatserver/internal/cache"
+	"onrabble.com/chatserver/internal/db"
+	"onrabble.com/chatserver/internal/models"
+
+	"github.com/google/uuid"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// ErrLegalHold is returned when erasing a user under legal hold.
+var ErrLegalHold = errors.New("user is under legal hold")
+
+// Export collects the data stored about a user. The caches are flushed first so messages
+// sent moments ago are included.
+func Export(pool *pgxpool.Pool, messageCache *cache.MessageCache, userID string) (models.UserDataExport, error) {
+	messageCache.FlushCacheToDB()
+	messageCache.FlushPrivateMessagesToDB()
+
+	export, err := db.FetchUserData(pool, userID)
+	if err != nil {
+		return export, err
+	}
+	export.ExportedAt = time.Now().UTC()
+
+	username, found, err := db.FindUsernameByID(pool, userID)
+	if err != nil {
+		return export, err
+	}
+	if found {
+		export.Username = username
+		for i := range export.ChatMessages {
+			export.ChatMessages[i].Username = username
+		}
+	}
+	return export, nil
+}
+
+// Counts returns the number of records in each part of an export.
+func Counts(export models.UserDataExport) map[string]int64 {
+	return map[string]int64{
+		"chat_messages":    int64(len(export.ChatMessages)),
+		"private_messages": int64(len(export.PrivateMessages)),
+		"sessions":         int64(len(export.Sessions)),
+		"bans":             int64(len(export.Bans)),
+		"reactions":        int64(len(export.Reactions)),
+	}
+}
+
+// WriteArchive writes an export as a ZIP archive holding user.json and one JSON file per
+// kind of record.
+func WriteArchive(w io.Writer, export models.UserDataExport) error {
+	archive := zip.NewWriter(w)
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"user.json", map[string]interface{}{
+			"user_id":     export.UserID,
+			"username":    export.Username,
+			"exported_at": export.ExportedAt,
+		}},
+		{"chat_messages.json", export.ChatMessages},
+		{"private_messages.json", export.PrivateMessages},
+		{"sessions.json", export.Sessions},
+		{"bans.json", export.Bans},
+		{"reactions.json", export.Reactions},
+	}
+	for _, file := range files {
+		f, err := archive.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: export.ExportedAt})
+		if err != nil {
+			return err
+		}
+		encoder := json.NewEncoder(f)
+		encoder.SetIndent("", "  ")
+		if err := encoder.Encode(file.data); err != nil {
+			return err
+		}
+	}
+	return archive.Close()
+}
+
+// NewPseudonym returns a random identifier to replace an erased user's ID and name.
+func NewPseudonym() string {
+	return "erased-" + strings.ReplaceAll(uuid.NewString(), "-", "")[:16]
+}
+
+// Eraser runs erasure jobs in the background.
+type Eraser struct {
+	db    *pgxpool.Pool
+	cache *cache.MessageCache
+}
+
+// NewEraser returns an eraser removing data from db and the cache.
+func NewEraser(db *pgxpool.Pool, cache *cache.MessageCache) *Eraser {
+	return &Eraser{db: db, cache: cache}
+}
+
+// Start runs the erasure with the given ID in the background.
+func (e *Eraser) Start(id int) {
+	go e.run(id)
+}
+
+// Resume restarts erasures that are pending or were left running by a server that stopped.
+func (e *Eraser) Resume() {
+	ids, err := db.FetchUnfinishedErasures(e.db)
+	if err != nil {
+		log.Printf("Failed to resume erasures: %v", err)
+		return
+	}
+	for _, id := range ids {
+		log.Printf("Resuming erasure %d", id)
+		e.Start(id)
+	}
+}
+
+// run claims an erasure, so it only runs once, and records its outcome.
+func (e *Eraser) run(id int) {
+	job, claimed, err := db.ClaimDataRequest(e.db, id)
+	if err != nil {
+		log.Printf("Failed to claim erasure %d: %v", id, err)
+		return
+	}
+	if !claimed {
+		return
+	}
+
+	counts, err := e.erase(job)
+	if err != nil {
+		log.Printf("Erasure %d of %s failed: %v", job.ID, job.UserID, err)
+	} else {
+		log.Printf("Erased %s as %s (erasure %d)", job.UserID, job.Pseudonym, job.ID)
+	}
+	if err := db.FinishDataRequest(e.db, job.ID, counts, err); err != nil {
+		log.Printf("Failed to record erasure %d: %v", job.ID, err)
+	}
+}
+
+// erase removes a user's data from the cache and then the database. Pseudonymizing flushes
+// the caches first so the messages it keeps are stored; anything still cached afterwards is
+// removed either way.
+func (e *Eraser) erase(job models.DataRequest) (map[string]int64, error) {
+	held, err := db.UserHeld(e.db, job.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if held {
+		return nil, ErrLegalHold
+	}
+
+	pseudonymize := job.Mode == models.ErasurePseudonymize
+	if pseudonymize {
+		e.cache.FlushCacheToDB()
+		e.cache.FlushPrivateMessagesToDB()
+	}
+
+	cached, err := e.cache.EraseUser(job.UserID)
+	if err != nil {
+		return nil, err
+	}
+
+	counts, err := db.EraseUserData(e.db, job.UserID, job.Pseudonym, pseudonymize)
+	if err != nil {
+		return map[string]int64{"cached_messages": cached}, err
+	}
+	counts["cached_messages"] = cached
+	return counts, nil
+}